@@ -0,0 +1,146 @@
+// Copyright 2015 Richard Lehane. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webarchive
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// AppendWriter is a WARCWriter that appends records to an existing WARC file, as returned by OpenAppend.
+type AppendWriter struct {
+	*WARCWriter
+	f         *os.File
+	truncated int64
+}
+
+// OpenAppend opens the WARC file at path, which may be gzipped, to append records to it, so that an interrupted crawl
+// can resume writing into the same file. The file is first scanned to the end of its last complete record (see
+// ScanOffsets), and a partial final record, such as one left by a crawler that stopped while writing it, is truncated.
+// Records are appended with the compression of the file: a gzipped file has a gzip member appended for each record.
+// If the file doesn't exist, it is created, and gzipped if path ends with ".gz".
+//
+// If the file begins with a warcinfo record, appended records refer to it with WARC-Warcinfo-ID. The Offset of the
+// writer is the offset of the next record within the file, and Count is the number of records appended.
+//
+// The file isn't modified if it can't be scanned for a reason other than a partial final record: for instance, if it
+// isn't a WARC file, if a record before its end is corrupt (returning an error wrapping ErrWARCHeader), or if it is
+// compressed other than with gzip (returning ErrCompression).
+func OpenAppend(path string) (*AppendWriter, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, err
+	}
+	a, err := openAppend(f, path)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return a, nil
+}
+
+func openAppend(f *os.File, path string) (*AppendWriter, error) {
+	st, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	c := NoCompression
+	if st.Size() == 0 && strings.HasSuffix(path, ".gz") {
+		c = GzipCompression
+	}
+	head := make([]byte, 4)
+	n, _ := f.ReadAt(head, 0)
+	switch {
+	case isgzip(head[:n]):
+		c = GzipCompression
+	case iszstd(head[:n]), isbzip2(head[:n]):
+		return nil, ErrCompression
+	}
+	end, err := completeEnd(f, st.Size(), c == GzipCompression)
+	if err != nil {
+		return nil, err
+	}
+	if end < st.Size() {
+		if err = f.Truncate(end); err != nil {
+			return nil, err
+		}
+	}
+	if _, err = f.Seek(end, io.SeekStart); err != nil {
+		return nil, err
+	}
+	ww, err := NewWARCWriter(f, c)
+	if err != nil {
+		return nil, err
+	}
+	ww.w.n = end
+	ww.info = firstWarcinfo(f, end)
+	return &AppendWriter{WARCWriter: ww, f: f, truncated: st.Size() - end}, nil
+}
+
+// completeEnd returns the offset of the end of the last complete record of a file of the given size. Scanning stops
+// at a partial final record: one that is cut short by the end of the file, or an uncompressed record at the end of the
+// file missing the CRLFs that end it. A record before the end of the file that doesn't end with CRLFs (for instance, one
+// with the wrong Content-Length) is an error, as truncating the file there would lose the records that follow it.
+func completeEnd(f *os.File, size int64, gz bool) (int64, error) {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	var end int64
+	err := ScanOffsets(f, func(offset, length int64) error {
+		if offset+length > size {
+			return io.ErrUnexpectedEOF // the block was seeked beyond the end of the file
+		}
+		if !gz {
+			tail := make([]byte, 4)
+			if _, err := f.ReadAt(tail, offset+length-4); err != nil || !bytes.Equal(tail, []byte("\r\n\r\n")) {
+				if offset+length == size {
+					return io.ErrUnexpectedEOF
+				}
+				return fmt.Errorf("%w: record at offset %d doesn't end with two CRLFs", ErrWARCHeader, offset)
+			}
+		}
+		end = offset + length
+		return nil
+	})
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return 0, err
+	}
+	return end, nil
+}
+
+// firstWarcinfo returns the WARC-Record-ID of the first record of the file, if it is a warcinfo record
+func firstWarcinfo(f *os.File, end int64) string {
+	if end == 0 {
+		return ""
+	}
+	rdr, err := NewWARCReader(io.NewSectionReader(f, 0, end))
+	if err != nil {
+		return ""
+	}
+	defer rdr.Close()
+	if _, err = rdr.Next(); err != nil || rdr.Type() != string(TypeWarcinfo) {
+		return ""
+	}
+	return rdr.ID()
+}
+
+// Truncated returns the number of bytes of a partial final record that were truncated when the file was opened.
+func (a *AppendWriter) Truncated() int64 { return a.truncated }
+
+// Close closes the file.
+func (a *AppendWriter) Close() error { return a.f.Close() }
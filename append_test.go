@@ -0,0 +1,112 @@
+package webarchive
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOpenAppend(t *testing.T) {
+	checkExamples(t)
+	dir, err := ioutil.TempDir("", "webarchive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, test := range []struct {
+		src   string
+		cut   int // bytes cut from the end of the file
+		trunc bool
+	}{
+		{"examples/hello-world.warc", 0, false},
+		{"examples/hello-world.warc", 2, true},   // missing the CRLFs that end the record
+		{"examples/hello-world.warc", 100, true}, // cut in the block
+		{"examples/IAH-20080430204825-00000-blackbook.warc.gz", 0, false},
+		{"examples/IAH-20080430204825-00000-blackbook.warc.gz", 50, true},
+	} {
+		src, _ := ioutil.ReadFile(test.src)
+		name := filepath.Join(dir, filepath.Base(test.src))
+		if err := ioutil.WriteFile(name, src[:len(src)-test.cut], 0666); err != nil {
+			t.Fatal(err)
+		}
+		var expect int
+		f, _ := os.Open(test.src)
+		ScanOffsets(f, func(_, _ int64) error { expect++; return nil })
+		f.Close()
+		if test.trunc {
+			expect--
+		}
+		a, err := OpenAppend(name)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if (a.Truncated() > 0) != test.trunc || a.Offset() != int64(len(src)-test.cut)-a.Truncated() {
+			t.Fatalf("%s cut by %d: bad truncation %d, offset %d", name, test.cut, a.Truncated(), a.Offset())
+		}
+		h := NewRecordHeader(TypeResource, "http://example.com/resumed", time.Now())
+		h.Set("Content-Type", "text/plain")
+		if err := a.WriteRecord(h, strings.NewReader("resumed")); err != nil {
+			t.Fatal(err)
+		}
+		if err := a.Close(); err != nil {
+			t.Fatal(err)
+		}
+		f, _ = os.Open(name)
+		rdr, err := NewWARCReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var n int
+		var info, last string
+		for rec, err := rdr.Next(); err == nil; rec, err = rdr.Next() {
+			if n == 0 && rdr.Type() == "warcinfo" {
+				info = rdr.ID()
+			}
+			last = rec.URL() + " " + rec.Fields().Get("WARC-Warcinfo-ID")
+			n++
+		}
+		rdr.Close()
+		f.Close()
+		if n != expect+1 || last != "http://example.com/resumed "+info {
+			t.Errorf("%s cut by %d: expecting %d records ending with the appended record, got %d ending %q", name, test.cut, expect+1, n, last)
+		}
+	}
+	// new files are created, gzipped by their extension
+	name := filepath.Join(dir, "new.warc.gz")
+	a, err := OpenAppend(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.WriteRecord(NewRecordHeader(TypeResource, "http://example.com/", time.Now()), strings.NewReader("new"))
+	a.Close()
+	b, _ := ioutil.ReadFile(name)
+	if !isgzip(b) {
+		t.Error("expecting a new .warc.gz file to be gzipped")
+	}
+	// files with a corrupt record before the last aren't truncated
+	name = filepath.Join(dir, "corrupt.warc")
+	src, _ := ioutil.ReadFile("examples/hello-world.warc")
+	src = []byte(strings.Replace(string(src), "Content-Length: 207", "Content-Length: 206", 1))
+	ioutil.WriteFile(name, src, 0666)
+	if _, err := OpenAppend(name); !errors.Is(err, ErrWARCHeader) {
+		t.Errorf("expecting ErrWARCHeader opening a file with a corrupt record, got %v", err)
+	}
+	if b, _ := ioutil.ReadFile(name); len(b) != len(src) {
+		t.Errorf("expecting a file with a corrupt record to be unmodified, got %d of %d bytes", len(b), len(src))
+	}
+	// files that aren't WARC files aren't modified
+	name = filepath.Join(dir, "hello-world.arc")
+	src, _ = ioutil.ReadFile("examples/hello-world.arc")
+	ioutil.WriteFile(name, src, 0666)
+	if _, err := OpenAppend(name); err == nil || err == io.ErrUnexpectedEOF {
+		t.Errorf("expecting an error opening an ARC file, got %v", err)
+	}
+	if b, _ := ioutil.ReadFile(name); len(b) != len(src) {
+		t.Error("expecting an ARC file to be unmodified")
+	}
+}
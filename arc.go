@@ -17,7 +17,10 @@ package webarchive
 import (
 	"bytes"
 	"io"
+	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -38,6 +41,7 @@ const ARCTime = "20060102150405"
 //	if ok {fmt.Println(arcrecord.IP())}
 type ARCRecord interface {
 	IP() string
+	HTTPResponse() (*http.Response, error)
 	Record
 }
 
@@ -64,6 +68,9 @@ type arcHeader interface {
 	Header
 	size() int64
 	setfields([]byte)
+	stored() []byte
+	setparsed(parsedFields)
+	settype(RecordType)
 }
 
 // Version 1 URL record
@@ -74,16 +81,26 @@ type url1 struct {
 	mime   string    // "no-type"|MIME type of data (e.g., "text/html")
 	sz     int64
 	fields []byte
+	parsed parsedFields
+	typ    RecordType
 }
 
 func (u *url1) URL() string     { return u.url }
 func (u *url1) Date() time.Time { return u.date }
-func (u *url1) Fields() map[string][]string {
-	var fields map[string][]string
+
+// NormalizedURL returns the URL of the current Record in the normal form given by NormalizeURL, without sorting
+// query parameters.
+func (u *url1) NormalizedURL() string { return NormalizeURL(u.url, false) }
+
+// TargetURI returns the parsed URL of the current Record e.g. with Scheme "dns" and Opaque "www.archive.org" for a
+// DNS lookup. Returns nil if the URL can't be parsed.
+func (u *url1) TargetURI() *url.URL { return parseTargetURI(u.url) }
+func (u *url1) Fields() Fields {
+	var fields Fields
 	if len(u.fields) > 0 {
 		fields = getAllValues(u.fields)
 	} else {
-		fields = make(map[string][]string)
+		fields = make(Fields)
 	}
 	fields["URL"] = []string{u.url}
 	fields["IP"] = []string{u.ip}
@@ -93,9 +110,28 @@ func (u *url1) Fields() map[string][]string {
 	return fields
 }
 
+// RawFields returns any HTTP headers stripped by NextPayload in their original order and spelling.
+func (u *url1) RawFields() RawFields { return getRawFields(u.fields) }
+
+// Parsed returns the result of the FieldParser registered for key (see WithFieldParser).
+// For ARC records, parsers apply to the HTTP headers stripped by NextPayload.
+func (u *url1) Parsed(key string) (interface{}, error) { return u.parsed.get(key) }
+
 func (u *url1) IP() string   { return u.ip }
 func (u *url1) MIME() string { return u.mime }
 
+// ID returns an empty string: ARC records have no record identifiers.
+func (u *url1) ID() string { return "" }
+
+// Type returns the type that the record would have in a WARC file, as given by CopyRecord: "response" if its block is
+// an HTTP response and otherwise "resource".
+func (u *url1) Type() string {
+	if u.typ == "" {
+		return string(TypeResource)
+	}
+	return string(u.typ)
+}
+
 func (u *url1) transferEncodings() []string {
 	if len(u.fields) == 0 {
 		return nil
@@ -123,8 +159,11 @@ func (u *url1) encodings() []string {
 	return append(splitAndReverse(vals[0]), splitAndReverse(vals[1])...)
 }
 
-func (u *url1) size() int64        { return u.sz }
-func (u *url1) setfields(f []byte) { u.fields = f }
+func (u *url1) size() int64              { return u.sz }
+func (u *url1) setfields(f []byte)       { u.fields = f }
+func (u *url1) stored() []byte           { return u.fields }
+func (u *url1) setparsed(p parsedFields) { u.parsed = p }
+func (u *url1) settype(t RecordType)     { u.typ = t }
 
 // Version 2 URL record
 type url2 struct {
@@ -136,7 +175,7 @@ type url2 struct {
 	filename   string
 }
 
-func (u *url2) Fields() map[string][]string {
+func (u *url2) Fields() Fields {
 	fields := u.url1.Fields()
 	fields["StatusCode"] = []string{strconv.Itoa(u.statusCode)}
 	fields["Checksum"] = []string{u.checksum}
@@ -148,11 +187,12 @@ func (u *url2) Fields() map[string][]string {
 
 // NewARCReader creates a new ARC reader from the supplied io.Reader.
 // Use instead of NewReader if you are only working with ARC files.
-func NewARCReader(r io.Reader) (*ARCReader, error) {
-	rdr, err := newReader(r)
+func NewARCReader(r io.Reader, opts ...Option) (*ARCReader, error) {
+	rdr, err := newReader(r, opts...)
 	if err != nil {
 		return nil, err
 	}
+	rdr.mixed = false
 	return newARCReader(rdr)
 }
 
@@ -163,6 +203,20 @@ func newARCReader(r *reader) (*ARCReader, error) {
 	return arc, err
 }
 
+// ArchiveMeta returns metadata about the ARC file from its version block.
+func (a *ARCReader) ArchiveMeta() ArchiveMeta {
+	if a.ARC == nil {
+		return ArchiveMeta{Format: "ARC"}
+	}
+	return ArchiveMeta{
+		Format:   "ARC",
+		Version:  strconv.Itoa(a.Version),
+		Filename: strings.TrimPrefix(a.FileDesc, "filedesc://"),
+		Date:     a.FileDate,
+		Operator: a.OriginCode,
+	}
+}
+
 // Reset allows re-use of an ARC reader
 func (a *ARCReader) Reset(r io.Reader) error {
 	a.reader.reset(r)
@@ -177,10 +231,41 @@ func (a *ARCReader) reset() error {
 
 // Next iterates to the next Record. Returns io.EOF at the end of file.
 func (a *ARCReader) Next() (Record, error) {
-	buf, err := a.next()
+	n, err := a.nextRecord(true)
+	a.tally(n, err)
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// NextHeader iterates to the next Record, returning only its header (see WARCReader.NextHeader).
+// Returns io.EOF at the end of file.
+func (a *ARCReader) NextHeader() (Header, error) {
+	n, err := a.nextRecord(false)
+	a.tally(n, err)
 	if err != nil {
 		return nil, err
 	}
+	return a, nil
+}
+
+// nextRecord reads the header of the next record, returning the length of the record.
+// If examine is set, the start of the block is examined for HTTP headers.
+func (a *ARCReader) nextRecord(examine bool) (int64, error) {
+	if a.mixed {
+		b, err := a.peekRecord()
+		if err != nil {
+			return 0, err
+		}
+		if isWARCStart(b) {
+			return 0, errFormat
+		}
+	}
+	buf, err := a.next()
+	if err != nil {
+		return 0, err
+	}
 	parts := bytes.Split(bytes.TrimSpace(buf), []byte(" "))
 	if a.Version == 1 {
 		a.arcHeader, err = makeUrl1(parts)
@@ -188,10 +273,20 @@ func (a *ARCReader) Next() (Record, error) {
 		a.arcHeader, err = makeUrl2(parts)
 	}
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
 	a.thisIdx, a.sz = 0, a.size()
-	return a, err
+	if examine {
+		a.examine(isHTTPResponse)
+	} else {
+		a.examine(nil)
+	}
+	// the type is decided by peeking at the block, even for NextHeader, so that it is the same however it is read
+	a.settype(TypeResource)
+	if b, _ := a.peek(5); a.sz >= 5 && isHTTPResponse(b) {
+		a.settype(TypeResponse)
+	}
+	return int64(len(buf)) + a.sz, nil
 }
 
 // NextPayload iterates to the next payload record.
@@ -203,16 +298,32 @@ func (a *ARCReader) NextPayload() (Record, error) {
 	if err != nil {
 		return r, err
 	}
-	if v, err := a.peek(5); err == nil && string(v) == "HTTP/" {
-		f, err := a.storeLines(0, true)
-		if err != nil {
-			return r, err
-		}
-		a.setfields(f)
+	if err = a.stripHTTP(); err != nil {
+		return r, err
 	}
+	a.summary.Payloads++
 	return r, err
 }
 
+// stripHTTP moves the HTTP headers of a record that holds an HTTP message into its fields
+func (a *ARCReader) stripHTTP() error {
+	if !a.IsHTTP() {
+		return nil
+	}
+	f, err := a.storeLines(0, true)
+	if err != nil {
+		return err
+	}
+	a.setfields(f)
+	a.setparsed(a.parseFields(f))
+	return nil
+}
+
+// HTTPResponse parses the HTTP headers of the current record into an *http.Response (see WARCReader.HTTPResponse).
+func (a *ARCReader) HTTPResponse() (*http.Response, error) {
+	return httpResponse(a.reader, a, a.stored)
+}
+
 func (r *ARCReader) readVersionBlock() (*ARC, error) {
 	buf, _ := r.readLine()
 	if len(buf) == 0 {
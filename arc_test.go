@@ -6,6 +6,7 @@ import (
 	"io"
 	"log"
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -58,3 +59,58 @@ func ExampleNewARCReader() {
 	// www.archive.org.	589	IN	A	207.241.229.39
 	// 298
 }
+
+func TestARCBzip2(t *testing.T) {
+	checkExamples(t)
+	urls := func(name string) []string {
+		f, _ := os.Open(name)
+		defer f.Close()
+		rdr, err := NewARCReader(f)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		var u []string
+		for rec, err := rdr.Next(); err == nil; rec, err = rdr.Next() {
+			u = append(u, rec.URL())
+		}
+		return u
+	}
+	plain, bz := urls("examples/hello-world.arc"), urls("examples/hello-world.arc.bz2")
+	if len(bz) == 0 || fmt.Sprint(plain) != fmt.Sprint(bz) {
+		t.Errorf("expecting the records of the bzip2 ARC file to match the uncompressed file, got %v and %v", bz, plain)
+	}
+}
+
+func TestARCTypeAndID(t *testing.T) {
+	checkExamples(t)
+	types := func(name string, next func(Reader) (Header, error)) []string {
+		f, _ := os.Open(name)
+		defer f.Close()
+		rdr, err := NewReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var typs []string
+		for h, err := next(rdr); err == nil; h, err = next(rdr) {
+			if _, ok := h.(*ARCReader); ok && h.ID() != "" {
+				t.Errorf("expecting ARC records to have no ID, got %s", h.ID())
+			}
+			if _, ok := h.(*WARCReader); ok && h.ID() != h.Fields().Get("WARC-Record-ID") {
+				t.Errorf("bad ID %s", h.ID())
+			}
+			typs = append(typs, h.Type())
+		}
+		return typs
+	}
+	records := func(r Reader) (Header, error) { return r.Next() }
+	arcTyps := types("examples/IAH-20080430204825-00000-blackbook.arc", records)
+	if len(arcTyps) != 299 || arcTyps[0] != "resource" || arcTyps[1] != "response" {
+		t.Errorf("bad ARC record types %v", arcTyps)
+	}
+	if typs := types("examples/IAH-20080430204825-00000-blackbook.arc", Reader.NextHeader); strings.Join(typs, " ") != strings.Join(arcTyps, " ") {
+		t.Errorf("expecting ARC records read with NextHeader to have the same types, got %v", typs)
+	}
+	if typs := types("examples/hello-world.warc", records); len(typs) != 6 || typs[0] != "warcinfo" {
+		t.Errorf("bad WARC record types %v", typs)
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2015 Richard Lehane. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webarchive
+
+import (
+	"encoding/base32"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// teeRecord copies the content of a record to w as it is read
+type teeRecord struct {
+	Record
+	w io.Writer
+}
+
+func (t teeRecord) Read(p []byte) (int, error) {
+	n, err := t.Record.Read(p)
+	if n > 0 {
+		t.w.Write(p[:n])
+	}
+	return n, err
+}
+
+// indexed is a record that should be in an index, with its payload digest as computed from its content
+type indexed struct {
+	record int
+	id     string
+	cdx    *CDX
+	sum    string // base32 sha1 of the payload; empty for revisits
+}
+
+// Audit cross-checks the entries of a CDX or CDXJ index against the WARC file in r that they describe.
+// Only entries for filename are checked (and all entries if filename is empty), so the index may cover a collection.
+//
+// Findings, which wrap ErrIndex or ErrDigestMatch, are returned for: response, resource and revisit records
+// that aren't in the index; entries whose offset doesn't resolve to such a record; entries whose length, URL, date
+// or digest differ from those of their record; and payloads whose content doesn't match their index digest.
+// Findings for index entries that don't resolve have a Record of -1 and, for ID, the SURT and date of the entry.
+func Audit(r io.Reader, filename string, index []*CDX) ([]Finding, error) {
+	byOffset := make(map[int64][]*CDX)
+	for _, c := range index {
+		if filename == "" || c.Filename == "" || c.Filename == filename {
+			byOffset[c.Offset] = append(byOffset[c.Offset], c)
+		}
+	}
+	var recs []*indexed
+	var idx int
+	err := scanRecords(r, func(rdr *WARCReader, rec Record, _ int64) ([]*CDX, error) {
+		defer func() { idx++ }()
+		var dg *digester
+		if !strings.EqualFold(rdr.Type(), "revisit") {
+			dg = newDigester("", "sha1")
+			rec = teeRecord{rec, dg}
+		}
+		c, err := cdxEntry(rdr, rec)
+		if c == nil || err != nil {
+			return nil, err
+		}
+		rc := &indexed{record: idx, id: rdr.ID(), cdx: c}
+		if dg != nil {
+			_, sum := dg.sums()
+			rc.sum = base32.StdEncoding.EncodeToString(sum)
+		}
+		recs = append(recs, rc)
+		return []*CDX{c}, nil
+	})
+	var findings []Finding
+	for _, rc := range recs {
+		add := func(err error) {
+			findings = append(findings, Finding{Record: rc.record, ID: rc.id, Err: err})
+		}
+		entries := byOffset[rc.cdx.Offset]
+		if len(entries) == 0 {
+			add(fmt.Errorf("%w: record at offset %d isn't indexed", ErrIndex, rc.cdx.Offset))
+			continue
+		}
+		delete(byOffset, rc.cdx.Offset)
+		for _, e := range entries {
+			digest := strings.ToUpper(strings.TrimPrefix(e.Digest, "sha1:"))
+			for _, d := range []struct{ name, index, record string }{
+				{"length", fmt.Sprint(e.Length), fmt.Sprint(rc.cdx.Length)},
+				{"URL", e.URL, rc.cdx.URL},
+				{"date", e.Date.Format(ARCTime), rc.cdx.Date.Format(ARCTime)},
+				{"digest", digest, strings.ToUpper(rc.cdx.Digest)},
+			} {
+				if d.index != d.record && d.index != "" && d.index != "0" {
+					add(fmt.Errorf("%w: index %s %s differs from record %s %s", ErrIndex, d.name, d.index, d.name, d.record))
+				}
+			}
+			// only base32 sha1 digests, the CDX convention, are checked against the content
+			if rc.sum != "" && len(digest) == len(rc.sum) && digest != rc.sum {
+				add(fmt.Errorf("%w: payload doesn't match index digest %s", ErrDigestMatch, e.Digest))
+			}
+		}
+	}
+	for _, c := range index {
+		if entries, ok := byOffset[c.Offset]; ok && entries[0] == c {
+			for _, e := range entries {
+				findings = append(findings, Finding{Record: -1, ID: e.SURT + " " + e.Date.Format(ARCTime),
+					Err: fmt.Errorf("%w: offset %d doesn't resolve to a record", ErrIndex, e.Offset)})
+			}
+			delete(byOffset, c.Offset)
+		}
+	}
+	return findings, err
+}
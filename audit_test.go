@@ -0,0 +1,54 @@
+package webarchive
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestAudit(t *testing.T) {
+	in, err := ioutil.ReadFile("examples/hello-world.warc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := Index(bytes.NewReader(in), "hello-world.warc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := &bytes.Buffer{}
+	for _, e := range entries {
+		buf.WriteString(e.CDXJ() + "\n")
+	}
+	buf.WriteString(`com,example)/ 20200101000000 {"url":"http://example.com/","offset":"99","length":"10","filename":"hello-world.warc"}` + "\n")
+	buf.WriteString(`com,example)/ 20200101000000 {"url":"http://example.com/","offset":"99","length":"10","filename":"other.warc"}` + "\n")
+	var index []*CDX
+	rdr := NewCDXReader(buf)
+	for {
+		c, err := rdr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		index = append(index, c)
+	}
+	if len(index) != len(entries)+2 || index[0].Offset != entries[0].Offset || index[0].Length != entries[0].Length {
+		t.Fatalf("bad CDXJ parse: %v", index)
+	}
+	findings, err := Audit(bytes.NewReader(in), "hello-world.warc", index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(findings) != 1 || findings[0].Record != -1 || !errors.Is(findings[0], ErrIndex) {
+		t.Errorf("expecting a finding for the unresolved entry, got %v", findings)
+	}
+	tampered := strings.Replace(string(in), "Hello World", "Hello Wyrld", 1)
+	findings, _ = Audit(strings.NewReader(tampered), "hello-world.warc", index[:1])
+	if len(findings) != 3 || !errors.Is(findings[0], ErrDigestMatch) || !errors.Is(findings[1], ErrIndex) {
+		t.Errorf("expecting mismatched and unindexed records, got %v", findings)
+	}
+}
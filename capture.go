@@ -0,0 +1,314 @@
+// Copyright 2015 Richard Lehane. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webarchive
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/http/httputil"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Recorder is an http.RoundTripper that archives the requests it sends and the responses it receives.
+// Each exchange is written to a WARC 1.0 file as a response record and a request record concurrent to it.
+// The address of the server the request was sent to is recorded in the WARC-IP-Address field of both records. For
+// requests sent over TLS, the protocols and cipher suite are recorded in the WARC-Protocol and WARC-Cipher-Suite
+// extension fields.
+//
+// Response bodies are read in full before RoundTrip returns. Bodies that the transport has decoded
+// (chunked transfer encoding, or gzip content encoding the transport asked for itself) are archived
+// decoded, with a Content-Length header to match.
+//
+// A Recorder is safe for concurrent use: the records of an exchange are written together, and in the same output.
+type Recorder struct {
+	Transport http.RoundTripper // transport used to send requests; http.DefaultTransport if nil
+	Digest    DigestFunc        // computes the block and payload digests of records; base32 SHA-1 if nil
+
+	mu      sync.Mutex
+	ww      *warcWriter
+	out     *rotator // outputs of a rotating Recorder
+	maxSize int64    // start a new output once the current one reaches maxSize bytes; 0 for no limit
+	info    []byte   // block of the warcinfo record that begins each output
+	infoID  string   // ID of the warcinfo record of the current output
+}
+
+// NewRecorder returns a Recorder that writes WARC records to w.
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{ww: newWARCWriter(w)}
+}
+
+// NewRotatingRecorder returns a Recorder that writes WARC records to a sequence of outputs, so that parallel fetchers
+// can share one Recorder for the whole of a crawl. A new output is started once the current one reaches maxSize bytes
+// (0 for no limit); the records of an exchange are never split between outputs. Each output begins with a warcinfo
+// record made from info, filled with this package's software name and the WARC 1.0 format and conformsTo if they are
+// empty, and the records in it refer to that warcinfo record with WARC-Warcinfo-ID.
+//
+// Close must be called to close the last output.
+func NewRotatingRecorder(outputs Outputs, maxSize int64, info Warcinfo) *Recorder {
+	if info.Software == "" {
+		info.Software = software
+	}
+	if info.Format == "" {
+		info.Format = "WARC File Format 1.0"
+	}
+	if info.ConformsTo == "" {
+		info.ConformsTo = conformsTo10
+	}
+	return &Recorder{out: &rotator{outputs: outputs}, maxSize: maxSize, info: info.Bytes()}
+}
+
+// Close closes the current output of a Recorder created with NewRotatingRecorder. Exchanges recorded after Close
+// are written to a new output. For Recorders created with NewRecorder, Close does nothing.
+func (rc *Recorder) Close() error {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if rc.out == nil {
+		return nil
+	}
+	rc.ww = nil
+	return rc.out.close()
+}
+
+// write the records of an exchange, first starting a new output if a rotating Recorder needs one
+func (rc *Recorder) write(e exchange) error {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if rc.out != nil && (rc.ww == nil || (rc.maxSize > 0 && rc.ww.n >= rc.maxSize)) {
+		rc.ww = nil
+		if err := rc.out.rotate(); err != nil {
+			return err
+		}
+		id, err := rc.out.writeWarcinfo("1.0", rc.out.name, rc.info)
+		if err != nil {
+			return err
+		}
+		rc.ww, rc.infoID = rc.out.warcWriter, id
+	}
+	e.warcinfo = rc.infoID
+	rc.ww.dg = rc.Digest
+	return rc.ww.writeExchange("1.0", e)
+}
+
+// RoundTrip sends the request with the Recorder's transport and archives the exchange. Errors from the transport
+// are returned as is and nothing is archived. If the exchange can't be archived, the response is closed and
+// the error returned.
+func (rc *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	t := rc.Transport
+	if t == nil {
+		t = http.DefaultTransport
+	}
+	reqBlock, err := httputil.DumpRequestOut(req, true) // restores req.Body
+	if err != nil {
+		return nil, err
+	}
+	var ip string
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			ip = remoteIP(info.Conn)
+		},
+	}
+	date := now()
+	resp, err := t.RoundTrip(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+	if err != nil {
+		return nil, err
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	e := exchange{
+		uri:     req.URL.String(),
+		date:    date,
+		ip:      ip,
+		req:     reqBlock,
+		resp:    responseBlock(resp, body),
+		payload: body,
+	}
+	if resp.TLS != nil {
+		e.protocol, e.cipher = tlsProtocols(resp), cipherSuiteName(resp.TLS.CipherSuite)
+	}
+	if err = rc.write(e); err != nil {
+		resp.Body.Close()
+		return nil, fmt.Errorf("webarchive: recording %s: %v", req.URL, err)
+	}
+	return resp, nil
+}
+
+// HTTPRecord is a response or request record made from net/http types by NewResponseRecord or NewRequestRecord.
+// It is both the header and block of the record, so it can be written with ww.WriteRecord(rec, rec).
+type HTTPRecord struct {
+	*RecordHeader
+	*bytes.Reader
+}
+
+// NewResponseRecord returns a WARC 1.0 response record of resp, dated now, with the URL of resp.Request as its
+// WARC-Target-URI. The body of resp is read in full and replaced with a copy, so the response can still be used.
+// As with a Recorder, a body that the transport has decoded is archived decoded, with a Content-Length header to
+// match. The record has block and payload digests; its Content-Length is set when it is written.
+func NewResponseRecord(resp *http.Response) (*HTTPRecord, error) {
+	var body []byte
+	if resp.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	var uri string
+	if resp.Request != nil && resp.Request.URL != nil {
+		uri = resp.Request.URL.String()
+	}
+	block := responseBlock(resp, body)
+	h := NewRecordHeader(TypeResponse, uri, now())
+	h.Set("Content-Type", "application/http;msgtype=response")
+	h.Set("WARC-Block-Digest", sha1Digest(block).String())
+	h.Set("WARC-Payload-Digest", sha1Digest(body).String())
+	return &HTTPRecord{h, bytes.NewReader(block)}, nil
+}
+
+// NewRequestRecord returns a WARC 1.0 request record of req, dated now. Requests received by a server are archived as
+// they were received, and other requests as they will be sent by a client (see httputil.DumpRequestOut). The body of
+// req is read in full and restored. To make the record concurrent to the response, set its WARC-Concurrent-To field:
+//
+//	reqRec.Set("WARC-Concurrent-To", respRec.ID())
+func NewRequestRecord(req *http.Request) (*HTTPRecord, error) {
+	var block []byte
+	var err error
+	if req.RequestURI != "" {
+		block, err = httputil.DumpRequest(req, true)
+	} else {
+		block, err = httputil.DumpRequestOut(req, true)
+	}
+	if err != nil {
+		return nil, err
+	}
+	u := *req.URL
+	if u.Host == "" {
+		u.Host = req.Host
+	}
+	if u.Scheme == "" {
+		u.Scheme = "http"
+		if req.TLS != nil {
+			u.Scheme = "https"
+		}
+	}
+	h := NewRecordHeader(TypeRequest, u.String(), now())
+	h.Set("Content-Type", "application/http;msgtype=request")
+	h.Set("WARC-Block-Digest", sha1Digest(block).String())
+	return &HTTPRecord{h, bytes.NewReader(block)}, nil
+}
+
+// names of TLS versions in WARC-Protocol fields
+var tlsVersions = map[uint16]string{
+	tls.VersionTLS10: "tls/1.0",
+	tls.VersionTLS11: "tls/1.1",
+	tls.VersionTLS12: "tls/1.2",
+	tls.VersionTLS13: "tls/1.3",
+}
+
+// IANA names of the cipher suites implemented by crypto/tls, for WARC-Cipher-Suite (tls.CipherSuiteName needs Go 1.14)
+var cipherSuites = map[uint16]string{
+	tls.TLS_RSA_WITH_RC4_128_SHA:                "TLS_RSA_WITH_RC4_128_SHA",
+	tls.TLS_RSA_WITH_3DES_EDE_CBC_SHA:           "TLS_RSA_WITH_3DES_EDE_CBC_SHA",
+	tls.TLS_RSA_WITH_AES_128_CBC_SHA:            "TLS_RSA_WITH_AES_128_CBC_SHA",
+	tls.TLS_RSA_WITH_AES_256_CBC_SHA:            "TLS_RSA_WITH_AES_256_CBC_SHA",
+	tls.TLS_RSA_WITH_AES_128_CBC_SHA256:         "TLS_RSA_WITH_AES_128_CBC_SHA256",
+	tls.TLS_RSA_WITH_AES_128_GCM_SHA256:         "TLS_RSA_WITH_AES_128_GCM_SHA256",
+	tls.TLS_RSA_WITH_AES_256_GCM_SHA384:         "TLS_RSA_WITH_AES_256_GCM_SHA384",
+	tls.TLS_ECDHE_ECDSA_WITH_RC4_128_SHA:        "TLS_ECDHE_ECDSA_WITH_RC4_128_SHA",
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA:    "TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA",
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA:    "TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA",
+	tls.TLS_ECDHE_RSA_WITH_RC4_128_SHA:          "TLS_ECDHE_RSA_WITH_RC4_128_SHA",
+	tls.TLS_ECDHE_RSA_WITH_3DES_EDE_CBC_SHA:     "TLS_ECDHE_RSA_WITH_3DES_EDE_CBC_SHA",
+	tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA:      "TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA",
+	tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA:      "TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA",
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256: "TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256",
+	tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA256:   "TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA256",
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256:   "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256",
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256: "TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256",
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384:   "TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384",
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384: "TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384",
+	tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305:    "TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256",
+	tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305:  "TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256",
+	tls.TLS_AES_128_GCM_SHA256:                  "TLS_AES_128_GCM_SHA256",
+	tls.TLS_AES_256_GCM_SHA384:                  "TLS_AES_256_GCM_SHA384",
+	tls.TLS_CHACHA20_POLY1305_SHA256:            "TLS_CHACHA20_POLY1305_SHA256",
+}
+
+// cipherSuiteName returns the IANA name of a cipher suite, or its ID in hex if it isn't known
+func cipherSuiteName(id uint16) string {
+	if name, ok := cipherSuites[id]; ok {
+		return name
+	}
+	return fmt.Sprintf("0x%04X", id)
+}
+
+// tlsProtocols returns the WARC-Protocol values of a response received over TLS: the application protocol,
+// as an ALPN identifier, then the TLS version
+func tlsProtocols(resp *http.Response) []string {
+	app := resp.TLS.NegotiatedProtocol
+	if app == "" {
+		app = strings.ToLower(resp.Proto)
+	}
+	ret := []string{app}
+	if v, ok := tlsVersions[resp.TLS.Version]; ok {
+		ret = append(ret, v)
+	}
+	return ret
+}
+
+// remoteIP returns the IP address of the peer of a connection
+func remoteIP(c net.Conn) string {
+	if c == nil || c.RemoteAddr() == nil {
+		return ""
+	}
+	addr := c.RemoteAddr().String()
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// responseBlock serialises a response with the body as it was read from the transport
+func responseBlock(resp *http.Response, body []byte) []byte {
+	keys := make([]string, 0, len(resp.Header))
+	for k := range resp.Header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var headers []headerField
+	for _, k := range keys {
+		for _, v := range resp.Header[k] {
+			headers = append(headers, headerField{Name: k, Value: v})
+		}
+	}
+	if _, ok := resp.Header["Content-Length"]; !ok && len(body) > 0 {
+		headers = append(headers, headerField{Name: "Content-Length", Value: strconv.Itoa(len(body))})
+	}
+	return httpMessage(fmt.Sprintf("%s %s", resp.Proto, resp.Status), headers, body, false)
+}
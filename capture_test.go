@@ -0,0 +1,202 @@
+package webarchive
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestRecorder(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("hello " + r.URL.Path))
+	}))
+	defer srv.Close()
+	buf := &bytes.Buffer{}
+	client := &http.Client{Transport: NewRecorder(buf)}
+	resp, err := client.Get(srv.URL + "/world")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "hello /world" {
+		t.Fatalf("bad body returned to client: %q", body)
+	}
+	recs, _ := readAll(t, buf.Bytes())
+	if len(recs) != 2 {
+		t.Fatalf("expecting 2 records, got %d", len(recs))
+	}
+	for _, r := range recs {
+		if r.Get("WARC-IP-Address") != "127.0.0.1" {
+			t.Errorf("expecting WARC-IP-Address 127.0.0.1, got %q", r.Get("WARC-IP-Address"))
+		}
+		if r.Get("WARC-Target-URI") != srv.URL+"/world" {
+			t.Errorf("bad target URI %q", r.Get("WARC-Target-URI"))
+		}
+	}
+	if recs[0].Get("WARC-Type") != "response" || recs[1].Get("WARC-Concurrent-To") != recs[0].Get("WARC-Record-ID") {
+		t.Errorf("bad records: %v", recs)
+	}
+	v := &Validator{Digests: true}
+	if findings, err := v.Validate(bytes.NewReader(buf.Bytes())); err != nil || len(findings) > 0 {
+		t.Errorf("expecting valid WARC, got %v %v", findings, err)
+	}
+	rdr, err := NewReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec, err := rdr.NextPayload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := ioutil.ReadAll(rec); string(b) != "hello /world" {
+		t.Errorf("bad archived payload: %q", b)
+	}
+}
+
+func TestRotatingRecorder(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello " + r.URL.Path))
+	}))
+	defer srv.Close()
+	dir, err := ioutil.TempDir("", "webarchive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	rc := NewRotatingRecorder(FileOutputs(dir, "crawl", NoCompression), 2048, Warcinfo{IsPartOf: "test"})
+	client := &http.Client{Transport: rc}
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			resp, err := client.Get(srv.URL + "/" + strconv.Itoa(i))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			resp.Body.Close()
+		}(i)
+	}
+	wg.Wait()
+	if err := rc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	names, _ := filepath.Glob(filepath.Join(dir, "crawl-*.warc"))
+	if len(names) < 2 {
+		t.Fatalf("expecting more than one output, got %v", names)
+	}
+	var exchanges int
+	for _, name := range names {
+		byt, _ := ioutil.ReadFile(name)
+		recs, _ := readAll(t, byt)
+		if len(recs) < 3 || recs[0].Get("WARC-Type") != "warcinfo" || recs[0].Get("WARC-Filename") != filepath.Base(name) {
+			t.Fatalf("%s: expecting a warcinfo record followed by exchanges, got %v", name, recs)
+		}
+		for i := 1; i+1 < len(recs); i += 2 {
+			resp, req := recs[i], recs[i+1]
+			if resp.Get("WARC-Type") != "response" || req.Get("WARC-Concurrent-To") != resp.Get("WARC-Record-ID") ||
+				resp.Get("WARC-Warcinfo-ID") != recs[0].Get("WARC-Record-ID") {
+				t.Errorf("%s: bad exchange %v %v", name, resp, req)
+			}
+			exchanges++
+		}
+	}
+	if exchanges != 20 {
+		t.Errorf("expecting 20 exchanges, got %d", exchanges)
+	}
+}
+
+func TestRecorderTLS(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("secure"))
+	}))
+	defer srv.Close()
+	buf := &bytes.Buffer{}
+	rc := NewRecorder(buf)
+	rc.Transport = srv.Client().Transport
+	resp, err := (&http.Client{Transport: rc}).Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	rdr, err := NewWARCReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := rdr.Next(); err != nil {
+			t.Fatal(err)
+		}
+		if p := rdr.Protocols(); len(p) != 2 || p[0] != "http/1.1" || !strings.HasPrefix(p[1], "tls/1.") {
+			t.Errorf("bad protocols %v", p)
+		}
+		if cs := rdr.CipherSuite(); !strings.HasPrefix(cs, "TLS_") {
+			t.Errorf("bad cipher suite %q", cs)
+		}
+	}
+	if findings, err := (Validator{Digests: true}).Validate(bytes.NewReader(buf.Bytes())); err != nil || len(findings) > 0 {
+		t.Errorf("expecting valid WARC, got %v %v", findings, err)
+	}
+}
+
+func TestHTTPRecords(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("hello " + r.URL.Path))
+	}))
+	defer srv.Close()
+	req, _ := http.NewRequest("GET", srv.URL+"/world", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	respRec, err := NewResponseRecord(resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body, _ := ioutil.ReadAll(resp.Body); string(body) != "hello /world" {
+		t.Fatalf("expecting body to be restored, got %q", body)
+	}
+	reqRec, err := NewRequestRecord(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reqRec.Set("WARC-Concurrent-To", respRec.ID())
+	buf := &bytes.Buffer{}
+	ww, _ := NewWARCWriter(buf, NoCompression)
+	for _, rec := range []*HTTPRecord{respRec, reqRec} {
+		if err := ww.WriteRecord(rec, rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	recs, blocks := readAll(t, buf.Bytes())
+	if len(recs) != 2 {
+		t.Fatalf("expecting 2 records, got %d", len(recs))
+	}
+	for _, r := range recs {
+		if r.Get("WARC-Target-URI") != srv.URL+"/world" {
+			t.Errorf("bad target URI %q", r.Get("WARC-Target-URI"))
+		}
+	}
+	if recs[0].Get("WARC-Type") != "response" || recs[1].Get("WARC-Type") != "request" ||
+		recs[1].Get("WARC-Concurrent-To") != recs[0].Get("WARC-Record-ID") {
+		t.Errorf("bad records: %v", recs)
+	}
+	if !strings.HasPrefix(string(blocks[1]), "GET /world HTTP/1.1\r\n") {
+		t.Errorf("bad request block %q", blocks[1])
+	}
+	v := &Validator{Digests: true}
+	if findings, err := v.Validate(bytes.NewReader(buf.Bytes())); err != nil || len(findings) > 0 {
+		t.Errorf("expecting valid WARC, got %v %v", findings, err)
+	}
+}
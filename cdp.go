@@ -0,0 +1,184 @@
+// Copyright 2015 Richard Lehane. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webarchive
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CDP archives the network traffic of a browser controlled with the Chrome DevTools Protocol as WARC 1.1 request
+// and response records. Pass it the Network domain events received from the browser with Event, and the body of each
+// response, fetched with Network.getResponseBody once Network.loadingFinished is received, with Body.
+//
+// Redirects are archived as they are reported, with the redirect response and an empty body. Browsers report decoded
+// response bodies, so Content-Encoding and Transfer-Encoding headers are dropped from responses and Content-Length
+// set to match the body.
+//
+// A CDP is safe for concurrent use.
+type CDP struct {
+	Digest DigestFunc // computes the block and payload digests of records; base32 SHA-1 if nil
+
+	mu        sync.Mutex
+	ww        *warcWriter
+	exchanges map[string]*cdpExchange // keyed by CDP request ID
+}
+
+// NewCDP returns a CDP that writes WARC records to w.
+func NewCDP(w io.Writer) *CDP {
+	return &CDP{ww: newWARCWriter(w), exchanges: make(map[string]*cdpExchange)}
+}
+
+type cdpRequest struct {
+	URL      string            `json:"url"`
+	Method   string            `json:"method"`
+	Headers  map[string]string `json:"headers"`
+	PostData string            `json:"postData"`
+}
+
+type cdpResponse struct {
+	URL             string            `json:"url"`
+	Status          int               `json:"status"`
+	StatusText      string            `json:"statusText"`
+	Headers         map[string]string `json:"headers"`
+	RequestHeaders  map[string]string `json:"requestHeaders"` // headers actually sent, if known
+	RemoteIPAddress string            `json:"remoteIPAddress"`
+	Protocol        string            `json:"protocol"`
+}
+
+type cdpEvent struct {
+	RequestID        string       `json:"requestId"`
+	Request          *cdpRequest  `json:"request"`
+	Response         *cdpResponse `json:"response"`
+	RedirectResponse *cdpResponse `json:"redirectResponse"`
+	WallTime         float64      `json:"wallTime"`
+}
+
+type cdpExchange struct {
+	date time.Time
+	req  *cdpRequest
+	resp *cdpResponse
+}
+
+// Event handles a CDP event, given its method name and JSON params. The Network.requestWillBeSent,
+// Network.responseReceived and Network.loadingFailed events are used; other events are ignored.
+func (c *CDP) Event(method string, params []byte) error {
+	switch method {
+	case "Network.requestWillBeSent", "Network.responseReceived", "Network.loadingFailed":
+	default:
+		return nil
+	}
+	var ev cdpEvent
+	if err := json.Unmarshal(params, &ev); err != nil {
+		return fmt.Errorf("webarchive: bad %s event: %v", method, err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch method {
+	case "Network.requestWillBeSent":
+		if ev.Request == nil {
+			return nil
+		}
+		if e, ok := c.exchanges[ev.RequestID]; ok && ev.RedirectResponse != nil {
+			e.resp = ev.RedirectResponse
+			if err := c.write(e, nil); err != nil {
+				return err
+			}
+		}
+		date := now()
+		if ev.WallTime > 0 {
+			sec, frac := math.Modf(ev.WallTime)
+			date = time.Unix(int64(sec), int64(frac*1e9))
+		}
+		c.exchanges[ev.RequestID] = &cdpExchange{date: date, req: ev.Request}
+	case "Network.responseReceived":
+		if e, ok := c.exchanges[ev.RequestID]; ok {
+			e.resp = ev.Response
+		}
+	case "Network.loadingFailed":
+		delete(c.exchanges, ev.RequestID)
+	}
+	return nil
+}
+
+// Body writes the records for a request once its response body, as returned by Network.getResponseBody, is known.
+// Returns ErrCDPResponse if no response was received for the request.
+func (c *CDP) Body(requestID, body string, base64Encoded bool) error {
+	payload := []byte(body)
+	if base64Encoded {
+		var err error
+		if payload, err = base64.StdEncoding.DecodeString(body); err != nil {
+			return err
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.exchanges[requestID]
+	if !ok || e.resp == nil {
+		return ErrCDPResponse
+	}
+	delete(c.exchanges, requestID)
+	return c.write(e, payload)
+}
+
+func (c *CDP) write(e *cdpExchange, payload []byte) error {
+	u, err := url.Parse(e.req.URL)
+	if err != nil {
+		return err
+	}
+	version := harVersion(e.resp.Protocol)
+	reqHeaders := e.resp.RequestHeaders
+	if len(reqHeaders) == 0 {
+		reqHeaders = e.req.Headers
+	}
+	statusText := e.resp.StatusText
+	if statusText == "" {
+		statusText = http.StatusText(e.resp.Status)
+	}
+	c.ww.dg = c.Digest
+	return c.ww.writeExchange("1.1", exchange{
+		uri:     e.req.URL,
+		date:    e.date,
+		ip:      strings.Trim(e.resp.RemoteIPAddress, "[]"),
+		req:     httpMessage(fmt.Sprintf("%s %s %s", e.req.Method, u.RequestURI(), version), cdpHeaders(reqHeaders), []byte(e.req.PostData), false),
+		resp:    httpMessage(fmt.Sprintf("%s %d %s", version, e.resp.Status, statusText), cdpHeaders(e.resp.Headers), payload, true),
+		payload: payload,
+	})
+}
+
+// cdpHeaders lists CDP headers in name order. CDP joins repeated headers with newlines.
+func cdpHeaders(h map[string]string) []headerField {
+	names := make([]string, 0, len(h))
+	for k := range h {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var ret []headerField
+	for _, k := range names {
+		for _, v := range strings.Split(h[k], "\n") {
+			ret = append(ret, headerField{Name: k, Value: v})
+		}
+	}
+	return ret
+}
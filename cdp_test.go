@@ -0,0 +1,58 @@
+package webarchive
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestCDP(t *testing.T) {
+	buf := &bytes.Buffer{}
+	c := NewCDP(buf)
+	for _, ev := range []struct{ method, params string }{
+		{"Network.requestWillBeSent", `{"requestId":"1","wallTime":1577836800.5,"request":{"url":"http://example.com/","method":"GET","headers":{"User-Agent":"HeadlessChrome"}}}`},
+		{"Network.requestWillBeSent", `{"requestId":"1","wallTime":1577836801,"request":{"url":"https://example.com/","method":"GET","headers":{}},` +
+			`"redirectResponse":{"url":"http://example.com/","status":301,"headers":{"Location":"https://example.com/"},"protocol":"http/1.1","remoteIPAddress":"93.184.216.34"}}`},
+		{"Network.responseReceived", `{"requestId":"1","response":{"url":"https://example.com/","status":200,"statusText":"OK",` +
+			`"headers":{"content-type":"text/html","content-encoding":"gzip","set-cookie":"a=1\nb=2"},"protocol":"h2","remoteIPAddress":"[2606:2800:220:1:248:1893:25c8:1946]"}}`},
+		{"Page.loadEventFired", `{}`},
+		{"Network.requestWillBeSent", `{"requestId":"2","request":{"url":"https://example.com/missing.css","method":"GET","headers":{}}}`},
+		{"Network.loadingFailed", `{"requestId":"2"}`},
+	} {
+		if err := c.Event(ev.method, []byte(ev.params)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.Body("1", "PGh0bWw+", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Body("2", "", false); err != ErrCDPResponse {
+		t.Fatalf("expecting ErrCDPResponse, got %v", err)
+	}
+	recs, blocks := readAll(t, buf.Bytes())
+	if len(recs) != 4 {
+		t.Fatalf("expecting 4 records, got %d", len(recs))
+	}
+	if recs[0].Get("WARC-Target-URI") != "http://example.com/" || recs[0].Get("WARC-Date") != "2020-01-01T00:00:00.5Z" ||
+		recs[0].Get("WARC-IP-Address") != "93.184.216.34" || !bytes.HasPrefix(blocks[0], []byte("HTTP/1.1 301 Moved Permanently\r\n")) {
+		t.Errorf("bad redirect record: %v %q", recs[0], blocks[0])
+	}
+	if recs[2].Get("WARC-IP-Address") != "2606:2800:220:1:248:1893:25c8:1946" || !bytes.HasPrefix(blocks[3], []byte("GET / HTTP/2\r\n")) {
+		t.Errorf("bad records: %v %q", recs[2], blocks[3])
+	}
+	if bytes.Contains(blocks[2], []byte("content-encoding")) || !bytes.Contains(blocks[2], []byte("set-cookie: b=2\r\n")) {
+		t.Errorf("bad response headers: %q", blocks[2])
+	}
+	rdr, err := NewReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rdr.NextPayload()
+	rec, err := rdr.NextPayload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := ioutil.ReadAll(rec); string(b) != "<html>" {
+		t.Errorf("bad payload %q", b)
+	}
+}
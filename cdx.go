@@ -0,0 +1,290 @@
+// Copyright 2015 Richard Lehane. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webarchive
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrCDX is returned when a CDX line can't be parsed.
+var ErrCDX = errors.New("webarchive: invalid CDX line")
+
+// CDX is a single line of a CDX index. Fields not given in the index are left empty.
+// See https://iipc.github.io/warc-specifications/specifications/cdx-format/cdx-2015/
+type CDX struct {
+	SURT     string    // N: massaged (SURT form) URL; A: canonized URL
+	Date     time.Time // b: date
+	URL      string    // a: original URL
+	MIME     string    // m: MIME type
+	Status   string    // s: response code
+	Digest   string    // k: new style checksum, usually a base32 sha1 digest
+	Redirect string    // r: redirect
+	Meta     string    // M: meta tags
+	Length   int64     // S: compressed record size
+	Offset   int64     // V: compressed arc file offset
+	Filename string    // g: file name
+}
+
+// default field order for CDX files without a header line: the common 11 field format
+const defaultCDXFields = "NbamskrMSVg"
+
+// CDXReader reads the lines of a CDX index.
+type CDXReader struct {
+	scanner *bufio.Scanner
+	fields  string // field letters, in order
+	line    int
+}
+
+// NewCDXReader returns a reader for the CDX index in r. The field order is taken from the
+// index's header line (e.g. " CDX N b a m s k r M S V g"). If there is no header line,
+// the 11 field format is assumed. CDXJ lines, as written by CDXJ, are also read.
+func NewCDXReader(r io.Reader) *CDXReader {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 0, 4096), 1<<20)
+	return &CDXReader{scanner: s, fields: defaultCDXFields}
+}
+
+// Next returns the next line of the index. Returns io.EOF at the end of the index.
+func (c *CDXReader) Next() (*CDX, error) {
+	for c.scanner.Scan() {
+		c.line++
+		line := strings.TrimSpace(c.scanner.Text())
+		if line == "" {
+			continue
+		}
+		if c.line == 1 && strings.HasPrefix(line, "CDX ") {
+			c.fields = strings.Replace(line[4:], " ", "", -1)
+			continue
+		}
+		if vals := strings.SplitN(line, " ", 3); len(vals) == 3 && strings.HasPrefix(vals[2], "{") {
+			return parseCDXJ(vals)
+		}
+		return parseCDX(c.fields, strings.Fields(line))
+	}
+	if err := c.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+func parseCDX(fields string, vals []string) (*CDX, error) {
+	if len(vals) != len(fields) {
+		return nil, ErrCDX
+	}
+	cdx := &CDX{}
+	var err error
+	for i, v := range vals {
+		if v == "-" {
+			continue
+		}
+		switch fields[i] {
+		case 'N', 'A':
+			cdx.SURT = v
+		case 'b':
+			if cdx.Date, err = parseCDXDate(v); err != nil {
+				return nil, ErrCDX
+			}
+		case 'a':
+			cdx.URL = v
+		case 'm':
+			cdx.MIME = v
+		case 's':
+			cdx.Status = v
+		case 'k':
+			cdx.Digest = v
+		case 'r':
+			cdx.Redirect = v
+		case 'M':
+			cdx.Meta = v
+		case 'S':
+			if cdx.Length, err = strconv.ParseInt(v, 10, 64); err != nil {
+				return nil, ErrCDX
+			}
+		case 'V':
+			if cdx.Offset, err = strconv.ParseInt(v, 10, 64); err != nil {
+				return nil, ErrCDX
+			}
+		case 'g':
+			cdx.Filename = v
+		}
+	}
+	return cdx, nil
+}
+
+// parse a CDXJ line split into SURT, date and JSON block
+func parseCDXJ(vals []string) (*CDX, error) {
+	var j struct {
+		URL      string      `json:"url"`
+		MIME     string      `json:"mime"`
+		Status   interface{} `json:"status"`
+		Digest   string      `json:"digest"`
+		Redirect string      `json:"redirect"`
+		Length   interface{} `json:"length"`
+		Offset   interface{} `json:"offset"`
+		Filename string      `json:"filename"`
+	}
+	if err := json.Unmarshal([]byte(vals[2]), &j); err != nil {
+		return nil, ErrCDX
+	}
+	cdx := &CDX{SURT: vals[0], URL: j.URL, MIME: j.MIME, Status: jsonString(j.Status), Digest: j.Digest, Redirect: j.Redirect, Filename: j.Filename}
+	var err error
+	if cdx.Date, err = parseCDXDate(vals[1]); err != nil {
+		return nil, ErrCDX
+	}
+	for _, v := range []struct {
+		dst *int64
+		val interface{}
+	}{{&cdx.Length, j.Length}, {&cdx.Offset, j.Offset}} {
+		if s := jsonString(v.val); s != "" {
+			if *v.dst, err = strconv.ParseInt(s, 10, 64); err != nil {
+				return nil, ErrCDX
+			}
+		}
+	}
+	return cdx, nil
+}
+
+// CDXIndex is a CDX index sorted for looking up the captures of URLs: by SURT and then date.
+type CDXIndex []*CDX
+
+// NewCDXIndex sorts entries, for example from Index or a CDXReader, into a CDXIndex. The entries are sorted in place.
+// Entries with the same SURT and date keep their order.
+func NewCDXIndex(entries []*CDX) CDXIndex {
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].SURT != entries[j].SURT {
+			return entries[i].SURT < entries[j].SURT
+		}
+		return entries[i].Date.Before(entries[j].Date)
+	})
+	return CDXIndex(entries)
+}
+
+// ReadCDXIndex reads the CDX or CDXJ index in r (see NewCDXReader) into a CDXIndex.
+func ReadCDXIndex(r io.Reader) (CDXIndex, error) {
+	rdr := NewCDXReader(r)
+	var entries []*CDX
+	for {
+		c, err := rdr.Next()
+		if err != nil {
+			if err == io.EOF {
+				return NewCDXIndex(entries), nil
+			}
+			return nil, err
+		}
+		entries = append(entries, c)
+	}
+}
+
+// Captures returns every capture of a URL in the index, oldest first: the history of a page. URLs are matched by
+// their canonical form (see Canonical), so variations such as "http://www.example.com/" and "https://example.com" are
+// the same URL.
+func (ix CDXIndex) Captures(u string) []*CDX {
+	return ix.lookup(canonical(u), false)
+}
+
+// CapturesSURT returns the captures of every URL whose SURT begins with prefix e.g. "com,example)/blog" for the
+// pages below http://example.com/blog, or "com,example" for those of example.com and its subdomains. Captures are
+// sorted by SURT and then date.
+func (ix CDXIndex) CapturesSURT(prefix string) []*CDX {
+	return ix.lookup(prefix, true)
+}
+
+// lookup returns the entries with the SURT key, or beginning with it if prefix is set
+func (ix CDXIndex) lookup(key string, prefix bool) []*CDX {
+	i := sort.Search(len(ix), func(i int) bool { return ix[i].SURT >= key })
+	j := i
+	for ; j < len(ix); j++ {
+		s := ix[j].SURT
+		if s != key && (!prefix || !strings.HasPrefix(s, key)) {
+			break
+		}
+	}
+	return ix[i:j]
+}
+
+// CDXJ writers give numbers either as JSON strings or numbers
+func jsonString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return ""
+}
+
+// CDXHeader is the header line for CDX files written in the 11 field format used by String.
+const CDXHeader = " CDX N b a m s k r M S V g"
+
+// String formats the CDX entry as a line (without newline) in the 11 field format. Empty fields are given as "-".
+func (c *CDX) String() string {
+	vals := []string{
+		c.SURT,
+		c.Date.Format(ARCTime),
+		c.URL,
+		c.MIME,
+		c.Status,
+		c.Digest,
+		c.Redirect,
+		c.Meta,
+		strconv.FormatInt(c.Length, 10),
+		strconv.FormatInt(c.Offset, 10),
+		c.Filename,
+	}
+	for i, v := range vals {
+		if v == "" {
+			vals[i] = "-"
+		} else {
+			vals[i] = strings.Replace(v, " ", "%20", -1)
+		}
+	}
+	return strings.Join(vals, " ")
+}
+
+// CDXJ formats the CDX entry as a CDXJ line (without newline): SURT, date and a JSON block of the remaining fields.
+// See https://pywb.readthedocs.io/en/latest/manual/indexing.html#cdxj-format
+func (c *CDX) CDXJ() string {
+	j := struct {
+		URL      string `json:"url"`
+		MIME     string `json:"mime,omitempty"`
+		Status   string `json:"status,omitempty"`
+		Digest   string `json:"digest,omitempty"`
+		Redirect string `json:"redirect,omitempty"`
+		Length   string `json:"length"`
+		Offset   string `json:"offset"`
+		Filename string `json:"filename,omitempty"`
+	}{c.URL, c.MIME, c.Status, c.Digest, c.Redirect, strconv.FormatInt(c.Length, 10), strconv.FormatInt(c.Offset, 10), c.Filename}
+	buf := &bytes.Buffer{}
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(j)
+	return c.SURT + " " + c.Date.Format(ARCTime) + " " + strings.TrimSpace(buf.String())
+}
+
+// CDX dates are 14 digit timestamps, but may be truncated
+func parseCDXDate(s string) (time.Time, error) {
+	if len(s) < len(ARCTime) {
+		s += "00000101000000"[len(s):]
+	}
+	return time.Parse(ARCTime, s[:len(ARCTime)])
+}
@@ -0,0 +1,56 @@
+package webarchive
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestCDX(t *testing.T) {
+	checkExamples(t)
+	f, _ := os.Open("examples/hello-world.cdx")
+	defer f.Close()
+	rdr := NewCDXReader(f)
+	var cdxs []*CDX
+	for {
+		c, err := rdr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		cdxs = append(cdxs, c)
+	}
+	if len(cdxs) != 3 {
+		t.Fatalf("expecting 3 CDX lines, got %d", len(cdxs))
+	}
+	c := cdxs[0]
+	if c.URL != "0-0-0checkmate.com:80/Bugs/Bug_Investigators.html" || c.Digest != "a725a64ad6bb7112c55ed26c9e4cef63" ||
+		c.Date.Format(ARCTime) != "20010424210551" || c.Filename != "DE_crawl6.20010424210458" || c.Offset != 17130110 {
+		t.Errorf("bad CDX parse: %+v", c)
+	}
+}
+
+func TestCDXIndex(t *testing.T) {
+	ix, err := ReadCDXIndex(strings.NewReader(` CDX N b a m s k r M S V g
+com,example)/b 20200102000000 http://example.com/b text/html 200 BBBB - - 10 100 a.warc
+com,example)/ 20200103000000 http://example.com/ text/html 200 CCCC - - 10 200 a.warc
+com,example)/ 20200101000000 https://www.example.com/ text/html 200 AAAA - - 10 0 a.warc
+org,example)/ 20200101000000 http://example.org/ text/html 200 DDDD - - 10 300 a.warc
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	caps := ix.Captures("http://example.com")
+	if len(caps) != 2 || caps[0].Digest != "AAAA" || caps[1].Offset != 200 {
+		t.Errorf("bad captures: %v", caps)
+	}
+	if caps = ix.CapturesSURT("com,example)"); len(caps) != 3 || caps[2].Digest != "BBBB" {
+		t.Errorf("bad SURT prefix captures: %v", caps)
+	}
+	if caps = ix.Captures("http://example.net/"); len(caps) != 0 {
+		t.Errorf("expecting no captures, got %v", caps)
+	}
+}
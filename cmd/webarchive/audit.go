@@ -0,0 +1,94 @@
+// Copyright 2015 Richard Lehane. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/richardlehane/webarchive"
+)
+
+func audit(args []string) error {
+	fs := newFlagSet("audit", "-index file file|directory...")
+	indexName := fs.String("index", "", "CDX or CDXJ index of the files")
+	quiet := fs.Bool("q", false, "only print files with discrepancies")
+	fs.Parse(args)
+	if fs.NArg() == 0 || *indexName == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+	index, err := readIndex(*indexName)
+	if err != nil {
+		return err
+	}
+	files, err := warcFiles(fs.Args())
+	if err != nil {
+		return err
+	}
+	var code exitError
+	for _, name := range files {
+		findings, err := auditFile(name, index)
+		for _, fd := range findings {
+			fmt.Printf("%s: %v\n", name, fd)
+		}
+		switch {
+		case err != nil:
+			fmt.Printf("%s: %v\n", name, err)
+			code = exitUnreadable
+		case len(findings) > 0:
+			if code == 0 {
+				code = exitInvalid
+			}
+		case !*quiet:
+			fmt.Printf("%s: OK\n", name)
+		}
+	}
+	if code != 0 {
+		return code
+	}
+	return nil
+}
+
+func readIndex(name string) ([]*webarchive.CDX, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var index []*webarchive.CDX
+	rdr := webarchive.NewCDXReader(f)
+	for {
+		c, err := rdr.Next()
+		if err == io.EOF {
+			return index, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		index = append(index, c)
+	}
+}
+
+func auditFile(name string, index []*webarchive.CDX) ([]webarchive.Finding, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return webarchive.Audit(f, filepath.Base(name), index)
+}
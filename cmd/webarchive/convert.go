@@ -0,0 +1,126 @@
+// Copyright 2015 Richard Lehane. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/richardlehane/webarchive"
+)
+
+// a converter reads one format and writes another
+type converter func(w io.Writer, r io.Reader) error
+
+func convert(args []string) error {
+	fs := newFlagSet("convert", "file")
+	to := fs.String("to", "warc", "output format: warc, warc.gz, wet, wet.gz, wat or wat.gz")
+	out := fs.String("o", "", "file to write the output to; written to stdout if not given")
+	level := fs.Int("level", gzip.DefaultCompression, "gzip compression level for .gz outputs")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	name := fs.Arg(0)
+	format := strings.TrimSuffix(*to, ".gz")
+	var chain []converter
+	switch lower := strings.ToLower(name); {
+	case strings.HasSuffix(lower, ".har"):
+		chain = append(chain, count("entries", webarchive.HARToWARC))
+	case strings.HasSuffix(lower, ".mhtml") || strings.HasSuffix(lower, ".mht"):
+		chain = append(chain, count("parts", webarchive.MHTMLToWARC))
+	case strings.HasSuffix(lower, ".webarchive"):
+		chain = append(chain, count("resources", webarchive.SafariToWARC))
+	case strings.HasSuffix(lower, ".arc") || strings.HasSuffix(lower, ".arc.gz"):
+		chain = append(chain, count("documents", webarchive.ARCToWARC))
+	}
+	switch format {
+	case "warc":
+	case "wet":
+		chain = append(chain, count("conversion records", webarchive.WARCToWET))
+	case "wat":
+		chain = append(chain, count("metadata records", func(w io.Writer, r io.Reader) (int, error) {
+			return webarchive.WARCToWAT(w, r, name)
+		}))
+	default:
+		fs.Usage()
+		os.Exit(2)
+	}
+	compression := webarchive.NoCompression
+	if strings.HasSuffix(*to, ".gz") {
+		compression = webarchive.GzipCompression
+	}
+	// always finish with a recompress: it writes the requested compression and checks digests
+	chain = append(chain, count("records", func(w io.Writer, r io.Reader) (int, error) {
+		return webarchive.Recompress(w, r, compression, *level)
+	}))
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w, finish, err := createOutput(*out)
+	if err != nil {
+		return err
+	}
+	return finish(pipeline(w, f, chain))
+}
+
+// count adapts a library conversion to a converter that reports the number of items converted on stderr
+func count(what string, fn func(io.Writer, io.Reader) (int, error)) converter {
+	return func(w io.Writer, r io.Reader) error {
+		n, err := fn(w, r)
+		if err == nil {
+			fmt.Fprintf(os.Stderr, "%d %s\n", n, what)
+		}
+		return err
+	}
+}
+
+// pipeline runs the converters concurrently, connected by pipes, from r to w
+func pipeline(w io.Writer, r io.Reader, chain []converter) error {
+	errs := make(chan error, len(chain)-1)
+	for _, c := range chain[:len(chain)-1] {
+		pr, pw := io.Pipe()
+		go func(c converter, src io.Reader) {
+			err := c(pw, src)
+			closePipe(src, err) // unblock the upstream converter if this one stopped early
+			pw.CloseWithError(err)
+			errs <- err
+		}(c, r)
+		r = pr
+	}
+	err := chain[len(chain)-1](w, r)
+	closePipe(r, err)
+	for range chain[:len(chain)-1] {
+		if e := <-errs; err == nil && e != nil {
+			err = e
+		}
+	}
+	return err
+}
+
+func closePipe(r io.Reader, err error) {
+	if pr, ok := r.(*io.PipeReader); ok {
+		if err == nil {
+			err = io.ErrClosedPipe
+		}
+		pr.CloseWithError(err)
+	}
+}
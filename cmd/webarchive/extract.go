@@ -0,0 +1,102 @@
+// Copyright 2015 Richard Lehane. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/richardlehane/webarchive"
+)
+
+func extract(args []string) error {
+	fs := newFlagSet("extract", "file...")
+	urls := fs.String("url", "", "comma-separated URLs of payloads to extract")
+	ids := fs.String("id", "", "comma-separated WARC-Record-IDs of payloads to extract")
+	out := fs.String("o", "", "directory to write payloads to; payloads are written to stdout if not given")
+	raw := fs.Bool("raw", false, "don't decode content and transfer encodings")
+	fs.Parse(args)
+	if fs.NArg() == 0 || (*urls == "" && *ids == "") {
+		fs.Usage()
+		os.Exit(2)
+	}
+	want := make(map[string]bool)
+	for _, v := range split(*urls) {
+		want[v] = true
+	}
+	for _, v := range split(*ids) {
+		want[strings.ToLower(strings.Trim(v, "<>"))] = true
+	}
+	names := make(map[string]int) // to avoid overwriting payloads that map to the same file name
+	return each(fs.Args(), true, func(_ string, rec webarchive.Record) error {
+		id := strings.ToLower(strings.Trim(rec.ID(), "<>"))
+		if !want[rec.URL()] && (id == "" || !want[id]) {
+			return nil
+		}
+		var rdr io.Reader = rec
+		if !*raw {
+			rdr = webarchive.DecodePayload(rec)
+		}
+		if *out == "" {
+			_, err := io.Copy(os.Stdout, rdr)
+			return err
+		}
+		name := fileName(rec.URL(), id)
+		if n := names[name]; n > 0 {
+			ext := filepath.Ext(name)
+			names[name]++
+			name = fmt.Sprintf("%s-%d%s", strings.TrimSuffix(name, ext), n, ext)
+		} else {
+			names[name] = 1
+		}
+		f, err := os.Create(filepath.Join(*out, name))
+		if err != nil {
+			return err
+		}
+		if _, err = io.Copy(f, rdr); err != nil {
+			f.Close()
+			return err
+		}
+		fmt.Fprintln(os.Stderr, name)
+		return f.Close()
+	})
+}
+
+var unsafeChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// fileName derives a safe file name for a payload from its URL, falling back to its record ID
+func fileName(u, id string) string {
+	var name string
+	if p, err := url.Parse(u); err == nil {
+		name = p.Host
+		if base := path.Base(p.Path); base != "/" && base != "." {
+			name += "_" + base
+		}
+	}
+	name = unsafeChars.ReplaceAllString(name, "_")
+	if strings.Trim(name, "_.") == "" {
+		name = unsafeChars.ReplaceAllString(id, "_")
+	}
+	if name == "" {
+		name = "payload"
+	}
+	return name
+}
@@ -0,0 +1,122 @@
+// Copyright 2015 Richard Lehane. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/richardlehane/webarchive"
+)
+
+func grep(args []string) error {
+	fs := newFlagSet("grep", "pattern file|directory...")
+	insensitive := fs.Bool("i", false, "case insensitive match")
+	mimes := fs.String("mime", "", "comma-separated MIME type prefixes of payloads to search e.g. text/,application/json")
+	urlPattern := fs.String("url", "", "only search payloads with URLs matching this regular expression")
+	count := fs.Bool("c", false, "print the number of matches in each matching payload")
+	raw := fs.Bool("raw", false, "search payloads without decoding content and transfer encodings")
+	workers := fs.Int("j", runtime.NumCPU(), "number of files to search in parallel")
+	fs.Parse(args)
+	if fs.NArg() < 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	pattern := fs.Arg(0)
+	if *insensitive {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return err
+	}
+	var urlRe *regexp.Regexp
+	if *urlPattern != "" {
+		if urlRe, err = regexp.Compile(*urlPattern); err != nil {
+			return err
+		}
+	}
+	files, err := warcFiles(fs.Args()[1:])
+	if err != nil {
+		return err
+	}
+	prefixes := split(*mimes)
+	var mu sync.Mutex
+	return parallel(files, *workers, func(name string) error {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out := &bytes.Buffer{} // results for a file are printed together
+		defer func() {
+			mu.Lock()
+			os.Stdout.Write(out.Bytes())
+			mu.Unlock()
+		}()
+		return webarchive.ScanPayloads(f, func(rec webarchive.Record, offset int64) error {
+			if urlRe != nil && !urlRe.MatchString(rec.URL()) {
+				return nil
+			}
+			if len(prefixes) > 0 && !hasPrefix(payloadMIME(rec), prefixes) {
+				return nil
+			}
+			var rdr io.Reader = rec
+			if !*raw {
+				rdr = webarchive.DecodePayload(rec)
+			}
+			payload, err := ioutil.ReadAll(rdr)
+			if err != nil {
+				return err
+			}
+			if *count {
+				if n := len(re.FindAllIndex(payload, -1)); n > 0 {
+					fmt.Fprintf(out, "%s\t%d\t%s\t%d\n", name, offset, rec.URL(), n)
+				}
+			} else if re.Match(payload) {
+				fmt.Fprintf(out, "%s\t%d\t%s\n", name, offset, rec.URL())
+			}
+			return nil
+		})
+	})
+}
+
+// payloadMIME is the media type of a payload: from its HTTP headers if it has them, otherwise from its record
+func payloadMIME(rec webarchive.Record) string {
+	ct := rec.Fields().Get("Content-Type")
+	if values := rec.Fields()["Content-Type"]; len(values) > 1 {
+		ct = values[len(values)-1] // the HTTP Content-Type follows the WARC one
+	}
+	if i := strings.IndexByte(ct, ';'); i > -1 {
+		ct = ct[:i]
+	}
+	return strings.ToLower(strings.TrimSpace(ct))
+}
+
+func hasPrefix(s string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,169 @@
+// Copyright 2015 Richard Lehane. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/richardlehane/webarchive"
+)
+
+func index(args []string) error {
+	fs := newFlagSet("index", "file|directory...")
+	format := fs.String("format", "cdx", "index format: cdx or cdxj")
+	out := fs.String("o", "", "file to write the index to; written to stdout if not given")
+	zipnum := fs.Int("zipnum", 0, "write a ZipNum index with this many lines per gzip block, and a summary file, to the -o file")
+	workers := fs.Int("j", runtime.NumCPU(), "number of files to index in parallel")
+	fs.Parse(args)
+	if fs.NArg() == 0 || (*format != "cdx" && *format != "cdxj") || (*zipnum > 0 && *out == "") {
+		fs.Usage()
+		os.Exit(2)
+	}
+	files, err := warcFiles(fs.Args())
+	if err != nil {
+		return err
+	}
+	lines, err := indexFiles(files, *format, *workers)
+	if err != nil {
+		return err
+	}
+	sort.Strings(lines)
+	if *format == "cdx" {
+		lines = append([]string{webarchive.CDXHeader}, lines...)
+	}
+	if *zipnum > 0 {
+		return writeZipNum(*out, lines, *zipnum)
+	}
+	w, finish, err := createOutput(*out)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	for _, l := range lines {
+		bw.WriteString(l)
+		bw.WriteByte('\n')
+	}
+	return finish(bw.Flush())
+}
+
+// indexFiles indexes files in parallel, returning unsorted index lines in the given format
+func indexFiles(files []string, format string, workers int) ([]string, error) {
+	var (
+		mu    sync.Mutex
+		lines []string
+	)
+	err := parallel(files, workers, func(name string) error {
+		l, err := indexFile(name, format)
+		mu.Lock()
+		lines = append(lines, l...)
+		mu.Unlock()
+		return err
+	})
+	return lines, err
+}
+
+func indexFile(name, format string) ([]string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	entries, err := webarchive.Index(f, filepath.Base(name))
+	if err != nil {
+		return nil, err
+	}
+	lines := make([]string, len(entries))
+	for i, c := range entries {
+		if format == "cdxj" {
+			lines[i] = c.CDXJ()
+		} else {
+			lines[i] = c.String()
+		}
+	}
+	return lines, nil
+}
+
+// writeZipNum writes sorted lines to name in gzip blocks of n lines, along with a summary file (name with a .idx extension)
+// giving the first key, offset and length of each block.
+func writeZipNum(name string, lines []string, n int) error {
+	if len(lines) > 0 && strings.HasPrefix(lines[0], " CDX ") {
+		lines = lines[1:] // ZipNum blocks don't have a header line
+	}
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	base := strings.TrimSuffix(filepath.Base(name), ".gz")
+	base = strings.TrimSuffix(strings.TrimSuffix(base, ".cdx"), ".cdxj")
+	summary, err := os.Create(strings.TrimSuffix(strings.TrimSuffix(name, ".gz"), filepath.Ext(strings.TrimSuffix(name, ".gz"))) + ".idx")
+	if err != nil {
+		return err
+	}
+	defer summary.Close()
+	cw := &countWriter{w: f}
+	zw := gzip.NewWriter(cw)
+	for i := 0; i < len(lines); i += n {
+		end := i + n
+		if end > len(lines) {
+			end = len(lines)
+		}
+		off := cw.n
+		zw.Reset(cw)
+		for _, l := range lines[i:end] {
+			io.WriteString(zw, l+"\n")
+		}
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(summary, "%s\t%s\t%d\t%d\t%d\n", zipNumKey(lines[i]), base, off, cw.n-off, i/n+1); err != nil {
+			return err
+		}
+	}
+	// an index is only complete once both files have been flushed by closing them
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return summary.Close()
+}
+
+// zipNumKey is the SURT and timestamp that begin an index line
+func zipNumKey(line string) string {
+	parts := strings.SplitN(line, " ", 3)
+	if len(parts) < 2 {
+		return line
+	}
+	return parts[0] + " " + parts[1]
+}
+
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
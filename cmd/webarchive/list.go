@@ -0,0 +1,90 @@
+// Copyright 2015 Richard Lehane. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/richardlehane/webarchive"
+)
+
+// listing is the metadata printed for a record by the list command
+type listing struct {
+	File string `json:"file,omitempty"`
+	Type string `json:"type,omitempty"`
+	ID   string `json:"id,omitempty"`
+	Date string `json:"date"`
+	MIME string `json:"mime,omitempty"`
+	Size int64  `json:"size"`
+	URL  string `json:"url,omitempty"`
+}
+
+func newListing(file string, rec webarchive.Record) listing {
+	return listing{
+		File: file,
+		Type: rec.Type(),
+		ID:   rec.ID(),
+		Date: webarchive.FormatWARCDate(rec.Date()),
+		MIME: rec.MIME(),
+		Size: rec.Size(),
+		URL:  rec.URL(),
+	}
+}
+
+func list(args []string) error {
+	fs := newFlagSet("list", "file...")
+	asJSON := fs.Bool("json", false, "print a JSON object per record")
+	payloads := fs.Bool("payloads", false, "list only response and resource records")
+	files := fs.Bool("files", false, "include the file name in each line")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		return each(fs.Args(), *payloads, func(name string, rec webarchive.Record) error {
+			l := newListing(name, rec)
+			if !*files {
+				l.File = ""
+			}
+			return enc.Encode(l)
+		})
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 1, ' ', 0)
+	err := each(fs.Args(), *payloads, func(name string, rec webarchive.Record) error {
+		l := newListing(name, rec)
+		if *files {
+			fmt.Fprintf(tw, "%s\t", l.File)
+		}
+		_, err := fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%s\n", dash(l.Type), dash(l.ID), l.Date, dash(l.MIME), l.Size, l.URL)
+		return err
+	})
+	if ferr := tw.Flush(); err == nil {
+		err = ferr
+	}
+	return err
+}
+
+// dash substitutes a "-" for empty columns so that lines have a fixed number of fields
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
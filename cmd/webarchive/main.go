@@ -0,0 +1,217 @@
+// Copyright 2015 Richard Lehane. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Webarchive is a command line tool for inspecting and working with WARC and ARC files.
+//
+// Usage:
+//
+//	webarchive <command> [flags] file...
+//
+// Commands:
+//
+//	list      print a line of metadata for each record
+//	extract   write record payloads, selected by URL or record ID, to files or stdout
+//	validate  check WARC files for conformance and digest mismatches
+//	index     write a CDX or CDXJ index (optionally ZipNum) of WARC files
+//	convert   convert ARC, HAR, MHTML, Safari and WARC files to WARC, WET or WAT files
+//	serve     replay the captures in WARC files over HTTP, with a CDX API
+//	grep      print the URLs and offsets of payloads that match a regular expression
+//	manifest  write a fixity manifest of a WARC file, or check a WARC file against one
+//	audit     cross-check a CDX or CDXJ index against the WARC files it describes
+//
+// Use `webarchive <command> -h` for the flags accepted by a command.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/richardlehane/webarchive"
+)
+
+type command struct {
+	usage string
+	run   func(args []string) error
+}
+
+var commands = map[string]command{
+	"list":     {"print a line of metadata for each record", list},
+	"extract":  {"write record payloads, selected by URL or record ID, to files or stdout", extract},
+	"validate": {"check WARC files for conformance and digest mismatches", validate},
+	"index":    {"write a CDX or CDXJ index (optionally ZipNum) of WARC files", index},
+	"convert":  {"convert ARC, HAR, MHTML, Safari and WARC files to WARC, WET or WAT files", convert},
+	"serve":    {"replay the captures in WARC files over HTTP, with a CDX API", serve},
+	"grep":     {"print the URLs and offsets of payloads that match a regular expression", grep},
+	"manifest": {"write a fixity manifest of a WARC file, or check a WARC file against one", manifest},
+	"audit":    {"cross-check a CDX or CDXJ index against the WARC files it describes", audit},
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: webarchive <command> [flags] file...")
+	fmt.Fprintln(os.Stderr, "commands:")
+	names := make([]string, 0, len(commands))
+	for k := range commands {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", k, commands[k].usage)
+	}
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+	if err := cmd.run(os.Args[2:]); err != nil {
+		if code, ok := err.(exitError); ok {
+			os.Exit(int(code))
+		}
+		fmt.Fprintln(os.Stderr, "webarchive:", err)
+		os.Exit(1)
+	}
+}
+
+// newFlagSet returns a flag set for the named command
+func newFlagSet(name, args string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: webarchive %s [flags] %s\n", name, args)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// each opens the named files in turn and calls fn for every record.
+// If payloads is true, only response and resource records are given, with continuations
+// merged and HTTP headers stripped.
+func each(names []string, payloads bool, fn func(name string, rec webarchive.Record) error) error {
+	var rdr webarchive.Reader
+	for _, name := range names {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		if rdr == nil {
+			rdr, err = webarchive.NewReader(f)
+		} else {
+			err = rdr.Reset(f)
+		}
+		if err != nil {
+			f.Close()
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		for {
+			var rec webarchive.Record
+			if payloads {
+				rec, err = rdr.NextPayload()
+			} else {
+				rec, err = rdr.Next()
+			}
+			if err != nil {
+				break
+			}
+			if err = fn(name, rec); err != nil {
+				break
+			}
+		}
+		f.Close()
+		if err != nil && err != io.EOF {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+	}
+	if rdr != nil {
+		return rdr.Close()
+	}
+	return nil
+}
+
+// parallel calls fn for each of the files, running up to workers calls at once.
+// Errors are collected and returned together, prefixed by file name.
+func parallel(files []string, workers int, fn func(name string) error) error {
+	if workers < 1 {
+		workers = 1
+	}
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []string
+	)
+	jobs := make(chan string)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for name := range jobs {
+				if err := fn(name); err != nil {
+					mu.Lock()
+					errs = append(errs, fmt.Sprintf("%s: %v", name, err))
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for _, name := range files {
+		jobs <- name
+	}
+	close(jobs)
+	wg.Wait()
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// createOutput returns a writer for the named output file, or stdout if name is empty. The file is written
+// atomically: it only appears under name if finish is called with a nil error, and finish returns the first error.
+func createOutput(name string) (w io.Writer, finish func(error) error, err error) {
+	if name == "" {
+		return os.Stdout, func(err error) error { return err }, nil
+	}
+	f, err := webarchive.CreateAtomic(name, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, func(err error) error {
+		if err != nil {
+			f.Abort()
+			return err
+		}
+		return f.Close()
+	}, nil
+}
+
+// split returns the non-empty comma-separated values in s
+func split(s string) []string {
+	var ret []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			ret = append(ret, v)
+		}
+	}
+	return ret
+}
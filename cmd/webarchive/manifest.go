@@ -0,0 +1,78 @@
+// Copyright 2015 Richard Lehane. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/richardlehane/webarchive"
+)
+
+func manifest(args []string) error {
+	fs := newFlagSet("manifest", "file")
+	alg := fs.String("alg", "sha256", "digest algorithm for new manifests")
+	out := fs.String("o", "", "file to write the manifest to; written to stdout if not given")
+	verify := fs.String("verify", "", "check the file against this manifest instead of writing one")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if *verify != "" {
+		return verifyManifest(f, fs.Arg(0), *verify)
+	}
+	entries, err := webarchive.Manifest(f, *alg)
+	if err != nil {
+		return err
+	}
+	w, finish, err := createOutput(*out)
+	if err != nil {
+		return err
+	}
+	return finish(webarchive.WriteManifest(w, entries))
+}
+
+// verifyManifest prints the findings for an archive that doesn't match its manifest, returning the same
+// exit codes as validate
+func verifyManifest(f *os.File, name, manifestName string) error {
+	mf, err := os.Open(manifestName)
+	if err != nil {
+		return err
+	}
+	entries, err := webarchive.ReadManifest(mf)
+	mf.Close()
+	if err != nil {
+		return err
+	}
+	findings, err := webarchive.VerifyManifest(f, entries)
+	for _, fd := range findings {
+		fmt.Printf("%s: %v\n", name, fd)
+	}
+	switch {
+	case err != nil:
+		fmt.Printf("%s: %v\n", name, err)
+		return exitError(exitUnreadable)
+	case len(findings) > 0:
+		return exitError(exitInvalid)
+	}
+	fmt.Printf("%s: OK\n", name)
+	return nil
+}
@@ -0,0 +1,43 @@
+// Copyright 2015 Richard Lehane. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/richardlehane/webarchive"
+)
+
+func serve(args []string) error {
+	fs := newFlagSet("serve", "file|directory...")
+	addr := fs.String("addr", "localhost:8080", "address to listen on")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	files, err := warcFiles(fs.Args())
+	if err != nil {
+		return err
+	}
+	rp, err := webarchive.NewReplay(files...)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "serving %d files at http://%s/\n", len(files), *addr)
+	return http.ListenAndServe(*addr, rp)
+}
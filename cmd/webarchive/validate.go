@@ -0,0 +1,160 @@
+// Copyright 2015 Richard Lehane. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/richardlehane/webarchive"
+)
+
+// exit codes returned by validate
+const (
+	exitInvalid    = 1 // findings were reported for at least one file
+	exitUnreadable = 3 // at least one file couldn't be read to the end
+)
+
+// exitError ends the program with the given exit code, without further message
+type exitError int
+
+func (e exitError) Error() string { return fmt.Sprintf("exit status %d", int(e)) }
+
+type validation struct {
+	File     string    `json:"file"`
+	Valid    bool      `json:"valid"`
+	Error    string    `json:"error,omitempty"`
+	Findings []finding `json:"findings,omitempty"`
+}
+
+type finding struct {
+	Record  int    `json:"record"`
+	ID      string `json:"id,omitempty"`
+	Kind    string `json:"kind"` // "conformance" or "digest"
+	Message string `json:"message"`
+}
+
+func validate(args []string) error {
+	fs := newFlagSet("validate", "file|directory...")
+	digests := fs.Bool("digests", true, "check block and payload digests")
+	asJSON := fs.Bool("json", false, "print a JSON report per file")
+	quiet := fs.Bool("q", false, "only print files that aren't valid")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	files, err := warcFiles(fs.Args())
+	if err != nil {
+		return err
+	}
+	v := webarchive.Validator{Digests: *digests}
+	enc := json.NewEncoder(os.Stdout)
+	var code exitError
+	for _, name := range files {
+		res := validateFile(v, name)
+		switch {
+		case res.Error != "":
+			code = exitUnreadable
+		case !res.Valid && code == 0:
+			code = exitInvalid
+		}
+		if *asJSON {
+			if err := enc.Encode(res); err != nil {
+				return err
+			}
+			continue
+		}
+		if res.Valid {
+			if !*quiet {
+				fmt.Printf("%s: OK\n", name)
+			}
+			continue
+		}
+		for _, f := range res.Findings {
+			if f.ID != "" {
+				fmt.Printf("%s: record %d %s: %s\n", name, f.Record, f.ID, f.Message)
+			} else {
+				fmt.Printf("%s: record %d: %s\n", name, f.Record, f.Message)
+			}
+		}
+		if res.Error != "" {
+			fmt.Printf("%s: %s\n", name, res.Error)
+		}
+	}
+	if code != 0 {
+		return code
+	}
+	return nil
+}
+
+func validateFile(v webarchive.Validator, name string) validation {
+	res := validation{File: name}
+	f, err := os.Open(name)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	defer f.Close()
+	findings, err := v.Validate(f)
+	if err != nil {
+		res.Error = err.Error()
+	}
+	for _, fd := range findings {
+		kind := "conformance"
+		if errors.Is(fd, webarchive.ErrDigestMatch) {
+			kind = "digest"
+		}
+		msg := fd.Err.Error()
+		for _, e := range []error{webarchive.ErrConformance, webarchive.ErrDigestMatch} {
+			msg = strings.TrimPrefix(msg, e.Error()+": ")
+		}
+		res.Findings = append(res.Findings, finding{Record: fd.Record, ID: fd.ID, Kind: kind, Message: msg})
+	}
+	res.Valid = err == nil && len(findings) == 0
+	return res
+}
+
+// warcFiles expands any directories in names to the WARC files they contain
+func warcFiles(names []string) ([]string, error) {
+	var files []string
+	for _, name := range names {
+		info, err := os.Stat(name)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, name)
+			continue
+		}
+		err = filepath.Walk(name, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() && (strings.HasSuffix(path, ".warc") || strings.HasSuffix(path, ".warc.gz")) {
+				files = append(files, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
@@ -0,0 +1,194 @@
+// Copyright 2015 Richard Lehane. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webarchive
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FileError is an error reading one of the files of a Collection.
+type FileError struct {
+	Path string
+	Err  error
+}
+
+func (e *FileError) Error() string { return e.Path + ": " + e.Err.Error() }
+
+func (e *FileError) Unwrap() error { return e.Err }
+
+// CollectionProgress reports the progress of a Collection, after each of its files has been read.
+type CollectionProgress struct {
+	File    int    // number of files read, including this one
+	Files   int    // number of files in the collection
+	Path    string // path of the file that was read
+	Records int    // number of records read from the file
+	Err     error  // error that stopped the file being read, if any
+}
+
+// Collection iterates the records of many ARC and WARC files as one collection. The files are listed in a manifest,
+// such as the warc.paths files published by Common Crawl, of a path or URL on each line: lines that are blank or begin
+// with "#" are skipped. Files are read in the order listed.
+//
+// Errors are isolated to the file in which they occur: if a file can't be opened or read, the records read from it
+// are kept and the Collection moves on to the next file. The errors are available from Errors.
+//
+// Example:
+//
+//	f, _ := os.Open("warc.paths")
+//	c, _ := webarchive.NewCollection(f)
+//	c.Base = "https://data.commoncrawl.org/"
+//	for rec, err := c.Next(); err == nil; rec, err = c.Next() {
+//		fmt.Println(c.Path(), rec.URL())
+//	}
+type Collection struct {
+	Base     string                                   // directory or URL prefix against which relative paths are resolved
+	Client   *http.Client                             // client used to fetch http and https URLs; http.DefaultClient if nil
+	Open     func(path string) (io.ReadCloser, error) // opens each file, overriding the default of local files and http(s) URLs
+	Options  []Option                                 // options of the reader of each file
+	Progress func(CollectionProgress)                 // called after each file has been read, if not nil
+
+	paths   []string
+	idx     int // index of the next file to open
+	path    string
+	f       io.ReadCloser
+	rdr     Reader
+	records int // records read from the current file
+	errs    []*FileError
+}
+
+// NewCollection reads the manifest in r and returns a Collection of the files listed in it.
+func NewCollection(r io.Reader) (*Collection, error) {
+	var paths []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if l := strings.TrimSpace(scanner.Text()); l != "" && !strings.HasPrefix(l, "#") {
+			paths = append(paths, l)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return &Collection{paths: paths}, nil
+}
+
+// Paths returns the paths of the files of the collection, as listed in its manifest.
+func (c *Collection) Paths() []string { return c.paths }
+
+// Path returns the path of the file of the current record, as listed in the manifest.
+func (c *Collection) Path() string { return c.path }
+
+// Errors returns the errors that stopped files of the collection being read, in the order they occurred.
+func (c *Collection) Errors() []*FileError { return c.errs }
+
+// Next returns the next record of the collection, opening the next file once the current one is exhausted.
+// Returns io.EOF once every file has been read.
+func (c *Collection) Next() (Record, error) {
+	for {
+		if c.rdr != nil {
+			rec, err := c.rdr.Next()
+			if err == nil {
+				c.records++
+				return rec, nil
+			}
+			if err == io.EOF {
+				err = nil
+			}
+			c.finish(err)
+		}
+		if c.idx >= len(c.paths) {
+			return nil, io.EOF
+		}
+		c.path = c.paths[c.idx]
+		c.idx++
+		c.records = 0
+		f, err := c.open(c.path)
+		if err != nil {
+			c.finish(err)
+			continue
+		}
+		c.f = f
+		if c.rdr, err = NewReader(f, c.Options...); err != nil {
+			c.rdr = nil
+			c.finish(err)
+		}
+	}
+}
+
+// Close closes the current file of the collection.
+func (c *Collection) Close() error {
+	if c.rdr != nil {
+		c.rdr.Close()
+		c.rdr = nil
+	}
+	if c.f == nil {
+		return nil
+	}
+	err := c.f.Close()
+	c.f = nil
+	return err
+}
+
+// finish the current file, recording any error and reporting progress
+func (c *Collection) finish(err error) {
+	c.Close()
+	if err != nil {
+		c.errs = append(c.errs, &FileError{Path: c.path, Err: err})
+	}
+	if c.Progress != nil {
+		c.Progress(CollectionProgress{File: c.idx, Files: len(c.paths), Path: c.path, Records: c.records, Err: err})
+	}
+}
+
+// open a file of the collection, resolving relative paths against Base
+func (c *Collection) open(path string) (io.ReadCloser, error) {
+	if c.Base != "" && !isRemote(path) && !filepath.IsAbs(path) {
+		if isRemote(c.Base) {
+			path = strings.TrimSuffix(c.Base, "/") + "/" + strings.TrimPrefix(path, "/")
+		} else {
+			path = filepath.Join(c.Base, path)
+		}
+	}
+	if c.Open != nil {
+		return c.Open(path)
+	}
+	if !isRemote(path) {
+		return os.Open(path)
+	}
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Get(path)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("fetching %s: %s", path, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// isRemote reports whether a path is an http or https URL
+func isRemote(path string) bool {
+	l := strings.ToLower(path)
+	return strings.HasPrefix(l, "http://") || strings.HasPrefix(l, "https://")
+}
@@ -0,0 +1,54 @@
+package webarchive
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestCollection(t *testing.T) {
+	checkExamples(t)
+	srv := httptest.NewServer(http.FileServer(http.Dir("examples")))
+	defer srv.Close()
+	manifest := "# test collection\n" +
+		"hello-world.warc\n\n" +
+		"missing.warc.gz\n" +
+		srv.URL + "/IAH-20080430204825-00000-blackbook.arc\n" +
+		srv.URL + "/missing.arc\n"
+	c, err := NewCollection(strings.NewReader(manifest))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.Paths()) != 4 {
+		t.Fatalf("expecting 4 paths, got %v", c.Paths())
+	}
+	c.Base = "examples"
+	var progress []CollectionProgress
+	c.Progress = func(p CollectionProgress) { progress = append(progress, p) }
+	counts := make(map[string]int)
+	for {
+		_, err := c.Next()
+		if err != nil {
+			if err != io.EOF {
+				t.Fatal(err)
+			}
+			break
+		}
+		counts[c.Path()]++
+	}
+	c.Close()
+	if counts["hello-world.warc"] != 6 || counts[srv.URL+"/IAH-20080430204825-00000-blackbook.arc"] != 299 {
+		t.Errorf("bad record counts: %v", counts)
+	}
+	if len(progress) != 4 || progress[1].File != 2 || progress[1].Files != 4 || progress[2].Records != 299 {
+		t.Errorf("bad progress: %+v", progress)
+	}
+	errs := c.Errors()
+	if len(errs) != 2 || errs[0].Path != "missing.warc.gz" || !errors.Is(errs[0], os.ErrNotExist) || errs[1].Path != srv.URL+"/missing.arc" {
+		t.Errorf("bad errors: %v", errs)
+	}
+}
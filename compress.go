@@ -0,0 +1,87 @@
+// Copyright 2015 Richard Lehane. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webarchive
+
+import (
+	"compress/gzip"
+	"io"
+	"time"
+)
+
+// Compressor compresses gzip members, for writing .warc.gz and .arc.gz files. It can be registered with RegisterGzip
+// to replace compress/gzip, for instance with a faster implementation.
+type Compressor interface {
+	// NewWriter returns a writer of a single gzip member to w, compressed at the given level (as for compress/gzip), and
+	// with modTime in its header (none if zero). The member is ended by closing the writer.
+	NewWriter(w io.Writer, level int, modTime time.Time) (io.WriteCloser, error)
+}
+
+// Decompressor decompresses gzip members, for reading .warc.gz and .arc.gz files. It can be registered with
+// RegisterGzip to replace compress/gzip, for instance with a faster implementation.
+//
+// Parallel decompressors that read ahead of the data they have returned (such as pgzip's Reader) don't meet this
+// contract, as they read past the end of the member, so can't be registered: each member is decompressed serially,
+// and only faster serial implementations will speed up reading. A parallel Compressor can still be registered, with
+// a nil Decompressor. Codecs other than gzip aren't registered here: zstd has its own codec (see RegisterZstd), as
+// its streams are read whole rather than member by member and may need a dictionary.
+type Decompressor interface {
+	// NewReader returns a reader of the single gzip member that begins at r, which is an io.ByteReader. The reader
+	// mustn't read from r beyond the end of the member, so that the next member can be opened where it ends: members
+	// are read one at a time to give the compressed offsets of records (as a gzip.Reader does with Multistream(false)).
+	NewReader(r io.Reader) (io.ReadCloser, error)
+}
+
+var (
+	gzipCompressor   Compressor
+	gzipDecompressor Decompressor
+)
+
+// RegisterGzip sets the Compressor and Decompressor of gzip members, which are otherwise compressed and decompressed
+// with compress/gzip. Either may be nil to restore compress/gzip.
+// RegisterGzip is not safe for concurrent use and is intended to be called from an init function.
+func RegisterGzip(c Compressor, d Decompressor) {
+	gzipCompressor, gzipDecompressor = c, d
+}
+
+// gzipOpener opens successive gzip members with the registered Decompressor or, if there is none, a gzip.Reader
+// that is re-used for each member
+type gzipOpener struct {
+	zr *gzip.Reader
+}
+
+func (g *gzipOpener) open(r io.Reader) (io.ReadCloser, error) {
+	if gzipDecompressor != nil {
+		return gzipDecompressor.NewReader(r)
+	}
+	var err error
+	if g.zr == nil {
+		g.zr, err = gzip.NewReader(r)
+	} else {
+		err = g.zr.Reset(r)
+	}
+	if err != nil {
+		return nil, err
+	}
+	g.zr.Multistream(false)
+	return g.zr, nil
+}
+
+// Close closes the gzip.Reader, if one has been opened.
+func (g *gzipOpener) Close() error {
+	if g.zr == nil {
+		return nil
+	}
+	return g.zr.Close()
+}
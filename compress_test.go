@@ -0,0 +1,61 @@
+package webarchive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// countingGzip wraps compress/gzip, counting the members it compresses and decompresses
+type countingGzip struct {
+	compressed, decompressed int
+}
+
+func (c *countingGzip) NewWriter(w io.Writer, level int, modTime time.Time) (io.WriteCloser, error) {
+	c.compressed++
+	zw, err := gzip.NewWriterLevel(w, level)
+	if err != nil {
+		return nil, err
+	}
+	zw.ModTime = modTime
+	return zw, nil
+}
+
+func (c *countingGzip) NewReader(r io.Reader) (io.ReadCloser, error) {
+	c.decompressed++
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	zr.Multistream(false)
+	return zr, nil
+}
+
+func TestRegisterGzip(t *testing.T) {
+	c := &countingGzip{}
+	RegisterGzip(c, c)
+	defer RegisterGzip(nil, nil)
+	var buf bytes.Buffer
+	ww, _ := NewWARCWriter(&buf, GzipCompression)
+	for _, s := range []string{"one", "two", "three"} {
+		h := NewRecordHeader(TypeResource, "http://example.com/"+s, time.Now())
+		h.Set("Content-Type", "text/plain")
+		if err := ww.WriteRecord(h, strings.NewReader(s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if c.compressed != 3 {
+		t.Fatalf("expecting 3 members compressed by the registered Compressor, got %d", c.compressed)
+	}
+	_, blocks := readAll(t, buf.Bytes())
+	if len(blocks) != 3 || string(blocks[2]) != "three" || c.decompressed != 3 {
+		t.Fatalf("expecting 3 records decompressed by the registered Decompressor, got %d records and %d members", len(blocks), c.decompressed)
+	}
+	var n int
+	if err := ScanOffsets(bytes.NewReader(buf.Bytes()), func(_, _ int64) error { n++; return nil }); err != nil || n != 3 || c.decompressed != 6 {
+		t.Errorf("expecting ScanOffsets to use the registered Decompressor, got %d extents, %d members, %v", n, c.decompressed, err)
+	}
+}
@@ -0,0 +1,253 @@
+// Copyright 2015 Richard Lehane. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webarchive
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// recorded in the warcinfo records of converted files
+const (
+	software     = "webarchive (https://github.com/richardlehane/webarchive)"
+	conformsTo10 = "http://bibnum.bnf.fr/WARC/WARC_ISO_28500_version1_latestdraft.pdf"
+	conformsTo11 = "http://iipc.github.io/warc-specifications/specifications/warc-format/warc-1.1/"
+)
+
+// ARCToWARC reads the ARC file in r and writes it to w as a WARC 1.0 file.
+// The details of the ARC version block are kept in a new warcinfo record. Documents with HTTP headers
+// become response records; others (such as dns: lookups) become resource records. Block and payload
+// digests (sha1) are computed for each record.
+//
+// Returns the number of documents converted.
+func ARCToWARC(w io.Writer, r io.Reader) (int, error) {
+	rdr, err := NewARCReader(r)
+	if err != nil {
+		return 0, err
+	}
+	defer rdr.Close()
+	ww := newWARCWriter(w)
+	info, err := ww.writeWarcinfo("1.0", "", Warcinfo{
+		Software:    software,
+		Format:      "WARC File Format 1.0",
+		ConformsTo:  conformsTo10,
+		Description: "converted from ARC file " + rdr.FileDesc,
+		Operator:    rdr.OriginCode,
+		Extra: RawFields{
+			{Key: "arc-file-date", Value: rdr.FileDate.Format(ARCTime)},
+			{Key: "arc-version", Value: strconv.Itoa(rdr.Version)},
+		},
+	}.Bytes())
+	if err != nil {
+		return 0, err
+	}
+	var n int
+	for {
+		rec, err := rdr.Next()
+		if err != nil {
+			if err == io.EOF {
+				return n, nil
+			}
+			return n, err
+		}
+		block, err := ioutil.ReadAll(rec)
+		if err != nil {
+			return n, err
+		}
+		typ, ct := "resource", rec.MIME()
+		if ct == "" || ct == "no-type" {
+			ct = "application/octet-stream"
+		}
+		hl := httpHeaderLen(block)
+		if hl > 0 && isHTTPResponse(block) {
+			typ, ct = "response", "application/http;msgtype=response"
+		}
+		fields := RawFields{
+			{Key: "WARC-Type", Value: typ},
+			{Key: "WARC-Record-ID", Value: newRecordID()},
+			{Key: "WARC-Date", Value: formatVersionDate("1.0", rec.Date())},
+			{Key: "WARC-Target-URI", Value: rec.URL()},
+		}
+		if ip := rdr.IP(); ip != "" && ip != "0.0.0.0" {
+			fields.Add("WARC-IP-Address", ip)
+		}
+		fields.Add("WARC-Warcinfo-ID", info)
+		fields.Add("Content-Type", ct)
+		fields.Add("WARC-Block-Digest", sha1Digest(block).String())
+		if typ == "response" {
+			fields.Add("WARC-Payload-Digest", sha1Digest(block[hl:]).String())
+		}
+		if err = ww.writeRecord("1.0", fields, bytes.NewReader(block), int64(len(block))); err != nil {
+			return n, err
+		}
+		n++
+	}
+}
+
+// HTTP Archive (HAR) files, as exported by browser developer tools.
+// See http://www.softwareishard.com/blog/har-12-spec/
+type harFile struct {
+	Log struct {
+		Creator struct {
+			Name    string `json:"name"`
+			Version string `json:"version"`
+		} `json:"creator"`
+		Entries []harEntry `json:"entries"`
+	} `json:"log"`
+}
+
+type harEntry struct {
+	Started  string `json:"startedDateTime"`
+	ServerIP string `json:"serverIPAddress"`
+	Request  struct {
+		Method      string        `json:"method"`
+		URL         string        `json:"url"`
+		HTTPVersion string        `json:"httpVersion"`
+		Headers     []headerField `json:"headers"`
+		PostData    *struct {
+			Text string `json:"text"`
+		} `json:"postData"`
+	} `json:"request"`
+	Response struct {
+		Status      int           `json:"status"`
+		StatusText  string        `json:"statusText"`
+		HTTPVersion string        `json:"httpVersion"`
+		Headers     []headerField `json:"headers"`
+		Content     struct {
+			Text     string `json:"text"`
+			Encoding string `json:"encoding"`
+		} `json:"content"`
+	} `json:"response"`
+}
+
+type headerField struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// harVersion gives an HTTP/1.x style version for an HAR httpVersion value (which may be e.g. "h2" or "http/2.0")
+func harVersion(v string) string {
+	v = strings.ToUpper(v)
+	if strings.HasPrefix(v, "HTTP/1.") {
+		return v
+	}
+	if strings.HasPrefix(v, "H2") || strings.HasPrefix(v, "HTTP/2") {
+		return "HTTP/2"
+	}
+	if strings.HasPrefix(v, "H3") || strings.HasPrefix(v, "HTTP/3") {
+		return "HTTP/3"
+	}
+	return "HTTP/1.1"
+}
+
+// httpMessage serialises a start line, headers and body as an HTTP/1.x message. HTTP/2 pseudo-headers are dropped.
+// If fixLength is set, the body is taken to be decoded: any Content-Encoding and Transfer-Encoding headers are
+// dropped and Content-Length is set to the length of the body.
+func httpMessage(start string, headers []headerField, body []byte, fixLength bool) []byte {
+	buf := &bytes.Buffer{}
+	buf.WriteString(start + "\r\n")
+	for _, h := range headers {
+		if strings.HasPrefix(h.Name, ":") {
+			continue
+		}
+		if fixLength {
+			switch strings.ToLower(h.Name) {
+			case "content-encoding", "transfer-encoding", "content-length":
+				continue
+			}
+		}
+		buf.WriteString(h.Name + ": " + h.Value + "\r\n")
+	}
+	if fixLength && len(body) > 0 {
+		buf.WriteString("Content-Length: " + strconv.Itoa(len(body)) + "\r\n")
+	}
+	buf.WriteString("\r\n")
+	buf.Write(body)
+	return buf.Bytes()
+}
+
+// HARToWARC reads the HTTP Archive (HAR) file in r and writes its entries to w as a WARC 1.1 file: a request
+// and response record for each entry, along with a warcinfo record naming the software that made the HAR.
+// Entries with no response (status 0) are skipped.
+//
+// HAR files hold decoded response content, so the Content-Encoding and Transfer-Encoding headers of responses
+// are dropped and their Content-Length is set to match the content.
+//
+// Returns the number of entries converted.
+func HARToWARC(w io.Writer, r io.Reader) (int, error) {
+	var har harFile
+	if err := json.NewDecoder(r).Decode(&har); err != nil {
+		return 0, err
+	}
+	ww := newWARCWriter(w)
+	creator := strings.TrimSpace(har.Log.Creator.Name + " " + har.Log.Creator.Version)
+	info, err := ww.writeWarcinfo("1.1", "", Warcinfo{
+		Software:    software,
+		Format:      "WARC File Format 1.1",
+		ConformsTo:  conformsTo11,
+		Description: "converted from HAR file created by " + creator,
+	}.Bytes())
+	if err != nil {
+		return 0, err
+	}
+	var n int
+	for i, e := range har.Log.Entries {
+		if e.Response.Status == 0 {
+			continue
+		}
+		date, err := ParseWARCDate(e.Started)
+		if err != nil {
+			return n, fmt.Errorf("HAR entry %d: %v", i, err)
+		}
+		u, err := url.Parse(e.Request.URL)
+		if err != nil {
+			return n, fmt.Errorf("HAR entry %d: %v", i, err)
+		}
+		body := []byte(e.Response.Content.Text)
+		if e.Response.Content.Encoding == "base64" {
+			if body, err = base64.StdEncoding.DecodeString(e.Response.Content.Text); err != nil {
+				return n, fmt.Errorf("HAR entry %d: %v", i, err)
+			}
+		}
+		resp := httpMessage(fmt.Sprintf("%s %d %s", harVersion(e.Response.HTTPVersion), e.Response.Status, e.Response.StatusText),
+			e.Response.Headers, body, true)
+		var post []byte
+		if e.Request.PostData != nil {
+			post = []byte(e.Request.PostData.Text)
+		}
+		req := httpMessage(fmt.Sprintf("%s %s %s", e.Request.Method, u.RequestURI(), harVersion(e.Request.HTTPVersion)),
+			e.Request.Headers, post, false)
+		if err = ww.writeExchange("1.1", exchange{
+			uri:      e.Request.URL,
+			date:     date,
+			ip:       strings.Trim(e.ServerIP, "[]"),
+			warcinfo: info,
+			req:      req,
+			resp:     resp,
+			payload:  body,
+		}); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
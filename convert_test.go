@@ -0,0 +1,65 @@
+package webarchive
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestARCToWARC(t *testing.T) {
+	checkExamples(t)
+	f, _ := os.Open("examples/IAH-20080430204825-00000-blackbook.arc")
+	defer f.Close()
+	buf := &bytes.Buffer{}
+	n, err := ARCToWARC(buf, f)
+	if err != nil || n != 299 {
+		t.Fatalf("expecting 299 documents converted, got %d %v", n, err)
+	}
+	findings, err := Validator{Digests: true}.Validate(bytes.NewReader(buf.Bytes()))
+	if err != nil || len(findings) > 0 {
+		t.Fatalf("expecting converted WARC to be valid, got %v %v", findings, err)
+	}
+	recs, _ := readAll(t, buf.Bytes())
+	if recs[0].Get("WARC-Type") != "warcinfo" || recs[1].Get("WARC-Type") != "resource" || recs[1].Get("WARC-Target-URI") != "dns:www.archive.org" ||
+		recs[2].Get("WARC-Type") != "response" || recs[2].Get("WARC-IP-Address") != "207.241.229.39" {
+		t.Errorf("bad conversion: %v %v %v", recs[0], recs[1], recs[2])
+	}
+}
+
+const testHAR = `{"log": {"version": "1.2", "creator": {"name": "Firefox", "version": "99.0"}, "entries": [
+{"startedDateTime": "2022-04-01T10:00:00.123+02:00", "serverIPAddress": "[2001:db8::1]",
+ "request": {"method": "GET", "url": "https://example.com/a?b=c", "httpVersion": "HTTP/2",
+  "headers": [{"name": ":authority", "value": "example.com"}, {"name": "Accept", "value": "*/*"}]},
+ "response": {"status": 200, "statusText": "OK", "httpVersion": "HTTP/2",
+  "headers": [{"name": "content-type", "value": "text/plain"}, {"name": "content-encoding", "value": "gzip"}, {"name": "content-length", "value": "30"}],
+  "content": {"mimeType": "text/plain", "text": "aGVsbG8=", "encoding": "base64"}}},
+{"startedDateTime": "2022-04-01T10:00:01Z", "request": {"method": "GET", "url": "https://example.com/blocked", "httpVersion": "", "headers": []},
+ "response": {"status": 0, "statusText": "", "httpVersion": "", "headers": [], "content": {}}}
+]}}`
+
+func TestHARToWARC(t *testing.T) {
+	buf := &bytes.Buffer{}
+	n, err := HARToWARC(buf, strings.NewReader(testHAR))
+	if err != nil || n != 1 {
+		t.Fatalf("expecting 1 entry converted, got %d %v", n, err)
+	}
+	findings, err := Validator{Digests: true}.Validate(bytes.NewReader(buf.Bytes()))
+	if err != nil || len(findings) > 0 {
+		t.Fatalf("expecting converted WARC to be valid, got %v %v", findings, err)
+	}
+	recs, blocks := readAll(t, buf.Bytes())
+	if len(recs) != 3 {
+		t.Fatalf("expecting warcinfo, response and request records, got %d", len(recs))
+	}
+	if recs[1].Get("WARC-Date") != "2022-04-01T08:00:00.123Z" || recs[1].Get("WARC-IP-Address") != "2001:db8::1" ||
+		recs[2].Get("WARC-Concurrent-To") != recs[1].Get("WARC-Record-ID") {
+		t.Errorf("bad fields: %v %v", recs[1], recs[2])
+	}
+	if string(blocks[1]) != "HTTP/2 200 OK\r\ncontent-type: text/plain\r\nContent-Length: 5\r\n\r\nhello" {
+		t.Errorf("bad response block: %q", blocks[1])
+	}
+	if string(blocks[2]) != "GET /a?b=c HTTP/2\r\nAccept: */*\r\n\r\n" {
+		t.Errorf("bad request block: %q", blocks[2])
+	}
+}
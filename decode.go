@@ -15,17 +15,31 @@
 package webarchive
 
 import (
+	"bufio"
+	"bytes"
 	"compress/gzip"
 	"compress/zlib"
+	"fmt"
 	"io"
+	"io/ioutil"
+	"net/http"
 	"net/http/httputil"
+	"strings"
 )
 
+// gzip member header flags: bits 5-7 are reserved and must be zero
+const gzipReservedFlags = 0xe0
+
+// isgzip reports whether buf begins a gzip member: the magic number, deflate compression method and flags with no
+// reserved bits set. The optional header fields that some writers include (FEXTRA, FNAME, FCOMMENT and FHCRC) follow
+// these first four bytes, and are skipped by gzip.Reader when each member is read.
 func isgzip(buf []byte) bool {
-	if buf[0] != 0x1f || buf[1] != 0x8b || buf[2] != 8 {
-		return false
-	}
-	return true
+	return len(buf) >= 4 && buf[0] == 0x1f && buf[1] == 0x8b && buf[2] == 8 && buf[3]&gzipReservedFlags == 0
+}
+
+// isbzip2 reports whether buf begins a bzip2 stream: the magic number and a block size from 1 to 9
+func isbzip2(buf []byte) bool {
+	return len(buf) >= 4 && buf[0] == 'B' && buf[1] == 'Z' && buf[2] == 'h' && buf[3] >= '1' && buf[3] <= '9'
 }
 
 const zlibDeflate = 8
@@ -98,7 +112,7 @@ func newDecoder(rec Record, encodings []string) Record {
 			}
 		case "gzip":
 			if i == 0 {
-				if peek, err := rec.peek(3); err != nil || !isgzip(peek) {
+				if peek, err := rec.peek(4); err != nil || !isgzip(peek) {
 					return rec
 				}
 			}
@@ -111,6 +125,91 @@ func newDecoder(rec Record, encodings []string) Record {
 	return pd
 }
 
+// httpResponse parses the HTTP headers of the current record, rec, read by r. Headers that haven't been stripped are
+// parsed from a peek at the start of the block, leaving the record as it is; stripped headers are the end of the
+// fields returned by stored.
+func httpResponse(r *reader, rec Record, stored func() []byte) (*http.Response, error) {
+	if !r.http {
+		return nil, ErrHTTPResponse
+	}
+	if r.strip {
+		f := stored()
+		if r.hdrLen < 0 || r.hdrLen > int64(len(f)) {
+			return nil, ErrHTTPResponse
+		}
+		return parseHTTPResponse(rec, f[int64(len(f))-r.hdrLen:], r.sz)
+	}
+	if r.thisIdx > 0 {
+		return nil, fmt.Errorf("%w: the record has been read from", ErrHTTPResponse)
+	}
+	if r.hdrLen < 0 {
+		return nil, fmt.Errorf("%w: HTTP headers longer than %d bytes", ErrHTTPResponse, examineLen)
+	}
+	peek, err := r.peek(int(r.hdrLen))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrHTTPResponse, err)
+	}
+	hdr := append([]byte(nil), peek...)
+	return parseHTTPResponse(&httpBody{Record: rec, hdr: hdr}, hdr, r.sz-r.hdrLen)
+}
+
+// httpBody reads the payload of a record whose HTTP headers, hdr, haven't been stripped from its block.
+// The headers are skipped on the first read.
+type httpBody struct {
+	Record
+	hdr  []byte
+	read bool
+}
+
+func (b *httpBody) Read(p []byte) (int, error) {
+	if !b.read {
+		b.read = true
+		if _, err := io.CopyN(ioutil.Discard, b.Record, int64(len(b.hdr))); err != nil {
+			return 0, err
+		}
+	}
+	return b.Record.Read(p)
+}
+
+func (b *httpBody) Size() int64 { return b.Record.Size() - int64(len(b.hdr)) }
+
+func (b *httpBody) Slice(off int64, l int) ([]byte, error) {
+	return b.Record.Slice(off+int64(len(b.hdr)), l)
+}
+
+func (b *httpBody) peek(i int) ([]byte, error) {
+	buf, err := b.Record.peek(len(b.hdr) + i)
+	if len(buf) < len(b.hdr) {
+		return nil, err
+	}
+	return buf[len(b.hdr):], err
+}
+
+func (b *httpBody) transferEncodings() []string {
+	vals := getSelectValues(b.hdr, "Transfer-Encoding")
+	if vals[0] == "" {
+		return nil
+	}
+	return splitAndReverse(vals[0])
+}
+
+// parseHTTPResponse parses the stripped HTTP header of a record, with a body that reads the record's payload
+func parseHTTPResponse(rec Record, hdr []byte, sz int64) (*http.Response, error) {
+	if !isHTTPResponse(hdr) {
+		return nil, ErrHTTPResponse
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(hdr)), nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrHTTPResponse, err)
+	}
+	resp.Body = ioutil.NopCloser(DecodePayloadT(rec))
+	resp.ContentLength = sz
+	if len(resp.TransferEncoding) > 0 {
+		resp.ContentLength = -1
+	}
+	return resp, nil
+}
+
 // DecodePayload decodes any encodings (transfer or content) declared in a record's HTTP header.
 // Decodes chunked, deflate and gzip encodings.
 func DecodePayload(r Record) Record {
@@ -122,3 +221,46 @@ func DecodePayload(r Record) Record {
 func DecodePayloadT(r Record) Record {
 	return newDecoder(r, r.transferEncodings())
 }
+
+// decodeBytes removes the given encodings, in the order given, from a buffered payload
+func decodeBytes(buf []byte, encodings []string) ([]byte, error) {
+	rdr, err := decodeReader(bytes.NewReader(buf), encodings)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(rdr)
+}
+
+// decodeReader returns a reader that removes the given encodings, in the order given, from the payload read by rdr
+func decodeReader(rdr io.Reader, encodings []string) (io.Reader, error) {
+	for _, v := range encodings {
+		var err error
+		switch v {
+		case "chunked":
+			rdr = httputil.NewChunkedReader(rdr)
+		case "deflate":
+			rdr, err = zlib.NewReader(rdr)
+		case "gzip":
+			rdr, err = gzip.NewReader(rdr)
+		case "identity":
+		default:
+			return nil, fmt.Errorf("webarchive: unsupported encoding %s", v)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return rdr, nil
+}
+
+// httpEncodings returns the transfer and content encodings declared in an HTTP header block, in decoding order
+func httpEncodings(buf []byte) []string {
+	vals := getSelectValues(buf, "Transfer-Encoding", "Content-Encoding")
+	var ret []string
+	for _, v := range vals {
+		if v != "" {
+			ret = append(ret, splitAndReverse(strings.ToLower(v))...)
+		}
+	}
+	return ret
+}
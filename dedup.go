@@ -0,0 +1,129 @@
+// Copyright 2015 Richard Lehane. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webarchive
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"sync"
+	"time"
+)
+
+// DedupCapture is an earlier capture of a payload, which revisit records written by a WARCWriter refer to.
+type DedupCapture struct {
+	ID   string    // WARC-Record-ID of the capture; empty if it isn't known (e.g. for captures loaded from a CDX index)
+	URL  string    // target URI of the capture
+	Date time.Time // WARC-Date of the capture
+}
+
+// DedupStore records the payloads a WARCWriter has written, so that later responses with the same payload can be
+// written as revisit records. Stores can be shared between the writers of a crawl, and backed by an index of earlier
+// crawls for incremental crawling.
+type DedupStore interface {
+	// Lookup returns an earlier capture of the payload with the given digest, captured from url. Stores decide whether
+	// a capture of the same payload from another URL matches.
+	Lookup(digest Digest, url string) (DedupCapture, bool, error)
+	// Add records a capture of the payload with the given digest.
+	Add(digest Digest, c DedupCapture) error
+}
+
+// MemoryDedupStore is a DedupStore held in memory. It matches captures by payload digest alone, as Deduplicate does,
+// unless MatchURL is set. It is safe for concurrent use by the writers of a crawl, but MatchURL shouldn't be changed
+// while it is in use.
+type MemoryDedupStore struct {
+	MatchURL bool // only match captures from the same URL, compared in canonical form
+
+	mu sync.Mutex
+	m  map[string]capture
+}
+
+// NewMemoryDedupStore returns an empty MemoryDedupStore.
+func NewMemoryDedupStore() *MemoryDedupStore {
+	return &MemoryDedupStore{m: make(map[string]capture)}
+}
+
+// LoadCDX adds the captures listed in a CDX index of an earlier crawl. CDX digests without a label are taken to be
+// sha1.
+func (s *MemoryDedupStore) LoadCDX(r io.Reader) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return loadCDXCaptures(s.m, r)
+}
+
+// Lookup returns the first capture added with the given digest.
+func (s *MemoryDedupStore) Lookup(digest Digest, url string) (DedupCapture, bool, error) {
+	s.mu.Lock()
+	c, ok := s.m[digest.String()]
+	s.mu.Unlock()
+	if !ok || (s.MatchURL && canonical(c.url) != canonical(url)) {
+		return DedupCapture{}, false, nil
+	}
+	date, _ := ParseWARCDate(c.date)
+	return DedupCapture{ID: c.id, URL: c.url, Date: date}, true, nil
+}
+
+// Add records a capture, unless a capture of the same payload has already been added.
+func (s *MemoryDedupStore) Add(digest Digest, c DedupCapture) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.m[digest.String()]; !ok {
+		s.m[digest.String()] = capture{id: c.ID, url: c.URL, date: FormatWARCDate(c.Date)}
+	}
+	return nil
+}
+
+// dedup consults the Dedup store of a WARCWriter for a response record, returning the fields and block to write: the
+// fields of a revisit record and the HTTP headers of the response, if its payload was captured before. Responses with
+// empty payloads are written unchanged.
+// The block is read into memory so that its payload digest can be computed if the record lacks one.
+func (w *WARCWriter) dedup(version string, fields RawFields, block io.Reader) (RawFields, io.Reader, int64, error) {
+	buf, err := ioutil.ReadAll(block)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	hl := httpHeaderLen(buf)
+	if hl == len(buf) {
+		// empty payloads all have the same digest, so don't show that a response duplicates another
+		return fields, bytes.NewReader(buf), int64(len(buf)), nil
+	}
+	digest, err := ParseDigest(fields.Get("WARC-Payload-Digest"))
+	if err != nil {
+		digest = w.w.digest(buf[hl:])
+	}
+	u := fields.Get("WARC-Target-URI")
+	first, ok, err := w.Dedup.Lookup(digest, u)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	if !ok {
+		date, _ := ParseWARCDate(fields.Get("WARC-Date"))
+		err = w.Dedup.Add(digest, DedupCapture{ID: fields.Get("WARC-Record-ID"), URL: u, Date: date})
+		return fields, bytes.NewReader(buf), int64(len(buf)), err
+	}
+	fields.Set("WARC-Type", string(TypeRevisit))
+	fields.Set("WARC-Profile", revisitProfile(version))
+	if first.ID != "" {
+		fields.Set("WARC-Refers-To", first.ID)
+	}
+	// WARC 1.0 has no fields for the URI or date of the capture, but they are the only reference to captures without IDs
+	if version != "1.0" || first.ID == "" {
+		fields.Set("WARC-Refers-To-Target-URI", first.URL)
+		fields.Set("WARC-Refers-To-Date", formatVersionDate(version, first.Date))
+	}
+	fields.Set("WARC-Payload-Digest", digest.String())
+	fields.Set("WARC-Block-Digest", w.w.digest(buf[:hl]).String())
+	return fields, bytes.NewReader(buf[:hl]), int64(hl), nil
+}
@@ -0,0 +1,100 @@
+package webarchive
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWARCWriterDedup(t *testing.T) {
+	const resp = "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\n\r\nhello world"
+	store := NewMemoryDedupStore()
+	buf := &bytes.Buffer{}
+	ww, _ := NewWARCWriter(buf, NoCompression)
+	ww.Dedup = store
+	var hdrs []*RecordHeader
+	for _, u := range []string{"http://example.com/", "http://example.com/copy"} {
+		h := NewRecordHeader(TypeResponse, u, time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC))
+		h.SetVersion("1.1")
+		h.Set("Content-Type", "application/http; msgtype=response")
+		if err := ww.WriteRecord(h, strings.NewReader(resp)); err != nil {
+			t.Fatal(err)
+		}
+		hdrs = append(hdrs, h)
+	}
+	fields, blocks := readAll(t, buf.Bytes())
+	if len(fields) != 2 {
+		t.Fatalf("expecting 2 records, got %d", len(fields))
+	}
+	if fields[0].Get("WARC-Type") != "response" || string(blocks[0]) != resp {
+		t.Errorf("expecting first capture to be written in full, got %v", fields[0])
+	}
+	if fields[1].Get("WARC-Type") != "revisit" || fields[1].Get("WARC-Refers-To") != hdrs[0].ID() ||
+		fields[1].Get("WARC-Refers-To-Target-URI") != "http://example.com/" ||
+		fields[1].Get("WARC-Refers-To-Date") != "2020-01-02T03:04:05Z" ||
+		fields[1].Get("WARC-Profile") != revisitProfile("1.1") ||
+		fields[1].Get("WARC-Payload-Digest") != sha1Digest([]byte("hello world")).String() {
+		t.Errorf("bad revisit record %v", fields[1])
+	}
+	if string(blocks[1]) != resp[:len(resp)-len("hello world")] {
+		t.Errorf("expecting revisit to keep only HTTP headers, got %q", blocks[1])
+	}
+	if fields[1].Get("WARC-Block-Digest") != sha1Digest(blocks[1]).String() {
+		t.Errorf("expecting block digest of the revisit's own block, got %v", fields[1])
+	}
+	store.MatchURL = true
+	if _, ok, _ := store.Lookup(sha1Digest([]byte("hello world")), "http://example.com/copy"); ok {
+		t.Error("expecting no match for another URL with MatchURL")
+	}
+	if c, ok, _ := store.Lookup(sha1Digest([]byte("hello world")), "http://example.com:80/"); !ok || c.ID != hdrs[0].ID() {
+		t.Errorf("expecting match for the canonical URL with MatchURL, got %v", c)
+	}
+}
+
+func TestWARCWriterDedupEmptyPayloads(t *testing.T) {
+	const resp = "HTTP/1.1 204 No Content\r\n\r\n"
+	store := NewMemoryDedupStore()
+	buf := &bytes.Buffer{}
+	ww, _ := NewWARCWriter(buf, NoCompression)
+	ww.Dedup = store
+	for _, u := range []string{"http://example.com/a", "http://example.org/b"} {
+		h := NewRecordHeader(TypeResponse, u, time.Now())
+		h.Set("Content-Type", "application/http; msgtype=response")
+		if err := ww.WriteRecord(h, strings.NewReader(resp)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fields, blocks := readAll(t, buf.Bytes())
+	for i, f := range fields {
+		if f.Get("WARC-Type") != "response" || string(blocks[i]) != resp {
+			t.Errorf("expecting empty responses to be written unchanged, got %v", f)
+		}
+	}
+	if _, ok, _ := store.Lookup(sha1Digest(nil), "http://example.com/a"); ok {
+		t.Error("expecting empty payloads not to be added to the store")
+	}
+}
+
+func TestMemoryDedupStoreConcurrent(t *testing.T) {
+	store := NewMemoryDedupStore()
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				d := sha1Digest([]byte(strconv.Itoa(j)))
+				if _, ok, _ := store.Lookup(d, ""); !ok {
+					store.Add(d, DedupCapture{ID: strconv.Itoa(i)})
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	if _, ok, _ := store.Lookup(sha1Digest([]byte("99")), ""); !ok {
+		t.Error("expecting captures added from several goroutines to be stored")
+	}
+}
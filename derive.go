@@ -0,0 +1,447 @@
+// Copyright 2015 Richard Lehane. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webarchive
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// payloadOf splits an HTTP message block into its headers and decoded entity. Blocks that aren't HTTP
+// messages are returned as the entity.
+func payloadOf(block []byte) ([]byte, []byte) {
+	hl := httpHeaderLen(block)
+	if hl == 0 {
+		return nil, block
+	}
+	hdr, body := block[:hl], block[hl:]
+	if enc := httpEncodings(hdr); len(enc) > 0 {
+		if dec, err := decodeBytes(body, enc); err == nil {
+			body = dec
+		}
+	}
+	return hdr, body
+}
+
+// textual reports whether a media type is one that WARCToWET extracts text from
+func textual(mime string) (isHTML, ok bool) {
+	switch mime {
+	case "text/html", "application/xhtml+xml":
+		return true, true
+	case "text/plain":
+		return false, true
+	}
+	return false, false
+}
+
+// recordText returns the plain text of the block of an HTML or plain text response or resource record, as extracted
+// by WARCToWET. Reports false if the record isn't textual or holds no text.
+func recordText(fields Fields, block []byte) (string, bool) {
+	hdr, body := payloadOf(block)
+	mime := mediaType(fields.Get("Content-Type"))
+	if hdr != nil {
+		mime = mediaType(getSelectValues(hdr, "Content-Type")[0])
+	}
+	isHTML, ok := textual(mime)
+	if !ok {
+		return "", false
+	}
+	text := string(body)
+	if isHTML {
+		text = htmlText(body)
+	}
+	return text, strings.TrimSpace(text) != ""
+}
+
+// WARCToWET reads the WARC file in r and writes a WET file to w: a conversion record holding the plain text of each
+// HTML and plain text response or resource, as popularised by Common Crawl. Each conversion record refers
+// to its original using WARC-Refers-To.
+//
+// Returns the number of conversion records written.
+func WARCToWET(w io.Writer, r io.Reader) (int, error) {
+	rdr, err := NewWARCReader(r)
+	if err != nil {
+		return 0, err
+	}
+	defer rdr.Close()
+	ww := newWARCWriter(w)
+	if _, err = ww.writeWarcinfo("1.0", "", Warcinfo{
+		Software:    software,
+		Format:      "WARC File Format 1.0",
+		ConformsTo:  conformsTo10,
+		Description: "plain text extracted from HTML and text records (WET)",
+	}.Bytes()); err != nil {
+		return 0, err
+	}
+	var n int
+	for {
+		rec, err := rdr.Next()
+		if err != nil {
+			if err == io.EOF {
+				return n, nil
+			}
+			return n, err
+		}
+		typ := rdr.Type()
+		if typ != "response" && typ != "resource" {
+			continue
+		}
+		block, err := ioutil.ReadAll(rec)
+		if err != nil {
+			return n, err
+		}
+		text, ok := recordText(rec.Fields(), block)
+		if !ok {
+			continue
+		}
+		b := []byte(text)
+		fields := RawFields{
+			{Key: "WARC-Type", Value: "conversion"},
+			{Key: "WARC-Target-URI", Value: rec.URL()},
+			{Key: "WARC-Date", Value: formatVersionDate("1.0", rec.Date())},
+			{Key: "WARC-Record-ID", Value: newRecordID()},
+			{Key: "WARC-Refers-To", Value: rdr.ID()},
+			{Key: "WARC-Block-Digest", Value: sha1Digest(b).String()},
+			{Key: "Content-Type", Value: "text/plain"},
+		}
+		if err = ww.writeRecord("1.0", fields, bytes.NewReader(b), int64(len(b))); err != nil {
+			return n, err
+		}
+		n++
+	}
+}
+
+// WAT is the JSON document held in each metadata record of a WAT file, as produced by WARCToWAT and read by ReadWAT.
+// The layout follows Common Crawl's WAT files, in which numbers are given as strings.
+type WAT struct {
+	Container *WATContainer `json:"Container,omitempty"`
+	Envelope  WATEnvelope   `json:"Envelope"`
+}
+
+// WATContainer describes the file that held the original record.
+type WATContainer struct {
+	Filename   string `json:"Filename"`
+	Compressed bool   `json:"Compressed"`
+	Offset     string `json:"Offset,omitempty"`
+}
+
+// WATEnvelope describes the original record: its WARC header fields and the metadata of its payload.
+type WATEnvelope struct {
+	Format              string            `json:"Format"`
+	WARCHeaderLength    string            `json:"WARC-Header-Length"`
+	BlockDigest         string            `json:"Block-Digest,omitempty"`
+	ActualContentLength string            `json:"Actual-Content-Length"`
+	WARCHeaderMetadata  map[string]string `json:"WARC-Header-Metadata"`
+	PayloadMetadata     WATPayload        `json:"Payload-Metadata"`
+}
+
+// WATPayload is the metadata of a record's block. Only the member relevant to the record is set.
+type WATPayload struct {
+	ActualContentType    string            `json:"Actual-Content-Type"`
+	HTTPResponseMetadata *WATResponse      `json:"HTTP-Response-Metadata,omitempty"`
+	HTTPRequestMetadata  *WATRequest       `json:"HTTP-Request-Metadata,omitempty"`
+	WARCInfoMetadata     map[string]string `json:"WARC-Info-Metadata,omitempty"`
+	WARCMetadataMetadata *WATMetadata      `json:"WARC-Metadata-Metadata,omitempty"`
+}
+
+// WATMetadata is the content of a metadata record, as described in Common Crawl's WAT files.
+type WATMetadata struct {
+	Records []struct {
+		Name  string `json:"Name"`
+		Value string `json:"Value"`
+	} `json:"Metadata-Records"`
+}
+
+// WATResponse is the metadata of an HTTP response.
+type WATResponse struct {
+	ResponseMessage struct {
+		Version string `json:"Version"`
+		Status  string `json:"Status"`
+		Reason  string `json:"Reason"`
+	} `json:"Response-Message"`
+	Headers       map[string]string `json:"Headers"`
+	HeadersLength string            `json:"Headers-Length"`
+	EntityLength  string            `json:"Entity-Length"`
+	EntityDigest  string            `json:"Entity-Digest,omitempty"`
+	HTMLMetadata  *WATHTML          `json:"HTML-Metadata,omitempty"`
+	Language      string            `json:"Identified-Content-Language,omitempty"` // with WithLanguageDetector
+}
+
+// WATRequest is the metadata of an HTTP request.
+type WATRequest struct {
+	RequestMessage struct {
+		Method  string `json:"Method"`
+		Path    string `json:"Path"`
+		Version string `json:"Version"`
+	} `json:"Request-Message"`
+	Headers       map[string]string `json:"Headers"`
+	HeadersLength string            `json:"Headers-Length"`
+	EntityLength  string            `json:"Entity-Length"`
+}
+
+// WATHTML is the metadata of an HTML page: its title, meta tags and links. Links in the head of the page, including
+// scripts, are given separately in Common Crawl's WAT files; WARCToWAT includes all links in Links.
+type WATHTML struct {
+	Head struct {
+		Title   string    `json:"Title,omitempty"`
+		Metas   []WATMeta `json:"Metas,omitempty"`
+		Link    []WATLink `json:"Link,omitempty"`
+		Scripts []WATLink `json:"Scripts,omitempty"`
+	} `json:"Head"`
+	Links []WATLink `json:"Links,omitempty"`
+}
+
+// WATMeta is a meta tag in the head of an HTML page.
+type WATMeta struct {
+	Name      string `json:"name,omitempty"`
+	Property  string `json:"property,omitempty"`
+	HTTPEquiv string `json:"http-equiv,omitempty"`
+	Content   string `json:"content"`
+}
+
+// WATLink is a link from an HTML page. Path gives the element and attribute of the link e.g. "A@/href".
+type WATLink struct {
+	Path string `json:"path"`
+	URL  string `json:"url"`
+	Text string `json:"text,omitempty"`
+	Rel  string `json:"rel,omitempty"`
+	Type string `json:"type,omitempty"` // type attribute, as given for links in the head in Common Crawl's WAT files
+}
+
+// ReadWAT decodes the WAT document held in a metadata record of a WAT file, as returned by a Reader's Next method.
+// Returns ErrWAT if the record isn't a metadata record with an application/json block.
+func ReadWAT(rec Record) (*WAT, error) {
+	fields := rec.Fields()
+	if RecordType(strings.ToLower(fields.Get("WARC-Type"))) != TypeMetadata || mediaType(fields.Get("Content-Type")) != "application/json" {
+		return nil, ErrWAT
+	}
+	b, err := ioutil.ReadAll(rec)
+	if err != nil {
+		return nil, err
+	}
+	wat := &WAT{}
+	if err = json.Unmarshal(b, wat); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrWAT, err)
+	}
+	return wat, nil
+}
+
+// attributes that hold links, by element
+var linkAttrs = map[string]string{
+	"a":      "href",
+	"area":   "href",
+	"link":   "href",
+	"img":    "src",
+	"script": "src",
+	"iframe": "src",
+	"frame":  "src",
+	"embed":  "src",
+	"source": "src",
+	"video":  "src",
+	"audio":  "src",
+	"form":   "action",
+}
+
+// watHTML extracts the title, meta tags and links of an HTML page
+func watHTML(b []byte) *WATHTML {
+	h := &WATHTML{}
+	var inTitle bool
+	anchor := -1 // index in Links of an open a element
+	tokenizeHTML(b, func(tok htmlToken) {
+		switch {
+		case tok.name == "":
+			if inTitle {
+				h.Head.Title += tok.text
+			}
+			if anchor > -1 {
+				h.Links[anchor].Text += tok.text
+			}
+		case tok.name == "title":
+			inTitle = !tok.closing
+		case tok.name == "meta" && !tok.closing:
+			if c, ok := tok.attrs["content"]; ok {
+				h.Head.Metas = append(h.Head.Metas, WATMeta{Name: tok.attrs["name"], Property: tok.attrs["property"], HTTPEquiv: tok.attrs["http-equiv"], Content: c})
+			}
+		case tok.name == "a" && tok.closing:
+			anchor = -1
+		default:
+			attr, ok := linkAttrs[tok.name]
+			if !ok || tok.closing || tok.attrs[attr] == "" {
+				return
+			}
+			h.Links = append(h.Links, WATLink{Path: strings.ToUpper(tok.name) + "@/" + attr, URL: tok.attrs[attr], Rel: tok.attrs["rel"]})
+			if tok.name == "a" {
+				anchor = len(h.Links) - 1
+			}
+		}
+	})
+	h.Head.Title = strings.Join(strings.Fields(h.Head.Title), " ")
+	for i := range h.Links {
+		h.Links[i].Text = strings.Join(strings.Fields(h.Links[i].Text), " ")
+	}
+	return h
+}
+
+// headerMap flattens HTTP headers, joining repeated values with ", "
+func headerMap(h http.Header) map[string]string {
+	m := make(map[string]string, len(h))
+	for k, v := range h {
+		m[k] = strings.Join(v, ", ")
+	}
+	return m
+}
+
+// newWAT describes a record in a WAT document
+func newWAT(ver string, fields RawFields, block []byte, filename string, detect LanguageDetector) *WAT {
+	wat := &WAT{Envelope: WATEnvelope{
+		Format:              "WARC",
+		WARCHeaderLength:    strconv.Itoa(len(recordHeader(ver, fields, int64(len(block))))),
+		BlockDigest:         sha1Digest(block).String(),
+		ActualContentLength: strconv.Itoa(len(block)),
+		WARCHeaderMetadata:  make(map[string]string),
+	}}
+	if filename != "" {
+		wat.Container = &WATContainer{Filename: filename, Compressed: strings.HasSuffix(filename, ".gz")}
+	}
+	for _, f := range fields {
+		if f.Key == "" {
+			continue
+		}
+		k := f.Canonical()
+		if v, ok := wat.Envelope.WARCHeaderMetadata[k]; ok {
+			wat.Envelope.WARCHeaderMetadata[k] = v + ", " + f.Value
+		} else {
+			wat.Envelope.WARCHeaderMetadata[k] = f.Value
+		}
+	}
+	pm := &wat.Envelope.PayloadMetadata
+	pm.ActualContentType = fields.Get("Content-Type")
+	switch strings.ToLower(fields.Get("WARC-Type")) {
+	case "warcinfo":
+		pm.WARCInfoMetadata = make(map[string]string)
+		for _, f := range getRawFields(block) {
+			if f.Key != "" {
+				pm.WARCInfoMetadata[f.Key] = f.Value
+			}
+		}
+	case "response":
+		hdr, body := payloadOf(block)
+		if hdr == nil || !isHTTPResponse(hdr) {
+			break
+		}
+		resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(hdr)), nil)
+		if err != nil {
+			break
+		}
+		resp.Body.Close()
+		rm := &WATResponse{
+			Headers:       headerMap(resp.Header),
+			HeadersLength: strconv.Itoa(len(hdr)),
+			EntityLength:  strconv.Itoa(len(block) - len(hdr)),
+			EntityDigest:  sha1Digest(block[len(hdr):]).String(),
+		}
+		rm.ResponseMessage.Version = resp.Proto
+		rm.ResponseMessage.Status = strconv.Itoa(resp.StatusCode)
+		rm.ResponseMessage.Reason = strings.TrimSpace(strings.TrimPrefix(resp.Status, strconv.Itoa(resp.StatusCode)))
+		if isHTML, _ := textual(mediaType(resp.Header.Get("Content-Type"))); isHTML {
+			rm.HTMLMetadata = watHTML(body)
+		}
+		if detect != nil {
+			rm.Language = detectLanguage(detect, body, resp.Header.Get("Content-Type"), nil)
+		}
+		pm.HTTPResponseMetadata = rm
+	case "request":
+		hl := httpHeaderLen(block)
+		if hl == 0 {
+			break
+		}
+		req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(block[:hl])))
+		if err != nil {
+			break
+		}
+		rm := &WATRequest{
+			Headers:       headerMap(req.Header),
+			HeadersLength: strconv.Itoa(hl),
+			EntityLength:  strconv.Itoa(len(block) - hl),
+		}
+		rm.RequestMessage.Method = req.Method
+		rm.RequestMessage.Path = req.RequestURI
+		rm.RequestMessage.Version = req.Proto
+		pm.HTTPRequestMetadata = rm
+	}
+	return wat
+}
+
+// WARCToWAT reads the WARC file in r and writes a WAT file to w: a metadata record for each record, holding a JSON
+// description (see the WAT type) of its WARC header fields, HTTP headers and, for HTML pages, title, meta tags
+// and links. Each metadata record refers to its original using WARC-Refers-To. The filename, if given, is
+// recorded as the container of the original records. Given WithLanguageDetector, the language of HTML and plain
+// text responses is also described.
+//
+// Returns the number of metadata records written.
+func WARCToWAT(w io.Writer, r io.Reader, filename string, opts ...Option) (int, error) {
+	rdr, err := NewWARCReader(r, opts...)
+	if err != nil {
+		return 0, err
+	}
+	defer rdr.Close()
+	ww := newWARCWriter(w)
+	if _, err = ww.writeWarcinfo("1.0", "", Warcinfo{
+		Software:    software,
+		Format:      "WARC File Format 1.0",
+		ConformsTo:  conformsTo10,
+		Description: "metadata of records (WAT)",
+	}.Bytes()); err != nil {
+		return 0, err
+	}
+	var n int
+	for {
+		rec, err := rdr.Next()
+		if err != nil {
+			if err == io.EOF {
+				return n, nil
+			}
+			return n, err
+		}
+		block, err := ioutil.ReadAll(rec)
+		if err != nil {
+			return n, err
+		}
+		b, err := json.Marshal(newWAT(rdr.Version(), rec.RawFields(), block, filename, rdr.detector))
+		if err != nil {
+			return n, err
+		}
+		fields := RawFields{{Key: "WARC-Type", Value: "metadata"}}
+		if rec.URL() != "" {
+			fields.Add("WARC-Target-URI", rec.URL())
+		}
+		fields.Add("WARC-Date", formatVersionDate("1.0", rec.Date()))
+		fields.Add("WARC-Record-ID", newRecordID())
+		fields.Add("WARC-Refers-To", rdr.ID())
+		fields.Add("WARC-Block-Digest", sha1Digest(b).String())
+		fields.Add("Content-Type", "application/json")
+		if err = ww.writeRecord("1.0", fields, bytes.NewReader(b), int64(len(b))); err != nil {
+			return n, err
+		}
+		n++
+	}
+}
@@ -0,0 +1,118 @@
+package webarchive
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"testing"
+)
+
+func TestHTMLText(t *testing.T) {
+	doc := `<html><head><title>A &amp; B</title><style>p {color: red}</style></head>
+<body><!-- comment --><h1>Heading</h1><p>Some <b>bold</b>
+text.<br>Next line</p><script>var a = "<p>";</script></body></html>`
+	if got := htmlText([]byte(doc)); got != "A & B\nHeading\nSome bold text.\nNext line" {
+		t.Errorf("bad text: %q", got)
+	}
+	h := watHTML([]byte(`<title>T</title><meta name="description" content="D"><a href="/x">link <i>text</i></a><img src='i.png'>`))
+	if h.Head.Title != "T" || len(h.Head.Metas) != 1 || h.Head.Metas[0].Content != "D" || len(h.Links) != 2 ||
+		h.Links[0].Text != "link text" || h.Links[1].Path != "IMG@/src" || h.Links[1].URL != "i.png" {
+		t.Errorf("bad HTML metadata: %+v", h)
+	}
+}
+
+func TestWARCToWET(t *testing.T) {
+	checkExamples(t)
+	f, _ := os.Open("examples/hello-world.warc")
+	defer f.Close()
+	buf := &bytes.Buffer{}
+	n, err := WARCToWET(buf, f)
+	if err != nil || n != 3 {
+		t.Fatalf("expecting 3 conversion records, got %d %v", n, err)
+	}
+	recs, blocks := readAll(t, buf.Bytes())
+	if recs[1].Get("WARC-Type") != "conversion" || recs[1].Get("WARC-Refers-To") != "<urn:uuid:3C74F309-6B37-461C-B982-1B5C447C3C0E>" ||
+		string(blocks[1]) != "Hello World\n\n" {
+		t.Errorf("bad conversion record: %v %q", recs[1], blocks[1])
+	}
+}
+
+func TestWARCToWAT(t *testing.T) {
+	checkExamples(t)
+	f, _ := os.Open("examples/hello-world.warc")
+	defer f.Close()
+	buf := &bytes.Buffer{}
+	n, err := WARCToWAT(buf, f, "hello-world.warc")
+	if err != nil || n != 6 {
+		t.Fatalf("expecting 6 metadata records, got %d %v", n, err)
+	}
+	_, blocks := readAll(t, buf.Bytes())
+	var wat WAT
+	if err := json.Unmarshal(blocks[3], &wat); err != nil {
+		t.Fatal(err)
+	}
+	resp := wat.Envelope.PayloadMetadata.HTTPResponseMetadata
+	if wat.Container.Filename != "hello-world.warc" || wat.Envelope.WARCHeaderMetadata["WARC-Type"] != "response" ||
+		resp == nil || resp.ResponseMessage.Status != "200" || resp.Headers["Content-Type"] != "text/plain; charset=utf-8" {
+		t.Errorf("bad WAT: %+v", wat)
+	}
+	if err := json.Unmarshal(blocks[1], &wat); err != nil || wat.Envelope.PayloadMetadata.WARCInfoMetadata["software"] == "" {
+		t.Errorf("bad warcinfo WAT: %+v %v", wat.Envelope.PayloadMetadata, err)
+	}
+}
+
+func TestReadWAT(t *testing.T) {
+	checkExamples(t)
+	f, _ := os.Open("examples/hello-world.warc")
+	defer f.Close()
+	buf := &bytes.Buffer{}
+	if _, err := WARCToWAT(buf, f, "hello-world.warc"); err != nil {
+		t.Fatal(err)
+	}
+	rdr, err := NewReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec, _ := rdr.Next()
+	if _, err := ReadWAT(rec); err != ErrWAT {
+		t.Errorf("expecting ErrWAT for the warcinfo record, got %v", err)
+	}
+	var wats []*WAT
+	for {
+		rec, err := rdr.Next()
+		if err != nil {
+			break
+		}
+		wat, err := ReadWAT(rec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		wats = append(wats, wat)
+	}
+	if len(wats) != 6 || wats[2].Envelope.PayloadMetadata.HTTPResponseMetadata == nil ||
+		wats[2].Envelope.PayloadMetadata.HTTPResponseMetadata.ResponseMessage.Status != "200" {
+		t.Fatalf("bad WATs: %v", wats)
+	}
+	// a metadata record in the form of Common Crawl's WAT files
+	cc := []byte(`{"Container":{"Filename":"x.warc.gz","Compressed":true,"Offset":"522","Gzip-Metadata":{"Deflate-Length":"4"}},` +
+		`"Envelope":{"Format":"WARC","Payload-Metadata":{"Actual-Content-Type":"application/http; msgtype=response",` +
+		`"HTTP-Response-Metadata":{"HTML-Metadata":{"Head":{"Title":"Example","Link":[{"path":"LINK@/href","url":"/a.css","rel":"stylesheet","type":"text/css"}],` +
+		`"Scripts":[{"path":"SCRIPT@/src","url":"/a.js"}]},"Links":[{"path":"A@/href","url":"/b","text":"B"}]}}}}}`)
+	buf.Reset()
+	ww := newWARCWriter(buf)
+	if err := ww.writeRecord("1.0", RawFields{{Key: "WARC-Type", Value: "metadata"}, {Key: "WARC-Date", Value: "2020-01-01T00:00:00Z"},
+		{Key: "Content-Type", Value: "application/json"}}, bytes.NewReader(cc), int64(len(cc))); err != nil {
+		t.Fatal(err)
+	}
+	rdr, _ = NewReader(bytes.NewReader(buf.Bytes()))
+	rec, _ = rdr.Next()
+	wat, err := ReadWAT(rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	html := wat.Envelope.PayloadMetadata.HTTPResponseMetadata.HTMLMetadata
+	if wat.Container.Offset != "522" || html.Head.Title != "Example" || html.Head.Link[0].Type != "text/css" ||
+		html.Head.Scripts[0].URL != "/a.js" || html.Links[0].Text != "B" {
+		t.Errorf("bad Common Crawl WAT: %+v", wat)
+	}
+}
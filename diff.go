@@ -0,0 +1,112 @@
+// Copyright 2015 Richard Lehane. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webarchive
+
+import "io"
+
+// ChangeKind describes how a URL differs between two archives.
+type ChangeKind int
+
+const (
+	URLAdded   ChangeKind = iota // captured only in the second archive
+	URLRemoved                   // captured only in the first archive
+	URLChanged                   // captured in both, with a different payload digest or status
+)
+
+func (k ChangeKind) String() string {
+	switch k {
+	case URLAdded:
+		return "added"
+	case URLRemoved:
+		return "removed"
+	}
+	return "changed"
+}
+
+// URLChange is a difference between two archives in the captures of a URL. Before and After are the latest captures
+// of the URL in the first and second archives; Before is nil for added URLs and After is nil for removed ones.
+type URLChange struct {
+	Kind   ChangeKind
+	SURT   string
+	Before *CDX
+	After  *CDX
+}
+
+// Diff indexes the WARC files in a and b, such as successive crawls of the same seeds, and reports the URLs
+// added, removed and changed between them (see DiffIndexes).
+func Diff(a, b io.Reader) ([]URLChange, error) {
+	ia, err := Index(a, "")
+	if err != nil {
+		return nil, err
+	}
+	ib, err := Index(b, "")
+	if err != nil {
+		return nil, err
+	}
+	return DiffIndexes(ia, ib), nil
+}
+
+// DiffIndexes compares the CDX indexes of two archives and reports the URLs added, removed and changed between them,
+// in SURT order. URLs are compared in SURT form, using the latest capture of each URL in each index: a URL is changed
+// if the payload digest or status of its latest capture differs. Revisit records are compared by the digest of the
+// payload they revisit, so a URL that was deduplicated in one crawl isn't reported as changed.
+//
+// The indexes needn't be sorted and aren't modified.
+func DiffIndexes(a, b []*CDX) []URLChange {
+	ka, kb := latestCaptures(a), latestCaptures(b)
+	var changes []URLChange
+	i, j := 0, 0
+	for i < len(ka) || j < len(kb) {
+		switch {
+		case j == len(kb) || (i < len(ka) && ka[i].SURT < kb[j].SURT):
+			changes = append(changes, URLChange{Kind: URLRemoved, SURT: ka[i].SURT, Before: ka[i]})
+			i++
+		case i == len(ka) || kb[j].SURT < ka[i].SURT:
+			changes = append(changes, URLChange{Kind: URLAdded, SURT: kb[j].SURT, After: kb[j]})
+			j++
+		default:
+			if ka[i].Digest != kb[j].Digest || !sameStatus(ka[i], kb[j]) {
+				changes = append(changes, URLChange{Kind: URLChanged, SURT: ka[i].SURT, Before: ka[i], After: kb[j]})
+			}
+			i++
+			j++
+		}
+	}
+	return changes
+}
+
+// latestCaptures returns the latest capture of each URL in an index, sorted by SURT
+func latestCaptures(entries []*CDX) CDXIndex {
+	latest := make(map[string]*CDX)
+	for _, e := range entries {
+		if l, ok := latest[e.SURT]; !ok || !e.Date.Before(l.Date) {
+			latest[e.SURT] = e
+		}
+	}
+	ret := make([]*CDX, 0, len(latest))
+	for _, e := range latest {
+		ret = append(ret, e)
+	}
+	return NewCDXIndex(ret)
+}
+
+// sameStatus compares the status of two captures. Revisits match any status, since the status of their
+// original isn't known.
+func sameStatus(a, b *CDX) bool {
+	if a.MIME == "warc/revisit" || b.MIME == "warc/revisit" {
+		return true
+	}
+	return a.Status == b.Status
+}
@@ -0,0 +1,56 @@
+package webarchive
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestDiff(t *testing.T) {
+	crawl := func(caps ...[3]string) []byte {
+		buf := &bytes.Buffer{}
+		ww := newWARCWriter(buf)
+		for i, c := range caps {
+			resp := []byte("HTTP/1.1 " + c[1] + "\r\nContent-Type: text/plain\r\n\r\n" + c[2])
+			if err := ww.writeExchange("1.0", exchange{
+				uri:     c[0],
+				date:    time.Date(2020, 1, 1, 0, i, 0, 0, time.UTC),
+				req:     []byte("GET / HTTP/1.1\r\n\r\n"),
+				resp:    resp,
+				payload: []byte(c[2]),
+			}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return buf.Bytes()
+	}
+	a := crawl([3]string{"http://example.com/", "200 OK", "home"}, [3]string{"http://example.com/old", "200 OK", "old"},
+		[3]string{"http://example.com/page", "200 OK", "v1"}, [3]string{"http://example.com/gone", "200 OK", "gone"})
+	b := crawl([3]string{"http://www.example.com/", "200 OK", "home"}, [3]string{"http://example.com/new", "200 OK", "new"},
+		[3]string{"http://example.com/page", "200 OK", "v1"}, [3]string{"http://example.com/page", "200 OK", "v2"},
+		[3]string{"http://example.com/gone", "404 Not Found", "gone"})
+	changes, err := Diff(bytes.NewReader(a), bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []struct {
+		kind ChangeKind
+		surt string
+	}{
+		{URLChanged, "com,example)/gone"},
+		{URLAdded, "com,example)/new"},
+		{URLRemoved, "com,example)/old"},
+		{URLChanged, "com,example)/page"},
+	}
+	if len(changes) != len(expect) {
+		t.Fatalf("expecting %d changes, got %v", len(expect), changes)
+	}
+	for i, e := range expect {
+		if changes[i].Kind != e.kind || changes[i].SURT != e.surt {
+			t.Errorf("%d: expecting %s %s, got %s %s", i, e.kind, e.surt, changes[i].Kind, changes[i].SURT)
+		}
+	}
+	if changes[1].Before != nil || changes[1].After == nil || changes[3].After.URL != "http://example.com/page" {
+		t.Errorf("bad captures in changes: %+v", changes)
+	}
+}
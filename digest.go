@@ -0,0 +1,403 @@
+// Copyright 2015 Richard Lehane. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webarchive
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"hash"
+	"io"
+	"strings"
+)
+
+// Digest is a labelled digest as found in the WARC-Block-Digest and WARC-Payload-Digest
+// fields e.g. "sha1:ECBYA457KB6YATF4WP7KDF6ZXXYGADEC".
+type Digest struct {
+	Algorithm string // lower-cased algorithm label e.g. "sha1"
+	Value     string // encoded digest value, as given
+}
+
+// ParseDigest parses a labelled digest of the form algorithm:value.
+func ParseDigest(s string) (Digest, error) {
+	idx := strings.IndexByte(s, ':')
+	if idx < 1 || idx == len(s)-1 {
+		return Digest{}, ErrDigest
+	}
+	return Digest{
+		Algorithm: strings.ToLower(strings.TrimSpace(s[:idx])),
+		Value:     strings.TrimSpace(s[idx+1:]),
+	}, nil
+}
+
+// String returns the digest in labelled form.
+func (d Digest) String() string {
+	return d.Algorithm + ":" + d.Value
+}
+
+// sha1Digest returns the sha1 digest of b, base32 encoded as is conventional in WARC files.
+func sha1Digest(b []byte) Digest {
+	sum := sha1.Sum(b)
+	return Digest{Algorithm: "sha1", Value: base32.StdEncoding.EncodeToString(sum[:])}
+}
+
+// httpHeaderLen returns the length of any HTTP headers (with status or request line) at the start of a record block.
+func httpHeaderLen(block []byte) int {
+	if !isHTTP(block) {
+		return 0
+	}
+	if i := indexBlankLine(block); i > -1 {
+		return i
+	}
+	return 0
+}
+
+// isHTTPResponse reports whether a block begins with an HTTP status line
+func isHTTPResponse(block []byte) bool {
+	return len(block) >= 5 && string(block[:5]) == "HTTP/"
+}
+
+// isHTTP reports whether a record block begins with an HTTP status line or request line
+func isHTTP(block []byte) bool {
+	if isHTTPResponse(block) {
+		return true
+	}
+	line, _ := readline(block)
+	line = bytes.TrimSpace(line)
+	sp := bytes.LastIndexByte(line, ' ')
+	return sp > 0 && bytes.IndexByte(line, ' ') < sp && bytes.HasPrefix(line[sp+1:], []byte("HTTP/"))
+}
+
+var hashes = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha224": sha256.New224,
+	"sha256": sha256.New,
+	"sha384": sha512.New384,
+	"sha512": sha512.New,
+	"blake3": newBlake3,
+}
+
+// normalise an algorithm label e.g. "SHA-256" to "sha256"
+func algorithmKey(algorithm string) string {
+	return strings.Replace(strings.ToLower(strings.TrimSpace(algorithm)), "-", "", -1)
+}
+
+// RegisterDigest adds a digest algorithm, such as sha3-256, for computing and verifying WARC digests.
+// The algorithm is matched against digest labels case-insensitively, ignoring hyphens.
+// RegisterDigest is not safe for concurrent use and is intended to be called from an init function.
+func RegisterDigest(algorithm string, fn func() hash.Hash) {
+	hashes[algorithmKey(algorithm)] = fn
+}
+
+func newHash(algorithm string) hash.Hash {
+	fn, ok := hashes[algorithmKey(algorithm)]
+	if !ok {
+		return nil
+	}
+	return fn()
+}
+
+// DigestEncoding is an encoding for the values of computed digests.
+type DigestEncoding int
+
+const (
+	Base32 DigestEncoding = iota // upper-case base32 with padding, as is conventional in WARC files
+	Base16                       // lower-case hexadecimal
+	Base64                       // standard base64 with padding
+)
+
+func (e DigestEncoding) encode(sum []byte) string {
+	switch e {
+	case Base16:
+		return hex.EncodeToString(sum)
+	case Base64:
+		return base64.StdEncoding.EncodeToString(sum)
+	}
+	return base32.StdEncoding.EncodeToString(sum)
+}
+
+// DigestFunc computes the labelled digest of a record block or payload.
+type DigestFunc func([]byte) Digest
+
+// DigestWith returns a DigestFunc computing digests with the given algorithm (e.g. "sha256") and encoding.
+// Returns ErrDigestAlgorithm if the algorithm is not supported (md5, sha1, sha224, sha256, sha384, sha512, blake3
+// and any added by RegisterDigest are).
+func DigestWith(algorithm string, enc DigestEncoding) (DigestFunc, error) {
+	key := algorithmKey(algorithm)
+	fn, ok := hashes[key]
+	if !ok {
+		return nil, ErrDigestAlgorithm
+	}
+	return func(b []byte) Digest {
+		h := fn()
+		h.Write(b)
+		return Digest{Algorithm: key, Value: enc.encode(h.Sum(nil))}
+	}, nil
+}
+
+// DigestReader computes digests of the content read through it, for example to check the fixity of a payload
+// or find duplicates while it is being extracted.
+//
+// Example:
+//
+//	dr, _ := NewDigestReader(record, Base32, "sha1", "sha256")
+//	io.Copy(f, dr)
+//	fmt.Println(dr.Digests())
+type DigestReader struct {
+	r       io.Reader
+	enc     DigestEncoding
+	keys    []string
+	hashes  []hash.Hash
+	digests []Digest
+}
+
+// NewDigestReader returns a DigestReader that reads from r, computing digests with the given algorithms.
+// Returns ErrDigestAlgorithm if any algorithm is not supported.
+func NewDigestReader(r io.Reader, enc DigestEncoding, algorithms ...string) (*DigestReader, error) {
+	dr := &DigestReader{r: r, enc: enc}
+	for _, a := range algorithms {
+		h := newHash(a)
+		if h == nil {
+			return nil, ErrDigestAlgorithm
+		}
+		dr.keys = append(dr.keys, algorithmKey(a))
+		dr.hashes = append(dr.hashes, h)
+	}
+	return dr, nil
+}
+
+// Read reads from the underlying reader, adding what is read to the digests.
+func (dr *DigestReader) Read(p []byte) (int, error) {
+	n, err := dr.r.Read(p)
+	for _, h := range dr.hashes {
+		h.Write(p[:n])
+	}
+	if err == io.EOF && dr.digests == nil {
+		dr.digests = make([]Digest, len(dr.hashes))
+		for i, h := range dr.hashes {
+			dr.digests[i] = Digest{Algorithm: dr.keys[i], Value: dr.enc.encode(h.Sum(nil))}
+		}
+	}
+	return n, err
+}
+
+// Digests returns the digests, in the order their algorithms were given, once the underlying reader has returned io.EOF.
+// Returns nil until then.
+func (dr *DigestReader) Digests() []Digest { return dr.digests }
+
+// WithFileDigest computes a digest, with the given algorithm (e.g. "sha256"), of the raw bytes of each file as they
+// are read, so that reading or validating a file also checks its fixity without reading it again. The digest is
+// returned by FileDigest once the file has been read to its end. Sources with a Slice method are read as streams
+// when this option is given. NewReader returns ErrDigestAlgorithm if the algorithm is not supported.
+func WithFileDigest(algorithm string) Option {
+	return func(r *reader) {
+		r.fileAlg = algorithm
+	}
+}
+
+// fileHasher hashes the raw bytes of a file as they are read
+type fileHasher struct {
+	r   io.Reader
+	key string
+	h   hash.Hash
+	eof bool
+}
+
+func (f *fileHasher) Read(p []byte) (int, error) {
+	n, err := f.r.Read(p)
+	f.h.Write(p[:n])
+	if err == io.EOF {
+		f.eof = true
+	}
+	return n, err
+}
+
+// hashSource wraps a new source in a fileHasher if the reader was created with WithFileDigest
+func (r *reader) hashSource(s io.Reader) (io.Reader, error) {
+	r.fileHash = nil
+	if r.fileAlg == "" {
+		return s, nil
+	}
+	h := newHash(r.fileAlg)
+	if h == nil {
+		return nil, ErrDigestAlgorithm
+	}
+	r.fileHash = &fileHasher{r: s, key: algorithmKey(r.fileAlg), h: h}
+	return r.fileHash, nil
+}
+
+// FileDigest returns the base32 digest of the raw bytes of the current file, if the reader was created with
+// WithFileDigest. The digest is only returned, with true, once the whole file has been read: that is, once Next,
+// NextPayload or NextHeader has returned io.EOF.
+func (r *reader) FileDigest() (Digest, bool) {
+	if r.fileHash == nil || !r.fileHash.eof {
+		return Digest{}, false
+	}
+	return Digest{Algorithm: r.fileHash.key, Value: Base32.encode(r.fileHash.h.Sum(nil))}, true
+}
+
+// decode a digest value given in base32, base16 or base64, checking it has the expected size in bytes
+func decodeDigest(value string, size int) []byte {
+	for _, fn := range []func(string) ([]byte, error){
+		base32.StdEncoding.DecodeString,
+		base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString,
+		hex.DecodeString,
+		base64.StdEncoding.DecodeString,
+		base64.RawStdEncoding.DecodeString,
+		base64.URLEncoding.DecodeString,
+	} {
+		if b, err := fn(value); err == nil && len(b) == size {
+			return b
+		}
+	}
+	if b, err := base32.StdEncoding.DecodeString(strings.ToUpper(value)); err == nil && len(b) == size {
+		return b
+	}
+	return nil
+}
+
+// redigest returns the digest of b with the algorithm of d, encoded as the value of d is. Digests with an unsupported
+// algorithm are recomputed as sha1.
+func redigest(d Digest, b []byte) Digest {
+	h := newHash(d.Algorithm)
+	if h == nil {
+		return sha1Digest(b)
+	}
+	h.Write(b)
+	sum := h.Sum(nil)
+	enc := Base32
+	if v, err := hex.DecodeString(d.Value); err == nil && len(v) == len(sum) {
+		enc = Base16
+	} else if v, err := base64.StdEncoding.DecodeString(d.Value); err == nil && len(v) == len(sum) {
+		enc = Base64
+	}
+	return Digest{Algorithm: d.Algorithm, Value: enc.encode(sum)}
+}
+
+// Sum decodes the digest's value, which may be given in base32, base16 or base64, returning the raw digest.
+// Returns ErrDigestAlgorithm if the algorithm isn't supported (its size is needed to tell the encodings apart),
+// and ErrDigest if the value can't be decoded as a digest of that size.
+func (d Digest) Sum() ([]byte, error) {
+	h := newHash(d.Algorithm)
+	if h == nil {
+		return nil, ErrDigestAlgorithm
+	}
+	b := decodeDigest(d.Value, h.Size())
+	if b == nil {
+		return nil, ErrDigest
+	}
+	return b, nil
+}
+
+// Encode returns the digest with its value in the given encoding, and with a normalised algorithm label
+// e.g. "sha1:2001c08ba3c91a3c7b84b6f0df3b0b8f2d2d8a2c" and "SHA-1:IAHAi6PJGjx7hLbw3zsLjy0tiiw=" both give
+// "sha1:EAA4BC5DZENDY64EW3YN6OYLR4WS3CRM" for Base32.
+func (d Digest) Encode(enc DigestEncoding) (Digest, error) {
+	sum, err := d.Sum()
+	if err != nil {
+		return Digest{}, err
+	}
+	return Digest{Algorithm: algorithmKey(d.Algorithm), Value: enc.encode(sum)}, nil
+}
+
+// Equal reports whether two digests are of the same algorithm and sum, regardless of how their values are encoded.
+func (d Digest) Equal(o Digest) bool {
+	if algorithmKey(d.Algorithm) != algorithmKey(o.Algorithm) {
+		return false
+	}
+	a, err := d.Sum()
+	if err != nil {
+		return false
+	}
+	return o.matches(a)
+}
+
+// matches reports whether a digest matches a computed sum
+func (d Digest) matches(sum []byte) bool {
+	b := decodeDigest(d.Value, len(sum))
+	return b != nil && bytes.Equal(b, sum)
+}
+
+// digester computes block and payload digests of a record block as it is written to it.
+// If the block is an HTTP message, the HTTP headers are excluded from the payload digest.
+type digester struct {
+	block     hash.Hash
+	payload   hash.Hash
+	hdr       []byte // block bytes buffered until the end of any HTTP headers is found
+	inPayload bool
+}
+
+const maxHTTPHeader = 1 << 16
+
+func newDigester(blockAlgorithm, payloadAlgorithm string) *digester {
+	d := &digester{}
+	if blockAlgorithm != "" {
+		d.block = newHash(blockAlgorithm)
+	}
+	if payloadAlgorithm != "" {
+		d.payload = newHash(payloadAlgorithm)
+	}
+	return d
+}
+
+func (d *digester) Write(p []byte) (int, error) {
+	if d.block != nil {
+		d.block.Write(p)
+	}
+	if d.payload == nil {
+		return len(p), nil
+	}
+	if d.inPayload {
+		return d.payload.Write(p)
+	}
+	d.hdr = append(d.hdr, p...)
+	if bytes.IndexByte(d.hdr, '\n') < 0 && len(d.hdr) < maxHTTPHeader {
+		return len(p), nil // can't yet tell if an HTTP message
+	}
+	if !isHTTP(d.hdr) || len(d.hdr) >= maxHTTPHeader {
+		d.inPayload = true
+		d.payload.Write(d.hdr)
+		d.hdr = nil
+		return len(p), nil
+	}
+	if i := httpHeaderLen(d.hdr); i > 0 {
+		d.inPayload = true
+		d.payload.Write(d.hdr[i:])
+		d.hdr = nil
+	}
+	return len(p), nil
+}
+
+// sums returns the block and payload digest sums (nil if not computed)
+func (d *digester) sums() ([]byte, []byte) {
+	var b, p []byte
+	if d.block != nil {
+		b = d.block.Sum(nil)
+	}
+	if d.payload != nil {
+		if !d.inPayload && !isHTTP(d.hdr) {
+			d.payload.Write(d.hdr) // a short block that isn't an HTTP message
+			d.hdr, d.inPayload = nil, true
+		}
+		p = d.payload.Sum(nil)
+	}
+	return b, p
+}
@@ -0,0 +1,198 @@
+package webarchive
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDigestWith(t *testing.T) {
+	if _, err := DigestWith("whirlpool", Base32); err != ErrDigestAlgorithm {
+		t.Fatalf("expecting ErrDigestAlgorithm, got %v", err)
+	}
+	for _, c := range []struct {
+		alg    string
+		enc    DigestEncoding
+		expect string
+	}{
+		{"SHA-1", Base32, "sha1:EJMWGY5T3ZALA34YD64F3ARRF2GA5VIR"},
+		{"sha256", Base16, "sha256:a948904f2f0f479b8f8197694b30184b0d2ed1c1cd2a1ec0fb85d299a192a447"},
+		{"sha256", Base64, "sha256:qUiQTy8PR5uPgZdpSzAYSw0u0cHNKh7A+4XSmaGSpEc="},
+		{"BLAKE3", Base16, "blake3:dc5a4edb8240b018124052c330270696f96771a63b45250a5c17d3000e823355"},
+	} {
+		fn, err := DigestWith(c.alg, c.enc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d := fn([]byte("hello world\n"))
+		if d.String() != c.expect {
+			t.Errorf("expecting %s, got %s", c.expect, d)
+		}
+		if sum := newHash(d.Algorithm); sum == nil {
+			t.Errorf("no hash for %s", d.Algorithm)
+		} else if sum.Write([]byte("hello world\n")); !d.matches(sum.Sum(nil)) {
+			t.Errorf("%s doesn't verify", d)
+		}
+	}
+	RegisterDigest("Test-256", func() hash.Hash { return sha256.New() })
+	defer delete(hashes, "test256")
+	fn, err := DigestWith("test256", Base16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello world\n"))
+	}))
+	defer srv.Close()
+	buf := &bytes.Buffer{}
+	rc := NewRecorder(buf)
+	rc.Digest = fn
+	resp, err := (&http.Client{Transport: rc}).Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	recs, _ := readAll(t, buf.Bytes())
+	if pd := recs[0].Get("WARC-Payload-Digest"); pd != "test256:a948904f2f0f479b8f8197694b30184b0d2ed1c1cd2a1ec0fb85d299a192a447" {
+		t.Errorf("bad payload digest %s", pd)
+	}
+	var out bytes.Buffer
+	if _, err := Recompress(&out, bytes.NewReader(buf.Bytes()), NoCompression, 0); err != nil {
+		t.Errorf("expecting registered digests to verify, got %v", err)
+	}
+}
+
+func TestDigestEncode(t *testing.T) {
+	a, _ := ParseDigest("sha1:2001c08ba3c91a3c7b84b6f0df3b0b8f2d2d8a2c")
+	b, _ := ParseDigest("SHA-1:IAHAi6PJGjx7hLbw3zsLjy0tiiw=")
+	c, _ := ParseDigest("sha1:EAA4BC5DZENDY64EW3YN6OYLR4WS3CRM")
+	for _, d := range []Digest{a, b, c} {
+		e, err := d.Encode(Base32)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e.String() != c.String() {
+			t.Errorf("expecting %s, got %s", c, e)
+		}
+		if !d.Equal(c) {
+			t.Errorf("expecting %s to equal %s", d, c)
+		}
+	}
+	if e, _ := b.Encode(Base16); e.String() != a.String() {
+		t.Errorf("expecting %s, got %s", a, e)
+	}
+	if e, _ := a.Encode(Base64); e.Value != b.Value {
+		t.Errorf("expecting %s, got %s", b.Value, e.Value)
+	}
+	if a.Equal(Digest{Algorithm: "sha256", Value: a.Value}) {
+		t.Error("digests of different algorithms shouldn't be equal")
+	}
+	if _, err := (Digest{Algorithm: "sha1", Value: "abc"}).Encode(Base16); err != ErrDigest {
+		t.Errorf("expecting ErrDigest, got %v", err)
+	}
+	if _, err := (Digest{Algorithm: "whirlpool", Value: "abc"}).Sum(); err != ErrDigestAlgorithm {
+		t.Errorf("expecting ErrDigestAlgorithm, got %v", err)
+	}
+}
+
+func TestBlake3(t *testing.T) {
+	// from the official test vectors, of inputs of the bytes 0 to 250 repeated
+	for _, c := range []struct {
+		l      int
+		expect string
+	}{
+		{0, "af1349b9f5f9a1a6a0404dea36dcc9499bcb25c9adc112b7cc9a93cae41f3262"},
+		{1, "2d3adedff11b61f14c886e35afa036736dcd87a74d27b5c1510225d0f592e213"},
+		{1023, "10108970eeda3eb932baac1428c7a2163b0e924c9a9e25b35bba72b28f70bd11"},
+		{1024, "42214739f095a406f3fc83deb889744ac00df831c10daa55189b5d121c855af7"},
+		{1025, "d00278ae47eb27b34faecf67b4fe263f82d5412916c1ffd97c8cb7fb814b8444"},
+		{2049, "5f4d72f40d7a5f82b15ca2b2e44b1de3c2ef86c426c95c1af0b6879522563030"},
+		{3072, "b98cb0ff3623be03326b373de6b9095218513e64f1ee2edd2525c7ad1e5cffd2"},
+		{31744, "62b6960e1a44bcc1eb1a611a8d6235b6b4b78f32e7abc4fb4c6cdcce94895c47"},
+	} {
+		in := make([]byte, c.l)
+		for i := range in {
+			in[i] = byte(i % 251)
+		}
+		h := newBlake3()
+		// write in uneven pieces, to cross block and chunk boundaries
+		for p := in; len(p) > 0; {
+			n := 100
+			if n > len(p) {
+				n = len(p)
+			}
+			h.Write(p[:n])
+			p = p[n:]
+		}
+		if got := hex.EncodeToString(h.Sum(nil)); got != c.expect {
+			t.Errorf("blake3 of %d bytes: expecting %s, got %s", c.l, c.expect, got)
+		}
+	}
+}
+
+func TestDigestReader(t *testing.T) {
+	if _, err := NewDigestReader(nil, Base32, "sha1", "whirlpool"); err != ErrDigestAlgorithm {
+		t.Fatalf("expecting ErrDigestAlgorithm, got %v", err)
+	}
+	dr, err := NewDigestReader(strings.NewReader("hello world\n"), Base16, "SHA-1", "sha256")
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 5)
+	if _, err := dr.Read(buf); err != nil || dr.Digests() != nil {
+		t.Fatalf("expecting no digests before EOF, got %v %v", dr.Digests(), err)
+	}
+	b, err := ioutil.ReadAll(dr)
+	if err != nil || string(buf)+string(b) != "hello world\n" {
+		t.Fatalf("bad read %q %v", b, err)
+	}
+	d := dr.Digests()
+	if len(d) != 2 {
+		t.Fatalf("expecting 2 digests, got %v", d)
+	}
+	if d[0].String() != "sha1:22596363b3de40b06f981fb85d82312e8c0ed511" {
+		t.Errorf("bad sha1 digest %s", d[0])
+	}
+	if d[1].String() != "sha256:a948904f2f0f479b8f8197694b30184b0d2ed1c1cd2a1ec0fb85d299a192a447" {
+		t.Errorf("bad sha256 digest %s", d[1])
+	}
+}
+
+func TestFileDigest(t *testing.T) {
+	if _, err := NewReader(bytes.NewReader(nil), WithFileDigest("whirlpool")); err != ErrDigestAlgorithm {
+		t.Fatalf("expecting ErrDigestAlgorithm, got %v", err)
+	}
+	for _, name := range []string{"examples/hello-world.warc", "examples/IAH-20080430204825-00000-blackbook.warc.gz", "examples/IAH-20080430204825-00000-blackbook.arc"} {
+		byt, err := ioutil.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sum := sha256.Sum256(byt)
+		expect := Digest{Algorithm: "sha256", Value: Base32.encode(sum[:])}
+		rep, err := Validate(bytes.NewReader(byt), WithFileDigest("sha256"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !rep.FileDigest.Equal(expect) {
+			t.Errorf("%s: expecting %s, got %s", name, expect, rep.FileDigest)
+		}
+		rdr, _ := NewReader(bytes.NewReader(byt), WithFileDigest("sha256"))
+		if _, ok := rdr.(*MultiReader).FileDigest(); ok {
+			t.Errorf("%s: expecting no digest before EOF", name)
+		}
+		for {
+			if _, err := rdr.NextHeader(); err != nil {
+				break
+			}
+		}
+		if d, ok := rdr.(*MultiReader).FileDigest(); !ok || !d.Equal(expect) {
+			t.Errorf("%s: expecting %s after NextHeader, got %s", name, expect, d)
+		}
+	}
+}
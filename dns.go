@@ -0,0 +1,86 @@
+// Copyright 2015 Richard Lehane. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webarchive
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// DNSAnswer is a resource record returned by a DNS lookup.
+type DNSAnswer struct {
+	Type  string // record type e.g. "A", "AAAA" or "CNAME"; an empty Type is taken to be "A" or "AAAA" as suits Value
+	Value string // e.g. an IP address, or the target of a CNAME
+	TTL   uint32 // time to live in seconds
+}
+
+// DNSLookup is the result of resolving a host name, for recording in a WARC file with WriteDNS.
+type DNSLookup struct {
+	Name       string // the host name looked up e.g. "www.example.com"
+	Answers    []DNSAnswer
+	Date       time.Time // when the lookup was made; the current time if zero
+	Resolver   string    // IP address of the DNS server, recorded as WARC-IP-Address; may be empty
+	AsResource bool      // write a resource record rather than a response record
+}
+
+// dnsBlock formats a lookup in the form written by Heritrix: a line with the 14 digit date of the lookup,
+// then a zone file line for each answer.
+func dnsBlock(l DNSLookup, date time.Time) []byte {
+	buf := &bytes.Buffer{}
+	buf.WriteString(date.UTC().Format(ARCTime) + "\n")
+	name := strings.TrimSuffix(l.Name, ".") + "."
+	for _, a := range l.Answers {
+		typ := strings.ToUpper(a.Type)
+		if typ == "" {
+			typ = "A"
+			if ip := net.ParseIP(a.Value); ip != nil && ip.To4() == nil {
+				typ = "AAAA"
+			}
+		}
+		fmt.Fprintf(buf, "%s\t%d\tIN\t%s\t%s\n", name, a.TTL, typ, a.Value)
+	}
+	return buf.Bytes()
+}
+
+// WriteDNS writes a WARC 1.0 record of a DNS lookup to w, in the form Heritrix uses: a "dns:" target URI and a
+// text/dns block with the date of the lookup and its answers as zone file lines. Returns the ID of the record.
+func WriteDNS(w io.Writer, l DNSLookup) (string, error) {
+	date := l.Date
+	if date.IsZero() {
+		date = now()
+	}
+	block := dnsBlock(l, date)
+	typ := "response"
+	if l.AsResource {
+		typ = "resource"
+	}
+	id := newRecordID()
+	fields := RawFields{
+		{Key: "WARC-Type", Value: typ},
+		{Key: "WARC-Target-URI", Value: "dns:" + strings.TrimSuffix(l.Name, ".")},
+		{Key: "WARC-Date", Value: formatVersionDate("1.0", date)},
+	}
+	if l.Resolver != "" {
+		fields.Add("WARC-IP-Address", l.Resolver)
+	}
+	fields.Add("WARC-Record-ID", id)
+	fields.Add("Content-Type", "text/dns")
+	fields.Add("WARC-Block-Digest", sha1Digest(block).String())
+	return id, newWARCWriter(w).writeRecord("1.0", fields, bytes.NewReader(block), int64(len(block)))
+}
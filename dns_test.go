@@ -0,0 +1,34 @@
+package webarchive
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestWriteDNS(t *testing.T) {
+	buf := &bytes.Buffer{}
+	id, err := WriteDNS(buf, DNSLookup{
+		Name:     "www.archive.org",
+		Answers:  []DNSAnswer{{Value: "207.241.229.39", TTL: 589}, {Value: "2001:db8::1", TTL: 60}},
+		Date:     time.Date(2008, 4, 30, 20, 48, 25, 0, time.UTC),
+		Resolver: "68.87.76.178",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	recs, blocks := readAll(t, buf.Bytes())
+	if len(recs) != 1 || recs[0].Get("WARC-Record-ID") != id || recs[0].Get("WARC-Type") != "response" ||
+		recs[0].Get("WARC-Target-URI") != "dns:www.archive.org" || recs[0].Get("WARC-IP-Address") != "68.87.76.178" ||
+		recs[0].Get("WARC-Date") != "2008-04-30T20:48:25Z" {
+		t.Fatalf("bad DNS record: %v", recs)
+	}
+	expect := "20080430204825\nwww.archive.org.\t589\tIN\tA\t207.241.229.39\nwww.archive.org.\t60\tIN\tAAAA\t2001:db8::1\n"
+	if string(blocks[0]) != expect {
+		t.Errorf("bad DNS block: %q", blocks[0])
+	}
+	findings, err := Validator{Digests: true}.Validate(bytes.NewReader(buf.Bytes()))
+	if err != nil || len(findings) > 0 {
+		t.Errorf("expecting valid record, got %v %v", findings, err)
+	}
+}
@@ -0,0 +1,324 @@
+// Copyright 2015 Richard Lehane. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webarchive
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Fields is a map of header fields, keyed by their canonical spelling, as returned by a Record's Fields() method.
+// The getters on Fields canonicalise the given key, so GetInt("content-length") will match "Content-Length".
+type Fields map[string][]string
+
+// Get returns the first value for the given key, or an empty string if the field isn't present.
+func (f Fields) Get(key string) string {
+	v := f[normaliseKey([]byte(key))]
+	if len(v) == 0 {
+		return ""
+	}
+	return v[0]
+}
+
+func (f Fields) value(key string) (string, error) {
+	v := f[normaliseKey([]byte(key))]
+	if len(v) == 0 {
+		return "", fmt.Errorf("%w: %s", ErrNoField, key)
+	}
+	return v[0], nil
+}
+
+// GetInt parses the first value for the given key as an integer e.g. Content-Length.
+func (f Fields) GetInt(key string) (int64, error) {
+	v, err := f.value(key)
+	if err != nil {
+		return 0, err
+	}
+	i, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("webarchive: invalid integer in %s field: %w", key, err)
+	}
+	return i, nil
+}
+
+// GetTime parses the first value for the given key as a time.
+// WARC dates (e.g. WARC-Date), HTTP dates (e.g. Last-Modified) and ARC dates are recognised.
+func (f Fields) GetTime(key string) (time.Time, error) {
+	v, err := f.value(key)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if t, err := ParseWARCDate(v); err == nil {
+		return t, nil
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(ARCTime, v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("webarchive: invalid date in %s field: %w", key, err)
+	}
+	return t, nil
+}
+
+// GetDigest parses the first value for the given key as a labelled digest e.g. WARC-Payload-Digest.
+func (f Fields) GetDigest(key string) (Digest, error) {
+	v, err := f.value(key)
+	if err != nil {
+		return Digest{}, err
+	}
+	d, err := ParseDigest(v)
+	if err != nil {
+		return d, fmt.Errorf("%w in %s field", err, key)
+	}
+	return d, nil
+}
+
+// GetURI parses the first value for the given key as a URI e.g. WARC-Target-URI or WARC-Record-ID.
+// Enclosing angle brackets, as used for WARC record IDs, are removed.
+func (f Fields) GetURI(key string) (*url.URL, error) {
+	v, err := f.value(key)
+	if err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(strings.TrimSuffix(strings.TrimPrefix(v, "<"), ">"))
+	if err != nil {
+		return nil, fmt.Errorf("webarchive: invalid URI in %s field: %w", key, err)
+	}
+	return u, nil
+}
+
+// RawField is a header field as it appeared in the source record.
+// The Key retains its original spelling (e.g. "WARC-Ip-Address" rather than the
+// canonical "WARC-IP-Address"). Lines within a header block that are not fields,
+// such as an HTTP status line or the terminating blank line, are kept as RawFields
+// with an empty Key so that a header block can be re-serialised exactly.
+type RawField struct {
+	Key   string
+	Value string
+	raw   []byte // source bytes, including line endings and any continuation lines
+}
+
+// Canonical returns the canonical spelling of the field's key, as used in the Fields() map.
+func (f RawField) Canonical() string {
+	if f.Key == "" {
+		return ""
+	}
+	return normaliseKey([]byte(f.Key))
+}
+
+// Bytes returns the field as it appeared in the source. If the field was not read
+// from a source, it is formatted as "Key: Value" with a CRLF line ending.
+func (f RawField) Bytes() []byte {
+	if f.raw != nil {
+		return f.raw
+	}
+	if f.Key == "" {
+		return []byte(f.Value + "\r\n")
+	}
+	return []byte(f.Key + ": " + f.Value + "\r\n")
+}
+
+// RawFields is an ordered list of header fields in their original spelling.
+type RawFields []RawField
+
+// Get returns the first value for the given key. The lookup is canonicalised, so
+// Get("warc-ip-address") will match a field spelled "WARC-IP-Address".
+func (r RawFields) Get(key string) string {
+	k := normaliseKey([]byte(key))
+	for _, f := range r {
+		if f.Key != "" && f.Canonical() == k {
+			return f.Value
+		}
+	}
+	return ""
+}
+
+// Values returns all values for the given key, using a canonicalised lookup.
+func (r RawFields) Values(key string) []string {
+	var ret []string
+	k := normaliseKey([]byte(key))
+	for _, f := range r {
+		if f.Key != "" && f.Canonical() == k {
+			ret = append(ret, f.Value)
+		}
+	}
+	return ret
+}
+
+// Clone returns a copy of the fields that can be modified without altering r.
+func (r RawFields) Clone() RawFields {
+	if r == nil {
+		return nil
+	}
+	ret := make(RawFields, len(r))
+	copy(ret, r)
+	return ret
+}
+
+// Set replaces the value of the first field matching key (retaining the original spelling of
+// the key) and removes any other fields matching key. If there is no match, the field is added.
+func (r *RawFields) Set(key, value string) {
+	k := normaliseKey([]byte(key))
+	for i := 0; i < len(*r); i++ {
+		f := (*r)[i]
+		if f.Key == "" || f.Canonical() != k {
+			continue
+		}
+		(*r)[i] = RawField{Key: f.Key, Value: value}
+		for j := len(*r) - 1; j > i; j-- {
+			if (*r)[j].Key != "" && (*r)[j].Canonical() == k {
+				*r = append((*r)[:j], (*r)[j+1:]...)
+			}
+		}
+		return
+	}
+	r.Add(key, value)
+}
+
+// Add appends a field. If the fields end with a blank line, the new field is inserted before it.
+func (r *RawFields) Add(key, value string) {
+	f := RawField{Key: key, Value: value}
+	l := len(*r)
+	if l > 0 && (*r)[l-1].Key == "" && (*r)[l-1].Value == "" {
+		*r = append(*r, (*r)[l-1])
+		(*r)[l-1] = f
+		return
+	}
+	*r = append(*r, f)
+}
+
+// Del removes all fields matching key.
+func (r *RawFields) Del(key string) {
+	k := normaliseKey([]byte(key))
+	ret := (*r)[:0]
+	for _, f := range *r {
+		if f.Key != "" && f.Canonical() == k {
+			continue
+		}
+		ret = append(ret, f)
+	}
+	*r = ret
+}
+
+// WriteTo writes the fields to w exactly as they appeared in the source.
+func (r RawFields) WriteTo(w io.Writer) (int64, error) {
+	var n int64
+	for _, f := range r {
+		i, err := w.Write(f.Bytes())
+		n += int64(i)
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// parse a header block into RawFields, retaining the source bytes of each line
+func getRawFields(buf []byte) RawFields {
+	var ret RawFields
+	for len(buf) > 0 {
+		var line []byte
+		if i := bytes.IndexByte(buf, '\n'); i > -1 {
+			line, buf = buf[:i+1], buf[i+1:]
+		} else {
+			line, buf = buf, nil
+		}
+		// continuation lines begin with whitespace; fold them into the preceding field
+		if len(ret) > 0 && ret[len(ret)-1].Key != "" && skipspace(line) > 0 && len(bytes.TrimSpace(line)) > 0 {
+			last := &ret[len(ret)-1]
+			last.raw = append(last.raw, line...)
+			last.Value += " " + string(bytes.TrimSpace(line))
+			continue
+		}
+		f := RawField{raw: append([]byte(nil), line...)}
+		if parts := bytes.SplitN(line, []byte(":"), 2); len(parts) == 2 && len(parts[0]) > 0 && bytes.IndexAny(parts[0], " \t") < 0 {
+			f.Key, f.Value = string(parts[0]), string(bytes.TrimSpace(parts[1]))
+		} else {
+			f.Value = string(bytes.TrimRight(line, "\r\n"))
+		}
+		ret = append(ret, f)
+	}
+	return ret
+}
+
+// FieldParser parses the values of a header field into a typed value.
+// It is given all values for the field, in the order they appear in the record.
+type FieldParser func(values []string) (interface{}, error)
+
+// WithFieldParser registers a FieldParser for the named header field. The parser is invoked
+// as each record is read and its result can be retrieved with the record's Parsed method.
+// For payload records, the parser is also applied to any stripped HTTP headers.
+//
+// Example:
+//
+//	rdr, _ := webarchive.NewReader(f, webarchive.WithFieldParser("WARC-JSON-Metadata", webarchive.JSONField))
+//	rec, _ := rdr.Next()
+//	meta, err := rec.Parsed("WARC-JSON-Metadata")
+func WithFieldParser(key string, fn FieldParser) Option {
+	return func(r *reader) {
+		if r.parsers == nil {
+			r.parsers = make(map[string]FieldParser)
+		}
+		r.parsers[normaliseKey([]byte(key))] = fn
+	}
+}
+
+// JSONField is a FieldParser that decodes the first value of a field as JSON.
+func JSONField(values []string) (interface{}, error) {
+	var v interface{}
+	err := json.Unmarshal([]byte(values[0]), &v)
+	return v, err
+}
+
+type parsedField struct {
+	val interface{}
+	err error
+}
+
+type parsedFields map[string]parsedField
+
+func (p parsedFields) get(key string) (interface{}, error) {
+	k := normaliseKey([]byte(key))
+	f, ok := p[k]
+	if !ok {
+		return nil, ErrNoParser
+	}
+	return f.val, f.err
+}
+
+func (r *reader) parseFields(buf []byte) parsedFields {
+	if len(r.parsers) == 0 {
+		return nil
+	}
+	ret := make(parsedFields)
+	for k, fn := range r.parsers {
+		vals := getSingleValues(buf, k)
+		if len(vals) == 0 {
+			ret[k] = parsedField{}
+			continue
+		}
+		v, err := fn(vals)
+		ret[k] = parsedField{v, err}
+	}
+	return ret
+}
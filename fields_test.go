@@ -0,0 +1,113 @@
+package webarchive
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestRawFields(t *testing.T) {
+	checkExamples(t)
+	buf, _ := ioutil.ReadFile("examples/decode.warc")
+	rdr, err := NewWARCReader(bytes.NewReader(buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec, err := rdr.NextPayload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw := rec.RawFields()
+	if v := raw.Get("warc-ip-address"); v != "173.194.72.121" {
+		t.Errorf("expecting 173.194.72.121, got %s", v)
+	}
+	if v := raw.Get("WARC-Target-URI"); v != "http://www.itforarchivists.com/" {
+		t.Errorf("expecting http://www.itforarchivists.com/, got %s", v)
+	}
+	out := &bytes.Buffer{}
+	raw.WriteTo(out)
+	if !bytes.Contains(buf, out.Bytes()) {
+		t.Errorf("re-serialised fields don't match the source:\n%s", out.Bytes())
+	}
+}
+
+func TestRawFieldsCasing(t *testing.T) {
+	raw := getRawFields([]byte("warc-ip-address: 127.0.0.1\r\nX-Folded: one\r\n two\r\n\r\n"))
+	if len(raw) != 3 {
+		t.Fatalf("expecting 3 fields, got %d", len(raw))
+	}
+	if raw[0].Key != "warc-ip-address" || raw[0].Canonical() != "WARC-IP-Address" {
+		t.Errorf("bad key casing: %s, %s", raw[0].Key, raw[0].Canonical())
+	}
+	if raw[1].Value != "one two" {
+		t.Errorf("expecting folded value, got %s", raw[1].Value)
+	}
+	out := &bytes.Buffer{}
+	raw.WriteTo(out)
+	if out.String() != "warc-ip-address: 127.0.0.1\r\nX-Folded: one\r\n two\r\n\r\n" {
+		t.Errorf("bad re-serialisation: %q", out.String())
+	}
+}
+
+func TestFieldParser(t *testing.T) {
+	rec := "WARC/1.1\r\nWARC-Type: resource\r\nWARC-Date: 2015-07-08T21:55:13Z\r\n" +
+		"WARC-JSON-Metadata: {\"title\": \"hello\"}\r\nContent-Length: 0\r\n\r\n\r\n\r\n"
+	rdr, err := NewWARCReader(strings.NewReader(rec), WithFieldParser("warc-json-metadata", JSONField))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := rdr.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := r.Parsed("WARC-JSON-Metadata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m, ok := v.(map[string]interface{}); !ok || m["title"] != "hello" {
+		t.Errorf("bad parse of JSON metadata: %v", v)
+	}
+	if _, err := r.Parsed("WARC-Profile"); err != ErrNoParser {
+		t.Errorf("expecting ErrNoParser, got %v", err)
+	}
+}
+
+func TestTypedFields(t *testing.T) {
+	checkExamples(t)
+	f, _ := os.Open("examples/hello-world.warc")
+	defer f.Close()
+	rdr, err := NewWARCReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rdr.Next()
+	rec, err := rdr.NextPayload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := rec.Fields()
+	if i, err := fields.GetInt("content-length"); err != nil || i != 494 {
+		t.Errorf("expecting 494, got %d (%v)", i, err)
+	}
+	if d, err := fields.GetTime("WARC-Date"); err != nil || d.Format(WARCTime) != "2015-07-08T21:55:13Z" {
+		t.Errorf("expecting 2015-07-08T21:55:13Z, got %v (%v)", d, err)
+	}
+	if d, err := fields.GetTime("Last-Modified"); err != nil || d.Year() != 2015 {
+		t.Errorf("expecting HTTP date in 2015, got %v (%v)", d, err)
+	}
+	if d, err := fields.GetDigest("WARC-Payload-Digest"); err != nil || d.Algorithm != "sha1" {
+		t.Errorf("expecting a sha1 digest, got %v (%v)", d, err)
+	}
+	if u, err := fields.GetURI("WARC-Target-URI"); err != nil || u.Host != "iipc.github.io" {
+		t.Errorf("expecting host iipc.github.io, got %v (%v)", u, err)
+	}
+	if u, err := fields.GetURI("WARC-Record-ID"); err != nil || u.Scheme != "urn" {
+		t.Errorf("expecting urn scheme, got %v (%v)", u, err)
+	}
+	if _, err := fields.GetInt("WARC-Segment-Number"); !errors.Is(err, ErrNoField) {
+		t.Errorf("expecting ErrNoField, got %v", err)
+	}
+}
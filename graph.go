@@ -0,0 +1,115 @@
+// Copyright 2015 Richard Lehane. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webarchive
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// HostEdge is an edge of a host-level link graph: the number of links from pages on one host to distinct URLs on
+// another.
+type HostEdge struct {
+	From  string
+	To    string
+	Count int
+}
+
+// HostGraph reads the WARC file in r and aggregates the links of its HTML pages (as found for WAT files) into a
+// host-level link graph. Links are resolved against the URL of their page; only links to http and https URLs are
+// counted, and each URL is counted once per page. Links between pages on the same host are left out.
+//
+// Edges are sorted by From and then To.
+func HostGraph(r io.Reader) ([]HostEdge, error) {
+	rdr, err := NewWARCReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer rdr.Close()
+	counts := make(map[[2]string]int)
+	for {
+		rec, err := rdr.Next()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		if rdr.RecordType() != TypeResponse {
+			continue
+		}
+		base, err := url.Parse(rec.URL())
+		if err != nil || base.Host == "" {
+			continue
+		}
+		block, err := ioutil.ReadAll(rec)
+		if err != nil {
+			return nil, err
+		}
+		hdr, body := payloadOf(block)
+		if hdr == nil || !isHTTPResponse(hdr) {
+			continue
+		}
+		if isHTML, _ := textual(mediaType(getSelectValues(hdr, "Content-Type")[0])); !isHTML {
+			continue
+		}
+		from := strings.ToLower(base.Hostname())
+		seen := make(map[string]bool)
+		for _, l := range watHTML(body).Links {
+			u, err := url.Parse(strings.TrimSpace(l.URL))
+			if err != nil {
+				continue
+			}
+			u = base.ResolveReference(u)
+			if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				continue
+			}
+			u.Fragment = ""
+			if seen[u.String()] {
+				continue
+			}
+			seen[u.String()] = true
+			if to := strings.ToLower(u.Hostname()); to != from {
+				counts[[2]string{from, to}]++
+			}
+		}
+	}
+	edges := make([]HostEdge, 0, len(counts))
+	for k, c := range counts {
+		edges = append(edges, HostEdge{From: k[0], To: k[1], Count: c})
+	}
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].From != edges[j].From {
+			return edges[i].From < edges[j].From
+		}
+		return edges[i].To < edges[j].To
+	})
+	return edges, nil
+}
+
+// WriteHostGraph writes edges as an edge list: a line for each edge with the from and to hosts and the count,
+// separated by tabs.
+func WriteHostGraph(w io.Writer, edges []HostEdge) error {
+	bw := bufio.NewWriter(w)
+	for _, e := range edges {
+		fmt.Fprintf(bw, "%s\t%s\t%d\n", e.From, e.To, e.Count)
+	}
+	return bw.Flush()
+}
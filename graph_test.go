@@ -0,0 +1,37 @@
+package webarchive
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestHostGraph(t *testing.T) {
+	buf := &bytes.Buffer{}
+	ww := newWARCWriter(buf)
+	for _, p := range [][2]string{
+		{"http://a.example/", `<a href="http://b.example/x">x</a><a href="http://b.example/x#top">x</a><a href="//b.example/y">y</a>
+<img src="https://cdn.example/i.png"><a href="/local">local</a><a href="mailto:me@a.example">mail</a>`},
+		{"http://a.example/2", `<a href="http://B.example/x">x</a>`},
+		{"http://b.example/x", `<a href="http://a.example/">a</a>`},
+	} {
+		resp := []byte("HTTP/1.1 200 OK\r\nContent-Type: text/html\r\n\r\n" + p[1])
+		if err := ww.writeExchange("1.0", exchange{
+			uri:  p[0],
+			date: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+			req:  []byte("GET / HTTP/1.1\r\n\r\n"),
+			resp: resp,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	edges, err := HostGraph(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := &bytes.Buffer{}
+	WriteHostGraph(out, edges)
+	if expect := "a.example\tb.example\t3\na.example\tcdn.example\t1\nb.example\ta.example\t1\n"; out.String() != expect {
+		t.Errorf("expecting %q, got %q", expect, out.String())
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright 2015 Richard Lehane. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webarchive
+
+import (
+	"bytes"
+	"html"
+	"strings"
+)
+
+// htmlToken is a tag or run of text in an HTML document. Text tokens have an empty name.
+type htmlToken struct {
+	name    string // lower-cased tag name, without any leading "/"
+	closing bool
+	attrs   map[string]string // lower-cased attribute names, unescaped values
+	text    string            // unescaped text, for text tokens
+}
+
+// tokenizeHTML calls fn for each tag and run of text in an HTML document. Comments and doctypes are skipped,
+// as is the content of script and style elements. It is a forgiving tokenizer for pulling text and links
+// out of archived pages, not a conforming HTML parser.
+func tokenizeHTML(b []byte, fn func(htmlToken)) {
+	for len(b) > 0 {
+		i := bytes.IndexByte(b, '<')
+		if i < 0 {
+			fn(htmlToken{text: html.UnescapeString(string(b))})
+			return
+		}
+		if i > 0 {
+			fn(htmlToken{text: html.UnescapeString(string(b[:i]))})
+		}
+		b = b[i:]
+		if bytes.HasPrefix(b, []byte("<!--")) {
+			if j := bytes.Index(b, []byte("-->")); j > -1 {
+				b = b[j+3:]
+			} else {
+				return
+			}
+			continue
+		}
+		j := bytes.IndexByte(b, '>')
+		if j < 0 {
+			return
+		}
+		tag := b[1:j]
+		b = b[j+1:]
+		if len(tag) == 0 || tag[0] == '!' || tag[0] == '?' {
+			continue
+		}
+		tok := parseTag(tag)
+		if tok.name == "" {
+			continue
+		}
+		fn(tok)
+		if !tok.closing && (tok.name == "script" || tok.name == "style") {
+			end := []byte("</" + tok.name)
+			k := bytes.Index(bytes.ToLower(b), end)
+			if k < 0 {
+				return
+			}
+			b = b[k:]
+		}
+	}
+}
+
+func parseTag(tag []byte) htmlToken {
+	var tok htmlToken
+	if tag[0] == '/' {
+		tok.closing = true
+		tag = tag[1:]
+	}
+	tag = bytes.TrimSuffix(tag, []byte("/"))
+	i := bytes.IndexAny(tag, " \t\r\n")
+	if i < 0 {
+		tok.name = strings.ToLower(string(tag))
+		return tok
+	}
+	tok.name = strings.ToLower(string(tag[:i]))
+	tok.attrs = make(map[string]string)
+	s := string(tag[i:])
+	for {
+		s = strings.TrimLeft(s, " \t\r\n")
+		if s == "" {
+			return tok
+		}
+		end := strings.IndexAny(s, "= \t\r\n")
+		if end < 0 {
+			tok.attrs[strings.ToLower(s)] = ""
+			return tok
+		}
+		name := strings.ToLower(s[:end])
+		s = strings.TrimLeft(s[end:], " \t\r\n")
+		if !strings.HasPrefix(s, "=") {
+			tok.attrs[name] = ""
+			continue
+		}
+		s = strings.TrimLeft(s[1:], " \t\r\n")
+		var val string
+		if s != "" && (s[0] == '"' || s[0] == '\'') {
+			if k := strings.IndexByte(s[1:], s[0]); k > -1 {
+				val, s = s[1:k+1], s[k+2:]
+			} else {
+				val, s = s[1:], ""
+			}
+		} else if k := strings.IndexAny(s, " \t\r\n"); k > -1 {
+			val, s = s[:k], s[k:]
+		} else {
+			val, s = s, ""
+		}
+		tok.attrs[name] = html.UnescapeString(val)
+	}
+}
+
+// elements that start a new line of text
+var blockElements = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true, "br": true, "dd": true, "div": true,
+	"dl": true, "dt": true, "figcaption": true, "footer": true, "form": true, "h1": true, "h2": true, "h3": true,
+	"h4": true, "h5": true, "h6": true, "header": true, "hr": true, "li": true, "main": true, "nav": true,
+	"ol": true, "p": true, "pre": true, "section": true, "table": true, "td": true, "th": true, "title": true,
+	"tr": true, "ul": true,
+}
+
+// htmlText extracts the text of an HTML document, one line per block of text
+func htmlText(b []byte) string {
+	var lines []string
+	line := &strings.Builder{}
+	flush := func() {
+		if s := strings.Join(strings.Fields(line.String()), " "); s != "" {
+			lines = append(lines, s)
+		}
+		line.Reset()
+	}
+	tokenizeHTML(b, func(tok htmlToken) {
+		switch {
+		case tok.name == "":
+			line.WriteString(tok.text)
+		case blockElements[tok.name]:
+			flush()
+		}
+	})
+	flush()
+	return strings.Join(lines, "\n")
+}
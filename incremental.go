@@ -0,0 +1,78 @@
+// Copyright 2015 Richard Lehane. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webarchive
+
+// CrawlStatus classifies a capture against an earlier crawl of the same URLs, for checking incremental harvests.
+type CrawlStatus int
+
+const (
+	Unclassified     CrawlStatus = iota // not a capture, or read without a prior index
+	CaptureNew                          // the URL wasn't captured in the earlier crawl
+	CaptureChanged                      // the URL was captured in the earlier crawl, with a different payload
+	CaptureUnchanged                    // the URL was captured in the earlier crawl, with the same payload digest
+)
+
+func (s CrawlStatus) String() string {
+	switch s {
+	case CaptureNew:
+		return "new"
+	case CaptureChanged:
+		return "changed"
+	case CaptureUnchanged:
+		return "unchanged"
+	}
+	return "unclassified"
+}
+
+// WithPriorIndex makes a WARC reader classify each response, resource and revisit record against the CDX index of
+// an earlier crawl. URLs are compared in SURT form, with the latest capture of each URL in prior, and payloads by the
+// WARC-Payload-Digest of the record (for revisits, the digest of the payload they revisit). Records or captures
+// without a payload digest can't be shown to be unchanged, so are classified as changed.
+//
+// The classification is available from the record's CrawlStatus method.
+func WithPriorIndex(prior []*CDX) Option {
+	digests := make(map[string]Digest)
+	for _, c := range latestCaptures(prior) {
+		d, err := ParseDigest(c.Digest)
+		if err != nil && c.Digest != "" {
+			d = Digest{Algorithm: "sha1", Value: c.Digest}
+		}
+		digests[c.SURT] = d
+	}
+	return func(r *reader) {
+		r.prior = digests
+	}
+}
+
+// classify a record against the payload digests of a prior index
+func classify(prior map[string]Digest, typ, url, digest string) CrawlStatus {
+	if prior == nil || url == "" {
+		return Unclassified
+	}
+	switch RecordType(typ) {
+	default:
+		return Unclassified
+	case TypeResponse, TypeResource, TypeRevisit:
+	}
+	pd, ok := prior[canonical(url)]
+	if !ok {
+		return CaptureNew
+	}
+	d, err := ParseDigest(digest)
+	if err != nil || pd.Value == "" || !d.Equal(pd) {
+		return CaptureChanged
+	}
+	return CaptureUnchanged
+}
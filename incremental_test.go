@@ -0,0 +1,78 @@
+package webarchive
+
+import (
+	"io"
+	"os"
+	"testing"
+)
+
+func crawlStatuses(t *testing.T, prior []*CDX) map[string]CrawlStatus {
+	f, err := os.Open("examples/hello-world.warc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rdr, err := NewWARCReader(f, WithPriorIndex(prior))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rdr.Close()
+	ret := make(map[string]CrawlStatus)
+	for {
+		rec, err := rdr.Next()
+		if err != nil {
+			if err != io.EOF {
+				t.Fatal(err)
+			}
+			return ret
+		}
+		if rec.(WARCRecord).CrawlStatus() != rdr.CrawlStatus() {
+			t.Fatal("expecting the record and reader to agree")
+		}
+		ret[rdr.Type()+" "+rec.URL()] = rdr.CrawlStatus()
+	}
+}
+
+func TestWithPriorIndex(t *testing.T) {
+	checkExamples(t)
+	f, err := os.Open("examples/hello-world.warc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	prior, err := Index(f, "hello-world.warc")
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, s := range crawlStatuses(t, prior) {
+		switch {
+		case k[:8] == "response":
+			if s != CaptureUnchanged {
+				t.Errorf("%s: expecting unchanged, got %s", k, s)
+			}
+		case k[:8] == "resource":
+			// wget's log resources have no payload digest
+			if s != CaptureChanged {
+				t.Errorf("%s: expecting changed, got %s", k, s)
+			}
+		case s != Unclassified:
+			t.Errorf("%s: expecting unclassified, got %s", k, s)
+		}
+	}
+	changed := make([]*CDX, len(prior))
+	for i, c := range prior {
+		cp := *c
+		cp.Digest = "sha1:" + "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA"
+		changed[i] = &cp
+	}
+	for k, s := range crawlStatuses(t, changed) {
+		if (k[:8] == "response" || k[:8] == "resource") && s != CaptureChanged {
+			t.Errorf("%s: expecting changed, got %s", k, s)
+		}
+	}
+	for k, s := range crawlStatuses(t, []*CDX{}) {
+		if (k[:8] == "response" || k[:8] == "resource") && s != CaptureNew {
+			t.Errorf("%s: expecting new, got %s", k, s)
+		}
+	}
+}
@@ -0,0 +1,435 @@
+// Copyright 2015 Richard Lehane. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webarchive
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base32"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Index reads the WARC file in r and returns a CDX entry for each response, resource and revisit record,
+// in file order. The filename is recorded in each entry.
+//
+// Offsets and lengths are of the record within the file. For a .warc.gz file, they are of the gzip
+// member holding the record: files that are gzipped as a single stream, rather than record by record,
+// can't be usefully indexed. ARC files are indexed with IndexARC.
+func Index(r io.Reader, filename string) ([]*CDX, error) {
+	var entries []*CDX
+	err := scanRecords(r, func(rdr *WARCReader, rec Record, _ int64) ([]*CDX, error) {
+		c, err := cdxEntry(rdr, rec)
+		if c == nil || err != nil {
+			return nil, err
+		}
+		c.Filename = filename
+		entries = append(entries, c)
+		return []*CDX{c}, nil
+	})
+	return entries, err
+}
+
+// ScanFunc is called by Scan and ScanPayloads for each record, with the offset of the record within the file.
+// For a .warc.gz file, the offset is of the gzip member holding the record.
+type ScanFunc func(rec Record, offset int64) error
+
+// Scan calls fn for each record in the WARC file in r, in file order.
+func Scan(r io.Reader, fn ScanFunc) error {
+	return scanRecords(r, func(_ *WARCReader, rec Record, offset int64) ([]*CDX, error) {
+		return nil, fn(rec, offset)
+	})
+}
+
+// ScanPayloads calls fn for each response, resource and conversion record in the WARC file in r, in file order.
+// As with NextPayload, HTTP headers are stripped from response records and are available in their Fields.
+// Unlike NextPayload, continuation records are skipped rather than merged.
+func ScanPayloads(r io.Reader, fn ScanFunc) error {
+	return scanRecords(r, func(rdr *WARCReader, rec Record, offset int64) ([]*CDX, error) {
+		if rdr.segment > 0 {
+			return nil, nil
+		}
+		switch rdr.typ {
+		case "resource", "conversion":
+		case "response":
+			if err := rdr.stripHTTP(); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, nil
+		}
+		if err := rdr.sniffPayload(); err != nil {
+			return nil, err
+		}
+		return nil, fn(rec, offset)
+	})
+}
+
+// scanRecords calls fn for each record in the WARC file in r, with the offset of the record (or its gzip member).
+// It then sets the offset and length of the record (or its gzip member) in the CDX entries returned by fn.
+func scanRecords(r io.Reader, fn func(*WARCReader, Record, int64) ([]*CDX, error)) error {
+	cr := &counter{r: r}
+	br := bufio.NewReader(cr)
+	pos := func() int64 { return cr.n - int64(br.Buffered()) }
+	var rdr *WARCReader
+	next := func(src io.Reader) error {
+		if rdr == nil {
+			var err error
+			rdr, err = NewWARCReader(src)
+			return err
+		}
+		return rdr.Reset(src)
+	}
+	setExtent := func(entries []*CDX, offset int64) {
+		for _, c := range entries {
+			c.Offset, c.Length = offset, pos()-offset
+		}
+	}
+	if buf, err := br.Peek(4); err == nil && isgzip(buf) {
+		var g gzipOpener
+		for {
+			offset := pos()
+			if _, err := br.Peek(1); err == io.EOF {
+				return nil
+			}
+			zr, err := g.open(br)
+			if err != nil {
+				return err
+			}
+			if err = next(zr); err != nil {
+				return err
+			}
+			var entries []*CDX
+			for {
+				rec, err := rdr.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					return err
+				}
+				e, err := fn(rdr, rec, offset)
+				if err != nil {
+					return err
+				}
+				entries = append(entries, e...)
+			}
+			if _, err = io.Copy(ioutil.Discard, zr); err != nil {
+				return err
+			}
+			setExtent(entries, offset)
+		}
+	}
+	for {
+		// skip any blank lines before the record
+		for {
+			b, err := br.Peek(1)
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if b[0] != '\r' && b[0] != '\n' {
+				break
+			}
+			br.Discard(1)
+		}
+		offset := pos()
+		var hdr []byte
+		for {
+			line, err := br.ReadSlice('\n')
+			if err != nil && err != bufio.ErrBufferFull {
+				if err == io.EOF {
+					return io.ErrUnexpectedEOF
+				}
+				return err
+			}
+			hdr = append(hdr, line...)
+			if err == nil && len(bytes.TrimSpace(line)) == 0 {
+				break
+			}
+		}
+		sz, err := strconv.ParseInt(getSelectValues(hdr, "Content-Length")[0], 10, 64)
+		if err != nil {
+			return ErrWARCHeader
+		}
+		block := io.LimitReader(br, sz)
+		if err = next(io.MultiReader(bytes.NewReader(hdr), block)); err != nil {
+			return err
+		}
+		rec, err := rdr.Next()
+		if err != nil {
+			return err
+		}
+		entries, err := fn(rdr, rec, offset)
+		if err != nil {
+			return err
+		}
+		if _, err = io.Copy(ioutil.Discard, block); err != nil {
+			return err
+		}
+		// the record ends with two CRLFs
+		for i := 0; i < 4; i++ {
+			if b, err := br.Peek(1); err != nil || (b[0] != '\r' && b[0] != '\n') {
+				break
+			}
+			br.Discard(1)
+		}
+		setExtent(entries, offset)
+	}
+}
+
+// OffsetFunc is called by ScanOffsets with the offset and length of each record, or gzip member, within the file.
+type OffsetFunc func(offset, length int64) error
+
+// ScanOffsets calls fn with the extent of each record in the WARC file in r, in file order, as a fast first pass for
+// building coarse indexes of large files. Records aren't parsed: for a .warc.gz file, the extents are of its gzip
+// members, found by decompressing each one without reading it; for an uncompressed file, the headers of each record
+// are only searched for its Content-Length, and its block is skipped (by seeking, if r is an io.Seeker).
+//
+// Files that are gzipped as a single stream, rather than record by record, have a single extent.
+func ScanOffsets(r io.Reader, fn OffsetFunc) error {
+	cr := &counter{r: r}
+	br := bufio.NewReader(cr)
+	pos := func() int64 { return cr.n - int64(br.Buffered()) }
+	if buf, err := br.Peek(4); err == nil && isgzip(buf) {
+		var g gzipOpener
+		for {
+			offset := pos()
+			if _, err := br.Peek(1); err == io.EOF {
+				return nil
+			}
+			zr, err := g.open(br)
+			if err != nil {
+				return err
+			}
+			if _, err = io.Copy(ioutil.Discard, zr); err != nil {
+				return err
+			}
+			if err = fn(offset, pos()-offset); err != nil {
+				return err
+			}
+		}
+	}
+	seeker, _ := r.(io.Seeker)
+	skip := func(n int64) error {
+		if b := int64(br.Buffered()); seeker != nil && n > b {
+			br.Discard(int(b))
+			if _, err := seeker.Seek(n-b, io.SeekCurrent); err != nil {
+				return err
+			}
+			cr.n += n - b
+			br.Reset(cr)
+			return nil
+		}
+		_, err := io.CopyN(ioutil.Discard, br, n)
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	for {
+		// skip any blank lines before the record
+		for {
+			b, err := br.Peek(1)
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if b[0] != '\r' && b[0] != '\n' {
+				break
+			}
+			br.Discard(1)
+		}
+		offset := pos()
+		sz := int64(-1)
+		for {
+			line, err := br.ReadSlice('\n')
+			if err != nil && err != bufio.ErrBufferFull {
+				if err == io.EOF {
+					return io.ErrUnexpectedEOF
+				}
+				return err
+			}
+			if err == nil && len(bytes.TrimSpace(line)) == 0 {
+				break
+			}
+			if len(line) > 15 && bytes.EqualFold(line[:15], []byte("Content-Length:")) {
+				if sz, err = strconv.ParseInt(string(bytes.TrimSpace(line[15:])), 10, 64); err != nil {
+					return ErrWARCHeader
+				}
+			}
+		}
+		if sz < 0 {
+			return ErrWARCHeader
+		}
+		if err := skip(sz); err != nil {
+			return err
+		}
+		// the record ends with two CRLFs
+		for i := 0; i < 4; i++ {
+			if b, err := br.Peek(1); err != nil || (b[0] != '\r' && b[0] != '\n') {
+				break
+			}
+			br.Discard(1)
+		}
+		if err := fn(offset, pos()-offset); err != nil {
+			return err
+		}
+	}
+}
+
+// cdxEntry returns a CDX entry (without filename, offset or length) for response, resource and revisit records.
+// Other records return nil.
+func cdxEntry(rdr *WARCReader, rec Record) (*CDX, error) {
+	typ := strings.ToLower(rdr.Type())
+	if typ != "response" && typ != "resource" && typ != "revisit" {
+		return nil, nil
+	}
+	fields := rec.Fields()
+	c := &CDX{
+		SURT: canonical(rec.URL()),
+		Date: rec.Date(),
+		URL:  rec.URL(),
+		MIME: mediaType(fields.Get("Content-Type")),
+	}
+	pd, _ := ParseDigest(fields.Get("WARC-Payload-Digest"))
+	if err := readEntry(c, rec, typ != "resource", pd.Value == "" && typ != "revisit"); err != nil {
+		return nil, err
+	}
+	if typ == "revisit" {
+		c.MIME = "warc/revisit"
+	}
+	if c.Digest == "" {
+		c.Digest = pd.Value
+	}
+	return c, nil
+}
+
+// readEntry reads the block of a record for its CDX entry: the status, MIME type and redirect of an HTTP response,
+// if resp is set, and the base32 sha1 digest of its payload, if digest is set
+func readEntry(c *CDX, block io.Reader, resp, digest bool) error {
+	var dg *digester
+	if digest {
+		dg = newDigester("", "sha1")
+	}
+	head := &prefix{max: maxHTTPHeader}
+	var dst io.Writer = head
+	if dg != nil {
+		dst = io.MultiWriter(head, dg)
+	}
+	if _, err := io.Copy(dst, block); err != nil {
+		return err
+	}
+	if resp {
+		if l := httpHeaderLen(head.buf); l > 0 && isHTTPResponse(head.buf) {
+			if resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(head.buf[:l])), nil); err == nil {
+				c.Status = strconv.Itoa(resp.StatusCode)
+				c.MIME = mediaType(resp.Header.Get("Content-Type"))
+				c.Redirect = resp.Header.Get("Location")
+				resp.Body.Close()
+			}
+		}
+	}
+	if dg != nil {
+		_, sum := dg.sums()
+		c.Digest = base32.StdEncoding.EncodeToString(sum)
+	}
+	return nil
+}
+
+// IndexARC reads the ARC file in r and returns a CDX entry for each of its URL records, in file order. The filename
+// is recorded in each entry. The status, redirect and MIME type of HTTP responses are taken from their HTTP headers,
+// and the digest is the sha1 of the payload.
+//
+// ARC files, such as those of the Internet Archive, are usually gzipped with a member for each record: in an .arc.gz
+// file, offsets and lengths are of the gzip member holding each record (see ARCReader.CompressedOffset). In an
+// uncompressed file, they are of the record itself.
+func IndexARC(r io.Reader, filename string) ([]*CDX, error) {
+	rdr, err := NewARCReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer rdr.Close()
+	var entries []*CDX
+	for {
+		rec, err := rdr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return entries, err
+		}
+		c := &CDX{
+			SURT:     canonical(rec.URL()),
+			Date:     rec.Date(),
+			URL:      rec.URL(),
+			MIME:     mediaType(rec.MIME()),
+			Filename: filename,
+		}
+		if u, ok := rdr.arcHeader.(*url2); ok && u.statusCode != 0 {
+			c.Status = strconv.Itoa(u.statusCode)
+		}
+		if err := readEntry(c, rec, true, true); err != nil {
+			return entries, err
+		}
+		if rdr.members != nil {
+			c.Offset, c.Length = rdr.CompressedOffset(), rdr.CompressedLength()
+		} else {
+			// the length of a record is known once the next one begins
+			c.Offset = rdr.recOff
+			if len(entries) > 0 {
+				prev := entries[len(entries)-1]
+				prev.Length = c.Offset - prev.Offset
+			}
+		}
+		entries = append(entries, c)
+	}
+	if len(entries) > 0 && rdr.members == nil {
+		last := entries[len(entries)-1]
+		last.Length = rdr.offset() - last.Offset
+	}
+	return entries, nil
+}
+
+// mediaType drops any parameters from a Content-Type value
+func mediaType(ct string) string {
+	if i := strings.IndexByte(ct, ';'); i > -1 {
+		ct = ct[:i]
+	}
+	return strings.ToLower(strings.TrimSpace(ct))
+}
+
+// prefix is a writer that keeps the first max bytes written to it
+type prefix struct {
+	buf []byte
+	max int
+}
+
+func (p *prefix) Write(b []byte) (int, error) {
+	if n := p.max - len(p.buf); n > 0 {
+		if n > len(b) {
+			n = len(b)
+		}
+		p.buf = append(p.buf, b[:n]...)
+	}
+	return len(b), nil
+}
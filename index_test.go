@@ -0,0 +1,243 @@
+package webarchive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestIndex(t *testing.T) {
+	checkExamples(t)
+	for _, name := range []string{"examples/hello-world.warc", "examples/IAH-20080430204825-00000-blackbook.warc.gz"} {
+		f, _ := os.Open(name)
+		entries, err := Index(f, "test.warc")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) == 0 {
+			t.Fatalf("%s: no CDX entries", name)
+		}
+		// each entry should point at its record
+		for _, c := range entries {
+			rdr, err := NewWARCReader(io.NewSectionReader(f, c.Offset, c.Length))
+			if err != nil {
+				t.Fatalf("%s: bad offset %d: %v", name, c.Offset, err)
+			}
+			rec, err := rdr.Next()
+			if err != nil || rec.URL() != c.URL {
+				t.Fatalf("%s: expecting %s at offset %d, got %v", name, c.URL, c.Offset, err)
+			}
+			rdr.Close()
+		}
+		f.Close()
+		if name == "examples/hello-world.warc" {
+			c := entries[0]
+			if len(entries) != 3 || c.Status != "200" || c.MIME != "text/plain" || c.Digest != "XMABAYFTCASBJ5QATNBILSXH6PSZEMG4" || entries[1].Digest != "KTV2WSNW5VSOLYZINAXKR3LXV7T4MMGI" {
+				t.Errorf("bad CDX entries: %v", entries)
+			}
+			if !strings.HasPrefix(c.String(), "io,github,iipc)/warc-specifications/primers/web-archive-formats/hello-world.txt 20150708215513 http") {
+				t.Errorf("bad CDX line: %s", c.String())
+			}
+		}
+	}
+}
+
+func TestScanPayloads(t *testing.T) {
+	checkExamples(t)
+	f, _ := os.Open("examples/hello-world.warc")
+	defer f.Close()
+	var offsets []int64
+	var payload []byte
+	err := ScanPayloads(f, func(rec Record, offset int64) error {
+		if len(offsets) == 0 {
+			payload, _ = ioutil.ReadAll(rec)
+		}
+		offsets = append(offsets, offset)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(offsets) != 3 || offsets[0] != 1260 || offsets[1] != 2772 || !strings.HasPrefix(string(payload), "Hello World") {
+		t.Errorf("bad scan: %v %q", offsets, payload)
+	}
+}
+
+func TestIndexGzipHeaderFields(t *testing.T) {
+	checkExamples(t)
+	src, _ := ioutil.ReadFile("examples/hello-world.warc")
+	offsets := []int{0, 589, 1260, 2349, 2772, 3340, len(src)}
+	// compress each record as a member with the optional header fields written by some WARC writers
+	buf := &bytes.Buffer{}
+	for i := 1; i < len(offsets); i++ {
+		zw := gzip.NewWriter(buf)
+		zw.Header.Name, zw.Header.Comment, zw.Header.Extra = "hello-world.warc", "record "+strconv.Itoa(i), []byte("sl\x04\x00abcd")
+		zw.Write(src[offsets[i-1]:offsets[i]])
+		zw.Close()
+	}
+	if !isgzip(buf.Bytes()) {
+		t.Fatal("expecting gzip to be detected")
+	}
+	rdr, err := NewReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	for _, err = rdr.Next(); err == nil; _, err = rdr.Next() {
+		n++
+	}
+	if err != io.EOF || n != 6 {
+		t.Fatalf("expecting 6 records, got %d %v", n, err)
+	}
+	entries, err := Index(bytes.NewReader(buf.Bytes()), "test.warc.gz")
+	if err != nil || len(entries) != 3 {
+		t.Fatalf("expecting 3 CDX entries, got %v %v", entries, err)
+	}
+	for _, c := range entries {
+		rdr, err := NewWARCReader(io.NewSectionReader(bytes.NewReader(buf.Bytes()), c.Offset, c.Length))
+		if err != nil {
+			t.Fatalf("bad offset %d: %v", c.Offset, err)
+		}
+		if rec, err := rdr.Next(); err != nil || rec.URL() != c.URL {
+			t.Fatalf("expecting %s at offset %d, got %v", c.URL, c.Offset, err)
+		}
+	}
+}
+
+func TestScanOffsets(t *testing.T) {
+	checkExamples(t)
+	for _, name := range []string{"examples/hello-world.warc", "examples/IAH-20080430204825-00000-blackbook.warc", "examples/IAH-20080430204825-00000-blackbook.warc.gz"} {
+		f, _ := os.Open(name)
+		var expect []int64
+		if err := Scan(f, func(_ Record, offset int64) error {
+			expect = append(expect, offset)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		buf, _ := ioutil.ReadFile(name)
+		// with and without seeking
+		for _, r := range []io.Reader{f, bytes.NewBuffer(buf)} {
+			f.Seek(0, io.SeekStart)
+			var got []int64
+			var end int64
+			if err := ScanOffsets(r, func(offset, length int64) error {
+				if offset != end {
+					t.Errorf("%s: expecting extent to start at %d, got %d", name, end, offset)
+				}
+				got, end = append(got, offset), offset+length
+				return nil
+			}); err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(expect) || got[len(got)-1] != expect[len(expect)-1] || end != int64(len(buf)) {
+				t.Errorf("%s: expecting %d extents ending at %d, got %d ending at %d", name, len(expect), len(buf), len(got), end)
+			}
+		}
+		f.Close()
+	}
+}
+
+func TestCompressedOffsets(t *testing.T) {
+	checkExamples(t)
+	for _, name := range []string{"examples/IAH-20080430204825-00000-blackbook.warc.gz", "examples/IAH-20080430204825-00000-blackbook.arc.gz"} {
+		f, _ := os.Open(name)
+		type ext struct{ off, l int64 }
+		var expect []ext
+		if err := ScanOffsets(f, func(offset, length int64) error {
+			expect = append(expect, ext{offset, length})
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if strings.HasSuffix(name, ".arc.gz") {
+			expect = expect[1:] // the version block isn't returned as a record
+		}
+		f.Seek(0, io.SeekStart)
+		rdr, err := NewReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mr := rdr.(*MultiReader)
+		var got []ext
+		for i := 0; ; i++ {
+			rec, err := rdr.Next()
+			if err != nil {
+				break
+			}
+			// records that haven't been read from have an unknown length
+			if i%2 == 0 {
+				if l := mr.CompressedLength(); l != -1 && l != expect[len(got)].l {
+					t.Fatalf("%s: bad length %d before reading record %d", name, l, i)
+				}
+				got = append(got, ext{mr.CompressedOffset(), -1})
+				continue
+			}
+			ioutil.ReadAll(rec)
+			if mr.CompressedLength() == -1 {
+				t.Fatalf("%s: expecting a length once record %d is read", name, i)
+			}
+			got = append(got, ext{mr.CompressedOffset(), mr.CompressedLength()})
+		}
+		rdr.Close()
+		f.Close()
+		if len(got) != len(expect) {
+			t.Fatalf("%s: expecting %d records, got %d", name, len(expect), len(got))
+		}
+		for i := range got {
+			if got[i].off != expect[i].off || (got[i].l != -1 && got[i].l != expect[i].l) {
+				t.Fatalf("%s: record %d: expecting extent %v, got %v", name, i, expect[i], got[i])
+			}
+		}
+	}
+	f, _ := os.Open("examples/hello-world.warc")
+	defer f.Close()
+	rdr, _ := NewWARCReader(f)
+	rdr.Next()
+	if rdr.CompressedOffset() != -1 || rdr.CompressedLength() != -1 {
+		t.Error("expecting no compressed extents for an uncompressed file")
+	}
+}
+
+func TestIndexARC(t *testing.T) {
+	checkExamples(t)
+	index := func(name string) ([]*CDX, []byte) {
+		b, _ := ioutil.ReadFile(name)
+		entries, err := IndexARC(bytes.NewReader(b), filepath.Base(name))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		return entries, b
+	}
+	gz, gzb := index("examples/IAH-20080430204825-00000-blackbook.arc.gz")
+	arc, arcb := index("examples/IAH-20080430204825-00000-blackbook.arc")
+	if len(gz) != 299 || len(arc) != len(gz) {
+		t.Fatalf("expecting 299 entries, got %d and %d", len(gz), len(arc))
+	}
+	for i, c := range gz {
+		a := arc[i]
+		if c.URL != a.URL || c.Digest != a.Digest || c.Status != a.Status || c.MIME != a.MIME || c.Digest == "" {
+			t.Fatalf("entry %d: expecting the same entry from the .arc and .arc.gz, got\n%s\n%s", i, c, a)
+		}
+		zr, err := gzip.NewReader(bytes.NewReader(gzb[c.Offset : c.Offset+c.Length]))
+		if err != nil {
+			t.Fatalf("entry %d: bad gzip extent %d %d", i, c.Offset, c.Length)
+		}
+		member, _ := ioutil.ReadAll(zr)
+		if !bytes.HasPrefix(member, []byte(c.URL+" ")) || !bytes.Equal(bytes.TrimSpace(member), bytes.TrimSpace(arcb[a.Offset:a.Offset+a.Length])) {
+			t.Fatalf("entry %d: expecting the extents of %s to hold the record", i, c.URL)
+		}
+	}
+	if last := arc[len(arc)-1]; last.Offset+last.Length != int64(len(arcb)) {
+		t.Errorf("expecting the last record to end the file, got %d", last.Offset+last.Length)
+	}
+	if gz[0].Filename != "IAH-20080430204825-00000-blackbook.arc.gz" || gz[1].Status != "200" {
+		t.Errorf("bad entries %s %s", gz[0], gz[1])
+	}
+}
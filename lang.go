@@ -0,0 +1,74 @@
+// Copyright 2015 Richard Lehane. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webarchive
+
+import "io"
+
+// LanguageDetector identifies the language of a text, returning a language code (e.g. "en" or "eng"), or an empty
+// string if the language can't be identified. This package doesn't include a detector: wrap one such as
+// github.com/pemistahl/lingua-go or a CLD2 binding.
+type LanguageDetector func(text string) string
+
+// langLen is the number of decoded payload bytes examined when detecting languages
+const langLen = 4096
+
+// WithLanguageDetector makes a WARC reader identify the language of each HTML and plain text payload record returned
+// by NextPayload, using d on the text of the first 4096 bytes of the decoded payload. The language is available from
+// the record's Language method. Records with a WARC-Identified-Content-Language field are not examined.
+func WithLanguageDetector(d LanguageDetector) Option {
+	return func(r *reader) {
+		r.detector = d
+	}
+}
+
+// detectLanguage identifies the language of a payload, which begins with buf, with any encodings still applied
+func detectLanguage(d LanguageDetector, buf []byte, mime string, encodings []string) string {
+	isHTML, ok := textual(mediaType(mime))
+	if !ok {
+		return ""
+	}
+	if len(encodings) > 0 {
+		// buf may be a truncated prefix of the encoded payload, so use whatever can be decoded from it
+		buf, _ = decodeBytes(buf, encodings)
+	}
+	if len(buf) > langLen {
+		buf = buf[:langLen]
+	}
+	text := string(buf)
+	if isHTML {
+		text = htmlText(buf)
+	}
+	if text == "" {
+		return ""
+	}
+	return d(text)
+}
+
+// identifyLanguage detects the language of the current payload record, if a detector is set
+func (w *WARCReader) identifyLanguage() error {
+	if w.detector == nil || getSelectValues(w.fields, "WARC-Identified-Content-Language")[0] != "" {
+		return nil
+	}
+	l := int64(langLen)
+	if w.sz-w.thisIdx < l {
+		l = w.sz - w.thisIdx
+	}
+	buf, err := w.peek(int(l))
+	if err != nil && err != io.EOF {
+		return err
+	}
+	w.lang = detectLanguage(w.detector, buf, w.MIME(), w.encodings())
+	return nil
+}
@@ -0,0 +1,50 @@
+package webarchive
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func testDetector(text string) string {
+	if strings.Contains(text, "Hello") {
+		return "en"
+	}
+	return ""
+}
+
+func TestLanguageDetector(t *testing.T) {
+	checkExamples(t)
+	f, _ := os.Open("examples/hello-world.warc")
+	defer f.Close()
+	rdr, err := NewWARCReader(f, WithLanguageDetector(testDetector))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec, err := rdr.NextPayload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lang := rec.(WARCRecord).Language(); lang != "en" {
+		t.Errorf("expecting en, got %q", lang)
+	}
+	if b, _ := ioutil.ReadAll(rec); string(b) != "Hello World\n\n" {
+		t.Errorf("expecting detection not to consume the payload, got %q", b)
+	}
+	f.Seek(0, 0)
+	buf := &bytes.Buffer{}
+	if _, err = WARCToWAT(buf, f, "", WithLanguageDetector(testDetector)); err != nil {
+		t.Fatal(err)
+	}
+	_, blocks := readAll(t, buf.Bytes())
+	var wat WAT
+	if err := json.Unmarshal(blocks[3], &wat); err != nil {
+		t.Fatal(err)
+	}
+	if resp := wat.Envelope.PayloadMetadata.HTTPResponseMetadata; resp == nil || resp.Language != "en" {
+		t.Errorf("bad WAT language: %+v", resp)
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright 2015 Richard Lehane. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webarchive
+
+import (
+	"bufio"
+	"encoding/base32"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ManifestEntry is a line of a fixity manifest: the ID, offset and digest of a record's block.
+type ManifestEntry struct {
+	ID     string // WARC-Record-ID
+	Offset int64  // offset of the record, or of its gzip member, in the file
+	Digest Digest // digest of the record's block, as computed when the manifest was made
+}
+
+// String returns the entry as a manifest line: record ID, offset and labelled digest separated by tabs.
+func (e ManifestEntry) String() string {
+	return e.ID + "\t" + strconv.FormatInt(e.Offset, 10) + "\t" + e.Digest.String()
+}
+
+// Manifest reads the WARC file in r and returns a manifest entry for each record, in file order.
+// Block digests are computed, with the given algorithm (e.g. "sha256"), from the content of each record:
+// any WARC-Block-Digest given in the record is not used.
+// Returns ErrDigestAlgorithm if the algorithm is not supported.
+func Manifest(r io.Reader, algorithm string) ([]ManifestEntry, error) {
+	if newHash(algorithm) == nil {
+		return nil, ErrDigestAlgorithm
+	}
+	var entries []ManifestEntry
+	err := Scan(r, func(rec Record, offset int64) error {
+		h := newHash(algorithm)
+		if _, err := io.Copy(h, rec); err != nil {
+			return err
+		}
+		entries = append(entries, ManifestEntry{
+			ID:     rec.(WARCRecord).ID(),
+			Offset: offset,
+			Digest: Digest{Algorithm: algorithmKey(algorithm), Value: base32.StdEncoding.EncodeToString(h.Sum(nil))},
+		})
+		return nil
+	})
+	return entries, err
+}
+
+// WriteManifest writes manifest entries to w, one per line.
+func WriteManifest(w io.Writer, entries []ManifestEntry) error {
+	bw := bufio.NewWriter(w)
+	for _, e := range entries {
+		bw.WriteString(e.String())
+		bw.WriteByte('\n')
+	}
+	return bw.Flush()
+}
+
+// ReadManifest reads the manifest entries written by WriteManifest. Blank lines and lines beginning with "#" are skipped.
+func ReadManifest(r io.Reader) ([]ManifestEntry, error) {
+	var entries []ManifestEntry
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.Split(line, "\t")
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("webarchive: bad manifest line %d", n)
+		}
+		off, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("webarchive: bad offset on manifest line %d", n)
+		}
+		d, err := ParseDigest(parts[2])
+		if err != nil {
+			return nil, fmt.Errorf("webarchive: bad digest on manifest line %d", n)
+		}
+		entries = append(entries, ManifestEntry{ID: parts[0], Offset: off, Digest: d})
+	}
+	return entries, scanner.Err()
+}
+
+// VerifyManifest reads the WARC file in r and checks it against a manifest made by Manifest, returning findings
+// for records whose digests don't match (these wrap ErrDigestMatch) and for records that have moved, are missing from
+// the manifest or are missing from the file (these wrap ErrManifest, and findings for records missing from the file
+// have a Record of -1). Records are matched to manifest entries by ID.
+func VerifyManifest(r io.Reader, entries []ManifestEntry) ([]Finding, error) {
+	byID := make(map[string][]ManifestEntry)
+	for _, e := range entries {
+		byID[e.ID] = append(byID[e.ID], e)
+	}
+	var findings []Finding
+	var idx int
+	err := Scan(r, func(rec Record, offset int64) error {
+		id := rec.(WARCRecord).ID()
+		add := func(err error) {
+			findings = append(findings, Finding{Record: idx, ID: id, Err: err})
+		}
+		defer func() { idx++ }()
+		if len(byID[id]) == 0 {
+			add(fmt.Errorf("%w: record is missing from the manifest", ErrManifest))
+			return nil
+		}
+		e := byID[id][0]
+		byID[id] = byID[id][1:]
+		h := newHash(e.Digest.Algorithm)
+		if h == nil {
+			add(fmt.Errorf("%w: %s", ErrDigestAlgorithm, e.Digest.Algorithm))
+			return nil
+		}
+		if _, err := io.Copy(h, rec); err != nil {
+			return err
+		}
+		if !e.Digest.matches(h.Sum(nil)) {
+			add(fmt.Errorf("%w: manifest digest is %s", ErrDigestMatch, e.Digest))
+		}
+		if e.Offset != offset {
+			add(fmt.Errorf("%w: record has moved from offset %d to %d", ErrManifest, e.Offset, offset))
+		}
+		return nil
+	})
+	for _, e := range entries {
+		if rest := byID[e.ID]; len(rest) > 0 && rest[0] == e {
+			findings = append(findings, Finding{Record: -1, ID: e.ID, Err: fmt.Errorf("%w: record at offset %d is missing from the file", ErrManifest, e.Offset)})
+			byID[e.ID] = rest[1:]
+		}
+	}
+	return findings, err
+}
@@ -0,0 +1,46 @@
+package webarchive
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestManifest(t *testing.T) {
+	in, err := ioutil.ReadFile("examples/hello-world.warc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Manifest(bytes.NewReader(in), "whirlpool"); err != ErrDigestAlgorithm {
+		t.Fatalf("expecting ErrDigestAlgorithm, got %v", err)
+	}
+	entries, err := Manifest(bytes.NewReader(in), "sha256")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 6 || entries[2].Offset != 1260 || entries[2].Digest.Algorithm != "sha256" {
+		t.Fatalf("bad manifest: %v", entries)
+	}
+	buf := &bytes.Buffer{}
+	if err := WriteManifest(buf, entries); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadManifest(strings.NewReader("# fixity audit\n" + buf.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if findings, err := VerifyManifest(bytes.NewReader(in), read); err != nil || len(findings) > 0 {
+		t.Fatalf("expecting file to match its manifest, got %v %v", findings, err)
+	}
+	tampered := strings.Replace(string(in), "Hello World", "Hello Wyrld", 1)
+	findings, _ := VerifyManifest(strings.NewReader(tampered), read)
+	if len(findings) != 1 || !errors.Is(findings[0], ErrDigestMatch) || findings[0].Record != 2 {
+		t.Errorf("expecting a digest mismatch for record 2, got %v", findings)
+	}
+	findings, _ = VerifyManifest(bytes.NewReader(in[:entries[5].Offset]), read[1:])
+	if len(findings) != 2 || !errors.Is(findings[0], ErrManifest) || findings[1].Record != -1 {
+		t.Errorf("expecting missing records to be reported, got %v", findings)
+	}
+}
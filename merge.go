@@ -0,0 +1,137 @@
+// Copyright 2015 Richard Lehane. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webarchive
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// Merger concatenates the records of many WARC files into one or more output files.
+//
+// The warcinfo records of the inputs are consolidated: each output begins with a single
+// new warcinfo record whose block contains the distinct fields of all the input warcinfo
+// records, and the WARC-Warcinfo-ID of merged records is updated to refer to it. Other records
+// are copied unchanged, preserving their record IDs and digests.
+//
+// Example:
+//
+//	m := &webarchive.Merger{Outputs: webarchive.FileOutputs("out", "merged", webarchive.NoCompression), MaxSize: 1 << 30}
+//	err := m.Merge("a.warc.gz", "b.warc.gz")
+type Merger struct {
+	Outputs        Outputs // opens each output file
+	MaxSize        int64   // start a new output once the current one reaches MaxSize bytes; 0 for no limit
+	DropDuplicates bool    // skip records with a WARC-Record-ID that has already been written
+}
+
+// Merge merges the WARC files at the given paths, in order. Input files may be gzipped.
+func (m *Merger) Merge(paths ...string) error {
+	info, ids, err := consolidateWarcinfo(paths)
+	if err != nil {
+		return err
+	}
+	out := &rotator{outputs: m.Outputs}
+	defer out.abort()
+	var infoID string
+	seen := make(map[string]bool)
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		rdr, err := NewWARCReader(f)
+		if err != nil {
+			f.Close()
+			return err
+		}
+		for {
+			rec, err := rdr.Next()
+			if err != nil {
+				rdr.Close()
+				f.Close()
+				if err == io.EOF {
+					break
+				}
+				return err
+			}
+			if ids[rdr.ID()] {
+				continue
+			}
+			if m.DropDuplicates {
+				if seen[rdr.ID()] {
+					continue
+				}
+				seen[rdr.ID()] = true
+			}
+			if out.warcWriter == nil || (m.MaxSize > 0 && out.warcWriter.n >= m.MaxSize) {
+				if err = out.rotate(); err != nil {
+					return err
+				}
+				if infoID, err = out.writeWarcinfo(rdr.Version(), out.name, info); err != nil {
+					return err
+				}
+			}
+			fields := rec.RawFields()
+			if ids[fields.Get("WARC-Warcinfo-ID")] {
+				fields.Set("WARC-Warcinfo-ID", infoID)
+			}
+			if err = out.writeRecord(rdr.Version(), fields, rec, rec.Size()); err != nil {
+				return err
+			}
+		}
+	}
+	return out.close()
+}
+
+// read the leading warcinfo records of each file, returning the distinct lines of their
+// blocks and the set of their record IDs
+func consolidateWarcinfo(paths []string) ([]byte, map[string]bool, error) {
+	block := &bytes.Buffer{}
+	lines := make(map[string]bool)
+	ids := make(map[string]bool)
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		rdr, err := NewWARCReader(f)
+		if err != nil {
+			f.Close()
+			return nil, nil, err
+		}
+		for {
+			rec, err := rdr.Next()
+			if err != nil || rdr.Type() != "warcinfo" {
+				break
+			}
+			ids[rdr.ID()] = true
+			b, _ := ioutil.ReadAll(rec)
+			for _, l := range bytes.Split(b, []byte("\n")) {
+				l = bytes.TrimSpace(l)
+				if len(l) == 0 || lines[string(l)] {
+					continue
+				}
+				lines[string(l)] = true
+				block.Write(l)
+				block.WriteString("\r\n")
+			}
+		}
+		rdr.Close()
+		f.Close()
+	}
+	return block.Bytes(), ids, nil
+}
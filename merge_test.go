@@ -0,0 +1,45 @@
+package webarchive
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	checkExamples(t)
+	dir, err := ioutil.TempDir("", "webarchive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	m := &Merger{Outputs: FileOutputs(dir, "merged", NoCompression), DropDuplicates: true}
+	if err := m.Merge("examples/hello-world.warc", "examples/hello-world.warc"); err != nil {
+		t.Fatal(err)
+	}
+	buf, err := ioutil.ReadFile(filepath.Join(dir, "merged-00000.warc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	recs, _ := readAll(t, buf)
+	if len(recs) != 6 {
+		t.Fatalf("expecting 6 records, got %d", len(recs))
+	}
+	if recs[0].Get("WARC-Type") != "warcinfo" || recs[0].Get("WARC-Filename") != "merged-00000.warc" {
+		t.Errorf("bad warcinfo: %v", recs[0])
+	}
+	if recs[1].Get("WARC-Warcinfo-ID") != recs[0].Get("WARC-Record-ID") {
+		t.Errorf("expecting warcinfo ID to be rewritten, got %s", recs[1].Get("WARC-Warcinfo-ID"))
+	}
+	if recs[2].Get("WARC-Record-ID") != "<urn:uuid:3C74F309-6B37-461C-B982-1B5C447C3C0E>" {
+		t.Errorf("expecting record IDs to be preserved, got %s", recs[2].Get("WARC-Record-ID"))
+	}
+	m = &Merger{Outputs: FileOutputs(dir, "rotated", NoCompression), MaxSize: 1}
+	if err := m.Merge("examples/hello-world.warc", "examples/hello-world.warc"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "rotated-00009.warc")); err != nil {
+		t.Errorf("expecting 10 output files: %v", err)
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright 2015 Richard Lehane. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webarchive
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"net/textproto"
+	"net/url"
+	"strings"
+)
+
+// MHTMLPart is a resource bundled in an MHTML (multipart/related) document, such as a page saved by a browser along
+// with its images and stylesheets.
+type MHTMLPart struct {
+	URL       string               // resolved Content-Location of the part, or "cid:" and its Content-ID
+	MIME      string               // Content-Type of the part
+	ContentID string               // Content-ID of the part, without angle brackets; may be empty
+	Header    textproto.MIMEHeader // MIME headers of the part
+	Payload   []byte               // content of the part, decoded of any base64 or quoted-printable transfer encoding
+}
+
+// ReadMHTML decodes the parts of the MHTML document held in a response or resource record, as returned by a Reader's
+// Next method. The payload of a response is decoded of any transfer and content encodings. Relative Content-Location
+// URLs are resolved against the URL of the record.
+// Returns ErrMHTML if the payload isn't a multipart/related document.
+func ReadMHTML(rec Record) ([]MHTMLPart, error) {
+	block, err := ioutil.ReadAll(rec)
+	if err != nil {
+		return nil, err
+	}
+	hdr, body := payloadOf(block)
+	ct := rec.Fields().Get("Content-Type")
+	if hdr != nil {
+		ct = getSelectValues(hdr, "Content-Type")[0]
+	}
+	return DecodeMHTML(bytes.NewReader(body), ct, rec.URL())
+}
+
+// DecodeMHTML decodes the parts of an MHTML document, given the body of the document and its Content-Type, which must
+// be multipart/related with a boundary. Relative Content-Location URLs are resolved against base, if it is given.
+// Returns ErrMHTML if the document isn't multipart/related.
+func DecodeMHTML(r io.Reader, contentType, base string) ([]MHTMLPart, error) {
+	mt, params, err := mime.ParseMediaType(contentType)
+	if err != nil || mt != "multipart/related" || params["boundary"] == "" {
+		return nil, ErrMHTML
+	}
+	bu, _ := url.Parse(base)
+	mr := multipart.NewReader(r, params["boundary"])
+	var parts []MHTMLPart
+	for {
+		p, err := mr.NextPart()
+		if err != nil {
+			if err == io.EOF {
+				return parts, nil
+			}
+			return parts, fmt.Errorf("%w: %v", ErrMHTML, err)
+		}
+		part := MHTMLPart{
+			MIME:      p.Header.Get("Content-Type"),
+			ContentID: strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(p.Header.Get("Content-Id")), "<"), ">"),
+			Header:    p.Header,
+		}
+		// quoted-printable parts are decoded by the multipart reader
+		var pr io.Reader = p
+		if strings.EqualFold(strings.TrimSpace(p.Header.Get("Content-Transfer-Encoding")), "base64") {
+			pr = base64.NewDecoder(base64.StdEncoding, p)
+		}
+		if part.Payload, err = ioutil.ReadAll(pr); err != nil {
+			return parts, fmt.Errorf("%w: %v", ErrMHTML, err)
+		}
+		part.URL = strings.TrimSpace(p.Header.Get("Content-Location"))
+		if part.URL != "" && bu != nil {
+			if u, err := url.Parse(part.URL); err == nil {
+				part.URL = bu.ResolveReference(u).String()
+			}
+		}
+		if part.URL == "" && part.ContentID != "" {
+			part.URL = "cid:" + part.ContentID
+		}
+		parts = append(parts, part)
+	}
+}
+
+// MHTMLToWARC reads a standalone MHTML file in r, such as a .mhtml or .mht file saved by a browser, and writes it to w
+// as a WARC 1.0 file. Each part of the file with a URL becomes a resource record, dated with the Date header of the
+// file, and the records of the other parts refer to the first one (normally the saved page) with WARC-Concurrent-To.
+// Parts are identified by their Content-Location, resolved against the Snapshot-Content-Location (as written by
+// Chrome) or Content-Location of the file, or else by their Content-ID as a "cid:" URI. Parts with neither are skipped.
+// Payloads are decoded of their transfer encodings.
+//
+// Returns the number of parts converted, or ErrMHTML if the file isn't multipart/related.
+func MHTMLToWARC(w io.Writer, r io.Reader) (int, error) {
+	msg, err := mail.ReadMessage(r)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrMHTML, err)
+	}
+	base := msg.Header.Get("Snapshot-Content-Location")
+	if base == "" {
+		base = msg.Header.Get("Content-Location")
+	}
+	parts, err := DecodeMHTML(msg.Body, msg.Header.Get("Content-Type"), base)
+	if err != nil {
+		return 0, err
+	}
+	date, err := msg.Header.Date()
+	if err != nil {
+		date = now()
+	}
+	desc := "converted from MHTML file"
+	if subj := msg.Header.Get("Subject"); subj != "" {
+		desc += " " + subj
+	}
+	ww := newWARCWriter(w)
+	info, err := ww.writeWarcinfo("1.0", "", Warcinfo{
+		Software:    software,
+		Format:      "WARC File Format 1.0",
+		ConformsTo:  conformsTo10,
+		Description: desc,
+	}.Bytes())
+	if err != nil {
+		return 0, err
+	}
+	var n int
+	var first string
+	for _, p := range parts {
+		if p.URL == "" {
+			continue
+		}
+		id := newRecordID()
+		fields := RawFields{
+			{Key: "WARC-Type", Value: "resource"},
+			{Key: "WARC-Record-ID", Value: id},
+			{Key: "WARC-Date", Value: formatVersionDate("1.0", date)},
+			{Key: "WARC-Target-URI", Value: p.URL},
+		}
+		if first != "" {
+			fields.Add("WARC-Concurrent-To", first)
+		} else {
+			first = id
+		}
+		fields.Add("WARC-Warcinfo-ID", info)
+		ct := p.MIME
+		if ct == "" {
+			ct = "application/octet-stream"
+		}
+		fields.Add("Content-Type", ct)
+		fields.Add("WARC-Block-Digest", sha1Digest(p.Payload).String())
+		if err = ww.writeRecord("1.0", fields, bytes.NewReader(p.Payload), int64(len(p.Payload))); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
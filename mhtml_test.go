@@ -0,0 +1,110 @@
+package webarchive
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+const testMHTML = "--BOUNDARY\r\n" +
+	"Content-Type: text/html\r\n" +
+	"Content-Location: http://example.com/page.html\r\n" +
+	"Content-Transfer-Encoding: quoted-printable\r\n\r\n" +
+	"<img src=3D\"img.png\">\r\n" +
+	"--BOUNDARY\r\n" +
+	"Content-Type: image/png\r\n" +
+	"Content-Location: img.png\r\n" +
+	"Content-Transfer-Encoding: base64\r\n\r\n" +
+	"iVBORw0K\r\nGgo=\r\n" +
+	"--BOUNDARY\r\n" +
+	"Content-Type: text/css\r\n" +
+	"Content-ID: <css@example>\r\n\r\n" +
+	"body {}\r\n" +
+	"--BOUNDARY--\r\n"
+
+func TestReadMHTML(t *testing.T) {
+	buf := &bytes.Buffer{}
+	resp := "HTTP/1.1 200 OK\r\nContent-Type: multipart/related; boundary=BOUNDARY; type=\"text/html\"\r\n\r\n" + testMHTML
+	if err := newWARCWriter(buf).writeExchange("1.0", exchange{
+		uri:  "http://example.com/saved.mhtml",
+		date: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		req:  []byte("GET /saved.mhtml HTTP/1.1\r\n\r\n"),
+		resp: []byte(resp),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	rdr, err := NewWARCReader(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec, err := rdr.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts, err := ReadMHTML(rec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parts) != 3 {
+		t.Fatalf("expecting 3 parts, got %d", len(parts))
+	}
+	if parts[0].URL != "http://example.com/page.html" || string(parts[0].Payload) != `<img src="img.png">` {
+		t.Errorf("bad first part: %s %q", parts[0].URL, parts[0].Payload)
+	}
+	if parts[1].URL != "http://example.com/img.png" || parts[1].MIME != "image/png" || !bytes.Equal(parts[1].Payload, []byte("\x89PNG\r\n\x1a\n")) {
+		t.Errorf("bad second part: %s %s %q", parts[1].URL, parts[1].MIME, parts[1].Payload)
+	}
+	if parts[2].URL != "cid:css@example" || parts[2].ContentID != "css@example" {
+		t.Errorf("bad third part: %s %s", parts[2].URL, parts[2].ContentID)
+	}
+	if rec, err = rdr.Next(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ReadMHTML(rec); err != ErrMHTML {
+		t.Errorf("expecting ErrMHTML for a request, got %v", err)
+	}
+	if _, err = rdr.Next(); err != io.EOF {
+		t.Errorf("expecting EOF, got %v", err)
+	}
+}
+
+func TestMHTMLToWARC(t *testing.T) {
+	file := "From: <Saved by Blink>\r\n" +
+		"Snapshot-Content-Location: http://example.com/page.html\r\n" +
+		"Subject: Example\r\n" +
+		"Date: Wed, 1 Jan 2020 10:00:00 -0000\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/related; type=\"text/html\"; boundary=\"BOUNDARY\"\r\n\r\n" +
+		testMHTML
+	buf := &bytes.Buffer{}
+	n, err := MHTMLToWARC(buf, bytes.NewReader([]byte(file)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Fatalf("expecting 3 parts, got %d", n)
+	}
+	recs, blocks := readAll(t, buf.Bytes())
+	if len(recs) != 4 || recs[0].Get("WARC-Type") != "warcinfo" {
+		t.Fatalf("bad records: %v", recs)
+	}
+	if !bytes.Contains(blocks[0], []byte("description: converted from MHTML file Example")) {
+		t.Errorf("bad warcinfo: %q", blocks[0])
+	}
+	for i, u := range []string{"http://example.com/page.html", "http://example.com/img.png", "cid:css@example"} {
+		r := recs[i+1]
+		if r.Get("WARC-Type") != "resource" || r.Get("WARC-Target-URI") != u || r.Get("WARC-Date") != "2020-01-01T10:00:00Z" {
+			t.Errorf("bad record %d: %v", i, r)
+		}
+		if i > 0 && r.Get("WARC-Concurrent-To") != recs[1].Get("WARC-Record-ID") {
+			t.Errorf("expecting record %d to be concurrent to the page, got %s", i, r.Get("WARC-Concurrent-To"))
+		}
+	}
+	if string(blocks[3]) != "body {}" || recs[3].Get("Content-Type") != "text/css" {
+		t.Errorf("bad css part: %q %s", blocks[3], recs[3].Get("Content-Type"))
+	}
+	if _, err = MHTMLToWARC(buf, bytes.NewReader([]byte("Content-Type: text/html\r\n\r\n<html>"))); err != ErrMHTML {
+		t.Errorf("expecting ErrMHTML, got %v", err)
+	}
+}
@@ -0,0 +1,245 @@
+// Copyright 2015 Richard Lehane. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webarchive
+
+import (
+	"io"
+	"io/ioutil"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Page is an HTML page captured in a WARC file, grouped with the captures of the resources embedded in it.
+type Page struct {
+	URL       string
+	ID        string // WARC-Record-ID of the page's response record
+	Date      time.Time
+	Size      int64 // length of the page's payload
+	Resources []PageResource
+	Missing   []string // URLs of embedded resources linked from the page that weren't captured
+}
+
+// Weight returns the total length of the payloads of the page and its resources.
+func (p Page) Weight() int64 {
+	n := p.Size
+	for _, r := range p.Resources {
+		n += r.Size
+	}
+	return n
+}
+
+// PageResource is the capture of a resource grouped with a Page.
+type PageResource struct {
+	URL   string
+	ID    string // WARC-Record-ID of the resource's response or resource record
+	Date  time.Time
+	MIME  string
+	Size  int64  // length of the resource's payload
+	Match string // how the resource was matched to the page: "referer", "link" or "time"
+}
+
+// pageCapture is a response or resource record read by Pages
+type pageCapture struct {
+	PageResource
+	norm       string   // normalised URL
+	concurrent []string // WARC-Concurrent-To IDs
+	page       bool     // a successful HTML response
+	links      []string // normalised URLs of embedded resources, for pages
+	idx        int      // index of the page, for pages
+}
+
+// embedding reports whether an HTML link, given by its element and attribute path (e.g. "IMG@/src") and rel
+// attribute, embeds a resource in the page rather than linking to another page
+func embedding(path, rel string) bool {
+	switch path {
+	case "A@/href", "AREA@/href", "FORM@/action":
+		return false
+	case "LINK@/href":
+		rel = strings.ToLower(rel)
+		return strings.Contains(rel, "stylesheet") || strings.Contains(rel, "icon") || strings.Contains(rel, "preload")
+	}
+	return true
+}
+
+// Pages reads the WARC file in r and groups its captures into pages: each successful (2xx) HTML response along with
+// the captures of the resources embedded in it. A capture is matched to a page, in order of preference:
+//   - by the Referer header of its request record;
+//   - by a link in the page's HTML that embeds it (e.g. an img, script or iframe element, or a stylesheet);
+//   - if window is positive, by being captured within window after the page.
+//
+// Where more than one capture of a page could match, the one captured most recently before the resource is
+// preferred. Each capture is grouped with at most one page. HTML pages are only matched to other pages by embedding
+// links (e.g. iframes), since the Referer of a page is usually the page linking to it.
+//
+// Pages are returned in the order of their records, as are the resources of each page.
+func Pages(r io.Reader, window time.Duration) ([]Page, error) {
+	rdr, err := NewWARCReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer rdr.Close()
+	var captures []*pageCapture
+	referers := make(map[string]string) // referers of requests by their ID and the IDs they are concurrent to
+	for {
+		rec, err := rdr.Next()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		typ := rdr.Type()
+		if typ != "response" && typ != "resource" && typ != "request" {
+			continue
+		}
+		block, err := ioutil.ReadAll(rec)
+		if err != nil {
+			return nil, err
+		}
+		hdr, body := payloadOf(block)
+		fields := rec.Fields()
+		if typ == "request" {
+			if ref := getSelectValues(hdr, "Referer")[0]; ref != "" {
+				referers[rdr.ID()] = ref
+				for _, id := range fields["WARC-Concurrent-To"] {
+					referers[id] = ref
+				}
+			}
+			continue
+		}
+		c := &pageCapture{
+			PageResource: PageResource{
+				URL:  rec.URL(),
+				ID:   rdr.ID(),
+				Date: rec.Date(),
+				MIME: mediaType(fields.Get("Content-Type")),
+				Size: int64(len(block) - len(hdr)),
+			},
+			norm:       NormalizeURL(rec.URL(), false),
+			concurrent: fields["WARC-Concurrent-To"],
+		}
+		if hdr != nil {
+			vals := getSelectValues(hdr, "Content-Type")
+			c.MIME = mediaType(vals[0])
+			line, _ := readline(hdr)
+			if status := strings.Fields(string(line)); len(status) > 1 && isHTTPResponse(hdr) {
+				code, _ := strconv.Atoi(status[1])
+				isHTML, _ := textual(c.MIME)
+				c.page = isHTML && code >= 200 && code < 300
+			}
+		}
+		if c.page {
+			base, _ := url.Parse(c.URL)
+			for _, l := range watHTML(body).Links {
+				if !embedding(l.Path, l.Rel) {
+					continue
+				}
+				if u, err := url.Parse(strings.TrimSpace(l.URL)); err == nil && base != nil {
+					c.links = append(c.links, NormalizeURL(base.ResolveReference(u).String(), false))
+				}
+			}
+		}
+		captures = append(captures, c)
+	}
+	return groupPages(captures, referers, window), nil
+}
+
+// groupPages matches captures to pages
+func groupPages(captures []*pageCapture, referers map[string]string, window time.Duration) []Page {
+	var pages []Page
+	byURL := make(map[string][]int)  // indexes in pages by normalised URL
+	byLink := make(map[string][]int) // indexes in pages by the normalised URLs they embed
+	captured := make(map[string]bool)
+	for _, c := range captures {
+		captured[c.norm] = true
+		if !c.page {
+			continue
+		}
+		c.idx = len(pages)
+		pages = append(pages, Page{URL: c.URL, ID: c.ID, Date: c.Date, Size: c.Size})
+		byURL[c.norm] = append(byURL[c.norm], c.idx)
+		for _, l := range c.links {
+			byLink[l] = append(byLink[l], c.idx)
+		}
+	}
+	// nearest returns the page captured most recently before date, or else the earliest after it; -1 if none
+	nearest := func(cands []int, date time.Time, self string) int {
+		best := -1
+		for _, i := range cands {
+			if pages[i].ID == self {
+				continue
+			}
+			switch {
+			case best < 0:
+				best = i
+			case !pages[i].Date.After(date):
+				if pages[best].Date.After(date) || pages[i].Date.After(pages[best].Date) {
+					best = i
+				}
+			case pages[best].Date.After(date) && pages[i].Date.Before(pages[best].Date):
+				best = i
+			}
+		}
+		return best
+	}
+	var last = -1 // the most recently captured page, for matching by time
+	for _, c := range captures {
+		if c.page {
+			last = c.idx
+		}
+		match, idx := "", -1
+		if !c.page {
+			ref := referers[c.ID]
+			for _, id := range c.concurrent {
+				if ref == "" {
+					ref = referers[id]
+				}
+			}
+			if ref != "" {
+				if idx = nearest(byURL[NormalizeURL(ref, false)], c.Date, c.ID); idx > -1 {
+					match = "referer"
+				}
+			}
+		}
+		if idx < 0 {
+			if idx = nearest(byLink[c.norm], c.Date, c.ID); idx > -1 {
+				match = "link"
+			}
+		}
+		if idx < 0 && !c.page && window > 0 && last > -1 {
+			if d := c.Date.Sub(pages[last].Date); d >= 0 && d <= window {
+				idx, match = last, "time"
+			}
+		}
+		if idx < 0 {
+			continue
+		}
+		res := c.PageResource
+		res.Match = match
+		pages[idx].Resources = append(pages[idx].Resources, res)
+	}
+	for _, c := range captures {
+		missing := make(map[string]bool)
+		for _, l := range c.links {
+			if !captured[l] && !missing[l] {
+				missing[l] = true
+				pages[c.idx].Missing = append(pages[c.idx].Missing, l)
+			}
+		}
+	}
+	return pages
+}
@@ -0,0 +1,64 @@
+package webarchive
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestPages(t *testing.T) {
+	buf := &bytes.Buffer{}
+	ww := newWARCWriter(buf)
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	page := `<html><img src="a.png"><script src="/b.js"></script><img src="missing.png"><a href="other.html">other</a></html>`
+	for i, c := range []struct {
+		uri, ct, referer, body string
+		delay                  time.Duration
+	}{
+		{"http://example.com/", "text/html", "", page, 0},
+		{"http://example.com/a.png", "image/png", "", "png", time.Second},                               // linked
+		{"http://example.com/b.js", "application/javascript", "http://example.com/", "js", time.Second}, // referer
+		{"http://example.com/c.css", "text/css", "", "css", 2 * time.Second},                            // time
+		{"http://example.com/other.html", "text/html", "http://example.com/", "<html></html>", 3 * time.Second},
+		{"http://example.com/d.gif", "image/gif", "", "gif", time.Hour}, // outside the window
+	} {
+		req := "GET " + c.uri[len("http://example.com"):] + " HTTP/1.1\r\nHost: example.com\r\n"
+		if c.referer != "" {
+			req += "Referer: " + c.referer + "\r\n"
+		}
+		resp := fmt.Sprintf("HTTP/1.1 200 OK\r\nContent-Type: %s\r\nContent-Length: %d\r\n\r\n%s", c.ct, len(c.body), c.body)
+		if err := ww.writeExchange("1.0", exchange{
+			uri:     c.uri,
+			date:    start.Add(c.delay),
+			req:     []byte(req + "\r\n"),
+			resp:    []byte(resp),
+			payload: []byte(c.body),
+		}); err != nil {
+			t.Fatalf("exchange %d: %v", i, err)
+		}
+	}
+	pages, err := Pages(bytes.NewReader(buf.Bytes()), 10*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) != 2 || pages[0].URL != "http://example.com/" || pages[1].URL != "http://example.com/other.html" {
+		t.Fatalf("bad pages: %v", pages)
+	}
+	var matches []string
+	for _, r := range pages[0].Resources {
+		matches = append(matches, r.URL[len("http://example.com/"):]+" "+r.Match)
+	}
+	if fmt.Sprint(matches) != "[a.png link b.js referer c.css time]" {
+		t.Errorf("bad resources: %v", matches)
+	}
+	if len(pages[0].Missing) != 1 || pages[0].Missing[0] != "http://example.com/missing.png" {
+		t.Errorf("bad missing resources %v", pages[0].Missing)
+	}
+	if w := pages[0].Weight(); w != int64(len(page)+len("pngjscss")) {
+		t.Errorf("bad page weight %d", w)
+	}
+	if len(pages[1].Resources) != 0 {
+		t.Errorf("expecting no resources for the second page, got %v", pages[1].Resources)
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright 2015 Richard Lehane. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webarchive
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// PartitionOutputs opens the output file for a partition of a Partitioner, given its key: a host, a SURT prefix, or ""
+// for records that belong to no partition. It returns the name of the file, which is recorded in the WARC-Filename
+// field of its warcinfo record, and a writer for the file.
+type PartitionOutputs func(key string) (string, io.WriteCloser, error)
+
+// FilePartitionOutputs returns PartitionOutputs that create files in dir, named with the given prefix and the key
+// e.g. "crawl-example.com.warc", with the extension of compression c (see FileOutputs). Characters of the key that
+// aren't allowed in file names are replaced with an underscore, and the empty key is named "_".
+func FilePartitionOutputs(dir, prefix string, c Compression) PartitionOutputs {
+	ext := fileExt(c)
+	return func(key string) (string, io.WriteCloser, error) {
+		name := prefix + "-" + safeSegment(key) + ext
+		f, err := os.Create(filepath.Join(dir, name))
+		return name, f, err
+	}
+}
+
+// Partitioner splits a WARC file into an output file for each host, or each SURT prefix, of the target URIs of its
+// records, so that a large crawl of many sites can be distributed to the owners of each site.
+//
+// Records are partitioned by the host of their target URI unless Prefixes are given, in which case each record goes
+// to the partition of the longest prefix that matches the SURT form of its target URI, or to the partition "" if none
+// match. Records without a target URI (such as metadata records) go to the partition of the record they are concurrent
+// to, using WARC-Concurrent-To.
+//
+// As with a Merger, the warcinfo records of the input are consolidated: each output begins with a single new warcinfo
+// record, and the WARC-Warcinfo-ID of partitioned records is updated to refer to it. Other records are copied
+// unchanged. All outputs are open until the input has been read.
+//
+// Example:
+//
+//	p := &webarchive.Partitioner{Outputs: webarchive.FilePartitionOutputs("out", "crawl", webarchive.NoCompression)}
+//	names, err := p.Partition("crawl.warc.gz")
+type Partitioner struct {
+	Outputs  PartitionOutputs // opens the output file of each partition
+	Prefixes []string         // SURT prefixes to partition by; if empty, records are partitioned by host
+}
+
+// Partition splits the WARC file at path, which may be gzipped, and returns the names of the output files by the key
+// of their partition.
+func (p *Partitioner) Partition(path string) (map[string]string, error) {
+	info, ids, err := consolidateWarcinfo([]string{path})
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	rdr, err := NewWARCReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer rdr.Close()
+	outs := make(map[string]*rotator)
+	infoIDs := make(map[string]string) // IDs of the warcinfo record of each output
+	defer func() {
+		for _, out := range outs {
+			out.abort()
+		}
+	}()
+	keys := make(map[string]string) // partition keys by record ID, for concurrent records
+	for {
+		rec, err := rdr.Next()
+		if err != nil {
+			if err != io.EOF {
+				return nil, err
+			}
+			break
+		}
+		if ids[rdr.ID()] {
+			continue
+		}
+		fields := rec.RawFields()
+		var key string
+		if u := rec.URL(); u != "" {
+			key = p.key(u)
+		} else {
+			for _, c := range fields.Values("WARC-Concurrent-To") {
+				if k, ok := keys[c]; ok {
+					key = k
+					break
+				}
+			}
+		}
+		keys[rdr.ID()] = key
+		out, open := outs[key]
+		if !open {
+			out = &rotator{outputs: func(int) (string, io.WriteCloser, error) { return p.Outputs(key) }}
+			outs[key] = out
+			if err = out.rotate(); err != nil {
+				return nil, err
+			}
+			if infoIDs[key], err = out.writeWarcinfo(rdr.Version(), out.name, info); err != nil {
+				return nil, err
+			}
+		}
+		if ids[fields.Get("WARC-Warcinfo-ID")] {
+			fields.Set("WARC-Warcinfo-ID", infoIDs[key])
+		}
+		if err = out.writeRecord(rdr.Version(), fields, rec, rec.Size()); err != nil {
+			return nil, err
+		}
+	}
+	names := make(map[string]string, len(outs))
+	for key, out := range outs {
+		names[key] = out.name
+		if err = out.close(); err != nil {
+			return nil, err
+		}
+	}
+	return names, nil
+}
+
+// key returns the partition of a target URI
+func (p *Partitioner) key(u string) string {
+	if len(p.Prefixes) == 0 {
+		return hostOf(u)
+	}
+	s := canonical(u)
+	var key string
+	for _, pre := range p.Prefixes {
+		if len(pre) > len(key) && strings.HasPrefix(s, pre) {
+			key = pre
+		}
+	}
+	return key
+}
@@ -0,0 +1,69 @@
+package webarchive
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPartition(t *testing.T) {
+	dir, err := ioutil.TempDir("", "webarchive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	buf := &bytes.Buffer{}
+	ww := newWARCWriter(buf)
+	if _, err := ww.writeWarcinfo("1.0", "in.warc", Warcinfo{IsPartOf: "test"}.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	for _, u := range []string{"http://a.example/x", "http://b.example/", "http://A.example/y"} {
+		if err := ww.writeExchange("1.0", exchange{
+			uri:  u,
+			date: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+			req:  []byte("GET / HTTP/1.1\r\n\r\n"),
+			resp: []byte("HTTP/1.1 200 OK\r\n\r\nhello"),
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	in := filepath.Join(dir, "in.warc")
+	if err := ioutil.WriteFile(in, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	p := &Partitioner{Outputs: FilePartitionOutputs(dir, "host", NoCompression)}
+	names, err := p.Partition(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 2 || names["a.example"] != "host-a.example.warc" || names["b.example"] != "host-b.example.warc" {
+		t.Fatalf("bad partitions: %v", names)
+	}
+	out, err := ioutil.ReadFile(filepath.Join(dir, names["a.example"]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	recs, blocks := readAll(t, out)
+	if len(recs) != 5 {
+		t.Fatalf("expecting 5 records, got %d", len(recs))
+	}
+	if recs[0].Get("WARC-Type") != "warcinfo" || recs[0].Get("WARC-Filename") != "host-a.example.warc" {
+		t.Errorf("bad warcinfo: %v", recs[0])
+	}
+	if !bytes.Contains(blocks[0], []byte("isPartOf: test")) {
+		t.Errorf("expecting input warcinfo fields, got %q", blocks[0])
+	}
+	if recs[4].Get("WARC-Target-URI") != "http://A.example/y" {
+		t.Errorf("bad record order: %v", recs[4])
+	}
+	p = &Partitioner{Outputs: FilePartitionOutputs(dir, "surt", NoCompression), Prefixes: []string{"example,a)/", "example,a)/y"}}
+	if names, err = p.Partition(in); err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 3 || names[""] != "surt-_.warc" || names["example,a)/y"] != "surt-example,a)_y.warc" {
+		t.Fatalf("bad partitions: %v", names)
+	}
+}
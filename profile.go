@@ -0,0 +1,142 @@
+// Copyright 2015 Richard Lehane. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webarchive
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Profile describes the content of an ARC or WARC file, for summarising collections. Counts are sorted by
+// decreasing count, and then by key.
+type Profile struct {
+	Meta    ArchiveMeta // format and provenance of the file
+	Records int         // number of records
+	Bytes   int64       // total length of record blocks
+	First   time.Time   // date of the earliest record
+	Last    time.Time   // date of the latest record
+	Types   []Count     // records by WARC-Type; the documents of ARC files are counted as responses
+	Hosts   []Count     // response, resource and revisit records by host of their target URI
+	MIME    []Count     // response and resource records by media type of their payload
+	Status  []Count     // HTTP responses by status code
+	Sizes   []SizeBucket
+}
+
+// Count is the number of records with a key, such as a host or media type.
+type Count struct {
+	Key   string
+	Count int
+}
+
+// SizeBucket is the number of response and resource records with payloads of fewer than Max bytes, and at
+// least the Max of the previous bucket. The Max of the last bucket is -1, for payloads of any larger size.
+type SizeBucket struct {
+	Max   int64
+	Count int
+}
+
+// payload size buckets of a Profile: less than 1KB, 10KB, 100KB, 1MB, 10MB, 100MB and larger
+var sizeBuckets = []int64{1 << 10, 10 << 10, 100 << 10, 1 << 20, 10 << 20, 100 << 20, -1}
+
+// NewProfile reads the ARC or WARC file in r and returns a profile of its content.
+func NewProfile(r io.Reader) (*Profile, error) {
+	rdr, err := NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer rdr.Close()
+	p := &Profile{Meta: rdr.(*MultiReader).ArchiveMeta(), Sizes: make([]SizeBucket, len(sizeBuckets))}
+	for i, m := range sizeBuckets {
+		p.Sizes[i].Max = m
+	}
+	types, hosts, mimes, statuses := make(map[string]int), make(map[string]int), make(map[string]int), make(map[string]int)
+	for {
+		rec, err := rdr.Next()
+		if err != nil {
+			if err != io.EOF {
+				return nil, err
+			}
+			break
+		}
+		p.Records++
+		p.Bytes += rec.Size()
+		if d := rec.Date(); !d.IsZero() {
+			if p.First.IsZero() || d.Before(p.First) {
+				p.First = d
+			}
+			if d.After(p.Last) {
+				p.Last = d
+			}
+		}
+		typ := TypeResponse
+		if wr, ok := rec.(WARCRecord); ok {
+			typ = wr.RecordType()
+		}
+		types[string(typ)]++
+		if typ != TypeResponse && typ != TypeResource && typ != TypeRevisit {
+			continue
+		}
+		hosts[hostOf(rec.URL())]++
+		if typ == TypeRevisit {
+			continue
+		}
+		head := &prefix{max: maxHTTPHeader}
+		n, err := io.Copy(head, rec)
+		if err != nil {
+			return nil, err
+		}
+		mime := mediaType(rec.MIME())
+		if l := httpHeaderLen(head.buf); l > 0 && isHTTPResponse(head.buf) {
+			n -= int64(l)
+			if resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(head.buf[:l])), nil); err == nil {
+				statuses[strconv.Itoa(resp.StatusCode)]++
+				mime = mediaType(resp.Header.Get("Content-Type"))
+				resp.Body.Close()
+			}
+		}
+		if mime == "" {
+			mime = "unknown"
+		}
+		mimes[mime]++
+		for i, m := range sizeBuckets {
+			if n < m || m < 0 {
+				p.Sizes[i].Count++
+				break
+			}
+		}
+	}
+	p.Types, p.Hosts, p.MIME, p.Status = sortedCounts(types), sortedCounts(hosts), sortedCounts(mimes), sortedCounts(statuses)
+	return p, nil
+}
+
+// sortedCounts sorts counts by decreasing count and then key
+func sortedCounts(m map[string]int) []Count {
+	ret := make([]Count, 0, len(m))
+	for k, v := range m {
+		ret = append(ret, Count{Key: k, Count: v})
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Count != ret[j].Count {
+			return ret[i].Count > ret[j].Count
+		}
+		return ret[i].Key < ret[j].Key
+	})
+	return ret
+}
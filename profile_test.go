@@ -0,0 +1,45 @@
+package webarchive
+
+import (
+	"os"
+	"testing"
+)
+
+func TestProfile(t *testing.T) {
+	checkExamples(t)
+	f, _ := os.Open("examples/IAH-20080430204825-00000-blackbook.warc.gz")
+	defer f.Close()
+	p, err := NewProfile(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Meta.Format != "WARC" || p.Records == 0 || p.First.IsZero() || p.Last.Before(p.First) {
+		t.Fatalf("bad profile: %+v", p)
+	}
+	var types, sizes int
+	for _, c := range p.Types {
+		types += c.Count
+	}
+	for _, b := range p.Sizes {
+		sizes += b.Count
+	}
+	if types != p.Records || len(p.Hosts) == 0 || len(p.MIME) == 0 || len(p.Status) == 0 {
+		t.Errorf("bad counts: %+v", p)
+	}
+	for i := 1; i < len(p.Hosts); i++ {
+		if p.Hosts[i].Count > p.Hosts[i-1].Count {
+			t.Errorf("expecting hosts in decreasing order of count: %v", p.Hosts)
+		}
+	}
+	if p.Sizes[len(p.Sizes)-1].Max != -1 || sizes == 0 {
+		t.Errorf("bad size histogram: %v", p.Sizes)
+	}
+	f, _ = os.Open("examples/IAH-20080430204825-00000-blackbook.arc")
+	defer f.Close()
+	if p, err = NewProfile(f); err != nil {
+		t.Fatal(err)
+	}
+	if p.Meta.Format != "ARC" || p.Records != 299 || p.Types[0].Key != "response" || p.Types[0].Count != 299 {
+		t.Errorf("bad ARC profile: %+v", p)
+	}
+}
@@ -17,9 +17,16 @@ package webarchive
 import (
 	"bufio"
 	"bytes"
-	"compress/gzip"
+	"compress/bzip2"
+	"compress/flate"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
 	"io"
 	"io/ioutil"
+	"math"
+	"net/http"
+	"os"
 	"strings"
 )
 
@@ -30,15 +37,37 @@ type slicer interface {
 }
 
 type reader struct {
-	src     io.Reader     // reference to the provided reader
-	sbuf    *bufio.Reader // buffer src if not a slicer
-	buf     *bufio.Reader // buf will point to sbuf, unless src is gzip
-	closer  *gzip.Reader  // if gzip, hold reference to close or reset it
-	slicer  bool          // does the source conform to the slicer interface? (siegfried related: siegfried buffers have this method)
-	idx     int64         // read index within the entire file - stays at the start of the Record/Payload until Next is called
-	thisIdx int64         // read index within the current record
-	sz      int64         // size of the current record (Read area)
-	store   []byte        // used as temp store for fields
+	src     io.Reader              // reference to the provided reader
+	sbuf    *bufio.Reader          // buffer src if not a slicer
+	scount  *counter               // counts the bytes of src read into sbuf
+	buf     *bufio.Reader          // buf will point to sbuf, unless src is gzip
+	gz      gzipOpener             // if gzip, opens each member, holding a gzip.Reader to close or reset
+	gzipped bool                   // the source is gzip compressed
+	dcloser io.Closer              // if zstd, the decompressor to close
+	members *memberReader          // if compressed as concatenated members, the reader of those members
+	recPos  int64                  // decompressed offset of the current record, if read from members
+	recOff  int64                  // offset of the current record, if the source is uncompressed
+	slicer  bool                   // does the source conform to the slicer interface? (siegfried related: siegfried buffers have this method)
+	idx     int64                  // read index within the entire file - stays at the start of the Record/Payload until Next is called
+	thisIdx int64                  // read index within the current record
+	sz      int64                  // size of the current record (Read area)
+	store   []byte                 // used as temp store for fields
+	http    bool                   // the current record's block is an HTTP message
+	hdrLen  int64                  // length of the HTTP headers of the current record; -1 if too long to examine and not stripped
+	strip   bool                   // the HTTP headers of the current record have been stripped
+	parsers map[string]FieldParser // custom field parsers registered with WithFieldParser
+
+	contLimit  int64              // limit on bytes of segments held for incomplete continuations; 0 for no limit
+	contPolicy ContinuationPolicy // applied when contLimit is exceeded
+	sniff      bool               // identify payload types by sniffing (see WithSniffing)
+	detector   LanguageDetector   // identify the languages of text payloads (see WithLanguageDetector)
+	mixed      bool               // detect the format of each record (see WithMixedFormats)
+	segHeaders bool               // hold only the headers of segmented records (see WithSegmentHeadersOnly)
+	fileAlg    string             // algorithm of the file digest (see WithFileDigest)
+	fileHash   *fileHasher        // hashes the current file, wrapping the provided reader in src
+	prior      map[string]Digest  // latest payload digests of an earlier crawl by SURT (see WithPriorIndex)
+
+	summary Summary // counts of records read since the reader was created or Reset
 }
 
 // Size returns the size in bytes of the content. When iterating with NextPayload,
@@ -48,6 +77,58 @@ func (r *reader) Size() int64 {
 	return r.sz
 }
 
+// unread returns the length of the block of the current record that is left to be read
+func (r *reader) unread() int64 {
+	return r.sz - r.thisIdx
+}
+
+// IsHTTP reports whether the block of the current record is an HTTP message.
+// This remains true after NextPayload has stripped the HTTP headers.
+func (r *reader) IsHTTP() bool { return r.http }
+
+// HasPayload reports whether the current record has a non-empty payload: for HTTP messages,
+// whether there is an entity body after the HTTP headers.
+func (r *reader) HasPayload() bool {
+	if !r.http || r.strip {
+		return r.sz > 0
+	}
+	return r.hdrLen < 0 || r.sz > r.hdrLen
+}
+
+// PayloadOffset returns the offset within the current record's block at which its payload begins: the length of
+// the HTTP headers of HTTP messages, or 0 for other blocks. Returns -1 if the HTTP headers are too long to have been
+// found (longer than 4096 bytes) and haven't been stripped by NextPayload.
+func (r *reader) PayloadOffset() int64 {
+	if !r.http {
+		return 0
+	}
+	return r.hdrLen
+}
+
+// maximum bytes examined for HTTP headers by examine
+const examineLen = 4096
+
+// examine the start of the current record's block, using isHTTP to decide whether it is an HTTP message.
+// If isHTTP is nil, as for NextHeader, the block isn't examined.
+func (r *reader) examine(isHTTP func([]byte) bool) {
+	r.http, r.hdrLen, r.strip = false, 0, false
+	if isHTTP == nil {
+		return
+	}
+	n := r.sz
+	if n > examineLen {
+		n = examineLen
+	}
+	buf, _ := r.peek(int(n))
+	if len(buf) < 5 || !isHTTP(buf) {
+		return
+	}
+	r.http, r.hdrLen = true, -1
+	if i := indexBlankLine(buf); i > -1 {
+		r.hdrLen = int64(i)
+	}
+}
+
 // Read reads the content of the record. When iterating with NextPayload, the read
 // will start after any stripped HTTP headers. Otherwise, the read starts immediately after
 // the WARC or ARC header block.
@@ -114,68 +195,343 @@ func (r *reader) EofSlice(off int64, l int) ([]byte, error) {
 	return slc, err
 }
 
-// Close closes the underlying gzip reader if the WARC or ARC file is gzipped.
-// If not a gzip file, this is a nop.
+// Summary returns counts of the records read so far. Counts are reset when the reader is Reset.
+func (r *reader) Summary() Summary { return r.summary }
+
+// tally counts a record of length n read by Next, or the error returned instead
+func (r *reader) tally(n int64, err error) {
+	switch err {
+	case nil:
+		r.summary.Records++
+		r.summary.Bytes += n
+	case io.EOF, errFormat:
+	default:
+		r.summary.Invalid++
+	}
+}
+
+// Close closes the underlying gzip or zstd reader if the WARC or ARC file is compressed with gzip or zstd.
+// Otherwise, this is a nop.
 func (r *reader) Close() error {
-	if r.closer == nil {
-		return nil
+	if r.dcloser != nil {
+		r.dcloser.Close()
+		r.dcloser = nil
 	}
-	return r.closer.Close()
+	return r.gz.Close()
 }
 
-func newReader(s io.Reader) (*reader, error) {
-	r := &reader{src: s}
+func newReader(s io.Reader, opts ...Option) (*reader, error) {
+	r := &reader{}
+	for _, o := range opts {
+		o(r)
+	}
+	s, err := r.hashSource(s)
+	if err != nil {
+		return nil, err
+	}
+	r.src = s
 	if _, ok := s.(slicer); ok {
 		r.slicer = true
 	} else {
-		r.sbuf = bufio.NewReader(s)
+		r.scount = &counter{r: s}
+		r.sbuf = bufio.NewReader(r.scount)
 	}
-	err := r.unzip()
+	err = r.unzip()
 	return r, err
 }
 
 func (r *reader) reset(s io.Reader) error {
+	s, err := r.hashSource(s)
+	if err != nil {
+		return err
+	}
 	r.src = s
 	if _, ok := s.(slicer); ok {
 		r.slicer = true
 	} else {
 		r.slicer = false
+		r.scount = &counter{r: s}
 		if r.sbuf == nil {
-			r.sbuf = bufio.NewReader(s)
+			r.sbuf = bufio.NewReader(r.scount)
 		} else {
-			r.sbuf.Reset(s)
+			r.sbuf.Reset(r.scount)
 		}
 	}
 	r.idx, r.thisIdx, r.sz = 0, 0, 0
+	r.summary = Summary{}
 	return r.unzip()
 }
 
 func (r *reader) unzip() error {
-	if buf, err := r.srcpeek(3); err == nil && isgzip(buf) {
-		var rdr io.Reader = r.sbuf
+	buf, err := r.srcpeek(4)
+	r.members, r.gzipped = nil, false
+	if err == nil && isgzip(buf) {
+		// read member by member, so that the compressed offset and length of each record can be given
+		r.gzipped = true
+		m := r.newMembers(r.gz.open)
+		if err = m.first(); err != nil {
+			return err
+		}
+		r.decompress(m)
+		return nil
+	}
+	if iszstd(buf) {
+		br := r.sbuf
 		if r.slicer {
-			rdr = r.src
+			br = bufio.NewReader(r.src)
 		}
-		if r.closer == nil {
-			r.closer, err = gzip.NewReader(rdr)
-		} else {
-			err = r.closer.Reset(rdr)
+		if r.dcloser != nil {
+			r.dcloser.Close()
 		}
+		zr, err := zstdReader(br)
 		if err != nil {
 			return err
 		}
-		if r.buf == nil || r.buf == r.sbuf {
-			r.buf = bufio.NewReader(r.closer)
-		} else {
-			r.buf.Reset(r.closer)
+		r.dcloser = zr
+		r.decompress(zr)
+		return nil
+	}
+	if isbzip2(buf) {
+		// the bzip2 reader reads concatenated streams, as written by compressing each record separately
+		var rdr io.Reader = r.sbuf
+		if r.slicer {
+			rdr = bufio.NewReader(r.src)
 		}
-		r.slicer = false
+		r.decompress(bzip2.NewReader(rdr))
+		return nil
+	}
+	if len(buf) >= 2 && iszlib(buf) && r.inflates(zlib.NewReader) {
+		r.decompress(r.newMembers(zlib.NewReader))
+		return nil
+	}
+	if r.inflates(openDeflate) {
+		r.decompress(r.newMembers(openDeflate))
+		return nil
+	}
+	r.buf = r.sbuf
+	return nil
+}
+
+func openDeflate(rdr io.Reader) (io.ReadCloser, error) { return flate.NewReader(rdr), nil }
+
+// decompress buffers the decompressed source
+func (r *reader) decompress(d io.Reader) {
+	if r.buf == nil || r.buf == r.sbuf {
+		r.buf = bufio.NewReader(d)
 	} else {
-		r.buf = r.sbuf
+		r.buf.Reset(d)
+	}
+	r.slicer = false
+}
+
+// maximum bytes inflated to check whether a file is zlib or raw deflate compressed
+const inflateLen = 512
+
+// inflates reports whether the start of the source, opened with open, inflates to the start of an ARC or WARC file.
+// Raw deflate has no magic number, and the two byte zlib header is easily matched by chance, so this is checked
+// before treating a source as compressed.
+func (r *reader) inflates(open func(io.Reader) (io.ReadCloser, error)) bool {
+	buf, _ := r.srcpeek(inflateLen)
+	if len(buf) == 0 || isWARCStart(buf) || isARCStart(buf) {
+		return false
+	}
+	rc, err := open(bytes.NewReader(buf))
+	if err != nil {
+		return false
 	}
+	head := make([]byte, 9)
+	n, _ := io.ReadFull(rc, head)
+	return isWARCStart(head[:n]) || isARCStart(head[:n])
+}
+
+// newMembers returns a reader of the concatenated gzip, zlib or raw deflate members of the source, each opened with open
+func (r *reader) newMembers(open func(io.Reader) (io.ReadCloser, error)) *memberReader {
+	src, cnt := r.sbuf, r.scount
+	if r.slicer {
+		cnt = &counter{r: r.src}
+		src = bufio.NewReader(cnt)
+	}
+	r.members = &memberReader{src: src, cnt: cnt, open: open}
+	return r.members
+}
+
+// memberReader reads concatenated compressed members. Reading from a bufio.Reader, which is an io.ByteReader,
+// ensures that the decompressor of a member doesn't read beyond its end.
+type memberReader struct {
+	src   *bufio.Reader
+	cnt   *counter // counts the bytes read into src
+	open  func(io.Reader) (io.ReadCloser, error)
+	cur   io.ReadCloser
+	out   int64    // bytes decompressed
+	spans []extent // the members that haven't yet been passed by the records read
+}
+
+// extent is the extent of a compressed member
+type extent struct {
+	off    int64 // offset of the member in the compressed source
+	length int64 // compressed length of the member; -1 until its end is reached
+	start  int64 // offset of the decompressed content of the member
+	clen   int64 // compressed length given by an "sl" field in the gzip header; 0 if none
+	ulen   int64 // uncompressed length given by an "sl" field in the gzip header; 0 if none
+}
+
+// pos is the offset in the compressed source of the next byte of src
+func (m *memberReader) pos() int64 { return m.cnt.n - int64(m.src.Buffered()) }
+
+// first opens the first member, so that a source without a valid header gives an error when it is opened
+func (m *memberReader) first() error {
+	e := extent{off: m.pos(), length: -1, start: m.out}
+	e.clen, e.ulen = skipLength(m.src)
+	var err error
+	if m.cur, err = m.open(m.src); err != nil {
+		return err
+	}
+	m.spans = append(m.spans, e)
 	return nil
 }
 
+// skipLength returns the lengths in the "sl" subfield of the extra field of the gzip member at the start of src (see
+// WARCWriter.SkipLengths), without reading them, or zeros if it has none
+func skipLength(src *bufio.Reader) (int64, int64) {
+	hdr, err := src.Peek(12)
+	if err != nil || !isgzip(hdr) || hdr[3]&gzipFEXTRA == 0 {
+		return 0, 0
+	}
+	xlen := int(binary.LittleEndian.Uint16(hdr[10:]))
+	extra, err := src.Peek(12 + xlen)
+	if err != nil {
+		return 0, 0
+	}
+	for extra = extra[12:]; len(extra) >= 4; {
+		l := int(binary.LittleEndian.Uint16(extra[2:]))
+		if len(extra) < 4+l {
+			break
+		}
+		if extra[0] == 's' && extra[1] == 'l' && l == 8 {
+			return int64(binary.LittleEndian.Uint32(extra[4:])), int64(binary.LittleEndian.Uint32(extra[8:]))
+		}
+		extra = extra[4+l:]
+	}
+	return 0, 0
+}
+
+// skipMember skips the rest of the current member, without decompressing it, in order to skip the n remaining bytes
+// of the current record. This is done if the member has skip lengths and its record ends with it, as is the case for
+// files written with WARCWriter.SkipLengths. Reports whether the member was skipped.
+func (r *reader) skipMember(n int64) bool {
+	m := r.members
+	if m == nil || m.cur == nil || len(m.spans) == 0 {
+		return false
+	}
+	e := &m.spans[len(m.spans)-1]
+	end := m.out - int64(r.buf.Buffered()) + n // the end of the record
+	if e.clen == 0 || e.ulen == 0 || e.start > r.recPos || e.start+e.ulen < end || e.start+e.ulen-end > 4 {
+		return false
+	}
+	d := e.off + e.clen - m.pos()
+	if d < 0 {
+		return false
+	}
+	if sk, ok := r.src.(io.Seeker); ok && m.src == r.sbuf && d > int64(m.src.Buffered()) {
+		b := int64(m.src.Buffered())
+		if _, err := sk.Seek(d-b, io.SeekCurrent); err != nil {
+			return false
+		}
+		m.cnt.n += d - b
+		m.src.Reset(m.cnt)
+	} else if _, err := m.src.Discard(int(d)); err != nil {
+		return false
+	}
+	m.cur.Close()
+	m.cur = nil
+	e.length = e.clen
+	m.out = e.start + e.ulen
+	r.buf.Reset(m)
+	return true
+}
+
+func (m *memberReader) Read(p []byte) (int, error) {
+	for {
+		if m.cur == nil {
+			if _, err := m.src.Peek(1); err != nil {
+				return 0, err
+			}
+			if err := m.first(); err != nil {
+				return 0, err
+			}
+		}
+		n, err := m.cur.Read(p)
+		m.out += int64(n)
+		if err == io.EOF {
+			m.cur.Close()
+			m.cur = nil
+			last := &m.spans[len(m.spans)-1]
+			last.length = m.pos() - last.off
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+// find returns the member holding the decompressed offset, dropping the members before it
+func (m *memberReader) find(pos int64) *extent {
+	i := len(m.spans) - 1
+	for i > 0 && m.spans[i].start > pos {
+		i--
+	}
+	m.spans = m.spans[i:]
+	if len(m.spans) == 0 {
+		return nil
+	}
+	return &m.spans[0]
+}
+
+// CompressedOffset returns the offset in the file of the gzip member that holds the start of the current record, as
+// given in the offset field of CDX indexes of .warc.gz and .arc.gz files. Files compressed with zlib or raw deflate
+// members are treated alike. Returns -1 if the file isn't compressed as concatenated members.
+//
+// Files are usually compressed record by record, so that the offset and CompressedLength of a record locate it for
+// random access. If a member holds many records (or the whole file), each of them is given that member's extent.
+func (r *reader) CompressedOffset() int64 {
+	if r.members == nil {
+		return -1
+	}
+	if m := r.members.find(r.recPos); m != nil {
+		return m.off
+	}
+	return -1
+}
+
+// CompressedLength returns the compressed length of the gzip member that holds the start of the current record (see
+// CompressedOffset). The length is only known once the end of the member has been read: that is, once the record
+// has been read to its end. Returns -1 if the record hasn't been read to its end, or if the file isn't compressed as
+// concatenated members.
+func (r *reader) CompressedLength() int64 {
+	if r.members == nil {
+		return -1
+	}
+	m := r.members.find(r.recPos)
+	if m == nil {
+		return -1
+	}
+	if m.length < 0 && m.clen > 0 {
+		return m.clen
+	}
+	if m.length < 0 && r.thisIdx >= r.sz {
+		// look past the blank lines that end the record, to reach the end of its member
+		for i := 1; m.length < 0; i++ {
+			b, err := r.buf.Peek(i)
+			if err != nil || (b[i-1] != '\r' && b[i-1] != '\n') {
+				break
+			}
+		}
+	}
+	return m.length
+}
+
 // peek from r.src (rather than usual r.buf)
 func (r *reader) srcpeek(i int) ([]byte, error) {
 	if r.slicer {
@@ -195,15 +551,95 @@ func (r *reader) next() ([]byte, error) {
 	// advance if haven't read the previous record
 	r.idx += r.sz
 	if r.thisIdx < r.sz && !r.slicer {
-		r.buf.Discard(int(r.sz-r.thisIdx))
+		if err := r.skip(r.sz - r.thisIdx); err != nil {
+			r.sz, r.thisIdx = 0, 0
+			return nil, err
+		}
 	}
-	var slc []byte
-	var err error
 	// trim any leading blank lines, then return the first line with text
 	// may reach io.EOF here in which case return that error for halting
-	for slc, err = r.readLine(); err == nil && len(bytes.TrimSpace(slc)) == 0; slc, err = r.readLine() {
+	for {
+		if r.members != nil {
+			r.recPos = r.members.out - int64(r.buf.Buffered())
+		} else {
+			r.recOff = r.offset()
+		}
+		slc, err := r.readLine()
+		if err != nil || len(bytes.TrimSpace(slc)) > 0 {
+			return slc, err
+		}
 	}
-	return slc, err
+}
+
+// offset returns the offset in an uncompressed source of the next byte to be read, or -1 if it is compressed
+func (r *reader) offset() int64 {
+	if r.slicer {
+		return r.idx
+	}
+	if r.buf != r.sbuf {
+		return -1
+	}
+	return r.scount.n - int64(r.sbuf.Buffered())
+}
+
+// skip discards n bytes of the current record. If the file isn't compressed and its source is an io.Seeker
+// (e.g. an *os.File), bytes beyond those buffered are skipped by seeking rather than reading them.
+// Returns io.ErrUnexpectedEOF if bytes are read rather than seeked, and the source ends before n bytes.
+func (r *reader) skip(n int64) error {
+	if r.skipMember(n) {
+		return nil
+	}
+	if sk, ok := r.src.(io.Seeker); ok && r.buf == r.sbuf && n > int64(r.buf.Buffered()) {
+		n -= int64(r.buf.Buffered())
+		r.buf.Discard(r.buf.Buffered())
+		if _, err := sk.Seek(n, io.SeekCurrent); err == nil {
+			r.scount.n += n
+			r.sbuf.Reset(r.scount)
+			return nil
+		}
+	}
+	for n > 0 {
+		l := n
+		if l > math.MaxInt32 {
+			l = math.MaxInt32
+		}
+		d, err := r.buf.Discard(int(l))
+		n -= int64(d)
+		if err != nil {
+			if err == io.EOF {
+				return io.ErrUnexpectedEOF
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// peekRecord advances to the start of the next record, skipping any blank lines, and returns its first bytes
+// without reading them. Used to detect changes of format in mixed streams.
+func (r *reader) peekRecord() ([]byte, error) {
+	r.idx += r.sz
+	var err error
+	if r.thisIdx < r.sz && !r.slicer {
+		err = r.skip(r.sz - r.thisIdx)
+	}
+	r.sz, r.thisIdx = 0, 0
+	if err != nil {
+		return nil, err
+	}
+	for {
+		b, _ := r.peek(1)
+		if len(b) == 0 || (b[0] != '\r' && b[0] != '\n' && b[0] != ' ' && b[0] != '\t') {
+			break
+		}
+		if r.slicer {
+			r.idx++
+		} else {
+			r.buf.Discard(1)
+		}
+	}
+	b, _ := r.peek(9)
+	return b, nil
 }
 
 // if a slicer - advance r.idx
@@ -260,6 +696,7 @@ func (r *reader) storeLines(i int, alter bool) ([]byte, error) {
 				r.idx += int64(idx)
 				if alter {
 					r.sz -= int64(idx)
+					r.strip, r.hdrLen = true, int64(idx)
 				}
 				return r.src.(slicer).Slice(start, int(r.idx-start))
 			}
@@ -289,6 +726,7 @@ func (r *reader) storeLines(i int, alter bool) ([]byte, error) {
 		i += len(slc)
 		if len(slc) < 3 {
 			if alter {
+				r.strip, r.hdrLen = true, int64(i-alterSz)
 				r.sz -= int64(i - alterSz)
 			}
 			return r.store[:i], err
@@ -359,36 +797,78 @@ func getLines(buf []byte) func() []byte {
 	}
 }
 
-var warcHeaders = map[string]string{
-	"Warc-Type":                    "WARC-Type",
-	"Warc-Record-Id":               "WARC-Record-ID",
-	"Warc-Date":                    "WARC-Date",
-	"Content-Length":               "Content-Length",
-	"Content-Type":                 "Content-Type",
-	"Warc-Concurrent-To":           "WARC-Concurrent-To",
-	"Warc-Block-Digest":            "WARC-Block-Digest",
-	"Warc-Payload-Digest":          "WARC-Payload-Digest",
-	"Warc-Ip-Address":              "WARC-IP-Address",
-	"Warc-Refers-To":               "WARC-Refers-To",
-	"Warc-Target-Uri":              "WARC-Target-URI",
-	"Warc-Truncated":               "WARC-Truncated",
-	"Warc-Warcinfo-Id":             "WARC-Warcinfo-ID",
-	"Warc-Filename":                "WARC-Filename",
-	"Warc-Profile":                 "WARC-Profile",
-	"Warc-Identified-Payload-Type": "WARC-Identified-Payload-Type",
-	"Warc-Segment-Origin-Id":       "WARC-Segment-Origin-ID",
-	"Warc-Segment-Number":          "WARC-Segment-Number",
-	"Warc-Segment-Total-Length":    "WARC-Segment-Total-Length",
+// FieldKind classifies a WARC named field by the specification that defines it.
+type FieldKind int
+
+const (
+	UnknownField   FieldKind = iota // not a WARC field known to this package
+	WARC10Field                     // defined by WARC 1.0 (ISO 28500:2009)
+	WARC11Field                     // added in WARC 1.1 (ISO 28500:2017)
+	ExtensionField                  // common extension field defined outside the standard
+)
+
+type warcField struct {
+	name string
+	kind FieldKind
+}
+
+// warcHeaders maps normalised (title-cased) keys to the canonical spelling of WARC named fields.
+var warcHeaders = map[string]warcField{
+	"Warc-Type":                    {"WARC-Type", WARC10Field},
+	"Warc-Record-Id":               {"WARC-Record-ID", WARC10Field},
+	"Warc-Date":                    {"WARC-Date", WARC10Field},
+	"Content-Length":               {"Content-Length", WARC10Field},
+	"Content-Type":                 {"Content-Type", WARC10Field},
+	"Warc-Concurrent-To":           {"WARC-Concurrent-To", WARC10Field},
+	"Warc-Block-Digest":            {"WARC-Block-Digest", WARC10Field},
+	"Warc-Payload-Digest":          {"WARC-Payload-Digest", WARC10Field},
+	"Warc-Ip-Address":              {"WARC-IP-Address", WARC10Field},
+	"Warc-Refers-To":               {"WARC-Refers-To", WARC10Field},
+	"Warc-Target-Uri":              {"WARC-Target-URI", WARC10Field},
+	"Warc-Truncated":               {"WARC-Truncated", WARC10Field},
+	"Warc-Warcinfo-Id":             {"WARC-Warcinfo-ID", WARC10Field},
+	"Warc-Filename":                {"WARC-Filename", WARC10Field},
+	"Warc-Profile":                 {"WARC-Profile", WARC10Field},
+	"Warc-Identified-Payload-Type": {"WARC-Identified-Payload-Type", WARC10Field},
+	"Warc-Segment-Origin-Id":       {"WARC-Segment-Origin-ID", WARC10Field},
+	"Warc-Segment-Number":          {"WARC-Segment-Number", WARC10Field},
+	"Warc-Segment-Total-Length":    {"WARC-Segment-Total-Length", WARC10Field},
+	"Warc-Refers-To-Target-Uri":    {"WARC-Refers-To-Target-URI", WARC11Field},
+	"Warc-Refers-To-Date":          {"WARC-Refers-To-Date", WARC11Field},
+	// extensions: see https://iipc.github.io/warc-specifications/specifications/warc-format/warc-1.1-annotated/
+	"Warc-Protocol":       {"WARC-Protocol", ExtensionField},
+	"Warc-Cipher-Suite":   {"WARC-Cipher-Suite", ExtensionField},
+	"Warc-Payload-Length": {"WARC-Payload-Length", ExtensionField},
+	"Warc-Json-Metadata":  {"WARC-JSON-Metadata", ExtensionField},
+	"Warc-Page-Id":        {"WARC-Page-ID", ExtensionField},
+	"Warc-Resource-Type":  {"WARC-Resource-Type", ExtensionField},
+	"Warc-Title":          {"WARC-Title", ExtensionField},
+	"Warc-Redacted":       {RedactedField, ExtensionField},
 }
 
-func normaliseKey(k []byte) string {
+// WARCField returns the canonical spelling of a WARC named field and the specification that defines it.
+// Keys are matched case-insensitively. For fields unknown to this package, the key is returned
+// title-cased (e.g. "X-Crawler-Id") with UnknownField.
+func WARCField(key string) (string, FieldKind) {
+	k := titleKey([]byte(key))
+	if w, ok := warcHeaders[k]; ok {
+		return w.name, w.kind
+	}
+	return k, UnknownField
+}
+
+func titleKey(k []byte) string {
 	parts := bytes.Split(k, []byte("-"))
 	for i, v := range parts {
 		parts[i] = []byte(strings.Title(strings.ToLower(string(v))))
 	}
-	s := string(bytes.Join(parts, []byte("-")))
-	if w := warcHeaders[s]; w != "" {
-		return w
+	return string(bytes.Join(parts, []byte("-")))
+}
+
+func normaliseKey(k []byte) string {
+	s := titleKey(k)
+	if w, ok := warcHeaders[s]; ok {
+		return w.name
 	}
 	return s
 }
@@ -434,11 +914,11 @@ func getSingleValues(buf []byte, key string) []string {
 	return ret
 }
 
-func getAllValues(buf []byte) map[string][]string {
-	ret := make(map[string][]string)
+func getAllValues(buf []byte) Fields {
+	ret := make(Fields)
 	lines := getLines(buf)
 	for l := lines(); l != nil; l = lines() {
-		parts := bytes.Split(l, []byte(":"))
+		parts := bytes.SplitN(l, []byte(":"), 2)
 		if len(parts) == 2 {
 			k := normaliseKey(parts[0])
 			ret[k] = append(ret[k], string(bytes.TrimSpace(parts[1])))
@@ -447,9 +927,45 @@ func getAllValues(buf []byte) map[string][]string {
 	return ret
 }
 
-type continuations map[string]*continuation
+// ContinuationPolicy determines what a WARCReader does when the segments it holds for incomplete segmented records
+// exceed the limit set with WithContinuationLimit.
+type ContinuationPolicy int
+
+const (
+	DropOldest   ContinuationPolicy = iota // discard the oldest incomplete records: they won't be returned by NextPayload
+	ErrorOnLimit                           // NextPayload returns ErrContinuationLimit
+	SpillToDisk                            // move the segments of the oldest incomplete records to temporary files
+)
+
+// WithContinuationLimit limits the bytes of segments that a WARCReader holds in memory while NextPayload waits for
+// the remaining segments of segmented records. Without a limit, segments are held until their records are complete,
+// which is never if final segments are missing.
+//
+// Use Incomplete, once NextPayload has returned io.EOF, for the number of segmented records that were never completed.
+func WithContinuationLimit(limit int64, policy ContinuationPolicy) Option {
+	return func(r *reader) {
+		r.contLimit, r.contPolicy = limit, policy
+	}
+}
+
+// WithSegmentHeadersOnly stops a WARCReader holding the blocks of segmented records while NextPayload waits for their
+// remaining segments, for callers that only want the headers of records (e.g. while indexing). Only any HTTP headers at
+// the start of the first segment are kept, so that they can be stripped as usual. The merged records that NextPayload
+// returns then have no content.
+func WithSegmentHeadersOnly() Option {
+	return func(r *reader) {
+		r.segHeaders = true
+	}
+}
+
+type continuations struct {
+	m       map[string]*continuation
+	order   []string        // IDs of incomplete continuations, oldest first
+	mem     int64           // bytes of segments held in memory
+	dropped map[string]bool // IDs of continuations discarded under the DropOldest policy
+}
 
-func (c continuations) put(w *WARCReader) (Record, bool) {
+func (c *continuations) put(w *WARCReader) (Record, bool, error) {
 	var id string
 	var final bool
 	if w.warcHeader.segment > 1 {
@@ -462,56 +978,238 @@ func (c continuations) put(w *WARCReader) (Record, bool) {
 	} else {
 		id = w.warcHeader.id
 	}
-	cr, ok := c[id]
+	if c.dropped[id] {
+		return nil, false, nil // later segments of a dropped continuation can't complete it
+	}
+	if c.m == nil {
+		c.m = make(map[string]*continuation)
+	}
+	cr, ok := c.m[id]
 	if !ok {
 		cr = &continuation{
 			warcHeader: &warcHeader{
-				url:    w.warcHeader.url,
-				id:     w.warcHeader.id,
-				date:   w.warcHeader.date,
-				typ:    w.warcHeader.typ,
-				fields: make([]byte, len(w.warcHeader.fields)),
+				version: w.warcHeader.version,
+				url:     w.warcHeader.url,
+				id:      w.warcHeader.id,
+				date:    w.warcHeader.date,
+				typ:     w.warcHeader.typ,
+				fields:  make([]byte, len(w.warcHeader.fields)),
+				parsed:  w.warcHeader.parsed,
 			},
-			bufs: make([][]byte, w.warcHeader.segment),
 		}
 		copy(cr.warcHeader.fields, w.warcHeader.fields)
-		c[id] = cr
+		c.m[id] = cr
+		c.order = append(c.order, id)
 	}
 	if final {
 		cr.final = true
 	}
-	if len(cr.bufs) < w.warcHeader.segment {
-		nb := make([][]byte, w.warcHeader.segment)
-		copy(nb, cr.bufs)
-		cr.bufs = nb
+	cr.grow(w.warcHeader.segment)
+	var buf []byte
+	var err error
+	if w.segHeaders {
+		buf, err = w.segmentHeaders()
+	} else {
+		buf, err = ioutil.ReadAll(w)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	i := w.warcHeader.segment - 1
+	c.mem -= int64(len(cr.bufs[i]))
+	cr.bufs[i], cr.have[i] = nil, true
+	if cr.file != nil {
+		if err := cr.spillSegment(i, buf); err != nil {
+			return nil, false, err
+		}
+	} else {
+		cr.bufs[i] = buf
+		c.mem += int64(len(buf))
+	}
+	held := cr.mem()
+	done, err := cr.complete()
+	if err != nil {
+		return nil, false, err
+	}
+	if done {
+		c.remove(id)
+		c.mem -= held
+		return cr, true, nil
 	}
-	cr.bufs[w.warcHeader.segment-1], _ = ioutil.ReadAll(w)
-	if !cr.complete() {
-		return nil, false
+	return nil, false, c.limit(w.contLimit, w.contPolicy)
+}
+
+// segmentHeaders returns a copy of any HTTP headers at the start of the first segment of a segmented record
+func (w *WARCReader) segmentHeaders() ([]byte, error) {
+	if w.warcHeader.segment != 1 || !w.reader.http || w.hdrLen <= 0 {
+		return nil, nil
+	}
+	b, err := w.peek(int(w.hdrLen))
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(nil), b...), nil
+}
+
+// limit applies the policy while the segments held in memory exceed the limit
+func (c *continuations) limit(limit int64, policy ContinuationPolicy) error {
+	if limit <= 0 {
+		return nil
+	}
+	for c.mem > limit {
+		switch policy {
+		case ErrorOnLimit:
+			return ErrContinuationLimit
+		case SpillToDisk:
+			var spilled bool
+			for _, id := range c.order {
+				if cr := c.m[id]; cr.mem() > 0 {
+					n := cr.mem()
+					if err := cr.spill(); err != nil {
+						return err
+					}
+					c.mem -= n
+					spilled = true
+					break
+				}
+			}
+			if !spilled {
+				return nil
+			}
+		default:
+			id := c.order[0]
+			cr := c.m[id]
+			c.mem -= cr.mem()
+			c.remove(id)
+			cr.clear()
+			if c.dropped == nil {
+				c.dropped = make(map[string]bool)
+			}
+			c.dropped[id] = true
+		}
+	}
+	return nil
+}
+
+// remove a continuation by ID
+func (c *continuations) remove(id string) {
+	delete(c.m, id)
+	for i, v := range c.order {
+		if v == id {
+			c.order = append(c.order[:i], c.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// clear removes any temporary files
+func (c *continuations) clear() {
+	for _, cr := range c.m {
+		cr.clear()
 	}
-	delete(c, id) // clear the continutation before returning
-	return cr, true
 }
 
 type continuation struct {
 	*warcHeader
-	final bool
-	idx   int
-	start int
-	bufs  [][]byte
-	buf   []byte
+	final  bool
+	idx    int
+	start  int
+	bufs   [][]byte
+	have   []bool     // segments received, whether held in bufs or spilled
+	file   *os.File   // temporary file holding spilled segments
+	spans  [][2]int64 // offset and length of spilled segments within file
+	hdrLen int        // length of HTTP headers stripped from the merged block
+	buf    []byte
+}
+
+// grow the continuation to hold n segments
+func (c *continuation) grow(n int) {
+	if len(c.bufs) >= n {
+		return
+	}
+	nb := make([][]byte, n)
+	copy(nb, c.bufs)
+	c.bufs = nb
+	nh := make([]bool, n)
+	copy(nh, c.have)
+	c.have = nh
+	ns := make([][2]int64, n)
+	copy(ns, c.spans)
+	c.spans = ns
+}
+
+// mem returns the bytes of segments held in memory
+func (c *continuation) mem() int64 {
+	var n int64
+	for _, b := range c.bufs {
+		n += int64(len(b))
+	}
+	return n
+}
+
+// spill moves all segments held in memory to a temporary file
+func (c *continuation) spill() error {
+	if c.file == nil {
+		var err error
+		if c.file, err = ioutil.TempFile("", "webarchive-continuation-"); err != nil {
+			return err
+		}
+	}
+	for i, b := range c.bufs {
+		if b != nil {
+			if err := c.spillSegment(i, b); err != nil {
+				return err
+			}
+			c.bufs[i] = nil
+		}
+	}
+	return nil
+}
+
+func (c *continuation) spillSegment(i int, b []byte) error {
+	off, err := c.file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	if _, err = c.file.Write(b); err != nil {
+		return err
+	}
+	c.spans[i] = [2]int64{off, int64(len(b))}
+	return nil
+}
+
+// clear closes and removes any temporary file
+func (c *continuation) clear() {
+	if c.file != nil {
+		c.file.Close()
+		os.Remove(c.file.Name())
+		c.file = nil
+	}
 }
 
 // check completeness - have final segment and all previous segments
-func (c *continuation) complete() bool {
+func (c *continuation) complete() (bool, error) {
 	if !c.final {
-		return false
+		return false, nil
+	}
+	for _, h := range c.have {
+		if !h {
+			return false, nil
+		}
+	}
+	if c.file != nil {
+		for i, sp := range c.spans {
+			if c.bufs[i] == nil && sp[1] > 0 {
+				c.bufs[i] = make([]byte, sp[1])
+				if _, err := c.file.ReadAt(c.bufs[i], sp[0]); err != nil {
+					return false, err
+				}
+			}
+		}
+		c.clear()
 	}
 	var sz int
 	for _, b := range c.bufs {
-		if b == nil {
-			return false
-		}
 		sz += len(b)
 	}
 	c.buf = make([]byte, sz+len(c.fields))
@@ -523,21 +1221,47 @@ func (c *continuation) complete() bool {
 	}
 	c.idx, c.start = len(c.fields), len(c.fields)
 	c.fields = c.buf[:c.idx]
-	if len(c.buf[c.idx:]) > 5 && string(c.buf[c.idx:c.idx+5]) == "HTTP/" {
+	if c.httpBlock(c.buf[c.idx:]) {
 		bi := indexBlankLine(c.buf[c.idx:])
 		if bi > -1 {
 			c.idx += bi
 			c.start += bi
 			c.fields = c.buf[:c.idx]
+			c.http, c.hdrLen = true, bi
 		}
 	}
-	return true
+	return true, nil
+}
+
+// IsHTTP reports whether the merged block was an HTTP message, whose headers have been stripped.
+func (c *continuation) IsHTTP() bool { return c.http }
+
+// HasPayload reports whether the merged record has a non-empty payload.
+func (c *continuation) HasPayload() bool { return c.Size() > 0 }
+
+// PayloadOffset returns the length of any HTTP headers stripped from the start of the merged block.
+func (c *continuation) PayloadOffset() int64 { return int64(c.hdrLen) }
+
+// HTTPResponse parses the HTTP header stripped from the merged block. The body of the response reads the record's
+// payload, decoded of any transfer encodings.
+func (c *continuation) HTTPResponse() (*http.Response, error) {
+	if !c.http {
+		return nil, ErrHTTPResponse
+	}
+	if c.idx > c.start {
+		return nil, fmt.Errorf("%w: the record has been read from", ErrHTTPResponse)
+	}
+	return parseHTTPResponse(c, c.fields[len(c.fields)-c.hdrLen:], c.Size())
 }
 
 func (c *continuation) Size() int64 {
 	return int64(len(c.buf) - c.start)
 }
 
+func (c *continuation) unread() int64 {
+	return int64(len(c.buf) - c.idx)
+}
+
 func (c *continuation) Read(p []byte) (int, error) {
 	if c.idx >= len(c.buf) {
 		return 0, io.EOF
@@ -548,7 +1272,7 @@ func (c *continuation) Read(p []byte) (int, error) {
 		l = len(c.buf) - c.idx
 		err = io.EOF
 	}
-	copy(p, c.buf[c.idx:l])
+	copy(p, c.buf[c.idx:c.idx+l])
 	c.idx += l
 	return l, err
 }
@@ -585,3 +1309,15 @@ func (c *continuation) EofSlice(off int64, l int) ([]byte, error) {
 func (c *continuation) peek(i int) ([]byte, error) {
 	return c.Slice(0, i)
 }
+
+// counter counts the bytes read from an underlying reader
+type counter struct {
+	r io.Reader
+	n int64
+}
+
+func (c *counter) Read(p []byte) (int, error) {
+	i, err := c.r.Read(p)
+	c.n += int64(i)
+	return i, err
+}
@@ -0,0 +1,225 @@
+// Copyright 2015 Richard Lehane. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webarchive
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Replay is an http.Handler that serves the captures in a set of WARC files, for quick local inspection.
+//
+// It handles these paths:
+//
+//	/                        an HTML list of the captures
+//	/cdx?url=URL             CDX API: CDXJ lines for the captures of URL; add matchType=prefix for the captures
+//	                         of all URLs below URL, output=json for a JSON array and limit=N to cap the results
+//	/TIMESTAMP/URL           the capture of URL closest to TIMESTAMP (1 to 14 digits, as in CDX dates)
+//
+// Captures are replayed with their archived status and headers, but links within them aren't rewritten.
+// Revisit records are replayed using the response with the same payload digest.
+type Replay struct {
+	entries CDXIndex          // sorted by SURT then date
+	paths   map[string]string // CDX filename to path
+}
+
+// NewReplay indexes the WARC files at paths and returns a Replay for them.
+func NewReplay(paths ...string) (*Replay, error) {
+	rp := &Replay{paths: make(map[string]string)}
+	for i, p := range paths {
+		f, err := os.Open(p)
+		if err != nil {
+			return nil, err
+		}
+		name := filepath.Base(p)
+		if _, ok := rp.paths[name]; ok {
+			name = strconv.Itoa(i) + "-" + name
+		}
+		entries, err := Index(f, name)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", p, err)
+		}
+		rp.paths[name] = p
+		rp.entries = append(rp.entries, entries...)
+	}
+	rp.entries = NewCDXIndex(rp.entries)
+	return rp, nil
+}
+
+func (rp *Replay) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/":
+		rp.list(w)
+	case r.URL.Path == "/cdx":
+		rp.cdx(w, r)
+	default:
+		rp.replay(w, r)
+	}
+}
+
+// lookup returns the entries for a URL, or for all URLs below it if prefix is set
+func (rp *Replay) lookup(u string, prefix bool) []*CDX {
+	if prefix {
+		return rp.entries.CapturesSURT(strings.TrimSuffix(canonical(u), "/"))
+	}
+	return rp.entries.Captures(u)
+}
+
+var listTemplate = template.Must(template.New("list").Parse(`<!DOCTYPE html>
+<html><head><title>Captures</title></head><body><h1>Captures</h1><ul>
+{{range .}}<li><a href="/{{.Date.Format "20060102150405"}}/{{.URL}}">{{.URL}}</a> {{.Date.Format "2006-01-02 15:04:05"}} {{.MIME}} {{.Status}}</li>
+{{end}}</ul></body></html>
+`))
+
+func (rp *Replay) list(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	listTemplate.Execute(w, rp.entries)
+}
+
+func (rp *Replay) cdx(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	u := q.Get("url")
+	if u == "" {
+		http.Error(w, "missing url parameter", http.StatusBadRequest)
+		return
+	}
+	entries := rp.lookup(u, q.Get("matchType") == "prefix")
+	if l, err := strconv.Atoi(q.Get("limit")); err == nil && l >= 0 && l < len(entries) {
+		entries = entries[:l]
+	}
+	if q.Get("output") == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		if entries == nil {
+			entries = []*CDX{}
+		}
+		json.NewEncoder(w).Encode(entries)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	for _, e := range entries {
+		fmt.Fprintln(w, e.CDXJ())
+	}
+}
+
+func (rp *Replay) replay(w http.ResponseWriter, r *http.Request) {
+	p := strings.TrimPrefix(r.URL.RequestURI(), "/")
+	i := strings.IndexByte(p, '/')
+	if i < 1 || i > len(ARCTime) {
+		http.NotFound(w, r)
+		return
+	}
+	when, err := parseCDXDate(p[:i])
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	var best *CDX
+	for _, e := range rp.lookup(p[i+1:], false) {
+		if best == nil || absDuration(e.Date.Sub(when)) < absDuration(best.Date.Sub(when)) {
+			best = e
+		}
+	}
+	if best == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if best.MIME == "warc/revisit" {
+		if best = rp.original(best); best == nil {
+			http.Error(w, "revisit of a capture that isn't in this collection", http.StatusNotFound)
+			return
+		}
+	}
+	if err := rp.serveCapture(w, best); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+// original finds the capture revisited by a revisit entry: the latest earlier capture with the same digest,
+// preferring the same URL
+func (rp *Replay) original(rv *CDX) *CDX {
+	var best *CDX
+	for _, e := range rp.entries {
+		if e.Digest != rv.Digest || e.MIME == "warc/revisit" || e.Date.After(rv.Date) {
+			continue
+		}
+		if best == nil || (e.SURT == rv.SURT && best.SURT != rv.SURT) ||
+			((e.SURT == rv.SURT) == (best.SURT == rv.SURT) && e.Date.After(best.Date)) {
+			best = e
+		}
+	}
+	return best
+}
+
+// hop-by-hop and framing headers that aren't replayed
+var skipHeaders = map[string]bool{
+	"Connection":        true,
+	"Keep-Alive":        true,
+	"Transfer-Encoding": true,
+	"Content-Length":    true,
+}
+
+func (rp *Replay) serveCapture(w http.ResponseWriter, c *CDX) error {
+	f, err := os.Open(rp.paths[c.Filename])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	rdr, err := NewWARCReader(io.NewSectionReader(f, c.Offset, c.Length))
+	if err != nil {
+		return err
+	}
+	defer rdr.Close()
+	rec, err := rdr.Next()
+	if err != nil {
+		return err
+	}
+	if rdr.Type() != "response" {
+		w.Header().Set("Content-Type", rec.Fields().Get("Content-Type"))
+		w.Header().Set("Content-Length", strconv.FormatInt(rec.Size(), 10))
+		_, err = io.Copy(w, rec)
+		return err
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(rec), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	for k, v := range resp.Header {
+		if !skipHeaders[k] {
+			w.Header()[k] = v
+		}
+	}
+	w.Header().Set("Memento-Datetime", c.Date.Format(http.TimeFormat))
+	w.WriteHeader(resp.StatusCode)
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
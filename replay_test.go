@@ -0,0 +1,41 @@
+package webarchive
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestReplay(t *testing.T) {
+	checkExamples(t)
+	rp, err := NewReplay("examples/hello-world.warc", "examples/IAH-20080430204825-00000-blackbook.warc.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	get := func(path string) (int, string) {
+		rec := httptest.NewRecorder()
+		rp.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+		b, _ := ioutil.ReadAll(rec.Body)
+		return rec.Code, string(b)
+	}
+	code, body := get("/2015/http://iipc.github.io/warc-specifications/primers/web-archive-formats/hello-world.txt")
+	if code != 200 || !strings.HasPrefix(body, "Hello World") {
+		t.Errorf("bad replay: %d %q", code, body)
+	}
+	code, body = get("/20080430204825/http://www.archive.org/robots.txt")
+	if code != 200 || !strings.Contains(body, "Welcome to the Archive!") {
+		t.Errorf("bad replay: %d %q", code, body)
+	}
+	if code, _ = get("/20080430204825/http://example.com/"); code != 404 {
+		t.Errorf("expecting not found, got %d", code)
+	}
+	code, body = get("/cdx?url=http://www.archive.org/robots.txt")
+	if code != 200 || strings.Count(body, "\n") != 1 || !strings.HasPrefix(body, "org,archive)/robots.txt 20080430204825 ") {
+		t.Errorf("bad CDX API response: %d %q", code, body)
+	}
+	code, body = get("/cdx?url=http://www.archive.org/&matchType=prefix&limit=5")
+	if code != 200 || strings.Count(body, "\n") != 5 {
+		t.Errorf("bad CDX API response: %d %q", code, body)
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright 2015 Richard Lehane. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webarchive
+
+import (
+	"bytes"
+	"io"
+	"net/url"
+	"time"
+)
+
+// Resource describes a resource record to be written with WriteResource. The target URI can use any scheme,
+// such as the "urn:", "screenshot:" and "metadata:" URIs written by browser-based capture tools.
+type Resource struct {
+	URI          string    // target URI e.g. "screenshot:http://example.com/" or "urn:pageinfo:http://example.com/"
+	ContentType  string    // media type of the block e.g. "image/png"
+	Date         time.Time // when the resource was captured; the current time if zero
+	ConcurrentTo []string  // IDs of records captured along with this one e.g. the response for the page in a screenshot
+	Block        []byte
+}
+
+// WriteResource writes a WARC 1.0 resource record to w, returning the ID of the record.
+// Returns ErrTargetURI if the resource's URI isn't an absolute URI.
+func WriteResource(w io.Writer, r Resource) (string, error) {
+	if u, err := url.Parse(r.URI); err != nil || u.Scheme == "" {
+		return "", ErrTargetURI
+	}
+	date := r.Date
+	if date.IsZero() {
+		date = now()
+	}
+	id := newRecordID()
+	fields := RawFields{
+		{Key: "WARC-Type", Value: "resource"},
+		{Key: "WARC-Target-URI", Value: r.URI},
+		{Key: "WARC-Date", Value: formatVersionDate("1.0", date)},
+		{Key: "WARC-Record-ID", Value: id},
+	}
+	for _, c := range r.ConcurrentTo {
+		fields.Add("WARC-Concurrent-To", bracketID(c))
+	}
+	ct := r.ContentType
+	if ct == "" {
+		ct = "application/octet-stream"
+	}
+	fields.Add("Content-Type", ct)
+	fields.Add("WARC-Block-Digest", sha1Digest(r.Block).String())
+	return id, newWARCWriter(w).writeRecord("1.0", fields, bytes.NewReader(r.Block), int64(len(r.Block)))
+}
@@ -0,0 +1,70 @@
+package webarchive
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteResource(t *testing.T) {
+	buf := &bytes.Buffer{}
+	if _, err := WriteResource(buf, Resource{URI: "example.com/page"}); err != ErrTargetURI {
+		t.Fatalf("expecting ErrTargetURI, got %v", err)
+	}
+	var ids []string
+	for _, r := range []Resource{
+		{URI: "screenshot:http://example.com/", ContentType: "image/png", ConcurrentTo: []string{"urn:uuid:1"}, Block: []byte("png")},
+		{URI: "urn:pageinfo:http://example.com/", ContentType: "application/json", Block: []byte("{}")},
+		{URI: "metadata://example.com/crawl.log", Block: []byte("log")},
+	} {
+		id, err := WriteResource(buf, r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	rdr, err := NewReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var urls []string
+	for {
+		rec, err := rdr.NextPayload()
+		if err != nil {
+			break
+		}
+		urls = append(urls, rec.URL())
+		if rec.(WARCRecord).ID() != ids[len(urls)-1] {
+			t.Errorf("bad ID for %s", rec.URL())
+		}
+	}
+	if len(urls) != 3 || urls[0] != "screenshot:http://example.com/" || urls[1] != "urn:pageinfo:http://example.com/" {
+		t.Fatalf("bad resources: %v", urls)
+	}
+	recs, _ := readAll(t, buf.Bytes())
+	if recs[0].Get("WARC-Concurrent-To") != "<urn:uuid:1>" || recs[2].Get("Content-Type") != "application/octet-stream" {
+		t.Errorf("bad fields: %v", recs)
+	}
+	if s := SURT("metadata://example.com/crawl.log"); s != "metadata://example.com/crawl.log" {
+		t.Errorf("expecting metadata URI not to be transformed, got %s", s)
+	}
+}
+
+func TestTargetURI(t *testing.T) {
+	buf := &bytes.Buffer{}
+	for _, uri := range []string{"urn:pageinfo:http://example.com/", "mailto:a@example.com", "metadata://example.com/crawl.log"} {
+		if _, err := WriteResource(buf, Resource{URI: uri}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rdr, _ := NewReader(bytes.NewReader(buf.Bytes()))
+	for _, e := range [][2]string{{"urn", "pageinfo:http://example.com/"}, {"mailto", "a@example.com"}, {"metadata", ""}} {
+		rec, err := rdr.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		u := rec.TargetURI()
+		if u == nil || u.Scheme != e[0] || u.Opaque != e[1] {
+			t.Errorf("%s: bad target URI %#v", rec.URL(), u)
+		}
+	}
+}
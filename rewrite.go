@@ -0,0 +1,828 @@
+// Copyright 2015 Richard Lehane. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webarchive
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// capture identifies a previously seen record that later records can refer to
+type capture struct {
+	id   string // WARC-Record-ID
+	url  string // WARC-Target-URI
+	date string // WARC-Date, as given in the record
+}
+
+// add the captures listed in a CDX index to a map of captures keyed by payload digest
+func loadCDXCaptures(seen map[string]capture, r io.Reader) error {
+	rdr := NewCDXReader(r)
+	for {
+		c, err := rdr.Next()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if c.Digest == "" || c.URL == "" {
+			continue
+		}
+		d, err := ParseDigest(c.Digest)
+		if err != nil {
+			d = Digest{Algorithm: "sha1", Value: c.Digest}
+		}
+		if _, ok := seen[d.String()]; !ok {
+			seen[d.String()] = capture{url: c.URL, date: FormatWARCDate(c.Date)}
+		}
+	}
+}
+
+func revisitProfile(version string) string {
+	if version == "1.1" {
+		return "http://netpreserve.org/warc/1.1/revisit/identical-payload-digest"
+	}
+	return "http://netpreserve.org/warc/1.0/revisit/identical-payload-digest"
+}
+
+// Deduplicate reads the WARC file in r and writes a deduplicated copy to w.
+// Response records with the same payload digest as an earlier response are
+// written as revisit records (using the identical-payload-digest profile)
+// that refer to the first capture. The revisit records retain the HTTP headers of
+// the duplicate response but not its payload. All other records are copied unchanged.
+// Responses with empty payloads are never replaced, as their digests are all the same.
+//
+// The WARC-Payload-Digest field is used for comparison. If a response doesn't have this field,
+// a sha1 digest of its payload is computed. Each response is buffered in memory while
+// its digest is checked.
+//
+// CDX indexes of earlier crawls can be given as priors, so that responses duplicating
+// captures stored in other files are also replaced by revisits. As CDX indexes don't record
+// WARC-Record-IDs, revisits of these captures refer to them by WARC-Refers-To-Target-URI
+// and WARC-Refers-To-Date only. These fields are only written to revisits in WARC/1.0 files when
+// the capture has no WARC-Record-ID, as they were added in WARC/1.1. CDX digests without a label are taken to be sha1.
+//
+// Returns the number of records that were replaced with revisit records.
+func Deduplicate(w io.Writer, r io.Reader, priors ...io.Reader) (int, error) {
+	seen := make(map[string]capture)
+	for _, p := range priors {
+		if err := loadCDXCaptures(seen, p); err != nil {
+			return 0, err
+		}
+	}
+	rdr, err := NewWARCReader(r)
+	if err != nil {
+		return 0, err
+	}
+	defer rdr.Close()
+	ww := newWARCWriter(w)
+	var n int
+	for {
+		rec, err := rdr.Next()
+		if err != nil {
+			if err == io.EOF {
+				return n, nil
+			}
+			return n, err
+		}
+		fields := rec.RawFields()
+		if rdr.Type() != "response" || rdr.segment > 0 {
+			if err = ww.writeRecord(rdr.Version(), fields, rec, rec.Size()); err != nil {
+				return n, err
+			}
+			continue
+		}
+		block, err := ioutil.ReadAll(rec)
+		if err != nil {
+			return n, err
+		}
+		hl := httpHeaderLen(block)
+		if hl == len(block) {
+			// empty payloads all have the same digest, so don't show that a response duplicates another
+			if err = ww.writeRecord(rdr.Version(), fields, bytes.NewReader(block), int64(len(block))); err != nil {
+				return n, err
+			}
+			continue
+		}
+		digest, err := ParseDigest(fields.Get("WARC-Payload-Digest"))
+		if err != nil {
+			digest = sha1Digest(block[hl:])
+		}
+		if first, ok := seen[digest.String()]; ok {
+			fields.Set("WARC-Type", "revisit")
+			fields.Set("WARC-Profile", revisitProfile(rdr.Version()))
+			if first.id != "" {
+				fields.Set("WARC-Refers-To", first.id)
+			}
+			// WARC 1.0 has no fields for the URI or date of the capture, but they are the only reference to captures
+			// without IDs
+			if rdr.Version() != "1.0" || first.id == "" {
+				fields.Set("WARC-Refers-To-Target-URI", first.url)
+				fields.Set("WARC-Refers-To-Date", first.date)
+			}
+			fields.Set("WARC-Payload-Digest", digest.String())
+			fields.Set("WARC-Block-Digest", sha1Digest(block[:hl]).String())
+			if err = ww.writeRecord(rdr.Version(), fields, bytes.NewReader(block[:hl]), int64(hl)); err != nil {
+				return n, err
+			}
+			n++
+			continue
+		}
+		seen[digest.String()] = capture{id: rdr.ID(), url: rec.URL(), date: fields.Get("WARC-Date")}
+		if err = ww.writeRecord(rdr.Version(), fields, bytes.NewReader(block), int64(len(block))); err != nil {
+			return n, err
+		}
+	}
+}
+
+// Extract copies the records in the WARC file read from r that match the given URLs or SURT
+// prefixes to w. Target URIs are compared in canonical form (see Canonical), by default SURT,
+// so "http://www.example.com/" matches "http://example.com:80/". A SURT prefix such as
+// "com,example)/about" matches all URLs below that point.
+//
+// Along with each matching record, any record that declares itself concurrent to a match
+// (using WARC-Concurrent-To, as metadata records typically do) is extracted. Request records
+// are matched by their target URI. Warcinfo records are always copied so that the output
+// retains the provenance of its records.
+//
+// Returns the number of records extracted, not counting warcinfo records.
+func Extract(w io.Writer, r io.Reader, urls []string, surtPrefixes []string) (int, error) {
+	rdr, err := NewWARCReader(r)
+	if err != nil {
+		return 0, err
+	}
+	defer rdr.Close()
+	exact := make(map[string]bool)
+	for _, u := range urls {
+		exact[canonical(u)] = true
+	}
+	match := func(u string) bool {
+		if u == "" {
+			return false
+		}
+		s := canonical(u)
+		if exact[s] {
+			return true
+		}
+		for _, p := range surtPrefixes {
+			if strings.HasPrefix(s, p) {
+				return true
+			}
+		}
+		return false
+	}
+	ww := newWARCWriter(w)
+	matched := make(map[string]bool)
+	var n int
+	for {
+		rec, err := rdr.Next()
+		if err != nil {
+			if err == io.EOF {
+				return n, nil
+			}
+			return n, err
+		}
+		fields := rec.RawFields()
+		ok := rdr.Type() == "warcinfo" || match(rec.URL())
+		if !ok {
+			for _, c := range fields.Values("WARC-Concurrent-To") {
+				if matched[c] {
+					ok = true
+					break
+				}
+			}
+		}
+		if !ok {
+			continue
+		}
+		if rdr.Type() != "warcinfo" {
+			matched[rdr.ID()] = true
+			n++
+		}
+		if err = ww.writeRecord(rdr.Version(), fields, rec, rec.Size()); err != nil {
+			return n, err
+		}
+	}
+}
+
+// selectCaptures copies the records of the WARC file in r to w, keeping the captures for which keep returns true.
+// keep is called for each record that isn't linked to an earlier record by WARC-Concurrent-To. Linked
+// records (e.g. metadata records) follow the decision made for the record they are concurrent to. A request
+// that precedes its response is held until the response is read, and then follows the decision for the response.
+// Warcinfo records are always copied. Returns the number of records for which keep returned true.
+func selectCaptures(w io.Writer, r io.Reader, keep func(Header) bool) (int, error) {
+	rdr, err := NewWARCReader(r)
+	if err != nil {
+		return 0, err
+	}
+	defer rdr.Close()
+	ww := newWARCWriter(w)
+	decided := make(map[string]bool)
+	var n int
+	var pending *heldRecord
+	decide := func(h Header) bool {
+		ok := keep(h)
+		if ok {
+			n++
+		}
+		return ok
+	}
+	flush := func(ok bool) error {
+		p := pending
+		pending = nil
+		decided[p.id] = ok
+		if !ok {
+			return nil
+		}
+		return ww.writeRecord(p.version, p.fields, bytes.NewReader(p.block), int64(len(p.block)))
+	}
+	for {
+		rec, err := rdr.Next()
+		if err != nil {
+			if err == io.EOF {
+				if pending != nil {
+					return n, flush(decide(pending))
+				}
+				return n, nil
+			}
+			return n, err
+		}
+		fields := rec.RawFields()
+		concurrent := fields.Values("WARC-Concurrent-To")
+		ok, linked := true, rdr.Type() == "warcinfo"
+		for _, c := range concurrent {
+			if v, seen := decided[c]; seen && !linked {
+				ok, linked = v, true
+			}
+		}
+		if pending != nil {
+			var follows bool
+			for _, c := range concurrent {
+				follows = follows || c == pending.id
+			}
+			if follows {
+				if !linked {
+					ok, linked = decide(rdr), true
+				}
+				if err = flush(ok); err != nil {
+					return n, err
+				}
+			} else if err = flush(decide(pending)); err != nil {
+				return n, err
+			}
+		}
+		if !linked {
+			if rdr.Type() == "request" {
+				if pending, err = holdRecord(rdr, fields); err != nil {
+					return n, err
+				}
+				continue
+			}
+			ok = decide(rdr)
+		}
+		decided[rdr.ID()] = ok
+		if !ok {
+			continue
+		}
+		if err = ww.writeRecord(rdr.Version(), fields, rec, rec.Size()); err != nil {
+			return n, err
+		}
+	}
+}
+
+// a record buffered in memory
+type heldRecord struct {
+	*warcHeader
+	version string
+	fields  RawFields
+	block   []byte
+}
+
+func holdRecord(w *WARCReader, fields RawFields) (*heldRecord, error) {
+	block, err := ioutil.ReadAll(w)
+	if err != nil {
+		return nil, err
+	}
+	hdr := *w.warcHeader
+	hdr.fields = append([]byte(nil), hdr.fields...)
+	return &heldRecord{warcHeader: &hdr, version: w.Version(), fields: fields, block: block}, nil
+}
+
+// Sampler selects a representative subset of the captures in a WARC file, for QA and development
+// against large collections. The sampling modes can be combined, in which case a capture must satisfy each.
+// A capture is a response, resource, revisit or conversion record, together with any request and metadata
+// records concurrent to it.
+type Sampler struct {
+	Every    int     // keep every nth capture, starting with the first; 0 or 1 keeps all
+	Fraction float64 // if between 0 and 1, keep each capture with this probability
+	Seed     int64   // seed for random selection, so that samples are reproducible
+	PerHost  int     // if greater than 0, keep only the first PerHost captures of each host
+}
+
+// Sample writes a sample of the WARC file read from r to w. Warcinfo records are always kept.
+// Returns the number of captures in the sample.
+func (s *Sampler) Sample(w io.Writer, r io.Reader) (int, error) {
+	rnd := rand.New(rand.NewSource(s.Seed))
+	hosts := make(map[string]int)
+	var i int
+	return selectCaptures(w, r, func(h Header) bool {
+		i++
+		if s.Every > 1 && (i-1)%s.Every != 0 {
+			return false
+		}
+		if s.Fraction > 0 && s.Fraction < 1 && rnd.Float64() >= s.Fraction {
+			return false
+		}
+		if s.PerHost > 0 {
+			host := hostOf(h.URL())
+			if hosts[host] >= s.PerHost {
+				return false
+			}
+			hosts[host]++
+		}
+		return true
+	})
+}
+
+// RedactedField is the extension field added to records altered by a Redactor.
+// Its value is "masked" if content within the payload was masked, or "removed" if the payload was removed.
+const RedactedField = "WARC-Redacted"
+
+// Redactor removes or masks payload content, as needed for takedown and privacy requests.
+//
+// Payloads with HTTP transfer or content encodings (chunked, gzip or deflate) are decoded before
+// patterns are matched; if a match is found, the decoded payload is written and the encoding
+// headers are removed. The HTTP Content-Length header, the record's Content-Length and any
+// WARC-Block-Digest and WARC-Payload-Digest fields are recomputed for altered records.
+// Digests are recomputed as sha1.
+//
+// Example:
+//
+//	rd := &webarchive.Redactor{Patterns: []*regexp.Regexp{regexp.MustCompile(`[\w.]+@example\.com`)}}
+//	n, err := rd.Redact(out, in)
+type Redactor struct {
+	Patterns    []*regexp.Regexp // payload content matching these patterns is masked
+	Replacement []byte           // replaces each match; if nil, each byte of the match is replaced with 'X'
+	URLs        []string         // records with these target URIs have their payload removed
+}
+
+// Redact reads the WARC file in r and writes a redacted copy to w. Patterns apply to the payloads of response,
+// request, resource, conversion and metadata records. Returns the number of records that were altered.
+func (rd *Redactor) Redact(w io.Writer, r io.Reader) (int, error) {
+	rdr, err := NewWARCReader(r)
+	if err != nil {
+		return 0, err
+	}
+	defer rdr.Close()
+	urls := make(map[string]bool)
+	for _, u := range rd.URLs {
+		urls[canonical(u)] = true
+	}
+	ww := newWARCWriter(w)
+	var n int
+	for {
+		rec, err := rdr.Next()
+		if err != nil {
+			if err == io.EOF {
+				return n, nil
+			}
+			return n, err
+		}
+		fields := rec.RawFields()
+		switch rdr.Type() {
+		case "response", "request", "resource", "conversion", "metadata":
+		default:
+			if err = ww.writeRecord(rdr.Version(), fields, rec, rec.Size()); err != nil {
+				return n, err
+			}
+			continue
+		}
+		block, err := ioutil.ReadAll(rec)
+		if err != nil {
+			return n, err
+		}
+		hl := httpHeaderLen(block)
+		header, payload := block[:hl], block[hl:]
+		var action string
+		var decoded bool
+		if rec.URL() != "" && urls[canonical(rec.URL())] {
+			action, payload, decoded = "removed", nil, true
+		} else {
+			if enc := httpEncodings(header); len(enc) > 0 {
+				if p, err := decodeBytes(payload, enc); err == nil {
+					payload, decoded = p, true
+				}
+			}
+			var masked bool
+			if payload, masked = rd.mask(payload); masked {
+				action = "masked"
+			}
+		}
+		if action == "" {
+			if err = ww.writeRecord(rdr.Version(), fields, bytes.NewReader(block), int64(len(block))); err != nil {
+				return n, err
+			}
+			continue
+		}
+		if hl > 0 {
+			hf := getRawFields(header)
+			if decoded {
+				hf.Del("Transfer-Encoding")
+				hf.Del("Content-Encoding")
+			}
+			if decoded || hf.Get("Content-Length") != "" {
+				hf.Set("Content-Length", strconv.Itoa(len(payload)))
+			}
+			buf := &bytes.Buffer{}
+			hf.WriteTo(buf)
+			header = buf.Bytes()
+		}
+		block = append(append([]byte{}, header...), payload...)
+		if fields.Get("WARC-Block-Digest") != "" {
+			fields.Set("WARC-Block-Digest", sha1Digest(block).String())
+		}
+		if fields.Get("WARC-Payload-Digest") != "" {
+			fields.Set("WARC-Payload-Digest", sha1Digest(payload).String())
+		}
+		fields.Set(RedactedField, action)
+		if err = ww.writeRecord(rdr.Version(), fields, bytes.NewReader(block), int64(len(block))); err != nil {
+			return n, err
+		}
+		n++
+	}
+}
+
+// mask any content matching the Redactor's patterns, reporting whether a match was found
+func (rd *Redactor) mask(payload []byte) ([]byte, bool) {
+	var masked bool
+	for _, re := range rd.Patterns {
+		payload = re.ReplaceAllFunc(payload, func(m []byte) []byte {
+			masked = true
+			if rd.Replacement != nil {
+				return rd.Replacement
+			}
+			return bytes.Repeat([]byte("X"), len(m))
+		})
+	}
+	return payload, masked
+}
+
+// normalise a record ID to its bracketed form e.g. <urn:uuid:...>
+func bracketID(id string) string {
+	id = strings.TrimSpace(id)
+	if strings.HasPrefix(id, "<") {
+		return id
+	}
+	return "<" + id + ">"
+}
+
+// Delete reads the WARC file in r and writes a copy to w without the records that have the given IDs.
+// IDs can be given with or without enclosing angle brackets.
+//
+// If reason is not empty, each deleted record is replaced by a tombstone: a metadata record that
+// refers to the deleted record (with WARC-Refers-To) and explains the removal in an application/warc-fields
+// block. Tombstones retain the target URI, date and warcinfo ID of the deleted record, so that the
+// removal is visible in indexes built from the output. All other records are copied unchanged.
+//
+// Returns the number of records deleted.
+func Delete(w io.Writer, r io.Reader, ids []string, reason string) (int, error) {
+	rdr, err := NewWARCReader(r)
+	if err != nil {
+		return 0, err
+	}
+	defer rdr.Close()
+	del := make(map[string]bool)
+	for _, id := range ids {
+		del[bracketID(id)] = true
+	}
+	ww := newWARCWriter(w)
+	var n int
+	for {
+		rec, err := rdr.Next()
+		if err != nil {
+			if err == io.EOF {
+				return n, nil
+			}
+			return n, err
+		}
+		fields := rec.RawFields()
+		if !del[rdr.ID()] {
+			if err = ww.writeRecord(rdr.Version(), fields, rec, rec.Size()); err != nil {
+				return n, err
+			}
+			continue
+		}
+		n++
+		if reason == "" {
+			continue
+		}
+		tomb := RawFields{
+			{Key: "WARC-Type", Value: "metadata"},
+			{Key: "WARC-Record-ID", Value: newRecordID()},
+			{Key: "WARC-Date", Value: fields.Get("WARC-Date")},
+		}
+		for _, k := range []string{"WARC-Target-URI", "WARC-Warcinfo-ID"} {
+			if v := fields.Get(k); v != "" {
+				tomb.Add(k, v)
+			}
+		}
+		tomb.Add("WARC-Refers-To", rdr.ID())
+		tomb.Add("Content-Type", "application/warc-fields")
+		block := []byte("deleted: " + rdr.ID() + "\r\ntype: " + rdr.Type() + "\r\ndeletion-date: " +
+			formatVersionDate(rdr.Version(), now()) + "\r\nreason: " + reason + "\r\n")
+		if err = ww.writeRecord(rdr.Version(), tomb, bytes.NewReader(block), int64(len(block))); err != nil {
+			return n, err
+		}
+	}
+}
+
+// Recompress reads the WARC file in r and writes a copy to w using compression c.
+// For GzipCompression, level is a gzip compression level (e.g. gzip.BestCompression), or gzip.DefaultCompression.
+// The content of records is not altered.
+//
+// The WARC-Block-Digest and WARC-Payload-Digest fields of each record are checked against the
+// content as it is copied (except the payload digests of revisit records, which are of the payload revisited),
+// and Recompress stops with an error wrapping ErrDigestMatch at
+// the first mismatch. Digests using algorithms that aren't supported (see DigestWith) are not checked.
+//
+// Returns the number of records copied.
+func Recompress(w io.Writer, r io.Reader, c Compression, level int) (int, error) {
+	ww := newWARCWriter(w)
+	if err := ww.setCompression(c); err != nil {
+		return 0, err
+	}
+	ww.level = level
+	rdr, err := NewWARCReader(r)
+	if err != nil {
+		return 0, err
+	}
+	defer rdr.Close()
+	var n int
+	for {
+		rec, err := rdr.Next()
+		if err != nil {
+			if err == io.EOF {
+				return n, nil
+			}
+			return n, err
+		}
+		fields := rec.RawFields()
+		bd, pd := recordDigests(fields)
+		dg := newDigester(bd.Algorithm, pd.Algorithm)
+		if err = ww.writeRecord(rdr.Version(), fields, io.TeeReader(rec, dg), rec.Size()); err != nil {
+			return n, err
+		}
+		if err = checkDigests(rdr.ID(), bd, pd, dg); err != nil {
+			return n, err
+		}
+		n++
+	}
+}
+
+// Reserialize writes a record returned by a Reader's Next method to w exactly as it was read: its version line and
+// header fields with their original spelling, order, folding and line endings, and its block, followed by the two
+// CRLFs that end each record. The block is checked against the record's WARC-Block-Digest and WARC-Payload-Digest
+// fields as it is written, so that tools that migrate or repackage records can show that content wasn't altered.
+// A mismatch returns an error wrapping ErrDigestMatch, after the record has been written.
+//
+// Returns ErrReserialize for records that can't be reproduced exactly: ARC records, records whose HTTP headers were
+// stripped by NextPayload, merged continuations, and records whose block has already been read. Returns the number
+// of bytes written.
+func Reserialize(w io.Writer, rec Record) (int64, error) {
+	wr, ok := rec.(*WARCReader)
+	if !ok || wr.strip || wr.thisIdx > 0 || len(wr.vline) == 0 {
+		return 0, ErrReserialize
+	}
+	fields := wr.RawFields()
+	bd, pd := recordDigests(fields)
+	dg := newDigester(bd.Algorithm, pd.Algorithm)
+	ww := newWARCWriter(w)
+	if _, err := ww.Write(wr.vline); err != nil {
+		return ww.n, err
+	}
+	if _, err := fields.WriteTo(ww); err != nil {
+		return ww.n, err
+	}
+	if n, err := io.Copy(ww, io.TeeReader(wr, dg)); err != nil {
+		return ww.n, err
+	} else if n < wr.Size() {
+		return ww.n, io.ErrUnexpectedEOF
+	}
+	if _, err := io.WriteString(ww, "\r\n\r\n"); err != nil {
+		return ww.n, err
+	}
+	return ww.n, checkDigests(wr.ID(), bd, pd, dg)
+}
+
+// recordDigests returns the block and payload digests of a record that can be checked against its block. The payload
+// digest of a revisit record is of the payload it revisits, not of its own block, so isn't returned.
+func recordDigests(fields RawFields) (block, payload Digest) {
+	block, _ = ParseDigest(fields.Get("WARC-Block-Digest"))
+	if RecordType(fields.Get("WARC-Type")) != TypeRevisit {
+		payload, _ = ParseDigest(fields.Get("WARC-Payload-Digest"))
+	}
+	return block, payload
+}
+
+// check digests computed by a digester against the block and payload digests given in a record's fields
+func checkDigests(id string, block, payload Digest, dg *digester) error {
+	bsum, psum := dg.sums()
+	if bsum != nil && !block.matches(bsum) {
+		return fmt.Errorf("%w: WARC-Block-Digest of record %s", ErrDigestMatch, id)
+	}
+	if psum != nil && !payload.matches(psum) {
+		return fmt.Errorf("%w: WARC-Payload-Digest of record %s", ErrDigestMatch, id)
+	}
+	return nil
+}
+
+// Truncate reads the WARC file in r and writes a copy to w in which payloads longer than limit bytes are cut
+// to that length, for producing slim derivative archives. Truncated records are marked with "WARC-Truncated: length"
+// and have their Content-Length and any WARC-Block-Digest and WARC-Payload-Digest fields recomputed, with the
+// algorithm and encoding of the original digests. HTTP headers are retained and don't count towards the limit, but
+// their Content-Length header is set to the length of the truncated payload. Payloads with a transfer encoding
+// (e.g. chunked) are decoded of it before they are cut, and the Transfer-Encoding header is removed.
+// Only response, resource and conversion records are truncated: records with HTTP headers too long to be retained
+// in full, and payloads that can't be decoded of their transfer encodings, are copied unchanged.
+//
+// Returns the number of records truncated.
+func Truncate(w io.Writer, r io.Reader, limit int64) (int, error) {
+	rdr, err := NewWARCReader(r)
+	if err != nil {
+		return 0, err
+	}
+	defer rdr.Close()
+	ww := newWARCWriter(w)
+	var n int
+	for {
+		rec, err := rdr.Next()
+		if err != nil {
+			if err == io.EOF {
+				return n, nil
+			}
+			return n, err
+		}
+		fields := rec.RawFields()
+		switch rdr.Type() {
+		case "response", "resource", "conversion":
+		default:
+			if err = ww.writeRecord(rdr.Version(), fields, rec, rec.Size()); err != nil {
+				return n, err
+			}
+			continue
+		}
+		if rec.Size() <= limit {
+			if err = ww.writeRecord(rdr.Version(), fields, rec, rec.Size()); err != nil {
+				return n, err
+			}
+			continue
+		}
+		head := rec.Size()
+		if head > limit+maxHTTPHeader {
+			head = limit + maxHTTPHeader
+		}
+		buf := make([]byte, head)
+		if _, err = io.ReadFull(rec, buf); err != nil {
+			return n, err
+		}
+		var hl int64
+		if rdr.IsHTTP() {
+			hl = int64(httpHeaderLen(buf))
+		}
+		if (rdr.IsHTTP() && hl == 0) || hl+limit >= rec.Size() {
+			if err = ww.writeRecord(rdr.Version(), fields, io.MultiReader(bytes.NewReader(buf), rec), rec.Size()); err != nil {
+				return n, err
+			}
+			continue
+		}
+		header, payload := buf[:hl], buf[hl:hl+limit]
+		if hl > 0 {
+			hf := getRawFields(header)
+			if te := hf.Get("Transfer-Encoding"); te != "" {
+				body, raw := io.MultiReader(bytes.NewReader(buf[hl:]), rec), &bytes.Buffer{}
+				if payload = truncateDecoded(io.TeeReader(body, raw), te, limit); payload == nil {
+					if err = ww.writeRecord(rdr.Version(), fields, io.MultiReader(bytes.NewReader(header), raw, body), rec.Size()); err != nil {
+						return n, err
+					}
+					continue
+				}
+				hf.Del("Transfer-Encoding")
+			}
+			hf.Set("Content-Length", strconv.Itoa(len(payload)))
+			hb := &bytes.Buffer{}
+			hf.WriteTo(hb)
+			header = hb.Bytes()
+		}
+		block := append(append([]byte{}, header...), payload...)
+		if v := fields.Get("WARC-Block-Digest"); v != "" {
+			d, _ := ParseDigest(v)
+			fields.Set("WARC-Block-Digest", redigest(d, block).String())
+		}
+		if v := fields.Get("WARC-Payload-Digest"); v != "" {
+			d, _ := ParseDigest(v)
+			fields.Set("WARC-Payload-Digest", redigest(d, payload).String())
+		}
+		fields.Set("WARC-Truncated", "length")
+		if err = ww.writeRecord(rdr.Version(), fields, bytes.NewReader(block), int64(len(block))); err != nil {
+			return n, err
+		}
+		n++
+	}
+}
+
+// truncateDecoded returns the first limit bytes of a payload read from r, decoded of the transfer encodings te.
+// Returns nil if the payload can't be decoded, or isn't longer than limit once decoded.
+func truncateDecoded(r io.Reader, te string, limit int64) []byte {
+	dec, err := decodeReader(r, splitAndReverse(strings.ToLower(te)))
+	if err != nil {
+		return nil
+	}
+	p := make([]byte, limit+1)
+	if _, err = io.ReadFull(dec, p); err != nil {
+		return nil
+	}
+	return p[:limit]
+}
+
+// Identify reads the WARC file in r and writes a copy to w in which response, resource and conversion records have a
+// WARC-Identified-Payload-Type field, identified by sniffing the first bytes of their payloads (see WithSniffing).
+// Records that already have the field, and records with empty payloads, are copied unchanged.
+//
+// Returns the number of records identified.
+func Identify(w io.Writer, r io.Reader) (int, error) {
+	rdr, err := NewWARCReader(r)
+	if err != nil {
+		return 0, err
+	}
+	defer rdr.Close()
+	ww := newWARCWriter(w)
+	var n int
+	for {
+		rec, err := rdr.Next()
+		if err != nil {
+			if err == io.EOF {
+				return n, nil
+			}
+			return n, err
+		}
+		fields := rec.RawFields()
+		switch rdr.Type() {
+		case "response", "resource", "conversion":
+		default:
+			if err = ww.writeRecord(rdr.Version(), fields, rec, rec.Size()); err != nil {
+				return n, err
+			}
+			continue
+		}
+		if fields.Get("WARC-Identified-Payload-Type") != "" || rdr.segment > 1 {
+			if err = ww.writeRecord(rdr.Version(), fields, rec, rec.Size()); err != nil {
+				return n, err
+			}
+			continue
+		}
+		head := rec.Size()
+		if head > maxHTTPHeader+sniffLen {
+			head = maxHTTPHeader + sniffLen
+		}
+		buf := make([]byte, head)
+		if _, err = io.ReadFull(rec, buf); err != nil {
+			return n, err
+		}
+		declared := fields.Get("Content-Type")
+		payload := buf
+		if rdr.Type() == "response" && rdr.httpBlock(buf) {
+			hl := httpHeaderLen(buf)
+			declared = getSelectValues(buf[:hl], "Content-Type")[0]
+			payload = buf[hl:]
+		}
+		if int64(len(buf)) == rec.Size() && len(payload) == 0 {
+			if err = ww.writeRecord(rdr.Version(), fields, bytes.NewReader(buf), rec.Size()); err != nil {
+				return n, err
+			}
+			continue
+		}
+		fields.Set("WARC-Identified-Payload-Type", sniffType(payload, declared))
+		if err = ww.writeRecord(rdr.Version(), fields, io.MultiReader(bytes.NewReader(buf), rec), rec.Size()); err != nil {
+			return n, err
+		}
+		n++
+	}
+}
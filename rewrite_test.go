@@ -0,0 +1,485 @@
+package webarchive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// read all records in a WARC, returning a snapshot of each record's fields and its block
+func readAll(t *testing.T, buf []byte) ([]Fields, [][]byte) {
+	rdr, err := NewWARCReader(bytes.NewReader(buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields []Fields
+	var blocks [][]byte
+	for {
+		rec, err := rdr.Next()
+		if err == io.EOF {
+			return fields, blocks
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := ioutil.ReadAll(rec)
+		fields = append(fields, rec.Fields())
+		blocks = append(blocks, b)
+	}
+}
+
+func TestDeduplicate(t *testing.T) {
+	checkExamples(t)
+	buf, _ := ioutil.ReadFile("examples/hello-world.warc")
+	out := &bytes.Buffer{}
+	n, err := Deduplicate(out, bytes.NewReader(append(append([]byte{}, buf...), buf...)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("expecting 1 revisit, got %d", n)
+	}
+	recs, blocks := readAll(t, out.Bytes())
+	if len(recs) != 12 {
+		t.Fatalf("expecting 12 records, got %d", len(recs))
+	}
+	rv := recs[8]
+	if rv.Get("WARC-Type") != "revisit" || rv.Get("WARC-Refers-To") != recs[2].Get("WARC-Record-ID") ||
+		rv.Get("WARC-Refers-To-Target-URI") != "" || rv.Get("WARC-Refers-To-Date") != "" {
+		t.Errorf("bad revisit record: %v", rv)
+	}
+	if l, _ := rv.GetInt("Content-Length"); l != int64(len(blocks[8])) || httpHeaderLen(blocks[8]) != len(blocks[8]) {
+		t.Errorf("expecting revisit block to contain only HTTP headers, got %q", blocks[8])
+	}
+	// the payload digest of the revisit is of the revisited payload, so isn't checked against its block
+	if _, err = Recompress(ioutil.Discard, bytes.NewReader(out.Bytes()), GzipCompression, gzip.DefaultCompression); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDeduplicateEmptyPayloads(t *testing.T) {
+	buf := &bytes.Buffer{}
+	ww := newWARCWriter(buf)
+	block := "HTTP/1.1 204 No Content\r\n\r\n"
+	for i := 0; i < 2; i++ {
+		fields := RawFields{
+			{Key: "WARC-Type", Value: "response"},
+			{Key: "WARC-Target-URI", Value: "http://example.com/" + strconv.Itoa(i)},
+			{Key: "WARC-Date", Value: "2020-01-01T00:00:00Z"},
+			{Key: "WARC-Record-ID", Value: newRecordID()},
+			{Key: "Content-Type", Value: "application/http;msgtype=response"},
+		}
+		if err := ww.writeRecord("1.1", fields, strings.NewReader(block), int64(len(block))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	n, err := Deduplicate(ioutil.Discard, bytes.NewReader(buf.Bytes()))
+	if err != nil || n != 0 {
+		t.Errorf("expecting empty payloads not to be deduplicated, got %d revisits (%v)", n, err)
+	}
+}
+
+func TestExtract(t *testing.T) {
+	checkExamples(t)
+	f, _ := os.Open("examples/IAH-20080430204825-00000-blackbook.warc.gz")
+	defer f.Close()
+	out := &bytes.Buffer{}
+	n, err := Extract(out, f, []string{"dns:www.archive.org"}, []string{"org,archive)/robots"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	recs, _ := readAll(t, out.Bytes())
+	if n != 4 || len(recs) != 5 {
+		t.Fatalf("expecting 4 records plus warcinfo, got %d (%d)", n, len(recs))
+	}
+	if recs[4].Get("WARC-Type") != "metadata" {
+		t.Errorf("expecting metadata record, got %s", recs[4].Get("WARC-Type"))
+	}
+}
+
+func TestSURT(t *testing.T) {
+	for in, out := range map[string]string{
+		"http://www.Example.com:80/A?b=1&a=2#frag": "com,example)/a?a=2&b=1",
+		"https://archive.org:8443/":                "org,archive:8443)/",
+		"dns:www.archive.org":                      "dns:www.archive.org",
+	} {
+		if s := SURT(in); s != out {
+			t.Errorf("%s: expecting %s, got %s", in, out, s)
+		}
+	}
+}
+
+func TestNormalizeURL(t *testing.T) {
+	for _, c := range []struct {
+		in        string
+		sortQuery bool
+		out       string
+	}{
+		{"HTTP://Example.com:80?b=1&a=2#top", true, "http://example.com/?a=2&b=1"},
+		{"HTTP://Example.com:80?b=1&a=2#top", false, "http://example.com/?b=1&a=2"},
+		{"https://Archive.org:8443/Path", false, "https://archive.org:8443/Path"},
+		{"urn:uuid:ABC", false, "urn:uuid:ABC"},
+	} {
+		if s := NormalizeURL(c.in, c.sortQuery); s != c.out {
+			t.Errorf("%s: expecting %s, got %s", c.in, c.out, s)
+		}
+	}
+}
+
+func TestStripSessionIDs(t *testing.T) {
+	c := StripSessionIDs(CanonicalizerFunc(SURT))
+	for in, out := range map[string]string{
+		"http://example.com/cart;jsessionid=0A1B?item=2":       "com,example)/cart?item=2",
+		"http://example.com/?PHPSESSID=abc&b=1&sid=2&a=3#frag": "com,example)/?a=3&b=1",
+		"http://example.com/page?jsessionid=x":                 "com,example)/page",
+		"http://example.com/page?side=1":                       "com,example)/page?side=1",
+	} {
+		if s := c.Canonicalize(in); s != out {
+			t.Errorf("%s: expecting %s, got %s", in, out, s)
+		}
+	}
+}
+
+func TestCanonical(t *testing.T) {
+	checkExamples(t)
+	defer func(c Canonicalizer) { Canonical = c }(Canonical)
+	Canonical = CanonicalizerFunc(func(u string) string { return "custom:" + SURT(u) })
+	f, _ := os.Open("examples/hello-world.warc")
+	defer f.Close()
+	entries, err := Index(f, "hello-world.warc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(entries[0].SURT, "custom:io,github") {
+		t.Fatalf("expecting custom canonical keys, got %s", entries[0].SURT)
+	}
+	if c := NewCDXIndex(entries).Captures(entries[0].URL); len(c) != 1 {
+		t.Errorf("expecting lookups with custom canonical keys, got %v", c)
+	}
+}
+
+func TestSample(t *testing.T) {
+	checkExamples(t)
+	buf, _ := ioutil.ReadFile("examples/hello-world.warc")
+	out := &bytes.Buffer{}
+	n, err := (&Sampler{Every: 2}).Sample(out, bytes.NewReader(buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	recs, _ := readAll(t, out.Bytes())
+	// the metadata record and the two resource records concurrent to it are the second capture
+	if n != 1 || len(recs) != 3 {
+		t.Fatalf("expecting 1 capture in 3 records, got %d in %d", n, len(recs))
+	}
+	if recs[1].Get("WARC-Type") != "request" || recs[2].Get("WARC-Type") != "response" {
+		t.Errorf("bad sample: %v", recs)
+	}
+	f, _ := os.Open("examples/IAH-20080430204825-00000-blackbook.warc.gz")
+	defer f.Close()
+	out.Reset()
+	n, err = (&Sampler{PerHost: 1}).Sample(out, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recs, _ = readAll(t, out.Bytes())
+	hosts := make(map[string]bool)
+	for _, r := range recs {
+		if r.Get("WARC-Type") == "response" {
+			h := hostOf(r.Get("WARC-Target-URI"))
+			if hosts[h] {
+				t.Errorf("more than one capture for %s", h)
+			}
+			hosts[h] = true
+		}
+	}
+	if n != len(hosts) {
+		t.Errorf("expecting %d captures, got %d", len(hosts), n)
+	}
+	var samples [2][]byte
+	for i := range samples {
+		f.Seek(0, 0)
+		out := &bytes.Buffer{}
+		if _, err = (&Sampler{Fraction: 0.2, Seed: 7}).Sample(out, f); err != nil {
+			t.Fatal(err)
+		}
+		samples[i] = out.Bytes()
+	}
+	if !bytes.Equal(samples[0], samples[1]) {
+		t.Error("expecting seeded samples to be reproducible")
+	}
+}
+
+func TestRedact(t *testing.T) {
+	checkExamples(t)
+	buf, _ := ioutil.ReadFile("examples/decode.warc")
+	rd := &Redactor{Patterns: []*regexp.Regexp{regexp.MustCompile(`(?i)archivists`)}}
+	out := &bytes.Buffer{}
+	n, err := rd.Redact(out, bytes.NewReader(buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the request, response, metadata and log resources all mention the host
+	if n != 6 {
+		t.Fatalf("expecting 6 altered records, got %d", n)
+	}
+	recs, blocks := readAll(t, out.Bytes())
+	for i, r := range recs {
+		if r.Get("WARC-Type") != "response" {
+			continue
+		}
+		if r.Get(RedactedField) != "masked" {
+			t.Errorf("expecting record to be annotated as masked, got %v", r)
+		}
+		if bytes.Contains(bytes.ToLower(blocks[i]), []byte("archivists")) || !bytes.Contains(blocks[i], []byte("XXXXXXXXXX")) {
+			t.Errorf("expecting payload to be masked")
+		}
+		hl := httpHeaderLen(blocks[i])
+		if r.Get("WARC-Block-Digest") != sha1Digest(blocks[i]).String() || r.Get("WARC-Payload-Digest") != sha1Digest(blocks[i][hl:]).String() {
+			t.Errorf("expecting digests to be recomputed")
+		}
+		if len(httpEncodings(blocks[i][:hl])) > 0 {
+			t.Errorf("expecting encodings to be removed, got %s", blocks[i][:hl])
+		}
+	}
+	buf, _ = ioutil.ReadFile("examples/hello-world.warc")
+	rd = &Redactor{URLs: []string{"http://iipc.github.io/warc-specifications/primers/web-archive-formats/hello-world.txt"}}
+	out.Reset()
+	if n, err = rd.Redact(out, bytes.NewReader(buf)); err != nil || n != 2 {
+		t.Fatalf("expecting request and response to be altered, got %d (%v)", n, err)
+	}
+	recs, blocks = readAll(t, out.Bytes())
+	if recs[2].Get(RedactedField) != "removed" || len(blocks[2]) != httpHeaderLen(blocks[2]) {
+		t.Errorf("expecting payload to be removed, got %s", blocks[2])
+	}
+}
+
+func TestDelete(t *testing.T) {
+	checkExamples(t)
+	buf, _ := ioutil.ReadFile("examples/hello-world.warc")
+	out := &bytes.Buffer{}
+	n, err := Delete(out, bytes.NewReader(buf), []string{"urn:uuid:3C74F309-6B37-461C-B982-1B5C447C3C0E"}, "takedown request")
+	if err != nil || n != 1 {
+		t.Fatalf("expecting 1 deletion, got %d (%v)", n, err)
+	}
+	recs, blocks := readAll(t, out.Bytes())
+	if len(recs) != 6 {
+		t.Fatalf("expecting 6 records, got %d", len(recs))
+	}
+	if recs[2].Get("WARC-Type") != "metadata" || recs[2].Get("WARC-Refers-To") != "<urn:uuid:3C74F309-6B37-461C-B982-1B5C447C3C0E>" {
+		t.Errorf("bad tombstone: %v", recs[2])
+	}
+	if !bytes.Contains(blocks[2], []byte("reason: takedown request")) {
+		t.Errorf("bad tombstone block: %s", blocks[2])
+	}
+	out.Reset()
+	if _, err = Delete(out, bytes.NewReader(buf), []string{"<urn:uuid:3C74F309-6B37-461C-B982-1B5C447C3C0E>"}, ""); err != nil {
+		t.Fatal(err)
+	}
+	if recs, _ = readAll(t, out.Bytes()); len(recs) != 5 {
+		t.Errorf("expecting 5 records, got %d", len(recs))
+	}
+}
+
+func TestRecompress(t *testing.T) {
+	checkExamples(t)
+	for _, path := range []string{"examples/hello-world.warc", "examples/decode.warc", "examples/IAH-20080430204825-00000-blackbook.warc.gz"} {
+		buf, _ := ioutil.ReadFile(path)
+		gz := &bytes.Buffer{}
+		n, err := Recompress(gz, bytes.NewReader(buf), GzipCompression, gzip.BestCompression)
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		if members, _ := recordMembers(bytes.NewReader(gz.Bytes())); len(members) != n {
+			t.Errorf("%s: expecting %d gzip members, got %d", path, n, len(members))
+		}
+		plain := &bytes.Buffer{}
+		if _, err = Recompress(plain, gz, NoCompression, 0); err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		_, blocks := readAll(t, plain.Bytes())
+		if len(blocks) != n {
+			t.Errorf("%s: expecting %d records, got %d", path, n, len(blocks))
+		}
+	}
+	buf, _ := ioutil.ReadFile("examples/hello-world.warc")
+	stored := &bytes.Buffer{}
+	if _, err := Recompress(stored, bytes.NewReader(buf), GzipCompression, gzip.NoCompression); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(stored.Bytes(), []byte("Hello World")) {
+		t.Error("expecting gzip.NoCompression to store records uncompressed")
+	}
+	buf = bytes.Replace(buf, []byte("Hello World"), []byte("Hello There"), 1)
+	if _, err := Recompress(ioutil.Discard, bytes.NewReader(buf), GzipCompression, 0); !errors.Is(err, ErrDigestMatch) {
+		t.Errorf("expecting digest mismatch, got %v", err)
+	}
+}
+
+func TestDeduplicateCDX(t *testing.T) {
+	checkExamples(t)
+	f, _ := os.Open("examples/hello-world.warc")
+	defer f.Close()
+	cdx := " CDX N b a m s k r M S V g\n" +
+		"io,github,iipc)/hello-world.txt 20150601000000 http://iipc.github.io/hello-world.txt text/plain 200 XMABAYFTCASBJ5QATNBILSXH6PSZEMG4 - - 900 0 earlier.warc.gz\n"
+	out := &bytes.Buffer{}
+	n, err := Deduplicate(out, f, strings.NewReader(cdx))
+	if err != nil || n != 1 {
+		t.Fatalf("expecting 1 revisit, got %d (%v)", n, err)
+	}
+	recs, _ := readAll(t, out.Bytes())
+	rv := recs[2]
+	if rv.Get("WARC-Type") != "revisit" || rv.Get("WARC-Refers-To") != "" ||
+		rv.Get("WARC-Refers-To-Target-URI") != "http://iipc.github.io/hello-world.txt" || rv.Get("WARC-Refers-To-Date") != "2015-06-01T00:00:00Z" {
+		t.Errorf("bad revisit: %v", rv)
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	checkExamples(t)
+	f, _ := os.Open("examples/IAH-20080430204825-00000-blackbook.warc.gz")
+	defer f.Close()
+	out := &bytes.Buffer{}
+	n, err := Truncate(out, f, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n == 0 {
+		t.Fatal("expecting records to be truncated")
+	}
+	recs, blocks := readAll(t, out.Bytes())
+	var truncated int
+	for i, r := range recs {
+		if r.Get("WARC-Truncated") != "length" {
+			continue
+		}
+		truncated++
+		hl := httpHeaderLen(blocks[i])
+		if len(blocks[i])-hl != 1000 {
+			t.Errorf("expecting 1000 byte payload, got %d", len(blocks[i])-hl)
+		}
+		if l, _ := r.GetInt("Content-Length"); l != int64(len(blocks[i])) {
+			t.Errorf("bad Content-Length: %d", l)
+		}
+	}
+	if truncated != n {
+		t.Errorf("expecting %d truncated records, got %d", n, truncated)
+	}
+	// recompressing checks the digests were recomputed
+	if _, err = Recompress(ioutil.Discard, bytes.NewReader(out.Bytes()), NoCompression, 0); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTruncateHTTP(t *testing.T) {
+	in := &bytes.Buffer{}
+	ww := newWARCWriter(in)
+	sha256, _ := DigestWith("sha256", Base16)
+	long := "HTTP/1.1 200 OK\r\nX-Long: " + strings.Repeat("x", maxHTTPHeader) + "\r\n\r\n" + strings.Repeat("y", 20)
+	blocks := []string{
+		"HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhello\r\n6\r\n world\r\n0\r\n\r\n",
+		"HTTP/1.1 200 OK\r\nContent-Length: 11\r\n\r\nhello world",
+		"HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n2\r\nhi\r\n0\r\n\r\n",
+		long,
+	}
+	for _, block := range blocks {
+		hl := httpHeaderLen([]byte(block))
+		if hl > maxHTTPHeader {
+			hl = 0 // headers this long aren't excluded from payload digests
+		}
+		fields := RawFields{
+			{Key: "WARC-Type", Value: "response"},
+			{Key: "WARC-Target-URI", Value: "http://example.com/"},
+			{Key: "WARC-Date", Value: "2020-01-01T00:00:00Z"},
+			{Key: "WARC-Record-ID", Value: newRecordID()},
+			{Key: "Content-Type", Value: "application/http;msgtype=response"},
+			{Key: "WARC-Block-Digest", Value: sha256([]byte(block)).String()},
+			{Key: "WARC-Payload-Digest", Value: sha256([]byte(block[hl:])).String()},
+		}
+		if err := ww.writeRecord("1.0", fields, strings.NewReader(block), int64(len(block))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	out := &bytes.Buffer{}
+	n, err := Truncate(out, bytes.NewReader(in.Bytes()), 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("expecting 2 truncated records, got %d", n)
+	}
+	recs, got := readAll(t, out.Bytes())
+	for i, expect := range []string{
+		"HTTP/1.1 200 OK\r\nContent-Length: 4\r\n\r\nhell",
+		"HTTP/1.1 200 OK\r\nContent-Length: 4\r\n\r\nhell",
+		blocks[2],
+		long,
+	} {
+		if string(got[i]) != expect {
+			t.Errorf("record %d: expecting block %.100q, got %.100q", i, expect, got[i])
+		}
+		if !strings.HasPrefix(recs[i].Get("WARC-Block-Digest"), "sha256:") || !strings.HasPrefix(recs[i].Get("WARC-Payload-Digest"), "sha256:") {
+			t.Errorf("record %d: expecting sha256 digests, got %v", i, recs[i])
+		}
+	}
+	if findings, err := (Validator{Digests: true}).Validate(bytes.NewReader(out.Bytes())); err != nil || len(findings) > 0 {
+		t.Errorf("expecting valid digests, got %v %v", findings, err)
+	}
+}
+
+func TestReserialize(t *testing.T) {
+	checkExamples(t)
+	for _, name := range []string{"examples/hello-world.warc", "examples/IAH-20080430204825-00000-blackbook.warc.gz"} {
+		f, _ := os.Open(name)
+		rdr, err := NewReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf := &bytes.Buffer{}
+		for {
+			rec, err := rdr.Next()
+			if err != nil {
+				if err != io.EOF {
+					t.Fatal(err)
+				}
+				break
+			}
+			if _, err = Reserialize(buf, rec); err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+		}
+		rdr.Close()
+		f.Seek(0, io.SeekStart)
+		var orig []byte
+		if strings.HasSuffix(name, ".gz") {
+			zr, _ := gzip.NewReader(f)
+			orig, _ = ioutil.ReadAll(zr)
+		} else {
+			orig, _ = ioutil.ReadAll(f)
+		}
+		f.Close()
+		if !bytes.Equal(buf.Bytes(), orig) {
+			t.Errorf("%s: expecting an identical copy of %d bytes, got %d bytes", name, len(orig), buf.Len())
+		}
+	}
+	orig, _ := ioutil.ReadFile("examples/hello-world.warc")
+	altered := bytes.Replace(orig, []byte("Hello World"), []byte("Hello_World"), 1)
+	rdr, _ := NewWARCReader(bytes.NewReader(altered))
+	for i := 0; i < 3; i++ {
+		rdr.Next()
+	}
+	if _, err := Reserialize(ioutil.Discard, rdr); !errors.Is(err, ErrDigestMatch) {
+		t.Errorf("expecting a digest mismatch for an altered record, got %v", err)
+	}
+	rdr, _ = NewWARCReader(bytes.NewReader(orig))
+	rec, _ := rdr.NextPayload()
+	if _, err := Reserialize(ioutil.Discard, rec); err != ErrReserialize {
+		t.Errorf("expecting ErrReserialize for a stripped record, got %v", err)
+	}
+}
@@ -0,0 +1,428 @@
+// Copyright 2015 Richard Lehane. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webarchive
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+const (
+	maxPlistDepth   = 64      // limits the nesting of arrays and dictionaries in property lists
+	maxPlistObjects = 1 << 20 // limits the objects decoded from a binary property list, which may share objects
+)
+
+// parsePlist decodes a binary or XML property list into maps, slices, strings, []byte, int64, float64, bool and
+// time.Time values
+func parsePlist(b []byte) (interface{}, error) {
+	if bytes.HasPrefix(b, []byte("bplist00")) {
+		return parseBinaryPlist(b)
+	}
+	return parseXMLPlist(b)
+}
+
+// a binary property list, as described in CFBinaryPList.c
+type bplist struct {
+	buf     []byte
+	offsets []uint64 // offsets of the objects
+	refSize int      // size of object references
+	decoded int      // number of objects decoded
+}
+
+func parseBinaryPlist(b []byte) (interface{}, error) {
+	if len(b) < 40 {
+		return nil, ErrSafari
+	}
+	trailer := b[len(b)-32:]
+	offSize, refSize := int(trailer[6]), int(trailer[7])
+	num, top, table := binary.BigEndian.Uint64(trailer[8:]), binary.BigEndian.Uint64(trailer[16:]), binary.BigEndian.Uint64(trailer[24:])
+	if offSize < 1 || offSize > 8 || refSize < 1 || refSize > 8 || top >= num ||
+		table > uint64(len(b)) || num > (uint64(len(b))-table)/uint64(offSize) {
+		return nil, ErrSafari
+	}
+	p := &bplist{buf: b, offsets: make([]uint64, num), refSize: refSize}
+	for i := range p.offsets {
+		p.offsets[i] = readUint(b[int(table)+i*offSize:], offSize)
+	}
+	return p.object(top, 0)
+}
+
+// read a big-endian unsigned integer of size bytes
+func readUint(b []byte, size int) uint64 {
+	var u uint64
+	for _, c := range b[:size] {
+		u = u<<8 | uint64(c)
+	}
+	return u
+}
+
+// slice returns l bytes at off, or an error if they are out of range
+func (p *bplist) slice(off, l uint64) ([]byte, error) {
+	if off > uint64(len(p.buf)) || l > uint64(len(p.buf))-off {
+		return nil, ErrSafari
+	}
+	return p.buf[off : off+l], nil
+}
+
+// count reads the count in the low nibble of a marker, which is followed by an integer object if it is 0xF.
+// Returns the count and the offset of the content after it.
+func (p *bplist) count(off uint64, marker byte) (uint64, uint64, error) {
+	if marker&0xf != 0xf {
+		return uint64(marker & 0xf), off + 1, nil
+	}
+	m, err := p.slice(off+1, 1)
+	if err != nil || m[0]>>4 != 0x1 || m[0]&0xf > 3 {
+		return 0, 0, ErrSafari
+	}
+	size := uint64(1) << (m[0] & 0xf)
+	b, err := p.slice(off+2, size)
+	if err != nil {
+		return 0, 0, err
+	}
+	return readUint(b, int(size)), off + 2 + size, nil
+}
+
+func (p *bplist) object(ref uint64, depth int) (interface{}, error) {
+	p.decoded++
+	if ref >= uint64(len(p.offsets)) || depth > maxPlistDepth || p.decoded > maxPlistObjects {
+		return nil, ErrSafari
+	}
+	off := p.offsets[ref]
+	m, err := p.slice(off, 1)
+	if err != nil {
+		return nil, err
+	}
+	marker := m[0]
+	switch marker >> 4 {
+	case 0x0:
+		switch marker {
+		case 0x08:
+			return false, nil
+		case 0x09:
+			return true, nil
+		}
+		return nil, nil
+	case 0x1:
+		size := uint64(1) << (marker & 0xf)
+		if size > 8 {
+			return nil, ErrSafari
+		}
+		b, err := p.slice(off+1, size)
+		if err != nil {
+			return nil, err
+		}
+		return int64(readUint(b, int(size))), nil
+	case 0x2, 0x3:
+		size := uint64(1) << (marker & 0xf)
+		b, err := p.slice(off+1, size)
+		if err != nil {
+			return nil, err
+		}
+		var f float64
+		switch size {
+		case 4:
+			f = float64(math.Float32frombits(binary.BigEndian.Uint32(b)))
+		case 8:
+			f = math.Float64frombits(binary.BigEndian.Uint64(b))
+		default:
+			return nil, ErrSafari
+		}
+		if marker>>4 == 0x3 {
+			// seconds since the start of 2001
+			return time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(f * float64(time.Second))), nil
+		}
+		return f, nil
+	case 0x4, 0x5, 0x6:
+		n, start, err := p.count(off, marker)
+		if err != nil {
+			return nil, err
+		}
+		if marker>>4 == 0x6 {
+			if n > uint64(len(p.buf))/2 {
+				return nil, ErrSafari
+			}
+			b, err := p.slice(start, n*2)
+			if err != nil {
+				return nil, err
+			}
+			u := make([]uint16, n)
+			for i := range u {
+				u[i] = binary.BigEndian.Uint16(b[i*2:])
+			}
+			return string(utf16.Decode(u)), nil
+		}
+		b, err := p.slice(start, n)
+		if err != nil {
+			return nil, err
+		}
+		if marker>>4 == 0x5 {
+			return string(b), nil
+		}
+		return b, nil
+	case 0x8:
+		b, err := p.slice(off+1, uint64(marker&0xf)+1)
+		if err != nil {
+			return nil, err
+		}
+		return int64(readUint(b, len(b))), nil
+	case 0xa, 0xc, 0xd:
+		n, start, err := p.count(off, marker)
+		if err != nil {
+			return nil, err
+		}
+		refs := n
+		if marker>>4 == 0xd {
+			refs *= 2
+		}
+		if refs > uint64(len(p.buf)) {
+			return nil, ErrSafari
+		}
+		b, err := p.slice(start, refs*uint64(p.refSize))
+		if err != nil {
+			return nil, err
+		}
+		vals := make([]interface{}, refs)
+		for i := range vals {
+			if vals[i], err = p.object(readUint(b[i*p.refSize:], p.refSize), depth+1); err != nil {
+				return nil, err
+			}
+		}
+		if marker>>4 != 0xd {
+			return vals, nil
+		}
+		d := make(map[string]interface{}, n)
+		for i := uint64(0); i < n; i++ {
+			k, ok := vals[i].(string)
+			if !ok {
+				return nil, ErrSafari
+			}
+			d[k] = vals[n+i]
+		}
+		return d, nil
+	}
+	return nil, ErrSafari
+}
+
+func parseXMLPlist(b []byte) (interface{}, error) {
+	dec := xml.NewDecoder(bytes.NewReader(b))
+	dec.Strict = false
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, ErrSafari
+		}
+		if se, ok := tok.(xml.StartElement); ok {
+			if se.Name.Local == "plist" {
+				continue
+			}
+			return xmlPlistValue(dec, se, 0)
+		}
+	}
+}
+
+// xmlPlistValue decodes the value of the element started by se
+func xmlPlistValue(dec *xml.Decoder, se xml.StartElement, depth int) (interface{}, error) {
+	if depth > maxPlistDepth {
+		return nil, ErrSafari
+	}
+	switch se.Name.Local {
+	case "array", "dict":
+		var vals []interface{}
+		for {
+			tok, err := dec.Token()
+			if err != nil {
+				return nil, ErrSafari
+			}
+			switch t := tok.(type) {
+			case xml.StartElement:
+				v, err := xmlPlistValue(dec, t, depth+1)
+				if err != nil {
+					return nil, err
+				}
+				if t.Name.Local == "key" {
+					v = xmlKey(v.(string))
+				}
+				vals = append(vals, v)
+			case xml.EndElement:
+				if se.Name.Local == "array" {
+					return vals, nil
+				}
+				d := make(map[string]interface{})
+				for i := 0; i+1 < len(vals); i += 2 {
+					k, ok := vals[i].(xmlKey)
+					if !ok {
+						return nil, ErrSafari
+					}
+					d[string(k)] = vals[i+1]
+				}
+				return d, nil
+			}
+		}
+	case "true", "false":
+		if err := dec.Skip(); err != nil {
+			return nil, ErrSafari
+		}
+		return se.Name.Local == "true", nil
+	}
+	var text string
+	if err := dec.DecodeElement(&text, &se); err != nil {
+		return nil, ErrSafari
+	}
+	switch se.Name.Local {
+	case "data":
+		b, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(text), ""))
+		if err != nil {
+			return nil, ErrSafari
+		}
+		return b, nil
+	case "integer":
+		i, err := strconv.ParseInt(strings.TrimSpace(text), 10, 64)
+		if err != nil {
+			return nil, ErrSafari
+		}
+		return i, nil
+	case "real":
+		f, err := strconv.ParseFloat(strings.TrimSpace(text), 64)
+		if err != nil {
+			return nil, ErrSafari
+		}
+		return f, nil
+	case "date":
+		t, err := time.Parse(time.RFC3339, strings.TrimSpace(text))
+		if err != nil {
+			return nil, ErrSafari
+		}
+		return t, nil
+	}
+	return text, nil
+}
+
+// xmlKey distinguishes the keys of dictionaries in XML property lists from string values
+type xmlKey string
+
+// a resource of a Safari webarchive
+type safariResource struct {
+	url, mime, charset string
+	data               []byte
+}
+
+// safariResources lists the main resource and subresources of a webarchive dictionary, followed by those of the
+// archives of its frames
+func safariResources(archive map[string]interface{}, depth int) []safariResource {
+	if depth > maxPlistDepth {
+		return nil
+	}
+	res := func(v interface{}) (safariResource, bool) {
+		d, ok := v.(map[string]interface{})
+		if !ok {
+			return safariResource{}, false
+		}
+		r := safariResource{}
+		r.url, _ = d["WebResourceURL"].(string)
+		r.mime, _ = d["WebResourceMIMEType"].(string)
+		r.charset, _ = d["WebResourceTextEncodingName"].(string)
+		r.data, _ = d["WebResourceData"].([]byte)
+		return r, r.url != ""
+	}
+	var ret []safariResource
+	if r, ok := res(archive["WebMainResource"]); ok {
+		ret = append(ret, r)
+	}
+	subs, _ := archive["WebSubresources"].([]interface{})
+	for _, s := range subs {
+		if r, ok := res(s); ok {
+			ret = append(ret, r)
+		}
+	}
+	frames, _ := archive["WebSubframeArchives"].([]interface{})
+	for _, f := range frames {
+		if d, ok := f.(map[string]interface{}); ok {
+			ret = append(ret, safariResources(d, depth+1)...)
+		}
+	}
+	return ret
+}
+
+// SafariToWARC reads a Safari .webarchive file in r, a binary or XML property list, and writes it to w as a
+// WARC 1.0 file. The main resource, the subresources, and the resources of any frames become resource records with
+// their original URLs and media types (with the charset of text resources). Webarchives don't record when they were
+// saved, so the records are dated with the current time. The records of the other resources refer to that of the
+// main resource with WARC-Concurrent-To.
+//
+// Returns the number of resources converted, or ErrSafari if r isn't a webarchive.
+func SafariToWARC(w io.Writer, r io.Reader) (int, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+	pl, err := parsePlist(b)
+	if err != nil {
+		return 0, err
+	}
+	archive, ok := pl.(map[string]interface{})
+	if !ok || archive["WebMainResource"] == nil {
+		return 0, ErrSafari
+	}
+	ww := newWARCWriter(w)
+	info, err := ww.writeWarcinfo("1.0", "", Warcinfo{
+		Software:    software,
+		Format:      "WARC File Format 1.0",
+		ConformsTo:  conformsTo10,
+		Description: "converted from Safari webarchive",
+	}.Bytes())
+	if err != nil {
+		return 0, err
+	}
+	date := now()
+	var n int
+	var first string
+	for _, res := range safariResources(archive, 0) {
+		id := newRecordID()
+		fields := RawFields{
+			{Key: "WARC-Type", Value: "resource"},
+			{Key: "WARC-Record-ID", Value: id},
+			{Key: "WARC-Date", Value: formatVersionDate("1.0", date)},
+			{Key: "WARC-Target-URI", Value: res.url},
+		}
+		if first != "" {
+			fields.Add("WARC-Concurrent-To", first)
+		} else {
+			first = id
+		}
+		fields.Add("WARC-Warcinfo-ID", info)
+		ct := res.mime
+		if ct == "" {
+			ct = "application/octet-stream"
+		} else if res.charset != "" {
+			ct += "; charset=" + res.charset
+		}
+		fields.Add("Content-Type", ct)
+		fields.Add("WARC-Block-Digest", sha1Digest(res.data).String())
+		if err = ww.writeRecord("1.0", fields, bytes.NewReader(res.data), int64(len(res.data))); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
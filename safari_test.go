@@ -0,0 +1,150 @@
+package webarchive
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sort"
+	"testing"
+)
+
+// encodeBinaryPlist writes a binary property list of maps, slices, strings and []byte, for testing
+func encodeBinaryPlist(v interface{}) []byte {
+	var objs [][]byte
+	marker := func(typ byte, n int) []byte {
+		if n < 15 {
+			return []byte{typ<<4 | byte(n)}
+		}
+		b := []byte{typ<<4 | 0xf, 0x12, 0, 0, 0, 0}
+		binary.BigEndian.PutUint32(b[2:], uint32(n))
+		return b
+	}
+	var add func(v interface{}) int
+	add = func(v interface{}) int {
+		idx := len(objs)
+		objs = append(objs, nil)
+		var b []byte
+		switch t := v.(type) {
+		case string:
+			b = append(marker(0x5, len(t)), t...)
+		case []byte:
+			b = append(marker(0x4, len(t)), t...)
+		case []interface{}:
+			refs := make([]byte, 2*len(t))
+			for i, e := range t {
+				binary.BigEndian.PutUint16(refs[2*i:], uint16(add(e)))
+			}
+			b = append(marker(0xa, len(t)), refs...)
+		case map[string]interface{}:
+			keys := make([]string, 0, len(t))
+			for k := range t {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			refs := make([]byte, 4*len(t))
+			for i, k := range keys {
+				binary.BigEndian.PutUint16(refs[2*i:], uint16(add(k)))
+				binary.BigEndian.PutUint16(refs[2*(len(t)+i):], uint16(add(t[k])))
+			}
+			b = append(marker(0xd, len(t)), refs...)
+		}
+		objs[idx] = b
+		return idx
+	}
+	add(v)
+	buf := bytes.NewBufferString("bplist00")
+	offsets := make([]byte, 4*len(objs))
+	for i, o := range objs {
+		binary.BigEndian.PutUint32(offsets[4*i:], uint32(buf.Len()))
+		buf.Write(o)
+	}
+	table := buf.Len()
+	buf.Write(offsets)
+	trailer := make([]byte, 32)
+	trailer[6], trailer[7] = 4, 2
+	binary.BigEndian.PutUint64(trailer[8:], uint64(len(objs)))
+	binary.BigEndian.PutUint64(trailer[24:], uint64(table))
+	buf.Write(trailer)
+	return buf.Bytes()
+}
+
+const testSafariXML = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>WebMainResource</key>
+	<dict>
+		<key>WebResourceData</key>
+		<data>PGh0bWw+PC9odG1sPg==</data>
+		<key>WebResourceFrameName</key>
+		<string></string>
+		<key>WebResourceMIMEType</key>
+		<string>text/html</string>
+		<key>WebResourceTextEncodingName</key>
+		<string>UTF-8</string>
+		<key>WebResourceURL</key>
+		<string>http://example.com/</string>
+	</dict>
+</dict>
+</plist>`
+
+func TestSafariToWARC(t *testing.T) {
+	page := map[string]interface{}{
+		"WebMainResource": map[string]interface{}{
+			"WebResourceURL":              "http://example.com/",
+			"WebResourceMIMEType":         "text/html",
+			"WebResourceTextEncodingName": "UTF-8",
+			"WebResourceData":             []byte("<html><iframe src=frame.html></html>"),
+		},
+		"WebSubresources": []interface{}{
+			map[string]interface{}{
+				"WebResourceURL":      "http://example.com/img.png",
+				"WebResourceMIMEType": "image/png",
+				"WebResourceData":     bytes.Repeat([]byte{0x89}, 20),
+			},
+		},
+		"WebSubframeArchives": []interface{}{
+			map[string]interface{}{
+				"WebMainResource": map[string]interface{}{
+					"WebResourceURL":      "http://example.com/frame.html",
+					"WebResourceMIMEType": "text/html",
+					"WebResourceData":     []byte("frame"),
+				},
+			},
+		},
+	}
+	buf := &bytes.Buffer{}
+	n, err := SafariToWARC(buf, bytes.NewReader(encodeBinaryPlist(page)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Fatalf("expecting 3 resources, got %d", n)
+	}
+	recs, blocks := readAll(t, buf.Bytes())
+	if len(recs) != 4 || recs[0].Get("WARC-Type") != "warcinfo" {
+		t.Fatalf("bad records: %v", recs)
+	}
+	for i, u := range []string{"http://example.com/", "http://example.com/img.png", "http://example.com/frame.html"} {
+		if recs[i+1].Get("WARC-Type") != "resource" || recs[i+1].Get("WARC-Target-URI") != u {
+			t.Errorf("bad record %d: %v", i, recs[i+1])
+		}
+		if i > 0 && recs[i+1].Get("WARC-Concurrent-To") != recs[1].Get("WARC-Record-ID") {
+			t.Errorf("expecting record %d to be concurrent to the main resource", i)
+		}
+	}
+	if recs[1].Get("Content-Type") != "text/html; charset=UTF-8" || len(blocks[2]) != 20 || string(blocks[3]) != "frame" {
+		t.Errorf("bad resources: %s %q %q", recs[1].Get("Content-Type"), blocks[2], blocks[3])
+	}
+	buf.Reset()
+	if n, err = SafariToWARC(buf, bytes.NewReader([]byte(testSafariXML))); err != nil || n != 1 {
+		t.Fatalf("expecting 1 resource from XML plist, got %d %v", n, err)
+	}
+	if _, blocks = readAll(t, buf.Bytes()); string(blocks[1]) != "<html></html>" {
+		t.Errorf("bad XML plist resource: %q", blocks[1])
+	}
+	for _, bad := range [][]byte{[]byte("bplist00 truncated"), encodeBinaryPlist([]interface{}{"x"}), []byte("<html>")} {
+		if _, err = SafariToWARC(buf, bytes.NewReader(bad)); err != ErrSafari {
+			t.Errorf("expecting ErrSafari for %q, got %v", bad, err)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright 2015 Richard Lehane. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webarchive
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// RecordSeeker is an io.ReadSeeker over the content of a record, returned by NewRecordSeeker.
+type RecordSeeker struct {
+	io.ReadSeeker
+	file *os.File // temporary file holding content larger than the threshold
+}
+
+// NewRecordSeeker returns a RecordSeeker over the content of a record, for handing payloads to libraries that need
+// to seek. If the record's content is already addressable, because the reader's source is a slicer or the record was
+// merged from continuations, it is used in place and is only valid until the reader moves to the next record.
+// Otherwise the content is read from the record: up to threshold bytes are buffered in memory and larger content is
+// spilled to a temporary file, which is removed by Close.
+//
+// The record should not have been read from.
+func NewRecordSeeker(r Record, threshold int64) (*RecordSeeker, error) {
+	switch rec := r.(type) {
+	case *continuation:
+		return &RecordSeeker{ReadSeeker: bytes.NewReader(rec.buf[rec.start:])}, nil
+	case interface{ IsSlicer() bool }:
+		if rec.IsSlicer() {
+			return &RecordSeeker{ReadSeeker: io.NewSectionReader(sliceReaderAt{r}, 0, r.Size())}, nil
+		}
+	}
+	// the size of decoded payloads isn't known, so read one byte beyond the threshold to find if it is exceeded
+	buf, err := ioutil.ReadAll(io.LimitReader(r, threshold+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(buf)) <= threshold {
+		return &RecordSeeker{ReadSeeker: bytes.NewReader(buf)}, nil
+	}
+	f, err := ioutil.TempFile("", "webarchive-record-")
+	if err != nil {
+		return nil, err
+	}
+	rs := &RecordSeeker{ReadSeeker: f, file: f}
+	if _, err = f.Write(buf); err == nil {
+		if _, err = io.Copy(f, r); err == nil {
+			_, err = f.Seek(0, io.SeekStart)
+		}
+	}
+	if err != nil {
+		rs.Close()
+		return nil, err
+	}
+	return rs, nil
+}
+
+// Close removes any temporary file holding the content.
+func (rs *RecordSeeker) Close() error {
+	if rs.file == nil {
+		return nil
+	}
+	err := rs.file.Close()
+	if e := os.Remove(rs.file.Name()); err == nil {
+		err = e
+	}
+	rs.file = nil
+	return err
+}
+
+// sliceReaderAt reads the content of a record from a slicer source
+type sliceReaderAt struct {
+	r Record
+}
+
+func (s sliceReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	b, err := s.r.Slice(off, len(p))
+	n := copy(p, b)
+	if err == nil && n < len(p) {
+		err = io.EOF
+	}
+	return n, err
+}
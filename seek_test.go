@@ -0,0 +1,73 @@
+package webarchive
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+// sliceBuffer is a slicer source, like a siegfried buffer
+type sliceBuffer []byte
+
+func (s sliceBuffer) Read(p []byte) (int, error) { return 0, io.EOF }
+
+func (s sliceBuffer) Slice(off int64, l int) ([]byte, error) {
+	if off >= int64(len(s)) {
+		return nil, io.EOF
+	}
+	if int(off)+l > len(s) {
+		return s[off:], io.EOF
+	}
+	return s[off : int(off)+l], nil
+}
+
+func TestRecordSeeker(t *testing.T) {
+	checkExamples(t)
+	src, _ := ioutil.ReadFile("examples/hello-world.warc")
+	for _, c := range []struct {
+		src       io.Reader
+		threshold int64
+		spilled   bool
+	}{
+		{bytes.NewReader(src), 1024, false},
+		{bytes.NewReader(src), 4, true},
+		{sliceBuffer(src), 4, false},
+	} {
+		rdr, err := NewReader(c.src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rec, err := rdr.NextPayload()
+		if err != nil {
+			t.Fatal(err)
+		}
+		rs, err := NewRecordSeeker(rec, c.threshold)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (rs.file != nil) != c.spilled {
+			t.Errorf("threshold %d: expecting spilled to be %v", c.threshold, c.spilled)
+		}
+		if _, err := rs.Seek(6, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadAll(rs)
+		if err != nil || string(b) != "World\n\n" {
+			t.Errorf("threshold %d: expecting \"World\\n\\n\", got %q %v", c.threshold, b, err)
+		}
+		var name string
+		if rs.file != nil {
+			name = rs.file.Name()
+		}
+		if err := rs.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if name != "" {
+			if _, err := os.Stat(name); !os.IsNotExist(err) {
+				t.Errorf("expecting temporary file to be removed on Close")
+			}
+		}
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright 2015 Richard Lehane. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webarchive
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// signatureField is the extension field that carries a record's signature
+const signatureField = "WARC-Signature"
+
+// signatureHash returns a hash to which a record's block is written to compute the message that is signed: the SHA-512 of
+// the record's version line and fields (without any WARC-Signature) followed by its block.
+func signatureHash(version string, fields RawFields, sz int64) hash.Hash {
+	fields = fields.Clone()
+	fields.Del(signatureField)
+	h := sha512.New()
+	h.Write(recordHeader(version, fields, sz))
+	return h
+}
+
+// Sign reads the WARC file in r and writes a copy to w in which each record is signed with key.
+// The Ed25519 signature, over the record's header and block, is given in a WARC-Signature extension field in the
+// form "ed25519:BASE64". Any existing signatures are replaced. Use a Validator with a SignatureKey to verify them.
+//
+// Returns the number of records signed.
+func Sign(w io.Writer, r io.Reader, key ed25519.PrivateKey) (int, error) {
+	rdr, err := NewWARCReader(r)
+	if err != nil {
+		return 0, err
+	}
+	defer rdr.Close()
+	ww := newWARCWriter(w)
+	var n int
+	for {
+		rec, err := rdr.Next()
+		if err != nil {
+			if err == io.EOF {
+				return n, nil
+			}
+			return n, err
+		}
+		fields := rec.RawFields()
+		block, err := ioutil.ReadAll(rec)
+		if err != nil {
+			return n, err
+		}
+		h := signatureHash(rdr.Version(), fields, int64(len(block)))
+		h.Write(block)
+		fields.Set(signatureField, "ed25519:"+base64.StdEncoding.EncodeToString(ed25519.Sign(key, h.Sum(nil))))
+		if err = ww.writeRecord(rdr.Version(), fields, bytes.NewReader(block), int64(len(block))); err != nil {
+			return n, err
+		}
+		n++
+	}
+}
+
+// verifier checks the signature of a record as its block is written to it
+type verifier struct {
+	hash.Hash
+	sig []byte
+	err error // set if the record has no usable signature
+}
+
+func newVerifier(version string, fields RawFields, sz int64) *verifier {
+	v := &verifier{Hash: signatureHash(version, fields, sz)}
+	s := fields.Get(signatureField)
+	if s == "" {
+		v.err = fmt.Errorf("%w: record isn't signed", ErrSignature)
+		return v
+	}
+	idx := strings.IndexByte(s, ':')
+	if idx < 0 || !strings.EqualFold(s[:idx], "ed25519") {
+		v.err = fmt.Errorf("%w: unsupported signature %q", ErrSignature, s)
+		return v
+	}
+	var err error
+	if v.sig, err = base64.StdEncoding.DecodeString(strings.TrimSpace(s[idx+1:])); err != nil {
+		v.err = fmt.Errorf("%w: bad signature encoding", ErrSignature)
+	}
+	return v
+}
+
+// verify the signature once the whole block has been written
+func (v *verifier) verify(key ed25519.PublicKey) error {
+	if v.err != nil {
+		return v.err
+	}
+	if !ed25519.Verify(key, v.Sum(nil), v.sig) {
+		return fmt.Errorf("%w: signature doesn't verify", ErrSignature)
+	}
+	return nil
+}
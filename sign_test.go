@@ -0,0 +1,44 @@
+package webarchive
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestSign(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	in, err := ioutil.ReadFile("examples/hello-world.warc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := &bytes.Buffer{}
+	n, err := Sign(buf, bytes.NewReader(in), priv)
+	if err != nil || n != 6 {
+		t.Fatalf("expecting 6 records signed, got %d %v", n, err)
+	}
+	v := Validator{SignatureKey: pub}
+	if findings, err := v.Validate(bytes.NewReader(buf.Bytes())); err != nil || len(findings) > 0 {
+		t.Fatalf("expecting signatures to verify, got %v %v", findings, err)
+	}
+	findings, _ := v.Validate(bytes.NewReader(in))
+	if len(findings) != 6 || !errors.Is(findings[0], ErrSignature) {
+		t.Errorf("expecting unsigned records to be reported, got %v", findings)
+	}
+	tampered := strings.Replace(buf.String(), "Hello World", "Hello Wyrld", 1)
+	findings, _ = v.Validate(strings.NewReader(tampered))
+	if len(findings) != 1 || !errors.Is(findings[0], ErrSignature) {
+		t.Errorf("expecting the tampered record to be reported, got %v", findings)
+	}
+	other, _, _ := ed25519.GenerateKey(nil)
+	findings, _ = Validator{SignatureKey: other}.Validate(bytes.NewReader(buf.Bytes()))
+	if len(findings) != 6 {
+		t.Errorf("expecting signatures not to verify with another key, got %v", findings)
+	}
+}
@@ -0,0 +1,182 @@
+// Copyright 2015 Richard Lehane. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webarchive
+
+import (
+	"hash/fnv"
+	"io"
+	"io/ioutil"
+	"math/bits"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Simhash is a 64 bit fingerprint of a text. Unlike a digest, the simhashes of near-identical texts (e.g. captures of
+// a page that differ only in a date or an advertisement) differ in only a few bits.
+type Simhash uint64
+
+// shingleLen is the number of words in each of the overlapping shingles hashed by NewSimhash
+const shingleLen = 3
+
+// NewSimhash computes the simhash of a text from its overlapping shingles of three words. Words are runs of letters
+// and digits, compared case-insensitively, so that differences in punctuation, spacing and case are ignored.
+func NewSimhash(text string) Simhash {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) == 0 {
+		return 0
+	}
+	var weights [64]int
+	h := fnv.New64a()
+	for i := 0; i == 0 || i+shingleLen <= len(words); i++ {
+		end := i + shingleLen
+		if end > len(words) {
+			end = len(words)
+		}
+		h.Reset()
+		io.WriteString(h, strings.Join(words[i:end], " "))
+		sum := h.Sum64()
+		for b := range weights {
+			if sum&(1<<uint(b)) != 0 {
+				weights[b]++
+			} else {
+				weights[b]--
+			}
+		}
+	}
+	var s Simhash
+	for b, w := range weights {
+		if w > 0 {
+			s |= 1 << uint(b)
+		}
+	}
+	return s
+}
+
+// Distance returns the number of bits that differ between two simhashes: 0 for identical texts, and a few bits
+// (say 3 or fewer) for near-duplicates.
+func (s Simhash) Distance(o Simhash) int {
+	return bits.OnesCount64(uint64(s ^ o))
+}
+
+// Fingerprint is the simhash of the text of a capture.
+type Fingerprint struct {
+	URL     string
+	ID      string // WARC-Record-ID of the response or resource record
+	Date    time.Time
+	Simhash Simhash
+}
+
+// Fingerprints reads the WARC file in r and returns the fingerprints of its HTML and plain text responses and
+// resources, computed from the text that WARCToWET extracts.
+func Fingerprints(r io.Reader) ([]Fingerprint, error) {
+	rdr, err := NewWARCReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer rdr.Close()
+	var fps []Fingerprint
+	for {
+		rec, err := rdr.Next()
+		if err != nil {
+			if err == io.EOF {
+				return fps, nil
+			}
+			return fps, err
+		}
+		if typ := rdr.RecordType(); typ != TypeResponse && typ != TypeResource {
+			continue
+		}
+		block, err := ioutil.ReadAll(rec)
+		if err != nil {
+			return fps, err
+		}
+		text, ok := recordText(rec.Fields(), block)
+		if !ok {
+			continue
+		}
+		fps = append(fps, Fingerprint{URL: rec.URL(), ID: rdr.ID(), Date: rec.Date(), Simhash: NewSimhash(text)})
+	}
+}
+
+// simhashBands is the number of 16 bit bands of a simhash by which a FingerprintIndex looks up fingerprints:
+// fingerprints within a distance of 3 must share at least one band
+const simhashBands = 4
+
+// FingerprintIndex finds near-duplicates among fingerprints, for example of captures from several crawls.
+// The zero value is an empty index ready for use.
+type FingerprintIndex struct {
+	fps   []Fingerprint
+	bands [simhashBands]map[uint16][]int // indexes in fps by the value of each band
+}
+
+// Add adds fingerprints to the index.
+func (fi *FingerprintIndex) Add(fps ...Fingerprint) {
+	for _, f := range fps {
+		for b := range fi.bands {
+			if fi.bands[b] == nil {
+				fi.bands[b] = make(map[uint16][]int)
+			}
+			k := uint16(f.Simhash >> uint(16*b))
+			fi.bands[b][k] = append(fi.bands[b][k], len(fi.fps))
+		}
+		fi.fps = append(fi.fps, f)
+	}
+}
+
+// Similar returns the fingerprints in the index whose simhash is within maxDistance of s, nearest first, with those
+// of equal distance in the order they were added. Lookups for distances of 3 or fewer use the index; for greater
+// distances every fingerprint is compared.
+func (fi *FingerprintIndex) Similar(s Simhash, maxDistance int) []Fingerprint {
+	if maxDistance < 0 {
+		return nil
+	}
+	if maxDistance > 64 {
+		maxDistance = 64
+	}
+	var cands []int
+	if maxDistance < simhashBands {
+		seen := make(map[int]bool)
+		for b := range fi.bands {
+			for _, i := range fi.bands[b][uint16(s>>uint(16*b))] {
+				if !seen[i] {
+					seen[i] = true
+					cands = append(cands, i)
+				}
+			}
+		}
+		sort.Ints(cands)
+	} else {
+		cands = make([]int, len(fi.fps))
+		for i := range cands {
+			cands[i] = i
+		}
+	}
+	// bucket the candidates by distance, keeping the order they were added within each distance
+	byDistance := make([][]Fingerprint, maxDistance+1)
+	for _, i := range cands {
+		if d := s.Distance(fi.fps[i].Simhash); d <= maxDistance {
+			byDistance[d] = append(byDistance[d], fi.fps[i])
+		}
+	}
+	var ret []Fingerprint
+	for _, fps := range byDistance {
+		ret = append(ret, fps...)
+	}
+	return ret
+}
@@ -0,0 +1,48 @@
+package webarchive
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestSimhash(t *testing.T) {
+	base := strings.Repeat("The quick brown fox jumps over the lazy dog while the cat watches from the wall. ", 20)
+	a := NewSimhash(base + "Captured on Monday.")
+	b := NewSimhash(strings.ToUpper(base) + "Captured on Tuesday!")
+	c := NewSimhash("An entirely different page about the history of web archiving and the WARC format.")
+	if d := a.Distance(b); d > 3 {
+		t.Errorf("expecting near-duplicates to be within 3 bits, got %d", d)
+	}
+	if d := a.Distance(c); d <= 3 {
+		t.Errorf("expecting different texts to be more than 3 bits apart, got %d", d)
+	}
+	fi := &FingerprintIndex{}
+	fi.Add(Fingerprint{URL: "http://example.com/a", Simhash: a}, Fingerprint{URL: "http://example.com/c", Simhash: c})
+	if sim := fi.Similar(b, 3); len(sim) != 1 || sim[0].URL != "http://example.com/a" {
+		t.Errorf("bad similar fingerprints: %v", sim)
+	}
+	if sim := fi.Similar(a, 64); len(sim) != 2 || sim[0].URL != "http://example.com/a" {
+		t.Errorf("expecting all fingerprints, nearest first: %v", sim)
+	}
+}
+
+func TestFingerprints(t *testing.T) {
+	buf := &bytes.Buffer{}
+	for _, r := range []Resource{
+		{URI: "http://example.com/1", ContentType: "text/plain", Block: []byte("hello world, hello world, hello world")},
+		{URI: "http://example.com/2", ContentType: "text/html", Block: []byte("<p>Hello <b>world</b>, hello world, hello world</p>")},
+		{URI: "http://example.com/3", ContentType: "image/png", Block: []byte("png")},
+	} {
+		if _, err := WriteResource(buf, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fps, err := Fingerprints(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fps) != 2 || fps[0].Simhash != fps[1].Simhash || fps[0].Simhash == 0 {
+		t.Errorf("bad fingerprints: %v", fps)
+	}
+}
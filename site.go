@@ -0,0 +1,189 @@
+// Copyright 2015 Richard Lehane. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webarchive
+
+import (
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// maxSegmentLen is the longest file or directory name written by ExtractSite, in bytes
+const maxSegmentLen = 200
+
+// indexFile is the name given to the payloads of URLs that end in a slash, and to files that share their name with a
+// directory
+const indexFile = "index.html"
+
+// sitePath maps a URL to a relative path of a host directory and the segments of the URL's path e.g.
+// "http://example.com:8080/a/b.html?q=1" to "example.com_8080/a/b.html@q=1". Returns nil for URLs without a host.
+func sitePath(s string) []string {
+	u, err := url.Parse(s)
+	if err != nil || u.Host == "" {
+		return nil
+	}
+	segs := []string{safeSegment(strings.Replace(strings.ToLower(u.Host), ":", "_", -1))}
+	parts := strings.Split(u.EscapedPath(), "/")[1:]
+	if len(parts) == 0 || parts[len(parts)-1] == "" {
+		if len(parts) > 0 {
+			parts = parts[:len(parts)-1]
+		}
+		parts = append(parts, indexFile)
+	}
+	for _, p := range parts {
+		if p == "" {
+			continue
+		}
+		if dec, err := url.PathUnescape(p); err == nil {
+			p = dec
+		}
+		segs = append(segs, safeSegment(p))
+	}
+	if u.RawQuery != "" {
+		segs[len(segs)-1] = safeSegment(segs[len(segs)-1] + "@" + u.RawQuery)
+	}
+	return segs
+}
+
+// safeSegment replaces characters that aren't allowed in file names on common file systems, and the names "." and
+// "..", and truncates long names
+func safeSegment(s string) string {
+	s = strings.Map(func(r rune) rune {
+		switch {
+		case r < 0x20, r == 0x7f:
+			return '_'
+		}
+		if strings.ContainsRune(`<>:"/\|?*`, r) {
+			return '_'
+		}
+		return r
+	}, s)
+	if s == "." || s == ".." || s == "" {
+		s = "_" + s
+	}
+	if len(s) > maxSegmentLen {
+		s = s[:maxSegmentLen]
+	}
+	return s
+}
+
+// ExtractSite reads the ARC or WARC file in r and writes the payloads of its successful (2xx) responses and its
+// resources into dir, reconstructing the crawled sites: each payload is written to a file named for its URL's host
+// and path, e.g. "http://example.com/a/b.html" to "example.com/a/b.html". Payloads are decoded of any transfer and
+// content encodings.
+//
+// URLs are mapped to file names as follows:
+//   - URLs ending in a slash are written to "index.html" in the directory for their path;
+//   - query strings are appended to the file name after an "@" e.g. "search@q=1";
+//   - characters not allowed in file names (such as ":" and "?") are replaced with an underscore, and long names are
+//     truncated;
+//   - a URL whose path is also the directory of other URLs, such as "/a" and "/a/b", is written to "a/index.html";
+//   - a URL that maps to the same file as a different URL is written with a "~N" suffix e.g. "a~1.html".
+//
+// Later captures of a URL replace earlier ones. Returns the number of files written.
+func ExtractSite(r io.Reader, dir string) (int, error) {
+	rdr, err := NewReader(r)
+	if err != nil {
+		return 0, err
+	}
+	defer rdr.Close()
+	owners := make(map[string]string) // normalised URLs by the file they were written to
+	var n int
+	for {
+		rec, err := rdr.Next()
+		if err != nil {
+			if err == io.EOF {
+				return n, nil
+			}
+			return n, err
+		}
+		if wr, ok := rec.(WARCRecord); ok {
+			if typ := wr.RecordType(); typ != TypeResponse && typ != TypeResource {
+				continue
+			}
+		}
+		segs := sitePath(rec.URL())
+		if segs == nil {
+			continue
+		}
+		block, err := ioutil.ReadAll(rec)
+		if err != nil {
+			return n, err
+		}
+		hdr, body := payloadOf(block)
+		if hdr != nil && isHTTPResponse(hdr) {
+			line, _ := readline(hdr)
+			if status := strings.Fields(string(line)); len(status) < 2 || !strings.HasPrefix(status[1], "2") {
+				continue
+			}
+		}
+		name, err := sitePlace(dir, segs, NormalizeURL(rec.URL(), false), owners)
+		if err != nil {
+			return n, err
+		}
+		if err = ioutil.WriteFile(name, body, 0644); err != nil {
+			return n, err
+		}
+		n++
+	}
+}
+
+// sitePlace returns the name of the file in dir to write the payload of a URL to, creating its directories.
+// Files that are in the way of a directory are moved to the index file of the directory.
+func sitePlace(dir string, segs []string, norm string, owners map[string]string) (string, error) {
+	path := dir
+	for _, seg := range segs[:len(segs)-1] {
+		path = filepath.Join(path, seg)
+		fi, err := os.Stat(path)
+		if err == nil && !fi.IsDir() {
+			// a file is in the way: move it to the index file of the new directory
+			tmp := path + ".tmp"
+			if err = os.Rename(path, tmp); err == nil {
+				if err = os.Mkdir(path, 0755); err == nil {
+					err = os.Rename(tmp, filepath.Join(path, indexFile))
+				}
+			}
+			if err != nil {
+				return "", err
+			}
+			if u, ok := owners[path]; ok {
+				delete(owners, path)
+				owners[filepath.Join(path, indexFile)] = u
+			}
+			continue
+		}
+		if err = os.MkdirAll(path, 0755); err != nil {
+			return "", err
+		}
+	}
+	name := filepath.Join(path, segs[len(segs)-1])
+	if fi, err := os.Stat(name); err == nil && fi.IsDir() {
+		name = filepath.Join(name, indexFile)
+	}
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for i := 1; ; i++ {
+		if u, ok := owners[name]; !ok || u == norm {
+			break
+		}
+		name = base + "~" + strconv.Itoa(i) + ext
+	}
+	owners[name] = norm
+	return name, nil
+}
@@ -0,0 +1,64 @@
+package webarchive
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestExtractSite(t *testing.T) {
+	buf := &bytes.Buffer{}
+	ww := newWARCWriter(buf)
+	for _, c := range []struct{ url, status, body string }{
+		{"http://example.com/", "200 OK", "home"},
+		{"http://example.com/a", "200 OK", "a"},
+		{"http://example.com/a/b?q=1", "200 OK", "b"},
+		{"http://example.com/missing", "404 Not Found", "missing"},
+		{"http://example.com/e%3Ff", "200 OK", "e1"},
+		{"http://example.com/e_f", "200 OK", "e2"},
+		{"http://example.com:8080/../x", "200 OK", "x"},
+		{"http://example.com/", "200 OK", "home again"},
+	} {
+		resp := []byte("HTTP/1.1 " + c.status + "\r\nContent-Type: text/plain\r\n\r\n" + c.body)
+		if err := ww.writeExchange("1.0", exchange{
+			uri:     c.url,
+			date:    time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+			req:     []byte("GET / HTTP/1.1\r\n\r\n"),
+			resp:    resp,
+			payload: []byte(c.body),
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dir, err := ioutil.TempDir("", "webarchive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	n, err := ExtractSite(bytes.NewReader(buf.Bytes()), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 7 {
+		t.Errorf("expecting 7 files written, got %d", n)
+	}
+	for name, expect := range map[string]string{
+		"example.com/index.html":   "home again",
+		"example.com/a/index.html": "a",
+		"example.com/a/b@q=1":      "b",
+		"example.com/e_f":          "e1",
+		"example.com/e_f~1":        "e2",
+		"example.com_8080/_../x":   "x",
+	} {
+		b, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil || string(b) != expect {
+			t.Errorf("%s: expecting %q, got %q %v", name, expect, b, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "example.com", "missing")); err == nil {
+		t.Error("expecting unsuccessful responses not to be extracted")
+	}
+}
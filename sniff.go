@@ -0,0 +1,50 @@
+// Copyright 2015 Richard Lehane. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webarchive
+
+import (
+	"net/http"
+	"strings"
+)
+
+// sniffLen is the number of payload bytes examined when sniffing
+const sniffLen = 512
+
+// WithSniffing makes a WARC reader identify the type of each payload record returned by NextPayload by sniffing its
+// first bytes for magic numbers, falling back to the declared Content-Type. The type is available from the record's
+// IdentifiedPayloadType method. Records with a WARC-Identified-Payload-Type field are not sniffed.
+func WithSniffing() Option {
+	return func(r *reader) {
+		r.sniff = true
+	}
+}
+
+// sniffType identifies the media type of a payload from its first bytes, using the algorithm of the WHATWG MIME
+// Sniffing standard (as implemented by http.DetectContentType). Where sniffing only gives a generic type
+// (application/octet-stream or text/plain), the declared type is preferred. Parameters are dropped.
+func sniffType(payload []byte, declared string) string {
+	if len(payload) == 0 {
+		return mediaType(declared)
+	}
+	if len(payload) > sniffLen {
+		payload = payload[:sniffLen]
+	}
+	sniffed := mediaType(http.DetectContentType(payload))
+	if declared = mediaType(declared); declared != "" && !strings.HasPrefix(declared, "application/http") &&
+		(sniffed == "application/octet-stream" || sniffed == "text/plain") {
+		return declared
+	}
+	return sniffed
+}
@@ -0,0 +1,50 @@
+package webarchive
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestSniffing(t *testing.T) {
+	buf := &bytes.Buffer{}
+	for _, r := range []Resource{
+		{URI: "http://example.com/logo", Block: []byte("\x89PNG\x0D\x0A\x1A\x0A\x00\x00\x00\x0DIHDR")},
+		{URI: "http://example.com/data.csv", ContentType: "text/csv", Block: []byte("a,b\n1,2\n")},
+		{URI: "http://example.com/empty", ContentType: "text/css"},
+	} {
+		if _, err := WriteResource(buf, r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expect := []string{"image/png", "text/csv", "text/css"}
+	rdr, err := NewWARCReader(bytes.NewReader(buf.Bytes()), WithSniffing())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, e := range expect {
+		rec, err := rdr.NextPayload()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if typ := rec.(WARCRecord).IdentifiedPayloadType(); typ != e {
+			t.Errorf("record %d: expecting %s, got %s", i, e, typ)
+		}
+	}
+	out := &bytes.Buffer{}
+	n, err := Identify(out, bytes.NewReader(buf.Bytes()))
+	if err != nil || n != 2 {
+		t.Fatalf("expecting 2 records identified, got %d %v", n, err)
+	}
+	recs, _ := readAll(t, out.Bytes())
+	if recs[0].Get("WARC-Identified-Payload-Type") != "image/png" || recs[2].Get("WARC-Identified-Payload-Type") != "" {
+		t.Errorf("bad identified types: %v", recs)
+	}
+	in, err := ioutil.ReadFile("examples/hello-world.warc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err = Identify(ioutil.Discard, bytes.NewReader(in)); err != nil || n != 3 {
+		t.Errorf("expecting 2 responses and a resource identified, got %d %v", n, err)
+	}
+}
@@ -0,0 +1,206 @@
+// Copyright 2015 Richard Lehane. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webarchive
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"time"
+)
+
+// SortOrder specifies how Sort orders the records of a WARC file.
+type SortOrder int
+
+const (
+	BySURT    SortOrder = iota // by target URI in SURT form, then by date
+	ByDate                     // by date
+	ByCapture                  // by capture: see Sort
+)
+
+// Sort reads the WARC file in r and writes its records to w in the given order.
+// Warcinfo records are written first, in their original order. Records that compare
+// equal retain their original order.
+//
+// ByCapture gives the layout that replay tools expect. Records linked by WARC-Concurrent-To
+// (e.g. a request, its response and metadata about the capture) are grouped together, with the
+// request first, then the response (or resource, revisit or conversion) and then metadata.
+// Captures are ordered chronologically by their earliest record.
+//
+// Records are spooled to a temporary file while the input is read, so Sort can be used
+// with compressed input and inputs too large to hold in memory.
+func Sort(w io.Writer, r io.Reader, order SortOrder) error {
+	sp, err := spool(r)
+	if err != nil {
+		return err
+	}
+	defer sp.close()
+	if order == ByCapture {
+		sp.groupCaptures()
+		return sp.writeTo(w)
+	}
+	sort.SliceStable(sp.entries, func(i, j int) bool {
+		a, b := sp.entries[i], sp.entries[j]
+		if (a.typ == "warcinfo") != (b.typ == "warcinfo") {
+			return a.typ == "warcinfo"
+		}
+		if order == BySURT && a.surt != b.surt {
+			return a.surt < b.surt
+		}
+		return a.date.Before(b.date)
+	})
+	return sp.writeTo(w)
+}
+
+// spooled records are stored in a temporary file, with an index of their positions
+type spooled struct {
+	f       *os.File
+	entries []spoolEntry
+}
+
+type spoolEntry struct {
+	id         string
+	typ        string
+	url        string
+	surt       string
+	date       time.Time
+	concurrent []string // WARC-Concurrent-To values
+	offset     int64    // position of the record in the spool file
+	length     int64
+}
+
+// spool copies the records of the WARC file in r to a temporary file
+func spool(r io.Reader) (*spooled, error) {
+	rdr, err := NewWARCReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer rdr.Close()
+	f, err := ioutil.TempFile("", "webarchive")
+	if err != nil {
+		return nil, err
+	}
+	sp := &spooled{f: f}
+	ww := newWARCWriter(f)
+	for {
+		rec, err := rdr.Next()
+		if err != nil {
+			if err == io.EOF {
+				return sp, nil
+			}
+			sp.close()
+			return nil, err
+		}
+		fields := rec.RawFields()
+		e := spoolEntry{
+			id:         rdr.ID(),
+			typ:        rdr.Type(),
+			url:        rec.URL(),
+			surt:       canonical(rec.URL()),
+			date:       rec.Date(),
+			concurrent: fields.Values("WARC-Concurrent-To"),
+			offset:     ww.n,
+		}
+		if err = ww.writeRecord(rdr.Version(), fields, rec, rec.Size()); err != nil {
+			sp.close()
+			return nil, err
+		}
+		e.length = ww.n - e.offset
+		sp.entries = append(sp.entries, e)
+	}
+}
+
+// order the entries by capture, with warcinfo records first
+func (sp *spooled) groupCaptures() {
+	// union-find over the WARC-Concurrent-To links between records
+	parent := make(map[string]string)
+	var find func(string) string
+	find = func(id string) string {
+		p, ok := parent[id]
+		if !ok || p == id {
+			return id
+		}
+		root := find(p)
+		parent[id] = root
+		return root
+	}
+	for _, e := range sp.entries {
+		if _, ok := parent[e.id]; !ok {
+			parent[e.id] = e.id
+		}
+		for _, c := range e.concurrent {
+			if _, ok := parent[c]; !ok {
+				parent[c] = c
+			}
+			if a, b := find(e.id), find(c); a != b {
+				parent[a] = b
+			}
+		}
+	}
+	groupDate := make(map[string]time.Time)
+	groupFirst := make(map[string]int) // position of a group's first record, to order captures with the same date
+	for i, e := range sp.entries {
+		g := find(e.id)
+		if d, ok := groupDate[g]; !ok || e.date.Before(d) {
+			groupDate[g] = e.date
+		}
+		if _, ok := groupFirst[g]; !ok {
+			groupFirst[g] = i
+		}
+	}
+	rank := func(typ string) int {
+		switch typ {
+		case "warcinfo":
+			return 0
+		case "request":
+			return 1
+		case "response", "resource", "revisit", "conversion":
+			return 2
+		case "metadata":
+			return 3
+		}
+		return 4
+	}
+	sort.SliceStable(sp.entries, func(i, j int) bool {
+		a, b := sp.entries[i], sp.entries[j]
+		if (a.typ == "warcinfo") != (b.typ == "warcinfo") {
+			return a.typ == "warcinfo"
+		}
+		ga, gb := find(a.id), find(b.id)
+		if ga != gb {
+			if da, db := groupDate[ga], groupDate[gb]; !da.Equal(db) {
+				return da.Before(db)
+			}
+			return groupFirst[ga] < groupFirst[gb]
+		}
+		return rank(a.typ) < rank(b.typ)
+	})
+}
+
+// write the spooled records to w in the order of the entries
+func (sp *spooled) writeTo(w io.Writer) error {
+	for _, e := range sp.entries {
+		if _, err := io.Copy(w, io.NewSectionReader(sp.f, e.offset, e.length)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (sp *spooled) close() error {
+	sp.f.Close()
+	return os.Remove(sp.f.Name())
+}
@@ -0,0 +1,55 @@
+package webarchive
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestSort(t *testing.T) {
+	checkExamples(t)
+	f, _ := os.Open("examples/IAH-20080430204825-00000-blackbook.warc.gz")
+	defer f.Close()
+	out := &bytes.Buffer{}
+	if err := Sort(out, f, BySURT); err != nil {
+		t.Fatal(err)
+	}
+	recs, _ := readAll(t, out.Bytes())
+	if len(recs) != 822 {
+		t.Fatalf("expecting 822 records, got %d", len(recs))
+	}
+	if recs[0].Get("WARC-Type") != "warcinfo" {
+		t.Errorf("expecting warcinfo first, got %s", recs[0].Get("WARC-Type"))
+	}
+	for i := 2; i < len(recs); i++ {
+		if a, b := SURT(recs[i-1].Get("WARC-Target-URI")), SURT(recs[i].Get("WARC-Target-URI")); a > b {
+			t.Fatalf("records out of order at %d: %s, %s", i, a, b)
+		}
+	}
+}
+
+func TestSortByCapture(t *testing.T) {
+	checkExamples(t)
+	f, _ := os.Open("examples/IAH-20080430204825-00000-blackbook.warc.gz")
+	defer f.Close()
+	out := &bytes.Buffer{}
+	if err := Sort(out, f, ByCapture); err != nil {
+		t.Fatal(err)
+	}
+	recs, _ := readAll(t, out.Bytes())
+	if len(recs) != 822 {
+		t.Fatalf("expecting 822 records, got %d", len(recs))
+	}
+	for i := 1; i < len(recs); i++ {
+		r := recs[i]
+		if r.Get("WARC-Type") == "request" {
+			next := recs[i+1]
+			if next.Get("WARC-Type") != "response" || next.Get("WARC-Record-ID") != r.Get("WARC-Concurrent-To") {
+				t.Fatalf("expecting request to be followed by its response at %d", i)
+			}
+		}
+		if r.Get("WARC-Type") == "metadata" && recs[i-1].Get("WARC-Type") != "request" && recs[i-1].Get("WARC-Type") != "response" {
+			t.Fatalf("expecting metadata to follow its capture at %d", i)
+		}
+	}
+}
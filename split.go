@@ -0,0 +1,184 @@
+// Copyright 2015 Richard Lehane. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webarchive
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// Splitter partitions a WARC file into output files that are capped by size, record count, or both.
+// Files are only split at record boundaries, so an output may exceed MaxSize if it holds a single large record.
+//
+// If the input is a .warc.gz file with one record per gzip member, the members are copied to the outputs
+// intact, without being decompressed. If the input is gzipped as a single stream, each record is
+// recompressed as its own gzip member. Uncompressed input produces uncompressed outputs.
+type Splitter struct {
+	Outputs    Outputs   // opens each output file
+	MaxSize    int64     // maximum size in bytes of each output; 0 for no limit
+	MaxRecords int       // maximum number of records in each output; 0 for no limit
+	Manifest   io.Writer // if not nil, a tab-separated line (record ID, output, offset, length) is written here for each record
+}
+
+// SplitEntry records where a Splitter wrote a record.
+type SplitEntry struct {
+	ID     string // WARC-Record-ID
+	Output string // name of the output file
+	Offset int64  // offset of the record (or its gzip member) within the output
+	Length int64  // length of the record (or its gzip member) within the output
+}
+
+// Split splits the WARC file at path, returning a manifest of where each record was written.
+func (s *Splitter) Split(path string) ([]SplitEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	members, err := recordMembers(f)
+	if err != nil {
+		return nil, err
+	}
+	out := &rotator{outputs: s.Outputs}
+	defer out.abort()
+	var entries []SplitEntry
+	emit := func(id string, sz int64, write func() error) error {
+		if out.warcWriter == nil || s.full(out.warcWriter, sz) {
+			if err := out.rotate(); err != nil {
+				return err
+			}
+		}
+		off := out.n
+		if err := write(); err != nil {
+			return err
+		}
+		e := SplitEntry{ID: id, Output: out.name, Offset: off, Length: out.n - off}
+		entries = append(entries, e)
+		if s.Manifest != nil {
+			_, err := fmt.Fprintf(s.Manifest, "%s\t%s\t%d\t%d\n", e.ID, e.Output, e.Offset, e.Length)
+			return err
+		}
+		return nil
+	}
+	if members != nil {
+		for _, m := range members {
+			err = emit(m.id, m.length, func() error {
+				_, err := io.Copy(out.warcWriter, io.NewSectionReader(f, m.offset, m.length))
+				out.count++
+				return err
+			})
+			if err != nil {
+				return entries, err
+			}
+		}
+		return entries, out.close()
+	}
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	rdr, err := NewWARCReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer rdr.Close()
+	recompress := rdr.gzipped
+	buf := &bytes.Buffer{}
+	for {
+		rec, err := rdr.Next()
+		if err != nil {
+			if err == io.EOF {
+				return entries, out.close()
+			}
+			return entries, err
+		}
+		fields := rec.RawFields()
+		if recompress {
+			buf.Reset()
+			mw := newWARCWriter(buf)
+			mw.gzip = true
+			if err = mw.writeRecord(rdr.Version(), fields, rec, rec.Size()); err != nil {
+				return entries, err
+			}
+			err = emit(rdr.ID(), int64(buf.Len()), func() error {
+				_, err := out.Write(buf.Bytes())
+				out.count++
+				return err
+			})
+		} else {
+			err = emit(rdr.ID(), recordSize(rdr.Version(), fields, rec.Size()), func() error {
+				return out.writeRecord(rdr.Version(), fields, rec, rec.Size())
+			})
+		}
+		if err != nil {
+			return entries, err
+		}
+	}
+}
+
+// would writing a record of size sz take the output past its caps?
+func (s *Splitter) full(w *warcWriter, sz int64) bool {
+	if w.count == 0 {
+		return false
+	}
+	return (s.MaxRecords > 0 && w.count >= s.MaxRecords) || (s.MaxSize > 0 && w.n+sz > s.MaxSize)
+}
+
+type member struct {
+	id     string // WARC-Record-ID of the record in the member
+	offset int64
+	length int64
+}
+
+// recordMembers scans the gzip members of a file. If each member holds exactly
+// one WARC record, it returns the record ID and extent of each member. Otherwise,
+// including when the file isn't gzipped, it returns nil.
+func recordMembers(r io.Reader) ([]member, error) {
+	cr := &counter{r: r}
+	br := bufio.NewReader(cr)
+	if buf, err := br.Peek(4); err != nil || !isgzip(buf) {
+		return nil, nil
+	}
+	var members []member
+	var g gzipOpener
+	for {
+		offset := cr.n - int64(br.Buffered())
+		if _, err := br.Peek(1); err == io.EOF {
+			return members, nil
+		}
+		zr, err := g.open(br)
+		if err != nil {
+			return nil, err
+		}
+		rdr, err := NewWARCReader(zr)
+		if err != nil {
+			return nil, nil
+		}
+		if _, err = rdr.Next(); err != nil {
+			return nil, nil
+		}
+		id := rdr.ID()
+		if _, err = rdr.Next(); err != io.EOF {
+			return nil, nil
+		}
+		if _, err = io.Copy(ioutil.Discard, zr); err != nil {
+			return nil, err
+		}
+		members = append(members, member{id: id, offset: offset, length: cr.n - int64(br.Buffered()) - offset})
+	}
+}
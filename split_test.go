@@ -0,0 +1,92 @@
+package webarchive
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSplit(t *testing.T) {
+	checkExamples(t)
+	dir, err := ioutil.TempDir("", "webarchive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	manifest := &bytes.Buffer{}
+	s := &Splitter{Outputs: FileOutputs(dir, "split", NoCompression), MaxRecords: 2, Manifest: manifest}
+	entries, err := s.Split("examples/hello-world.warc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 6 || entries[5].Output != "split-00002.warc" {
+		t.Fatalf("bad manifest: %v", entries)
+	}
+	if bytes.Count(manifest.Bytes(), []byte("\n")) != 6 {
+		t.Errorf("bad manifest output: %s", manifest.Bytes())
+	}
+	buf, _ := ioutil.ReadFile(filepath.Join(dir, "split-00001.warc"))
+	recs, _ := readAll(t, buf)
+	if len(recs) != 2 || recs[0].Get("WARC-Record-ID") != entries[2].ID {
+		t.Errorf("bad split output: %v", recs)
+	}
+}
+
+func TestSplitMembers(t *testing.T) {
+	checkExamples(t)
+	dir, err := ioutil.TempDir("", "webarchive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s := &Splitter{Outputs: FileOutputs(dir, "split", GzipCompression), MaxSize: 1 << 20}
+	entries, err := s.Split("examples/IAH-20080430204825-00000-blackbook.warc.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var outputs []string
+	byOutput := make(map[string][]SplitEntry)
+	for _, e := range entries {
+		if byOutput[e.Output] == nil {
+			outputs = append(outputs, e.Output)
+		}
+		byOutput[e.Output] = append(byOutput[e.Output], e)
+	}
+	var count int
+	for _, o := range outputs {
+		if filepath.Ext(o) != ".gz" {
+			t.Errorf("expecting a .warc.gz output, got %s", o)
+		}
+		f, _ := os.Open(filepath.Join(dir, o))
+		info, _ := f.Stat()
+		if info.Size() > 1<<20 {
+			t.Errorf("%s exceeds cap: %d", o, info.Size())
+		}
+		// each record is copied as the gzip member at the offset and length given by its entry
+		members, err := recordMembers(f)
+		if err != nil || len(members) != len(byOutput[o]) {
+			t.Fatalf("%s: expecting %d gzip members, got %d (%v)", o, len(byOutput[o]), len(members), err)
+		}
+		for i, m := range members {
+			if e := byOutput[o][i]; m.id != e.ID || m.offset != e.Offset || m.length != e.Length {
+				t.Errorf("%s: expecting member %d at %d (%d bytes) for %s, got %d (%d bytes) for %s", o, i, e.Offset, e.Length, e.ID, m.offset, m.length, m.id)
+			}
+		}
+		f.Seek(0, io.SeekStart)
+		rdr, err := NewWARCReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, err = rdr.Next(); err == nil; _, err = rdr.Next() {
+			count++
+		}
+		rdr.Close()
+		f.Close()
+	}
+	if count != len(entries) || len(outputs) < 2 {
+		t.Errorf("expecting %d records across several outputs, got %d in %d", len(entries), count, len(outputs))
+	}
+}
@@ -0,0 +1,189 @@
+// Copyright 2015 Richard Lehane. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webarchive
+
+import (
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Canonicalizer maps URLs to the canonical keys by which captures are indexed and looked up: in CDX entries, and
+// when filtering, classifying, partitioning and replaying captures. Keys should be in SURT form, so that SURT prefixes
+// match them.
+type Canonicalizer interface {
+	Canonicalize(url string) string
+}
+
+// CanonicalizerFunc adapts a function to a Canonicalizer.
+type CanonicalizerFunc func(url string) string
+
+// Canonicalize calls f(url).
+func (f CanonicalizerFunc) Canonicalize(url string) string { return f(url) }
+
+// Canonical is the Canonicalizer used throughout the package, SURT by default. Institution-specific rules can be
+// swapped in, e.g.
+//
+//	webarchive.Canonical = webarchive.StripSessionIDs(webarchive.CanonicalizerFunc(webarchive.SURT))
+//
+// Set it before indexing or reading captures, and use the same rules as were used for any CDX indexes that are read.
+// It must not be changed while other goroutines are using the package.
+var Canonical Canonicalizer = CanonicalizerFunc(SURT)
+
+// canonical returns the canonical key of a URL, with the package's Canonicalizer
+func canonical(s string) string { return Canonical.Canonicalize(s) }
+
+// sessionParams are the names (lower-cased) of query parameters removed by StripSessionIDs
+var sessionParams = map[string]bool{
+	"jsessionid":   true,
+	"phpsessid":    true,
+	"aspsessionid": true,
+	"sessionid":    true,
+	"sid":          true,
+	"cfid":         true,
+	"cftoken":      true,
+}
+
+// jsessionid path parameters, such as "/cart;jsessionid=0123?a=1"
+var sessionPath = regexp.MustCompile(`(?i);jsessionid=[^?#/]*`)
+
+// StripSessionIDs returns a Canonicalizer that removes common session IDs from URLs before canonicalizing them with c:
+// ";jsessionid=" path parameters and the query parameters jsessionid, phpsessid, aspsessionid, sessionid, sid, cfid
+// and cftoken (compared case-insensitively). Captures of a page made in different sessions then share a key.
+func StripSessionIDs(c Canonicalizer) Canonicalizer {
+	return CanonicalizerFunc(func(s string) string {
+		s = sessionPath.ReplaceAllString(s, "")
+		if i := strings.IndexByte(s, '?'); i > -1 {
+			q, frag := s[i+1:], ""
+			if j := strings.IndexByte(q, '#'); j > -1 {
+				q, frag = q[:j], q[j:]
+			}
+			var keep []string
+			for _, p := range strings.Split(q, "&") {
+				name := p
+				if k := strings.IndexByte(p, '='); k > -1 {
+					name = p[:k]
+				}
+				if !sessionParams[strings.ToLower(name)] {
+					keep = append(keep, p)
+				}
+			}
+			s = s[:i]
+			if len(keep) > 0 {
+				s += "?" + strings.Join(keep, "&")
+			}
+			s += frag
+		}
+		return c.Canonicalize(s)
+	})
+}
+
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+	"ftp":   "21",
+}
+
+// SURT returns the Sort-friendly URI Reordering Transform of a URL, as used for CDX files
+// e.g. "http://www.Example.com:80/a?b=1&a=2" becomes "com,example)/a?a=2&b=1".
+// The scheme, a leading "www." in the host, default ports and fragments are dropped, the
+// host and path are lower-cased and query parameters are sorted.
+// URIs with other schemes (e.g. "dns:archive.org" or "metadata://gnu.org/software/wget/warc/wget.log")
+// are returned lower-cased, so that they don't collide with web captures.
+func SURT(s string) string {
+	u, err := url.Parse(strings.TrimSpace(s))
+	if err != nil || u.Host == "" {
+		return strings.ToLower(s)
+	}
+	if _, ok := defaultPorts[strings.ToLower(u.Scheme)]; !ok {
+		return strings.ToLower(s)
+	}
+	host := strings.ToLower(u.Hostname())
+	host = strings.TrimPrefix(host, "www.")
+	parts := strings.Split(host, ".")
+	for i, j := 0, len(parts)-1; i < j; i, j = i+1, j-1 {
+		parts[i], parts[j] = parts[j], parts[i]
+	}
+	ret := strings.Join(parts, ",")
+	if port := u.Port(); port != "" && port != defaultPorts[strings.ToLower(u.Scheme)] {
+		ret += ":" + port
+	}
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	ret += ")" + strings.ToLower(path)
+	if u.RawQuery != "" {
+		ret += "?" + sortedQuery(u.RawQuery)
+	}
+	return ret
+}
+
+// sortedQuery sorts the parameters of a raw query string
+func sortedQuery(q string) string {
+	params := strings.Split(q, "&")
+	sort.Strings(params)
+	return strings.Join(params, "&")
+}
+
+// NormalizeURL returns the normal form of a URL used when indexing, deduplicating or filtering captures: the scheme and
+// host are lower-cased, default ports and any fragment are dropped, an empty path becomes "/" and, if sortQuery is set,
+// query parameters are sorted e.g. "HTTP://Example.com:80?b=1&a=2#top" becomes "http://example.com/?a=2&b=1".
+// URIs without a host (e.g. "dns:archive.org" or "urn:uuid:...") and URIs that can't be parsed are returned unchanged.
+func NormalizeURL(s string, sortQuery bool) string {
+	u, err := url.Parse(strings.TrimSpace(s))
+	if err != nil || u.Host == "" {
+		return s
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	if port := u.Port(); port != "" && port == defaultPorts[u.Scheme] {
+		u.Host = strings.TrimSuffix(u.Host, ":"+port)
+	}
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	if sortQuery && u.RawQuery != "" {
+		u.RawQuery = sortedQuery(u.RawQuery)
+	}
+	u.Fragment = ""
+	return u.String()
+}
+
+// parseTargetURI parses the target URI of a record, returning nil if it is empty or can't be parsed.
+// URIs without a "//" authority, such as "urn:uuid:..." or "mailto:...", are parsed with their scheme-specific part in Opaque.
+func parseTargetURI(s string) *url.URL {
+	if s == "" {
+		return nil
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil
+	}
+	return u
+}
+
+// hostOf returns the lower-cased host of a URL. For URIs without a host (e.g. "dns:archive.org"), the scheme is returned.
+func hostOf(s string) string {
+	u, err := url.Parse(s)
+	if err != nil {
+		return ""
+	}
+	if u.Host == "" {
+		return strings.ToLower(u.Scheme) + ":"
+	}
+	return strings.ToLower(u.Hostname())
+}
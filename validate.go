@@ -0,0 +1,305 @@
+// Copyright 2015 Richard Lehane. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webarchive
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ErrConformance is wrapped by findings for records that don't conform to the WARC standard.
+var ErrConformance = errors.New("webarchive: record doesn't conform to the WARC standard")
+
+// Finding is a problem found in a record by a Validator, VerifyManifest or Audit.
+// Err wraps ErrConformance, ErrDigestMatch, ErrSignature, ErrManifest or ErrIndex.
+type Finding struct {
+	Record int    // index of the record in the file, counting from 0; -1 for a record that is missing from the file
+	ID     string // WARC-Record-ID of the record, if it has one
+	Err    error
+}
+
+func (f Finding) Error() string {
+	if f.Record < 0 {
+		return fmt.Sprintf("%s: %v", f.ID, f.Err)
+	}
+	if f.ID == "" {
+		return fmt.Sprintf("record %d: %v", f.Record, f.Err)
+	}
+	return fmt.Sprintf("record %d %s: %v", f.Record, f.ID, f.Err)
+}
+
+func (f Finding) Unwrap() error { return f.Err }
+
+// Validator checks WARC files for conformance to the WARC 1.0 and 1.1 standards.
+//
+// Each record is checked for: a known version (1.0, 1.1 or the 0.17 and 0.18 drafts); the presence of mandatory fields (and of fields mandatory for
+// its WARC-Type); well-formed record IDs, dates, lengths and labelled digests; repetition of non-repeatable
+// fields; WARC 1.1 fields in WARC 1.0 records; duplicate record IDs and blocks shorter than their Content-Length.
+type Validator struct {
+	Digests      bool              // also check the WARC-Block-Digest and WARC-Payload-Digest of each record
+	SignatureKey ed25519.PublicKey // if set, also check that each record has a WARC-Signature made with the key (see Sign)
+}
+
+// versions of WARC files in the wild: 0.17 and 0.18 are drafts of the standard, written by older crawlers
+var warcVersions = map[string]bool{"0.17": true, "0.18": true, "1.0": true, "1.1": true}
+
+// record types that must have a WARC-Target-URI
+var targetTypes = map[string]bool{
+	"response":     true,
+	"resource":     true,
+	"request":      true,
+	"revisit":      true,
+	"conversion":   true,
+	"continuation": true,
+}
+
+// Validate reads the WARC file in r and returns findings for any records that don't conform.
+// An error is returned if the file can't be read to the end (e.g. because a record header is malformed);
+// findings for the records before that point are returned with it.
+func (v Validator) Validate(r io.Reader) ([]Finding, error) {
+	rdr, err := NewWARCReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer rdr.Close()
+	_, findings, err := v.validate(rdr)
+	return findings, err
+}
+
+// validate checks the records of a WARC file, returning the number of records read along with any findings
+func (v Validator) validate(rdr *WARCReader) (int, []Finding, error) {
+	var findings []Finding
+	ids := make(map[string]bool)
+	for idx := 0; ; idx++ {
+		rec, err := rdr.Next()
+		if err != nil {
+			if err == io.EOF {
+				return idx, findings, nil
+			}
+			return idx, findings, fmt.Errorf("record %d: %w", idx, err)
+		}
+		id := rdr.ID()
+		add := func(err error) {
+			findings = append(findings, Finding{Record: idx, ID: id, Err: err})
+		}
+		for _, e := range checkFields(rdr.Version(), rec.RawFields()) {
+			add(fmt.Errorf("%w: %s", ErrConformance, e))
+		}
+		if id != "" {
+			if ids[id] {
+				add(fmt.Errorf("%w: duplicate WARC-Record-ID", ErrConformance))
+			}
+			ids[id] = true
+		}
+		var dst io.Writer = ioutil.Discard
+		var bd, pd Digest
+		var dg *digester
+		if v.Digests {
+			fields := rec.Fields()
+			bd, _ = ParseDigest(fields.Get("WARC-Block-Digest"))
+			// the payload digest of a segmented record is of the whole payload, so can't be checked per segment, and
+			// the payload digest of a revisit is of the payload it revisits
+			if fields.Get("WARC-Segment-Number") == "" && RecordType(fields.Get("WARC-Type")) != TypeRevisit {
+				pd, _ = ParseDigest(fields.Get("WARC-Payload-Digest"))
+			}
+			dg = newDigester(bd.Algorithm, pd.Algorithm)
+			dst = dg
+		}
+		var sv *verifier
+		if v.SignatureKey != nil {
+			sv = newVerifier(rdr.Version(), rec.RawFields(), rec.Size())
+			dst = io.MultiWriter(dst, sv)
+		}
+		n, err := io.Copy(dst, rec)
+		if err != nil {
+			return idx, findings, fmt.Errorf("record %d: %w", idx, err)
+		}
+		if n < rec.Size() {
+			add(fmt.Errorf("%w: block is %d bytes, shorter than its Content-Length", ErrConformance, n))
+			continue
+		}
+		if dg != nil {
+			if err := checkDigests(id, bd, pd, dg); err != nil {
+				add(err)
+			}
+		}
+		if sv != nil {
+			if err := sv.verify(v.SignatureKey); err != nil {
+				add(err)
+			}
+		}
+	}
+}
+
+// Report is the result of Validate.
+type Report struct {
+	Format     string // "WARC" or "ARC"
+	Records    int    // number of records read
+	Findings   []Finding
+	FileDigest Digest // digest of the whole file, if Validate was given WithFileDigest
+}
+
+// Valid reports whether no problems were found. A file is only valid if Validate also returned a nil error.
+func (r *Report) Valid() bool { return len(r.Findings) == 0 }
+
+// Validate reads the ARC or WARC file in r and reports any problems found with it. WARC files are checked by a
+// Validator, including their block and payload digests; the documents of ARC files are checked for being shorter
+// than their declared length. Options, such as WithContinuationLimit, configure the Reader used.
+//
+// Returns ErrNotWebarchive if r is neither an ARC nor WARC file. If the file can't be read to the end,
+// the report of the records before that point is returned along with the error.
+func Validate(r io.Reader, opts ...Option) (*Report, error) {
+	rdr, err := NewReader(r, opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer rdr.Close()
+	rep := &Report{}
+	switch rdr := rdr.(*MultiReader).Reader.(type) {
+	case *WARCReader:
+		rep.Format = "WARC"
+		rep.Records, rep.Findings, err = Validator{Digests: true}.validate(rdr)
+	case *ARCReader:
+		rep.Format = "ARC"
+		rep.Records, rep.Findings, err = validateARC(rdr)
+	}
+	if err == nil {
+		rep.FileDigest, _ = rdr.(*MultiReader).FileDigest()
+	}
+	return rep, err
+}
+
+// validateARC checks the documents of an ARC file, returning the number of documents read along with any findings
+func validateARC(rdr *ARCReader) (int, []Finding, error) {
+	var findings []Finding
+	for idx := 0; ; idx++ {
+		rec, err := rdr.Next()
+		if err != nil {
+			if err == io.EOF {
+				return idx, findings, nil
+			}
+			return idx, findings, fmt.Errorf("record %d: %w", idx, err)
+		}
+		n, err := io.Copy(ioutil.Discard, rec)
+		if err != nil {
+			return idx, findings, fmt.Errorf("record %d: %w", idx, err)
+		}
+		if n < rec.Size() {
+			findings = append(findings, Finding{Record: idx,
+				Err: fmt.Errorf("%w: document is %d bytes, shorter than its length", ErrConformance, n)})
+		}
+	}
+}
+
+// checkFields returns descriptions of any problems with the version and fields of a WARC record
+func checkFields(version string, fields RawFields) []string {
+	var problems []string
+	problem := func(format string, a ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, a...))
+	}
+	if !warcVersions[version] {
+		problem("unknown WARC version %q", version)
+	}
+	counts := make(map[string]int)
+	for _, f := range fields {
+		if f.Key == "" {
+			continue
+		}
+		name, kind := WARCField(f.Key)
+		counts[name]++
+		if kind == WARC11Field && version == "1.0" {
+			problem("%s is a WARC 1.1 field", name)
+		}
+	}
+	for name, c := range counts {
+		if c > 1 && name != "WARC-Concurrent-To" && name != "WARC-Protocol" {
+			if _, kind := WARCField(name); kind == WARC10Field || kind == WARC11Field {
+				problem("%s is repeated", name)
+			}
+		}
+	}
+	for _, name := range []string{"WARC-Record-ID", "Content-Length", "WARC-Date", "WARC-Type"} {
+		if counts[name] == 0 {
+			problem("missing mandatory field %s", name)
+		}
+	}
+	typ := strings.ToLower(fields.Get("WARC-Type"))
+	if typ != "" && !RecordType(typ).Valid() && typ != webSocketType {
+		problem("unknown WARC-Type %q", typ)
+	}
+	if targetTypes[typ] && counts["WARC-Target-URI"] == 0 {
+		problem("%s record is missing WARC-Target-URI", typ)
+	}
+	switch typ {
+	case "revisit":
+		if counts["WARC-Profile"] == 0 {
+			problem("revisit record is missing WARC-Profile")
+		}
+	case "continuation":
+		if counts["WARC-Segment-Origin-ID"] == 0 {
+			problem("continuation record is missing WARC-Segment-Origin-ID")
+		}
+		if counts["WARC-Segment-Number"] == 0 {
+			problem("continuation record is missing WARC-Segment-Number")
+		}
+	}
+	for _, name := range []string{"WARC-Record-ID", "WARC-Concurrent-To", "WARC-Refers-To", "WARC-Warcinfo-ID", "WARC-Segment-Origin-ID"} {
+		for _, v := range fields.Values(name) {
+			if !isRecordID(v) {
+				problem("%s %q isn't a URI in angle brackets", name, v)
+			}
+		}
+	}
+	for _, name := range []string{"WARC-Date", "WARC-Refers-To-Date"} {
+		if v := fields.Get(name); v != "" {
+			if _, err := ParseWARCDate(v); err != nil {
+				problem("%s %q isn't a valid date", name, v)
+			}
+		}
+	}
+	for _, name := range []string{"Content-Length", "WARC-Segment-Number", "WARC-Segment-Total-Length"} {
+		if v := fields.Get(name); v != "" {
+			if i, err := strconv.ParseInt(v, 10, 64); err != nil || i < 0 {
+				problem("%s %q isn't a non-negative integer", name, v)
+			}
+		}
+	}
+	for _, name := range []string{"WARC-Block-Digest", "WARC-Payload-Digest"} {
+		if v := fields.Get(name); v != "" {
+			if _, err := ParseDigest(v); err != nil {
+				problem("%s %q isn't a labelled digest", name, v)
+			}
+		}
+	}
+	if counts["Content-Type"] == 0 && fields.Get("Content-Length") != "0" && typ != "continuation" {
+		problem("missing Content-Type for a non-empty block")
+	}
+	return problems
+}
+
+// isRecordID reports whether s is an absolute URI in angle brackets, as required for record IDs
+func isRecordID(s string) bool {
+	if len(s) < 3 || s[0] != '<' || s[len(s)-1] != '>' {
+		return false
+	}
+	u, err := url.Parse(s[1 : len(s)-1])
+	return err == nil && u.Scheme != ""
+}
@@ -0,0 +1,94 @@
+package webarchive
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	f, err := os.Open("examples/hello-world.warc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	findings, err := Validator{Digests: true}.Validate(f)
+	if err != nil || len(findings) != 0 {
+		t.Fatalf("expecting hello-world.warc to validate, got %v %v", findings, err)
+	}
+	bad := "WARC/1.0\r\n" +
+		"WARC-Type: revisit\r\n" +
+		"WARC-Record-ID: urn:uuid:1\r\n" +
+		"WARC-Date: 2015-07-08T21:55:13Z\r\n" +
+		"WARC-Target-URI: http://example.com/\r\n" +
+		"WARC-Block-Digest: sha1:UZY6ND6CCHXETFVJD2MSS7ZENMWF7KQ2\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"Content-Length: 5\r\n\r\n" +
+		"hello\r\n\r\n"
+	findings, err = Validator{Digests: true}.Validate(strings.NewReader(bad + bad))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var conformance, digest int
+	for _, f := range findings {
+		switch {
+		case errors.Is(f, ErrConformance):
+			conformance++
+		case errors.Is(f, ErrDigestMatch):
+			digest++
+		}
+	}
+	// each record: bad record ID and missing WARC-Profile; the second record is a duplicate
+	if conformance != 5 || digest != 2 {
+		t.Fatalf("expecting 5 conformance and 2 digest findings, got %v", findings)
+	}
+}
+
+func TestValidateFile(t *testing.T) {
+	for _, c := range []struct {
+		name    string
+		format  string
+		records int
+	}{
+		{"examples/hello-world.warc", "WARC", 6},
+		{"examples/IAH-20080430204825-00000-blackbook.arc", "ARC", 299},
+	} {
+		f, err := os.Open(c.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rep, err := Validate(f)
+		f.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if rep.Format != c.format || rep.Records != c.records || !rep.Valid() {
+			t.Errorf("%s: unexpected report %+v", c.name, rep)
+		}
+	}
+	if _, err := Validate(strings.NewReader("hello world")); err != ErrNotWebarchive {
+		t.Errorf("expecting ErrNotWebarchive, got %v", err)
+	}
+	rep, err := Validate(strings.NewReader("WARC/1.0\r\nWARC-Type: resource\r\nWARC-Date: 2015-07-08T21:55:13Z\r\nContent-Length: 5\r\n\r\nhello\r\n\r\n"))
+	if err != nil || rep.Valid() || rep.Records != 1 {
+		t.Errorf("expecting findings for a record without an ID, got %+v %v", rep, err)
+	}
+}
+
+func TestValidateDeduplicated(t *testing.T) {
+	checkExamples(t)
+	buf, _ := ioutil.ReadFile("examples/hello-world.warc")
+	// a second crawl of the same content, with different record IDs
+	again := bytes.Replace(buf, []byte("WARC-Record-ID: <urn:uuid:"), []byte("WARC-Record-ID: <urn:uuid:0"), -1)
+	out := &bytes.Buffer{}
+	if n, err := Deduplicate(out, bytes.NewReader(append(append([]byte{}, buf...), again...))); err != nil || n != 1 {
+		t.Fatalf("expecting 1 revisit, got %d (%v)", n, err)
+	}
+	findings, err := Validator{Digests: true}.Validate(bytes.NewReader(out.Bytes()))
+	if err != nil || len(findings) != 0 {
+		t.Errorf("expecting deduplicated file to validate, got %v %v", findings, err)
+	}
+}
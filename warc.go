@@ -15,11 +15,96 @@
 package webarchive
 
 import (
+	"bytes"
 	"io"
+	"net"
+	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 	"time"
 )
 
+// WARCTime is a time format string for the WARC 1.0 WARC-Date format.
+const WARCTime = "2006-01-02T15:04:05Z07:00"
+
+// WARCTimeNano is a time format string for the WARC 1.1 WARC-Date format,
+// which permits fractional seconds. Trailing zeros in the fraction are omitted.
+const WARCTimeNano = "2006-01-02T15:04:05.999999999Z07:00"
+
+// W3C-DTF layouts of decreasing precision that are accepted when parsing a WARC-Date
+var warcDateLayouts = []string{
+	WARCTimeNano,
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02",
+	"2006-01",
+	"2006",
+}
+
+// ParseWARCDate parses a WARC-Date value. Fractional seconds are retained at full precision.
+// Reduced precision W3C-DTF dates (e.g. "2015-07-08") are also accepted.
+func ParseWARCDate(s string) (time.Time, error) {
+	var t time.Time
+	var err error
+	for _, l := range warcDateLayouts {
+		t, err = time.Parse(l, s)
+		if err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return t, err
+}
+
+// FormatWARCDate formats a time as a WARC-Date value in UTC.
+// Fractional seconds are included only if the time has them.
+func FormatWARCDate(t time.Time) string {
+	return t.UTC().Format(WARCTimeNano)
+}
+
+// format a date for a record of the given WARC version: only WARC 1.1 permits fractional seconds
+func formatVersionDate(version string, t time.Time) string {
+	if version == "1.0" || version == "" {
+		return t.UTC().Format(WARCTime)
+	}
+	return FormatWARCDate(t)
+}
+
+// RecordType is the type of a WARC record, given by its WARC-Type field.
+type RecordType string
+
+// The record types defined by the WARC standard.
+const (
+	TypeWarcinfo     RecordType = "warcinfo"
+	TypeResponse     RecordType = "response"
+	TypeResource     RecordType = "resource"
+	TypeRequest      RecordType = "request"
+	TypeMetadata     RecordType = "metadata"
+	TypeRevisit      RecordType = "revisit"
+	TypeConversion   RecordType = "conversion"
+	TypeContinuation RecordType = "continuation"
+)
+
+// ParseRecordType parses a WARC-Type value, which is case-insensitive.
+// Returns ErrRecordType if it isn't one of the types defined by the WARC standard.
+func ParseRecordType(s string) (RecordType, error) {
+	t := RecordType(strings.ToLower(strings.TrimSpace(s)))
+	if !t.Valid() {
+		return t, ErrRecordType
+	}
+	return t, nil
+}
+
+// Valid reports whether t is one of the types defined by the WARC standard.
+func (t RecordType) Valid() bool {
+	switch t {
+	case TypeWarcinfo, TypeResponse, TypeResource, TypeRequest, TypeMetadata, TypeRevisit, TypeConversion, TypeContinuation:
+		return true
+	}
+	return false
+}
+
+func (t RecordType) String() string { return string(t) }
+
 // WARCRecord allows access to specific WARC record fields. Other WARC
 // fields not included here are accessible via the Fields() method.
 // To access the ID() and Type() methods of a WARCRecord, do an interface
@@ -30,25 +115,55 @@ import (
 //  warcrecord, ok := record.(WARCRecord)
 //  if ok {fmt.Println(warcrecord.ID())}
 type WARCRecord interface {
-	ID() string
-	Type() string
+	RecordType() RecordType
+	Version() string
+	Filename() string
+	IPAddress() net.IP
+	WarcinfoID() string
+	RefersTo() string
+	RefersToTargetURI() string
+	RefersToDate() time.Time
+	Protocols() []string
+	CipherSuite() string
+	Stripped() bool
+	HTTPResponse() (*http.Response, error)
+	IdentifiedPayloadType() string
+	Language() string
+	CrawlStatus() CrawlStatus
 	Record
 }
 
 type warcHeader struct {
-	url     string    // WARC-Target-URI
-	id      string    // WARC-Record-ID
-	date    time.Time // WARC-Date
-	typ     string    // WARC-Type
-	segment int       // WARC-Segment-Number
-	mime    string    // WARC-Identified-Payload-Type or HTTP Content-Type header
+	version string      // e.g. "1.0" or "1.1" from the WARC/1.0 magic line
+	url     string      // WARC-Target-URI
+	id      string      // WARC-Record-ID
+	date    time.Time   // WARC-Date
+	typ     string      // WARC-Type
+	segment int         // WARC-Segment-Number
+	mime    string      // WARC-Identified-Payload-Type or HTTP Content-Type header
+	http    bool        // HTTP headers have been stripped from the block and appended to fields
+	sniffed string      // payload type identified by sniffing, with WithSniffing
+	lang    string      // language of the payload identified with WithLanguageDetector
+	crawl   CrawlStatus // classification against an earlier crawl, with WithPriorIndex
+	vline   []byte      // version line as read, with its line ending
 	fields  []byte
+	parsed  parsedFields // results of any registered field parsers
 }
 
 // URL returns the URL of the current Record.
 func (h *warcHeader) URL() string { return h.url }
 
+// NormalizedURL returns the URL of the current Record in the normal form given by NormalizeURL, without sorting
+// query parameters. Use NormalizeURL(rec.URL(), true) to also sort them.
+func (h *warcHeader) NormalizedURL() string { return NormalizeURL(h.url, false) }
+
+// TargetURI returns the parsed WARC-Target-URI of the current Record. For URIs without an authority, such as
+// "urn:pageinfo:http://example.com/" or "mailto:a@example.com", the part after the scheme is in Opaque.
+// Returns nil if the record has no target URI or it can't be parsed.
+func (h *warcHeader) TargetURI() *url.URL { return parseTargetURI(h.url) }
+
 // Date returns the archive date of the current Record.
+// For WARC 1.1 records, the date retains any fractional seconds given in WARC-Date.
 func (h *warcHeader) Date() time.Time { return h.date }
 
 func (h *warcHeader) MIME() string {
@@ -56,14 +171,64 @@ func (h *warcHeader) MIME() string {
 		return h.mime
 	}
 	ctypes := getSingleValues(h.fields, "Content-Type")
-	switch len(ctypes) {
-	case 0:
-		return ""
-	case 1:
-		return ctypes[0]
-	default:
+	if h.http {
+		// the first Content-Type is the WARC one, naming the block as an HTTP message
+		if len(ctypes) < 2 {
+			return ""
+		}
 		return ctypes[1]
 	}
+	if len(ctypes) == 0 {
+		return ""
+	}
+	return ctypes[0]
+}
+
+// IdentifiedPayloadType returns the media type of the record's payload as identified by the WARC-Identified-Payload-Type
+// field or, for payload records read by a reader created with WithSniffing, by sniffing the payload.
+// Returns an empty string if the type hasn't been identified.
+func (h *warcHeader) IdentifiedPayloadType() string {
+	if h.mime != "" {
+		return h.mime
+	}
+	return h.sniffed
+}
+
+// Language returns the language of the record's payload as given by the WARC-Identified-Content-Language field or,
+// for payload records read by a reader created with WithLanguageDetector, as identified by the detector.
+// Returns an empty string if the language hasn't been identified.
+func (h *warcHeader) Language() string {
+	if lang := getSelectValues(h.fields, "WARC-Identified-Content-Language")[0]; lang != "" {
+		return lang
+	}
+	return h.lang
+}
+
+// CrawlStatus returns the classification of the record against an earlier crawl, for records read by a reader
+// created with WithPriorIndex. Returns Unclassified otherwise.
+func (h *warcHeader) CrawlStatus() CrawlStatus { return h.crawl }
+
+// Stripped reports whether the record's HTTP headers were stripped from its block by NextPayload (see IsHTTP).
+// For other records (e.g. ftp fetches, dns lookups or resources) the payload is the complete block and
+// MIME returns the media type given by the record's Content-Type field.
+func (h *warcHeader) Stripped() bool { return h.http }
+
+// httpBlock reports whether a record's block, which begins with peek, holds an HTTP message.
+// This is decided by the record's Content-Type field ("application/http"): the block is only inspected
+// for records without one. Blocks that don't begin with an HTTP status or request line are never treated as
+// HTTP messages, since stripping headers from them would truncate the payload.
+func (h *warcHeader) httpBlock(peek []byte) bool {
+	if !isHTTP(peek) {
+		return false
+	}
+	ct := getSelectValues(h.fields, "Content-Type")[0]
+	if ct == "" {
+		return true
+	}
+	if i := strings.IndexByte(ct, ';'); i > -1 {
+		ct = ct[:i]
+	}
+	return strings.EqualFold(strings.TrimSpace(ct), "application/http")
 }
 
 func (h *warcHeader) transferEncodings() []string {
@@ -89,7 +254,16 @@ func (h *warcHeader) encodings() []string {
 
 // Fields returns a map of all WARC fields for the current Record.
 // If NextPayload was used, this map will also contain any stripped HTTP headers.
-func (h *warcHeader) Fields() map[string][]string { return getAllValues(h.fields) }
+func (h *warcHeader) Fields() Fields { return getAllValues(h.fields) }
+
+// RawFields returns the WARC fields for the current Record in their original order and spelling.
+// If NextPayload was used, the list will also contain any stripped HTTP headers.
+func (h *warcHeader) RawFields() RawFields { return getRawFields(h.fields) }
+
+// Parsed returns the result of the FieldParser registered for key (see WithFieldParser).
+// Returns a nil value and nil error if the field is not present in the record,
+// and ErrNoParser if no parser was registered for key.
+func (h *warcHeader) Parsed(key string) (interface{}, error) { return h.parsed.get(key) }
 
 // ID returns the WARC Record ID.
 func (h *warcHeader) ID() string { return h.id }
@@ -97,28 +271,108 @@ func (h *warcHeader) ID() string { return h.id }
 // Type returns the WARC Type
 func (h *warcHeader) Type() string { return h.typ }
 
+// RecordType returns the WARC-Type of the record as a RecordType, in lower case so that it can be compared with the
+// constants e.g. TypeResponse. Use Valid to check whether it is a type defined by the WARC standard.
+func (h *warcHeader) RecordType() RecordType { return RecordType(strings.ToLower(h.typ)) }
+
+// Version returns the WARC version declared in the record's first line e.g. "1.0" or "1.1".
+// Returns an empty string if the record did not begin with a "WARC/" version line.
+func (h *warcHeader) Version() string { return h.version }
+
+// Filename returns the WARC-Filename field, which names the WARC file a warcinfo record describes.
+func (h *warcHeader) Filename() string {
+	return getSelectValues(h.fields, "WARC-Filename")[0]
+}
+
+// IPAddress returns the WARC-IP-Address field: the address of the server a record's content was fetched from.
+// Returns nil if the field isn't present or isn't a valid IP address.
+func (h *warcHeader) IPAddress() net.IP {
+	return net.ParseIP(getSelectValues(h.fields, "WARC-IP-Address")[0])
+}
+
+// WarcinfoID returns the WARC-Warcinfo-ID field, the ID of the warcinfo record describing the record's capture.
+// As with ID, the angle brackets that enclose the ID are retained.
+func (h *warcHeader) WarcinfoID() string {
+	return getSelectValues(h.fields, "WARC-Warcinfo-ID")[0]
+}
+
+// RefersTo returns the WARC-Refers-To field, the ID of the record that a revisit, conversion or metadata record
+// refers to. As with ID, the angle brackets that enclose the ID are retained.
+func (h *warcHeader) RefersTo() string {
+	return getSelectValues(h.fields, "WARC-Refers-To")[0]
+}
+
+// RefersToTargetURI returns the WARC 1.1 WARC-Refers-To-Target-URI field, the target URI of the capture a revisit
+// record refers to.
+func (h *warcHeader) RefersToTargetURI() string {
+	return strings.TrimSuffix(strings.TrimPrefix(getSelectValues(h.fields, "WARC-Refers-To-Target-URI")[0], "<"), ">")
+}
+
+// RefersToDate returns the WARC 1.1 WARC-Refers-To-Date field, the date of the capture a revisit record refers to,
+// with any fractional seconds. Returns the zero time if the field isn't present or can't be parsed.
+func (h *warcHeader) RefersToDate() time.Time {
+	t, _ := ParseWARCDate(getSelectValues(h.fields, "WARC-Refers-To-Date")[0])
+	return t
+}
+
+// Protocols returns the values of the WARC-Protocol extension field, which name the protocols used to fetch the
+// record's content, outermost first e.g. ["h2", "tls/1.3"]. Returns nil if the field isn't present.
+func (h *warcHeader) Protocols() []string {
+	return getAllValues(h.fields)["WARC-Protocol"]
+}
+
+// CipherSuite returns the WARC-Cipher-Suite extension field: the cipher suite of the TLS connection the record's
+// content was fetched over, in its IANA form e.g. "TLS_AES_128_GCM_SHA256".
+func (h *warcHeader) CipherSuite() string {
+	return getSelectValues(h.fields, "WARC-Cipher-Suite")[0]
+}
+
 // WARCReader is the WARC implementation of a webarchive Reader
 type WARCReader struct {
 	*warcHeader
 	*reader
-	continuations
+	continuations continuations
+	meta          ArchiveMeta // from the warcinfo record at the start of the file
 }
 
 // NewWARCReader creates a new WARC reader from the supplied io.Reader.
 // Use instead of NewReader if you are only working with ARC files.
-func NewWARCReader(r io.Reader) (*WARCReader, error) {
-	rdr, err := newReader(r)
+func NewWARCReader(r io.Reader, opts ...Option) (*WARCReader, error) {
+	rdr, err := newReader(r, opts...)
 	if err != nil {
 		return nil, err
 	}
+	rdr.mixed = false
 	return newWARCReader(rdr)
 }
 
 func newWARCReader(r *reader) (*WARCReader, error) {
-	w := &WARCReader{&warcHeader{}, r, nil}
+	w := &WARCReader{warcHeader: &warcHeader{}, reader: r}
 	return w, w.reset()
 }
 
+// Incomplete returns the number of segmented records that NextPayload has seen segments of, but hasn't returned
+// because they are incomplete (including any dropped under the DropOldest policy of WithContinuationLimit).
+// Once NextPayload has returned io.EOF, these are records missing segments.
+func (w *WARCReader) Incomplete() int {
+	return len(w.continuations.m) + len(w.continuations.dropped)
+}
+
+// Summary returns counts of the records read so far, including the number of incomplete segmented records.
+// Counts are reset when the reader is Reset.
+func (w *WARCReader) Summary() Summary {
+	s := w.summary
+	s.Incomplete = w.Incomplete()
+	return s
+}
+
+// Close closes the underlying gzip reader if the WARC file is gzipped, and removes any temporary files holding
+// segments spilled under the SpillToDisk policy of WithContinuationLimit.
+func (w *WARCReader) Close() error {
+	w.continuations.clear()
+	return w.reader.Close()
+}
+
 // Reset allows re-use of a ARC reader
 func (w *WARCReader) Reset(r io.Reader) error {
 	w.reader.reset(r)
@@ -129,46 +383,136 @@ func (w *WARCReader) reset() error {
 	if v, err := w.peek(4); err != nil || string(v) != "WARC" {
 		return ErrWARCHeader
 	}
+	w.meta = w.readMeta()
 	return nil
 }
 
+// bytes examined at the start of a WARC file for a warcinfo record
+const metaLen = 4096
+
+// readMeta reads archive-level metadata from any warcinfo record at the start of the file, without advancing the reader.
+// The warcinfo fields are only read if the record is shorter than metaLen.
+func (w *WARCReader) readMeta() ArchiveMeta {
+	meta := ArchiveMeta{Format: "WARC"}
+	buf, _ := w.peek(metaLen)
+	line, n := readline(buf)
+	meta.Version = parseVersion(line)
+	if n == 0 {
+		return meta
+	}
+	end := indexBlankLine(buf[n:])
+	if end < 0 {
+		return meta
+	}
+	vals := getSelectValues(buf[n:n+end], "WARC-Type", "WARC-Filename", "WARC-Date", "Content-Length")
+	if vals[0] != "warcinfo" {
+		return meta
+	}
+	meta.Filename = vals[1]
+	meta.Date, _ = ParseWARCDate(vals[2])
+	if l, err := strconv.Atoi(vals[3]); err == nil && n+end+l <= len(buf) {
+		wi := ParseWarcinfo(buf[n+end : n+end+l])
+		meta.Software, meta.Operator = wi.Software, wi.Operator
+	}
+	return meta
+}
+
+// ArchiveMeta returns metadata about the WARC file from the warcinfo record at its start, if it has one.
+func (w *WARCReader) ArchiveMeta() ArchiveMeta { return w.meta }
+
 // Next iterates to the next Record. Returns io.EOF at the end of file.
 func (w *WARCReader) Next() (Record, error) {
-	// discard the returned slice as the first line in a WARC record is just the WARC header
-	_, err := w.next()
+	n, err := w.nextRecord(true)
+	w.tally(n, err)
+	if err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// NextHeader iterates to the next Record, returning only its header. Unlike Next, the start of the record's block
+// isn't examined for HTTP headers, so the block is skipped without being read if the file isn't compressed and
+// its source is seekable (e.g. an *os.File). The blocks of compressed files must still be decompressed to skip them.
+// Returns io.EOF at the end of file.
+func (w *WARCReader) NextHeader() (Header, error) {
+	n, err := w.nextRecord(false)
+	w.tally(n, err)
 	if err != nil {
 		return nil, err
 	}
+	return w, nil
+}
+
+// nextRecord reads the header of the next record, returning the length of the record.
+// If examine is set, the start of the block is examined for HTTP headers.
+func (w *WARCReader) nextRecord(examine bool) (int64, error) {
+	if w.mixed {
+		b, err := w.peekRecord()
+		if err != nil {
+			return 0, err
+		}
+		if isARCStart(b) {
+			return 0, errFormat
+		}
+	}
+	// the first line in a WARC record is the version line e.g. WARC/1.0
+	line, err := w.next()
+	if err != nil {
+		return 0, err
+	}
+	w.version = parseVersion(line)
+	w.vline = append(w.vline[:0], line...)
 	w.fields, err = w.storeLines(0, false)
 	if err != nil {
-		return nil, ErrWARCRecord
+		return 0, ErrWARCRecord
 	}
 	vals := getSelectValues(w.fields, "WARC-Type", "WARC-Target-URI", "WARC-Date", "Content-Length", "WARC-Record-ID", "WARC-Segment-Number", "WARC-Identified-Payload-Type")
-	w.typ, w.url, w.id, w.mime = vals[0], vals[1], vals[4], vals[6]
-	w.date, err = time.Parse(time.RFC3339, vals[2])
+	// some writers enclose the target URI in angle brackets, following an example in the WARC 1.0 standard
+	w.typ, w.url, w.id, w.mime = vals[0], strings.TrimSuffix(strings.TrimPrefix(vals[1], "<"), ">"), vals[4], vals[6]
+	w.date, err = ParseWARCDate(vals[2])
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
 	w.sz, err = strconv.ParseInt(vals[3], 10, 64)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
 	w.thisIdx = 0
+	w.warcHeader.http, w.sniffed, w.lang = false, "", ""
 	if vals[5] != "" {
 		w.segment, err = strconv.Atoi(vals[5])
 		if err != nil {
-			return nil, err
+			return 0, err
 		}
 	} else {
 		w.segment = 0
 	}
-	return w, nil
+	w.parsed = w.parseFields(w.fields)
+	w.crawl = Unclassified
+	if w.prior != nil {
+		w.crawl = classify(w.prior, w.typ, w.url, getSelectValues(w.fields, "WARC-Payload-Digest")[0])
+	}
+	if examine {
+		w.examine(w.httpBlock)
+	} else {
+		w.examine(nil)
+	}
+	return int64(len(line)+len(w.fields)) + w.sz, nil
+}
+
+func parseVersion(line []byte) string {
+	line = bytes.TrimSpace(line)
+	if len(line) < 5 || !bytes.EqualFold(line[:5], []byte("WARC/")) {
+		return ""
+	}
+	return string(line[5:])
 }
 
 // NextPayload iterates to the next payload record.
 // It skips non-resource, conversion or response records and merges continuations into single records.
-// It also strips HTTP headers from response records. After stripping, those HTTP headers are available alongside
-// the WARC headers in the record.Fields() map.
+// It also strips HTTP headers from response records with an "application/http" Content-Type. After stripping, those
+// HTTP headers are available alongside the WARC headers in the record.Fields() map. The payloads of other response
+// records, such as ftp fetches, are their complete blocks.
 func (w *WARCReader) NextPayload() (Record, error) {
 	for {
 		r, err := w.Next()
@@ -176,25 +520,85 @@ func (w *WARCReader) NextPayload() (Record, error) {
 			return r, err
 		}
 		if w.segment > 0 {
-			if w.continuations == nil {
-				w.continuations = make(continuations)
+			c, ok, err := w.continuations.put(w)
+			if err != nil {
+				return nil, err
 			}
-			if c, ok := w.continuations.put(w); ok {
+			if ok {
+				cr := c.(*continuation)
+				if w.sniff {
+					cr.sniffed = sniffType(cr.buf[cr.start:], cr.MIME())
+				}
+				if w.detector != nil && getSelectValues(cr.fields, "WARC-Identified-Content-Language")[0] == "" {
+					cr.lang = detectLanguage(w.detector, cr.buf[cr.start:], cr.MIME(), cr.encodings())
+				}
+				w.summary.Payloads++
 				return c, nil
 			}
 			continue
 		}
 		switch w.typ {
 		default:
+			w.summary.Skipped++
 			continue
 		case "resource", "conversion":
-			return r, err
+			w.summary.Payloads++
+			return r, w.identify()
 		case "response":
-			if v, err := w.peek(5); err == nil && string(v) == "HTTP/" {
-				l := len(w.fields)
-				w.fields, err = w.storeLines(l, true)
+			if err := w.stripHTTP(); err != nil {
+				return r, err
 			}
-			return r, err
+			w.summary.Payloads++
+			return r, w.identify()
 		}
 	}
 }
+
+// identify the type and language of the current payload record, as enabled by WithSniffing and WithLanguageDetector
+func (w *WARCReader) identify() error {
+	if err := w.sniffPayload(); err != nil {
+		return err
+	}
+	return w.identifyLanguage()
+}
+
+// sniffPayload identifies the type of the current payload record, if sniffing is enabled
+func (w *WARCReader) sniffPayload() error {
+	if !w.sniff || w.mime != "" {
+		return nil
+	}
+	l := int64(sniffLen)
+	if w.sz-w.thisIdx < l {
+		l = w.sz - w.thisIdx
+	}
+	buf, err := w.peek(int(l))
+	if err != nil && err != io.EOF {
+		return err
+	}
+	w.sniffed = sniffType(buf, w.MIME())
+	return nil
+}
+
+// HTTPResponse parses the HTTP headers of a response record into an *http.Response, so that archived responses can
+// be handled like live ones. The Body of the response reads the payload of the record, decoded of any transfer
+// encoding (as by DecodePayloadT) but not of its content encodings. If the record was read with Next, its HTTP headers
+// are parsed from the start of its block without being stripped, so that its Size and fields are unchanged and it can
+// still be copied with CopyRecord until the Body is read.
+//
+// Returns an error wrapping ErrHTTPResponse if the block of the record isn't an HTTP response, or if its headers
+// haven't been stripped and either it has already been read from or they are longer than 4096 bytes.
+func (w *WARCReader) HTTPResponse() (*http.Response, error) {
+	return httpResponse(w.reader, w, func() []byte { return w.fields })
+}
+
+// stripHTTP moves the HTTP headers of a response record that holds an HTTP message into its fields
+func (w *WARCReader) stripHTTP() error {
+	if !w.reader.http {
+		return nil
+	}
+	w.warcHeader.http = true
+	var err error
+	w.fields, err = w.storeLines(len(w.fields), true)
+	w.parsed = w.parseFields(w.fields)
+	return err
+}
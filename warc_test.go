@@ -1,11 +1,18 @@
 package webarchive
 
 import (
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
+	"net"
 	"os"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 )
@@ -27,6 +34,118 @@ func TestWARC(t *testing.T) {
 	}
 }
 
+func TestWARCDate(t *testing.T) {
+	for _, c := range []struct {
+		in, out string
+	}{
+		{"2015-07-08T21:55:13Z", "2015-07-08T21:55:13Z"},
+		{"2015-07-08T21:55:13.5Z", "2015-07-08T21:55:13.5Z"},
+		{"2015-07-08T21:55:13.123456789Z", "2015-07-08T21:55:13.123456789Z"},
+		{"2015-07-08", "2015-07-08T00:00:00Z"},
+	} {
+		d, err := ParseWARCDate(c.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f := FormatWARCDate(d); f != c.out {
+			t.Errorf("expecting %s, got %s", c.out, f)
+		}
+	}
+	rec := "WARC/1.1\r\nWARC-Type: resource\r\nWARC-Date: 2015-07-08T21:55:13.042Z\r\nContent-Length: 0\r\n\r\n\r\n\r\n"
+	rdr, err := NewWARCReader(strings.NewReader(rec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := rdr.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Date().Nanosecond() != 42000000 {
+		t.Errorf("expecting 42ms fraction, got %v", r.Date())
+	}
+	if v := r.(WARCRecord).Version(); v != "1.1" {
+		t.Errorf("expecting version 1.1, got %s", v)
+	}
+}
+
+func TestWARC11RoundTrip(t *testing.T) {
+	date := time.Date(2020, 1, 2, 3, 4, 5, 6000000, time.UTC)
+	orig := time.Date(2019, 12, 1, 0, 0, 0, 500000000, time.UTC)
+	h := NewRecordHeader(TypeRevisit, "http://example.com/", date)
+	h.SetVersion("1.1")
+	h.SetRefersTo("<urn:uuid:00000000-0000-4000-8000-000000000000>", "http://example.com/", orig)
+	h.Set("WARC-Profile", revisitProfile("1.1"))
+	buf := &bytes.Buffer{}
+	ww, _ := NewWARCWriter(buf, NoCompression)
+	if err := ww.WriteRecord(h, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(buf.String(), "WARC/1.1\r\n") {
+		t.Fatalf("expecting a WARC/1.1 version line, got %q", buf.String())
+	}
+	src := buf.Bytes()
+	rdr, err := NewWARCReader(bytes.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := rdr.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wr := r.(WARCRecord)
+	if wr.Version() != "1.1" || !wr.Date().Equal(date) {
+		t.Errorf("expecting version 1.1 dated %v, got %s %v", date, wr.Version(), wr.Date())
+	}
+	if wr.RefersTo() != "<urn:uuid:00000000-0000-4000-8000-000000000000>" || wr.RefersToTargetURI() != "http://example.com/" ||
+		!wr.RefersToDate().Equal(orig) {
+		t.Errorf("bad refers-to fields %q %q %v", wr.RefersTo(), wr.RefersToTargetURI(), wr.RefersToDate())
+	}
+	if rep, err := Validate(bytes.NewReader(src)); err != nil || !rep.Valid() {
+		t.Errorf("expecting a conforming WARC 1.1 revisit, got %v %v", rep.Findings, err)
+	}
+}
+
+func TestWARCField(t *testing.T) {
+	for _, c := range []struct {
+		in, out string
+		kind    FieldKind
+	}{
+		{"warc-record-id", "WARC-Record-ID", WARC10Field},
+		{"WARC-Refers-To-Target-URI", "WARC-Refers-To-Target-URI", WARC11Field},
+		{"warc-protocol", "WARC-Protocol", ExtensionField},
+		{"x-crawler-id", "X-Crawler-Id", UnknownField},
+	} {
+		name, kind := WARCField(c.in)
+		if name != c.out || kind != c.kind {
+			t.Errorf("%s: expecting %s (%d), got %s (%d)", c.in, c.out, c.kind, name, kind)
+		}
+	}
+}
+
+func TestProvenance(t *testing.T) {
+	f, _ := os.Open("examples/hello-world.warc")
+	defer f.Close()
+	rdr, _ := NewWARCReader(f)
+	rec, _ := rdr.Next()
+	if fn := rec.(WARCRecord).Filename(); fn != "hello-world.warc.gz" {
+		t.Errorf("expecting hello-world.warc.gz, got %s", fn)
+	}
+	if ip := rec.(WARCRecord).IPAddress(); ip != nil {
+		t.Errorf("expecting no IP address, got %s", ip)
+	}
+	rec, _ = rdr.Next()
+	w := rec.(WARCRecord)
+	if ip := w.IPAddress(); !ip.Equal(net.IPv4(185, 31, 18, 133)) {
+		t.Errorf("expecting 185.31.18.133, got %s", ip)
+	}
+	if id := w.WarcinfoID(); id != "<urn:uuid:B8FDDD7C-DBB0-4EC4-BC7E-AA0B21749707>" {
+		t.Errorf("bad warcinfo ID %s", id)
+	}
+	if w.Filename() != "" {
+		t.Errorf("expecting no filename, got %s", w.Filename())
+	}
+}
+
 func TestGZ(t *testing.T) {
 	checkExamples(t)
 	f, _ := os.Open("examples/IAH-20080430204825-00000-blackbook.warc.gz")
@@ -83,3 +202,397 @@ func ExampleNewWARCReader() {
 	// www.archive.org.	589	IN	A	207.241.229.39
 	// 298
 }
+
+func TestZlibAndDeflate(t *testing.T) {
+	checkExamples(t)
+	src, _ := ioutil.ReadFile("examples/hello-world.warc")
+	offsets := []int{0, 589, 1260, 2349, 2772, 3340, len(src)}
+	for _, compress := range []func(io.Writer) io.WriteCloser{
+		func(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) },
+		func(w io.Writer) io.WriteCloser { fw, _ := flate.NewWriter(w, flate.DefaultCompression); return fw },
+	} {
+		// compress each record as a separate member
+		buf := &bytes.Buffer{}
+		for i := 1; i < len(offsets); i++ {
+			zw := compress(buf)
+			zw.Write(src[offsets[i-1]:offsets[i]])
+			zw.Close()
+		}
+		rdr, err := NewReader(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var payloads []string
+		for rec, err := rdr.NextPayload(); err != io.EOF; rec, err = rdr.NextPayload() {
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, _ := ioutil.ReadAll(rec)
+			payloads = append(payloads, string(b))
+		}
+		if len(payloads) != 3 || payloads[0] != "Hello World\n\n" {
+			t.Errorf("bad payloads %q", payloads)
+		}
+	}
+}
+
+func TestBzip2(t *testing.T) {
+	checkExamples(t)
+	src, _ := ioutil.ReadFile("examples/hello-world.warc.bz2")
+	// concatenated streams, as when each record is compressed separately
+	for i, b := range [][]byte{src, append(append([]byte{}, src...), src...)} {
+		rdr, err := NewReader(bytes.NewReader(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var payloads []string
+		for rec, err := rdr.NextPayload(); err != io.EOF; rec, err = rdr.NextPayload() {
+			if err != nil {
+				t.Fatal(err)
+			}
+			p, _ := ioutil.ReadAll(rec)
+			payloads = append(payloads, string(p))
+		}
+		if len(payloads) != 3*(i+1) || payloads[0] != "Hello World\n\n" {
+			t.Errorf("bad payloads %q", payloads)
+		}
+	}
+}
+
+func TestNonHTTPPayload(t *testing.T) {
+	buf := &bytes.Buffer{}
+	ww := newWARCWriter(buf)
+	for _, r := range []struct{ ct, block string }{
+		{"text/plain", "HTTP/1.1 is described in RFC 2616\r\n\r\nand RFC 7230"},
+		{"application/http;msgtype=response", "HTTP/1.1 200 OK\r\nContent-Type: text/html\r\n\r\n<html>"},
+	} {
+		fields := RawFields{
+			{Key: "WARC-Type", Value: "response"},
+			{Key: "WARC-Target-URI", Value: "ftp://example.com/http.txt"},
+			{Key: "WARC-Date", Value: "2020-01-01T00:00:00Z"},
+			{Key: "WARC-Record-ID", Value: newRecordID()},
+			{Key: "Content-Type", Value: r.ct},
+		}
+		if err := ww.writeRecord("1.0", fields, strings.NewReader(r.block), int64(len(r.block))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rdr, err := NewWARCReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expect := range []struct {
+		stripped bool
+		mime     string
+		sz       int64
+	}{
+		{false, "text/plain", 49},
+		{true, "text/html", 6},
+	} {
+		rec, err := rdr.NextPayload()
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := rec.(WARCRecord)
+		if w.Stripped() != expect.stripped || w.MIME() != expect.mime || w.Size() != expect.sz {
+			t.Errorf("expecting %v, got %v %s %d", expect, w.Stripped(), w.MIME(), w.Size())
+		}
+	}
+}
+
+func segmentedWARC(t *testing.T) []byte {
+	buf := &bytes.Buffer{}
+	ww := newWARCWriter(buf)
+	for _, s := range []struct {
+		id, origin, num, block string
+		final                  bool
+	}{
+		{"<urn:a>", "", "1", "first half of a ", false},
+		{"<urn:b>", "", "1", "first half of b, which never ends", false},
+		{"<urn:a2>", "<urn:a>", "2", "second half of a", true},
+	} {
+		typ := "resource"
+		fields := RawFields{{Key: "WARC-Record-ID", Value: s.id}}
+		if s.origin != "" {
+			typ = "continuation"
+			fields.Add("WARC-Segment-Origin-ID", s.origin)
+		}
+		fields.Add("WARC-Type", typ)
+		fields.Add("WARC-Target-URI", "http://example.com/"+s.id[5:6])
+		fields.Add("WARC-Date", "2020-01-01T00:00:00Z")
+		fields.Add("WARC-Segment-Number", s.num)
+		if s.final {
+			fields.Add("WARC-Segment-Total-Length", "32")
+		}
+		if err := ww.writeRecord("1.0", fields, strings.NewReader(s.block), int64(len(s.block))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.Bytes()
+}
+
+func TestContinuationLimit(t *testing.T) {
+	in := segmentedWARC(t)
+	for _, c := range []struct {
+		opts       []Option
+		records    int
+		incomplete int
+		err        error
+	}{
+		{nil, 1, 1, io.EOF},
+		{[]Option{WithContinuationLimit(40, DropOldest)}, 0, 2, io.EOF}, // a is dropped, so its second half is too
+		{[]Option{WithContinuationLimit(40, ErrorOnLimit)}, 0, 2, ErrContinuationLimit},
+		{[]Option{WithContinuationLimit(40, SpillToDisk)}, 1, 1, io.EOF},
+	} {
+		rdr, err := NewWARCReader(bytes.NewReader(in), c.opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var n int
+		for {
+			rec, err := rdr.NextPayload()
+			if err != nil {
+				if err != c.err {
+					t.Errorf("expecting %v, got %v", c.err, err)
+				}
+				break
+			}
+			if b, _ := ioutil.ReadAll(rec); string(b) != "first half of a second half of a" {
+				t.Errorf("bad merged record %q", b)
+			}
+			n++
+		}
+		if n != c.records || rdr.Incomplete() != c.incomplete || rdr.Summary().Incomplete != c.incomplete {
+			t.Errorf("expecting %d records and %d incomplete, got %d and %d", c.records, c.incomplete, n, rdr.Incomplete())
+		}
+		for _, cr := range rdr.continuations.m {
+			if cr.file != nil {
+				name := cr.file.Name()
+				rdr.Close()
+				if _, err := os.Stat(name); !os.IsNotExist(err) {
+					t.Errorf("expecting spilled segments to be removed on Close")
+				}
+			}
+		}
+		rdr.Close()
+	}
+}
+
+func TestSegmentHeadersOnly(t *testing.T) {
+	buf := &bytes.Buffer{}
+	ww := newWARCWriter(buf)
+	for i, block := range []string{"HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\n\r\nfirst half", ", second half"} {
+		fields := RawFields{
+			{Key: "WARC-Type", Value: "response"},
+			{Key: "WARC-Record-ID", Value: "<urn:a" + strconv.Itoa(i) + ">"},
+			{Key: "WARC-Target-URI", Value: "http://example.com/"},
+			{Key: "WARC-Date", Value: "2020-01-01T00:00:00Z"},
+			{Key: "WARC-Segment-Number", Value: strconv.Itoa(i + 1)},
+		}
+		if i == 0 {
+			fields.Add("Content-Type", "application/http;msgtype=response")
+		} else {
+			fields[0].Value = "continuation"
+			fields.Add("WARC-Segment-Origin-ID", "<urn:a0>")
+			fields.Add("WARC-Segment-Total-Length", "57")
+		}
+		if err := ww.writeRecord("1.0", fields, strings.NewReader(block), int64(len(block))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rdr, err := NewWARCReader(bytes.NewReader(buf.Bytes()), WithSegmentHeadersOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec, err := rdr.NextPayload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.Size() != 0 || rec.MIME() != "text/plain" || !rec.IsHTTP() || rec.(WARCRecord).ID() != "<urn:a0>" {
+		t.Errorf("bad merged record: size %d, MIME %s", rec.Size(), rec.MIME())
+	}
+	if rdr.continuations.mem != 0 {
+		t.Errorf("expecting no segments held, got %d bytes", rdr.continuations.mem)
+	}
+}
+
+func TestIsHTTP(t *testing.T) {
+	buf := &bytes.Buffer{}
+	ww := newWARCWriter(buf)
+	for _, r := range []struct{ typ, ct, block string }{
+		{"response", "application/http;msgtype=response", "HTTP/1.1 204 No Content\r\n\r\n"},
+		{"request", "application/http;msgtype=request", "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n"},
+		{"response", "application/http;msgtype=response", "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\n\r\nhello"},
+		{"resource", "text/plain", ""},
+		{"resource", "text/plain", "HTTP/1.1 is a protocol"},
+	} {
+		fields := RawFields{
+			{Key: "WARC-Type", Value: r.typ},
+			{Key: "WARC-Target-URI", Value: "http://example.com/"},
+			{Key: "WARC-Date", Value: "2020-01-01T00:00:00Z"},
+			{Key: "WARC-Record-ID", Value: newRecordID()},
+			{Key: "Content-Type", Value: r.ct},
+		}
+		if err := ww.writeRecord("1.0", fields, strings.NewReader(r.block), int64(len(r.block))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expect := []struct {
+		http, payload bool
+		offset        int64
+	}{{true, false, 27}, {true, false, 37}, {true, true, 45}, {false, false, 0}, {false, true, 0}}
+	rdr, err := NewWARCReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, e := range expect {
+		rec, err := rdr.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rec.IsHTTP() != e.http || rec.HasPayload() != e.payload || rec.PayloadOffset() != e.offset {
+			t.Errorf("record %d: expecting %v, got %v %v %d", i, e, rec.IsHTTP(), rec.HasPayload(), rec.PayloadOffset())
+		}
+	}
+	rdr, _ = NewWARCReader(bytes.NewReader(buf.Bytes()))
+	for _, i := range []int{0, 2, 3, 4} {
+		rec, err := rdr.NextPayload()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rec.HasPayload() != expect[i].payload || rec.PayloadOffset() != expect[i].offset {
+			t.Errorf("record %d: expecting %v after NextPayload, got %v %d", i, expect[i], rec.HasPayload(), rec.PayloadOffset())
+		}
+	}
+}
+
+func TestRecordType(t *testing.T) {
+	for _, s := range []string{"response", "Response ", "CONTINUATION"} {
+		if typ, err := ParseRecordType(s); err != nil || !typ.Valid() {
+			t.Errorf("%s: expecting a valid record type, got %v", s, err)
+		}
+	}
+	if _, err := ParseRecordType("websocket"); err != ErrRecordType {
+		t.Errorf("expecting ErrRecordType, got %v", err)
+	}
+	f, _ := os.Open("examples/hello-world.warc")
+	defer f.Close()
+	rdr, err := NewWARCReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []RecordType{TypeWarcinfo, TypeRequest, TypeResponse}
+	for _, e := range expect {
+		if _, err := rdr.Next(); err != nil {
+			t.Fatal(err)
+		}
+		if rdr.RecordType() != e {
+			t.Errorf("expecting %s, got %s", e, rdr.RecordType())
+		}
+	}
+}
+
+func TestTruncatedSkip(t *testing.T) {
+	checkExamples(t)
+	buf, _ := ioutil.ReadFile("examples/hello-world.warc")
+	// cut the file in the block of the response record, which is skipped without being read
+	cut := bytes.Index(buf, []byte("Hello World"))
+	rdr, err := NewWARCReader(struct{ io.Reader }{bytes.NewReader(buf[:cut])})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err = rdr.NextHeader(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err = rdr.NextHeader(); err != io.ErrUnexpectedEOF {
+		t.Errorf("expecting io.ErrUnexpectedEOF, got %v", err)
+	}
+}
+
+func TestHTTPResponse(t *testing.T) {
+	buf := &bytes.Buffer{}
+	ww := newWARCWriter(buf)
+	for _, r := range []struct{ typ, block string }{
+		{"response", "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhello\r\n6\r\n world\r\n0\r\n\r\n"},
+		{"response", "HTTP/1.1 404 Not Found\r\nContent-Type: text/html\r\nContent-Length: 9\r\n\r\nnot found"},
+		{"request", "GET / HTTP/1.1\r\nHost: example.com\r\n\r\n"},
+	} {
+		fields := RawFields{
+			{Key: "WARC-Type", Value: r.typ},
+			{Key: "WARC-Target-URI", Value: "http://example.com/"},
+			{Key: "WARC-Date", Value: "2020-01-01T00:00:00Z"},
+			{Key: "WARC-Record-ID", Value: newRecordID()},
+			{Key: "Content-Type", Value: "application/http;msgtype=" + r.typ},
+		}
+		if err := ww.writeRecord("1.0", fields, strings.NewReader(r.block), int64(len(r.block))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, next := range []func(*WARCReader) (Record, error){(*WARCReader).Next, (*WARCReader).NextPayload} {
+		rdr, _ := NewWARCReader(bytes.NewReader(buf.Bytes()))
+		rec, _ := next(rdr)
+		resp, err := rec.(WARCRecord).HTTPResponse()
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		if resp.StatusCode != 200 || resp.Header.Get("Content-Type") != "text/plain" || string(body) != "hello world" || resp.ContentLength != -1 {
+			t.Errorf("bad chunked response %v %q", resp, body)
+		}
+		rdr.Next()
+		resp, err = rdr.HTTPResponse()
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ = ioutil.ReadAll(resp.Body)
+		if resp.StatusCode != 404 || string(body) != "not found" || resp.ContentLength != 9 {
+			t.Errorf("bad response %v %q", resp, body)
+		}
+		rdr.Next()
+		if _, err = rdr.HTTPResponse(); !errors.Is(err, ErrHTTPResponse) {
+			t.Errorf("expecting ErrHTTPResponse for a request record, got %v", err)
+		}
+	}
+	rdr, _ := NewWARCReader(bytes.NewReader(buf.Bytes()))
+	rec, _ := rdr.Next()
+	rec.Read(make([]byte, 10))
+	if _, err := rdr.HTTPResponse(); !errors.Is(err, ErrHTTPResponse) {
+		t.Errorf("expecting ErrHTTPResponse for a record that has been read from, got %v", err)
+	}
+	rdr, _ = NewWARCReader(bytes.NewReader(buf.Bytes()))
+	rec, _ = rdr.Next()
+	sz := rec.Size()
+	if _, err := rdr.HTTPResponse(); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Size() != sz || rdr.Stripped() || rdr.RawFields().Get("Transfer-Encoding") != "" {
+		t.Errorf("expecting HTTPResponse to leave the record unchanged, got size %d (was %d) and fields %v", rec.Size(), sz, rdr.RawFields())
+	}
+	out := &bytes.Buffer{}
+	ww2, _ := NewWARCWriter(out, NoCompression)
+	if err := CopyRecord(ww2, rec); err != nil {
+		t.Fatalf("expecting a record to be copied after HTTPResponse, got %v", err)
+	}
+	if !bytes.Contains(out.Bytes(), []byte("5\r\nhello\r\n6\r\n world")) {
+		t.Errorf("expecting the copy to keep the HTTP message, got %q", out.Bytes())
+	}
+	checkExamples(t)
+	f, _ := os.Open("examples/IAH-20080430204825-00000-blackbook.arc")
+	defer f.Close()
+	ardr, _ := NewARCReader(f)
+	ardr.Next()
+	if _, err := ardr.HTTPResponse(); !errors.Is(err, ErrHTTPResponse) {
+		t.Errorf("expecting ErrHTTPResponse for a dns record, got %v", err)
+	}
+	ardr.Next()
+	resp, err := ardr.HTTPResponse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != 200 || int64(len(body)) != ardr.Size()-ardr.PayloadOffset() || len(body) == 0 {
+		t.Errorf("bad ARC response %v, body of %d bytes", resp, len(body))
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright 2015 Richard Lehane. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webarchive
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Warcinfo holds the fields of a warcinfo record's application/warc-fields block, as recommended by the
+// WARC 1.1 standard (annex C). Use Bytes to serialise it as the block of a warcinfo record.
+type Warcinfo struct {
+	Software            string // name and version of the software that wrote the file
+	Format              string // e.g. "WARC File Format 1.1"
+	ConformsTo          string // URI of the format specification
+	Operator            string // contact information for the operator of the crawl
+	Robots              string // robots policy e.g. "classic", "ignore" or "obey"
+	IsPartOf            string // name of the collection or crawl the file belongs to
+	Description         string
+	Hostname            string    // host name of the machine that wrote the file
+	IP                  string    // IP address of the machine that wrote the file
+	HTTPHeaderUserAgent string    // User-Agent header sent by the crawler
+	HTTPHeaderFrom      string    // From header sent by the crawler
+	Extra               RawFields // further fields, written after the others
+}
+
+// warcinfo keys, in the order they are written
+func (wi Warcinfo) pairs() [][2]string {
+	return [][2]string{
+		{"software", wi.Software},
+		{"format", wi.Format},
+		{"conformsTo", wi.ConformsTo},
+		{"operator", wi.Operator},
+		{"robots", wi.Robots},
+		{"isPartOf", wi.IsPartOf},
+		{"description", wi.Description},
+		{"hostname", wi.Hostname},
+		{"ip", wi.IP},
+		{"http-header-user-agent", wi.HTTPHeaderUserAgent},
+		{"http-header-from", wi.HTTPHeaderFrom},
+	}
+}
+
+// Bytes serialises the fields as "key: value" lines ending in CRLF. Empty fields are skipped.
+func (wi Warcinfo) Bytes() []byte {
+	buf := &bytes.Buffer{}
+	for _, p := range wi.pairs() {
+		if p[1] != "" {
+			buf.WriteString(p[0] + ": " + p[1] + "\r\n")
+		}
+	}
+	for _, f := range wi.Extra {
+		if f.Key != "" {
+			buf.WriteString(f.Key + ": " + f.Value + "\r\n")
+		}
+	}
+	return buf.Bytes()
+}
+
+// Validate returns an error wrapping ErrConformance that lists any recommended fields that are missing
+// (software, format, conformsTo, operator, robots and isPartOf) and notes a conformsTo that isn't an absolute URI.
+func (wi Warcinfo) Validate() error {
+	var missing []string
+	for _, p := range wi.pairs()[:6] {
+		if strings.TrimSpace(p[1]) == "" {
+			missing = append(missing, p[0])
+		}
+	}
+	var problems []string
+	if len(missing) > 0 {
+		problems = append(problems, "missing recommended warcinfo fields "+strings.Join(missing, ", "))
+	}
+	if wi.ConformsTo != "" {
+		if u, err := url.Parse(wi.ConformsTo); err != nil || u.Scheme == "" {
+			problems = append(problems, fmt.Sprintf("conformsTo %q isn't an absolute URI", wi.ConformsTo))
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrConformance, strings.Join(problems, "; "))
+}
+
+// ParseWarcinfo reads the fields of a warcinfo record's block. Fields that Warcinfo doesn't name are
+// kept in Extra.
+func ParseWarcinfo(block []byte) Warcinfo {
+	var wi Warcinfo
+	dst := map[string]*string{
+		"software":               &wi.Software,
+		"format":                 &wi.Format,
+		"conformsto":             &wi.ConformsTo,
+		"operator":               &wi.Operator,
+		"robots":                 &wi.Robots,
+		"ispartof":               &wi.IsPartOf,
+		"description":            &wi.Description,
+		"hostname":               &wi.Hostname,
+		"ip":                     &wi.IP,
+		"http-header-user-agent": &wi.HTTPHeaderUserAgent,
+		"http-header-from":       &wi.HTTPHeaderFrom,
+	}
+	for _, f := range getRawFields(block) {
+		if f.Key == "" {
+			continue
+		}
+		if p, ok := dst[strings.ToLower(f.Key)]; ok && *p == "" {
+			*p = f.Value
+			continue
+		}
+		wi.Extra = append(wi.Extra, RawField{Key: f.Key, Value: f.Value})
+	}
+	return wi
+}
@@ -0,0 +1,41 @@
+package webarchive
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestWarcinfo(t *testing.T) {
+	wi := Warcinfo{
+		Software:   "test/1.0",
+		Format:     "WARC File Format 1.1",
+		ConformsTo: "http://iipc.github.io/warc-specifications/specifications/warc-format/warc-1.1/",
+		Robots:     "classic",
+		Extra:      RawFields{{Key: "x-custom", Value: "yes"}},
+	}
+	if s := string(wi.Bytes()); s != "software: test/1.0\r\nformat: WARC File Format 1.1\r\n"+
+		"conformsTo: http://iipc.github.io/warc-specifications/specifications/warc-format/warc-1.1/\r\nrobots: classic\r\nx-custom: yes\r\n" {
+		t.Errorf("bad warcinfo block: %q", s)
+	}
+	err := wi.Validate()
+	if !errors.Is(err, ErrConformance) || !strings.Contains(err.Error(), "operator, isPartOf") {
+		t.Errorf("expecting missing operator and isPartOf, got %v", err)
+	}
+	wi.Operator, wi.IsPartOf = "Test Library", "test crawl"
+	if err = wi.Validate(); err != nil {
+		t.Error(err)
+	}
+	checkExamples(t)
+	f, _ := os.Open("examples/hello-world.warc")
+	defer f.Close()
+	rdr, _ := NewWARCReader(f)
+	rec, _ := rdr.Next()
+	b, _ := ioutil.ReadAll(rec)
+	wi = ParseWarcinfo(b)
+	if !strings.HasPrefix(wi.Software, "Wget/1.16.2") || wi.Format != "WARC File Format 1.0" || len(wi.Extra) == 0 {
+		t.Errorf("bad parse: %+v", wi)
+	}
+}
@@ -15,22 +15,84 @@
 package webarchive
 
 import (
+	"bytes"
 	"errors"
 	"io"
+	"net/url"
 	"time"
 )
 
 var (
-	ErrReset         = errors.New("webarchive: attempted reset on nil MultiReader, use NewReader() first")
-	ErrNotWebarchive = errors.New("webarchive: not a valid ARC or WARC file")
-	ErrVersionBlock  = errors.New("webarchive: invalid ARC version block")
-	ErrARCHeader     = errors.New("webarchive: invalid ARC header")
-	ErrNotSlicer     = errors.New("webarchive: underlying reader must be a slicer to expose Slice and EOFSlice methods")
-	ErrWARCHeader    = errors.New("webarchive: invalid WARC header")
-	ErrWARCRecord    = errors.New("webarchive: error parsing WARC record")
-	ErrDiscard       = errors.New("webarchive: failed to do full read during discard")
+	ErrReset             = errors.New("webarchive: attempted reset on nil MultiReader, use NewReader() first")
+	ErrNotWebarchive     = errors.New("webarchive: not a valid ARC or WARC file")
+	ErrVersionBlock      = errors.New("webarchive: invalid ARC version block")
+	ErrARCHeader         = errors.New("webarchive: invalid ARC header")
+	ErrNotSlicer         = errors.New("webarchive: underlying reader must be a slicer to expose Slice and EOFSlice methods")
+	ErrWARCHeader        = errors.New("webarchive: invalid WARC header")
+	ErrWARCRecord        = errors.New("webarchive: error parsing WARC record")
+	ErrDiscard           = errors.New("webarchive: failed to do full read during discard")
+	ErrNoParser          = errors.New("webarchive: no parser registered for field")
+	ErrNoField           = errors.New("webarchive: field not present")
+	ErrDigest            = errors.New("webarchive: invalid labelled digest")
+	ErrDigestMatch       = errors.New("webarchive: digest doesn't match record content")
+	ErrDigestAlgorithm   = errors.New("webarchive: unsupported digest algorithm")
+	ErrCompression       = errors.New("webarchive: unsupported compression")
+	ErrTargetURI         = errors.New("webarchive: target URI must be an absolute URI")
+	ErrCDPResponse       = errors.New("webarchive: no CDP response received for request")
+	ErrSignature         = errors.New("webarchive: missing or invalid record signature")
+	ErrManifest          = errors.New("webarchive: file doesn't match its manifest")
+	ErrContinuationLimit = errors.New("webarchive: segments of incomplete continuations exceed the limit")
+	ErrIndex             = errors.New("webarchive: index doesn't match archive")
+	ErrWebSocket         = errors.New("webarchive: not a WebSocket frame record")
+	ErrRecordType        = errors.New("webarchive: unknown WARC record type")
+	ErrWAT               = errors.New("webarchive: not a WAT metadata record")
+	ErrMHTML             = errors.New("webarchive: not an MHTML (multipart/related) document")
+	ErrSafari            = errors.New("webarchive: not a Safari webarchive file")
+	ErrReserialize       = errors.New("webarchive: record can't be re-serialised exactly")
+	ErrHTTPResponse      = errors.New("webarchive: record doesn't hold an HTTP response")
 )
 
+// Option configures a Reader. Options are retained when a Reader is Reset.
+type Option func(*reader)
+
+// WithMixedFormats makes a Reader created with NewReader detect the format of each record, rather than only at the
+// start of the file, so that streams made by concatenating ARC and WARC files can be read. An ARC file must begin with
+// its version block. It has no effect on Readers created with NewARCReader or NewWARCReader.
+func WithMixedFormats() Option {
+	return func(r *reader) {
+		r.mixed = true
+	}
+}
+
+// errFormat is returned by the Next methods of ARC and WARC readers in mixed mode when the next record is of the other format
+var errFormat = errors.New("webarchive: change of format")
+
+// ARC and WARC files begin with a version block or line
+func isARCStart(b []byte) bool  { return bytes.HasPrefix(b, []byte("filedesc:")) }
+func isWARCStart(b []byte) bool { return bytes.HasPrefix(b, []byte("WARC/")) }
+
+// Summary counts the records read by a Reader, for example to report on a file once Next or NextPayload
+// has returned io.EOF.
+type Summary struct {
+	Records    int   // records read by Next, including those read by NextPayload
+	Payloads   int   // payload records returned by NextPayload, with merged continuations counting once
+	Skipped    int   // records skipped by NextPayload because they aren't payload records (e.g. requests or metadata)
+	Invalid    int   // records that couldn't be read because of a malformed header
+	Incomplete int   // segmented records that NextPayload hasn't returned because they are incomplete (see WARCReader.Incomplete)
+	Bytes      int64 // length of the records read: headers and blocks, not including any padding between records
+}
+
+// ArchiveMeta is metadata about an ARC or WARC file as a whole, from the version block of an ARC file or the
+// warcinfo record at the start of a WARC file. Fields are empty if the file doesn't give them.
+type ArchiveMeta struct {
+	Format   string    // "ARC" or "WARC"
+	Version  string    // e.g. "1" for ARC files or "1.0" for WARC files
+	Filename string    // the file's name when it was written, from the ARC filedesc URL or WARC-Filename field
+	Date     time.Time // when the file was created
+	Software string    // the software that wrote the file, from the warcinfo software field (not given by ARC files)
+	Operator string    // the organisation that made the file, from the ARC origin code or warcinfo operator field
+}
+
 // Record represents both ARC and WARC records.
 type Record interface {
 	Header
@@ -39,10 +101,16 @@ type Record interface {
 
 // Header represents the common header fields shared by ARC and WARC records.
 type Header interface {
+	Type() string // WARC-Type of the record; for ARC records, "response" if the block is an HTTP message and otherwise "resource"
+	ID() string   // WARC-Record-ID of the record; empty for ARC records, which have no identifiers
 	URL() string
+	NormalizedURL() string // URL in the normal form given by NormalizeURL, without sorting query parameters
+	TargetURI() *url.URL   // URL parsed, with its Scheme and, for URIs such as "urn:" and "mailto:", Opaque part; nil if it can't be parsed
 	Date() time.Time
 	MIME() string
-	Fields() map[string][]string
+	Fields() Fields
+	RawFields() RawFields
+	Parsed(key string) (interface{}, error)
 	// private methods - used by DecodePayload
 	transferEncodings() []string
 	encodings() []string
@@ -50,6 +118,9 @@ type Header interface {
 
 // Content represents the content portion of a WARC or ARC record.
 type Content interface {
+	IsHTTP() bool         // the block is an HTTP message (its headers may have been stripped by NextPayload)
+	HasPayload() bool     // there is a non-empty payload after any HTTP headers
+	PayloadOffset() int64 // offset of the payload within the block i.e. after any HTTP headers
 	Size() int64
 	Read(p []byte) (n int, err error)
 	Slice(off int64, l int) ([]byte, error)
@@ -63,6 +134,7 @@ type Reader interface {
 	Reset(io.Reader) error
 	Next() (Record, error)
 	NextPayload() (Record, error) // skip non-resonse/resource records; merge continuations; strip non-body content from record
+	NextHeader() (Header, error)  // read only the header of the next record, skipping its block
 	Close() error
 }
 
@@ -115,10 +187,119 @@ func (m *MultiReader) Reset(r io.Reader) error {
 	return ErrNotWebarchive
 }
 
+// Next iterates to the next Record. Returns io.EOF at the end of file.
+func (m *MultiReader) Next() (Record, error) {
+	rec, err := m.Reader.Next()
+	if err == errFormat {
+		if err = m.switchFormat(); err != nil {
+			return nil, err
+		}
+		return m.Reader.Next()
+	}
+	return rec, err
+}
+
+// NextPayload iterates to the next payload record (see ARCReader.NextPayload and WARCReader.NextPayload).
+func (m *MultiReader) NextPayload() (Record, error) {
+	rec, err := m.Reader.NextPayload()
+	if err == errFormat {
+		if err = m.switchFormat(); err != nil {
+			return nil, err
+		}
+		return m.NextPayload()
+	}
+	return rec, err
+}
+
+// NextHeader iterates to the next Record, returning only its header (see WARCReader.NextHeader).
+func (m *MultiReader) NextHeader() (Header, error) {
+	hdr, err := m.Reader.NextHeader()
+	if err == errFormat {
+		if err = m.switchFormat(); err != nil {
+			return nil, err
+		}
+		return m.Reader.NextHeader()
+	}
+	return hdr, err
+}
+
+// switchFormat changes the current reader when, with WithMixedFormats, a record of the other format is next
+func (m *MultiReader) switchFormat() error {
+	var err error
+	if _, ok := m.Reader.(*WARCReader); ok {
+		if m.a == nil {
+			m.a, err = newARCReader(m.r)
+		} else {
+			err = m.a.reset()
+		}
+		m.Reader = m.a
+		return err
+	}
+	if m.w == nil {
+		m.w, err = newWARCReader(m.r)
+	} else {
+		err = m.w.reset()
+	}
+	m.Reader = m.w
+	return err
+}
+
+// ArchiveMeta returns metadata about the current file (see ArchiveMeta). With WithMixedFormats, this is
+// the metadata of the ARC or WARC file that the current record belongs to.
+func (m *MultiReader) ArchiveMeta() ArchiveMeta {
+	if _, ok := m.Reader.(*WARCReader); ok {
+		return m.w.ArchiveMeta()
+	}
+	return m.a.ArchiveMeta()
+}
+
+// Summary returns counts of the records read from the current file (see Summary).
+func (m *MultiReader) Summary() Summary {
+	s := m.r.summary
+	s.Incomplete = m.Incomplete()
+	return s
+}
+
+// FileDigest returns the digest of the current file, once it has been read to its end (see WithFileDigest).
+func (m *MultiReader) FileDigest() (Digest, bool) {
+	return m.r.FileDigest()
+}
+
+// CompressedOffset returns the offset of the gzip member holding the current record (see WARCReader.CompressedOffset).
+func (m *MultiReader) CompressedOffset() int64 {
+	return m.r.CompressedOffset()
+}
+
+// CompressedLength returns the compressed length of the gzip member holding the current record, once the record
+// has been read to its end (see WARCReader.CompressedLength).
+func (m *MultiReader) CompressedLength() int64 {
+	return m.r.CompressedLength()
+}
+
+// Close closes the underlying gzip reader if the current file is gzipped, and removes any temporary files
+// holding continuation segments spilled by WARC files (see WithContinuationLimit).
+func (m *MultiReader) Close() error {
+	if m.w != nil {
+		m.w.continuations.clear()
+	}
+	return m.r.Close()
+}
+
+// Incomplete returns the number of segmented records in WARC files that NextPayload hasn't returned because
+// they are incomplete (see WARCReader.Incomplete).
+func (m *MultiReader) Incomplete() int {
+	if m.w == nil {
+		return 0
+	}
+	return m.w.Incomplete()
+}
+
 // NewReader returns a new webarchive Reader reading from the io.Reader.
-// The supplied io.Reader can be a WARC, ARC, WARC.GZ or ARC.GZ file.
-func NewReader(r io.Reader) (Reader, error) {
-	rdr, err := newReader(r)
+// The supplied io.Reader can be a WARC, ARC, WARC.GZ or ARC.GZ file. Files compressed with bzip2 (WARC.BZ2 or
+// ARC.BZ2), or as zlib or raw deflate members, as found in some legacy archives, are also decompressed.
+// Options, such as WithFieldParser, can be given to configure the Reader.
+func NewReader(r io.Reader, opts ...Option) (Reader, error) {
+	rdr, err := newReader(r, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -11,6 +11,7 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 )
 
 func checkExamples(t *testing.T) {
@@ -170,3 +171,137 @@ func ExampleNewReader() {
 		}
 	}
 }
+
+func TestMixedFormats(t *testing.T) {
+	checkExamples(t)
+	warc, _ := ioutil.ReadFile("examples/hello-world.warc")
+	arc, _ := ioutil.ReadFile("examples/IAH-20080430204825-00000-blackbook.arc")
+	stream := append(append(append([]byte{}, warc...), arc...), warc...)
+	count := func(next func(Reader) (Record, error), opts ...Option) (int, error) {
+		rdr, err := NewReader(bytes.NewReader(stream), opts...)
+		if err != nil {
+			return 0, err
+		}
+		defer rdr.Close()
+		var n int
+		for {
+			_, err := next(rdr)
+			if err == io.EOF {
+				return n, nil
+			}
+			if err != nil {
+				return n, err
+			}
+			n++
+		}
+	}
+	next := func(r Reader) (Record, error) { return r.Next() }
+	if _, err := count(next); err == nil {
+		t.Error("expecting an error reading a mixed stream without WithMixedFormats")
+	}
+	if n, err := count(next, WithMixedFormats()); err != nil || n != 311 {
+		t.Errorf("expecting 311 records, got %d %v", n, err)
+	}
+	payload := func(r Reader) (Record, error) { return r.NextPayload() }
+	if n, err := count(payload, WithMixedFormats()); err != nil || n != 305 {
+		t.Errorf("expecting 305 payload records, got %d %v", n, err)
+	}
+}
+
+func TestSummary(t *testing.T) {
+	checkExamples(t)
+	f, _ := os.Open("examples/hello-world.warc")
+	defer f.Close()
+	info, _ := f.Stat()
+	rdr, err := NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, err = rdr.NextPayload(); err == nil; _, err = rdr.NextPayload() {
+	}
+	if err != io.EOF {
+		t.Fatal(err)
+	}
+	s := rdr.(*MultiReader).Summary()
+	// each record is followed by two CRLFs
+	expect := Summary{Records: 6, Payloads: 3, Skipped: 3, Bytes: info.Size() - 6*4}
+	if s != expect {
+		t.Errorf("expecting %+v, got %+v", expect, s)
+	}
+	rdr.Reset(strings.NewReader("WARC/1.0\r\nWARC-Date: 2015-07-08T21:55:13Z\r\nContent-Length: x\r\n\r\n"))
+	if _, err := rdr.Next(); err == nil {
+		t.Fatal("expecting an error for a bad Content-Length")
+	}
+	if s := rdr.(*MultiReader).Summary(); s != (Summary{Invalid: 1}) {
+		t.Errorf("expecting one invalid record, got %+v", s)
+	}
+}
+
+func TestNextHeader(t *testing.T) {
+	checkExamples(t)
+	for _, name := range []string{
+		"examples/IAH-20080430204825-00000-blackbook.warc",
+		"examples/IAH-20080430204825-00000-blackbook.warc.gz",
+		"examples/IAH-20080430204825-00000-blackbook.arc",
+	} {
+		var urls []string
+		f, _ := os.Open(name)
+		rdr, err := NewReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for rec, err := rdr.Next(); err == nil; rec, err = rdr.Next() {
+			urls = append(urls, rec.URL())
+		}
+		f.Seek(0, io.SeekStart)
+		if err := rdr.Reset(f); err != nil {
+			t.Fatal(err)
+		}
+		var i int
+		for hdr, err := rdr.NextHeader(); err != io.EOF; hdr, err = rdr.NextHeader() {
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			if i >= len(urls) || hdr.URL() != urls[i] {
+				t.Fatalf("%s: header %d doesn't match record", name, i)
+			}
+			i++
+		}
+		if i != len(urls) {
+			t.Errorf("%s: expecting %d headers, got %d", name, len(urls), i)
+		}
+		rdr.Close()
+		f.Close()
+	}
+}
+
+func TestArchiveMeta(t *testing.T) {
+	checkExamples(t)
+	for _, c := range []struct {
+		name string
+		meta ArchiveMeta
+	}{
+		{"examples/hello-world.warc", ArchiveMeta{Format: "WARC", Version: "1.0", Filename: "hello-world.warc.gz", Software: "Wget/1.16.2 (darwin14.1.0)"}},
+		{"examples/IAH-20080430204825-00000-blackbook.warc.gz", ArchiveMeta{Format: "WARC", Version: "0.17", Filename: "IAH-20080430204825-00000-blackbook.warc.gz", Software: "Heritrix/@VERSION@ http://crawler.archive.org", Operator: "Admin"}},
+		{"examples/IAH-20080430204825-00000-blackbook.arc", ArchiveMeta{Format: "ARC", Version: "1", Filename: "IAH-20080430204825-00000-blackbook.arc", Operator: "InternetArchive"}},
+	} {
+		f, _ := os.Open(c.name)
+		rdr, err := NewReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		meta := rdr.(*MultiReader).ArchiveMeta()
+		if meta.Date.IsZero() {
+			t.Errorf("%s: expecting a date", c.name)
+		}
+		meta.Date = time.Time{}
+		if meta != c.meta {
+			t.Errorf("%s: expecting %+v, got %+v", c.name, c.meta, meta)
+		}
+		if _, err := rdr.Next(); err != nil {
+			t.Errorf("%s: expecting ArchiveMeta not to advance the reader, got %v", c.name, err)
+		}
+		rdr.Close()
+		f.Close()
+	}
+}
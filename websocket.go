@@ -0,0 +1,101 @@
+// Copyright 2015 Richard Lehane. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webarchive
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// WebSocket frames are recorded in extension records with their own WARC-Type and a Content-Type giving the type of
+// message e.g. "application/websocket;msgtype=text". Readers and rewriters that don't know the extension pass these
+// records through unchanged.
+const (
+	webSocketType      = "websocket"
+	webSocketMIME      = "application/websocket"
+	webSocketDirection = "WARC-WebSocket-Direction" // "client" for frames sent by the browser, "server" for those received
+)
+
+// WebSocketFrame is a message sent or received over a WebSocket connection, for recording in a WARC file with
+// WriteWebSocketFrame.
+type WebSocketFrame struct {
+	URI          string    // URI of the connection e.g. "wss://example.com/socket"
+	Type         string    // "text", "binary", "close", "ping" or "pong"; "binary" if empty
+	FromServer   bool      // the frame was received from the server rather than sent by the client
+	Date         time.Time // when the frame was captured; the current time if zero
+	ConcurrentTo []string  // IDs of related records e.g. the response to the handshake that opened the connection
+	Payload      []byte
+}
+
+// WriteWebSocketFrame writes a WARC 1.0 WebSocket frame record to w, returning the ID of the record.
+// Returns ErrTargetURI if the frame's URI isn't an absolute URI.
+func WriteWebSocketFrame(w io.Writer, f WebSocketFrame) (string, error) {
+	if u, err := url.Parse(f.URI); err != nil || u.Scheme == "" {
+		return "", ErrTargetURI
+	}
+	date := f.Date
+	if date.IsZero() {
+		date = now()
+	}
+	typ := strings.ToLower(f.Type)
+	if typ == "" {
+		typ = "binary"
+	}
+	dir := "client"
+	if f.FromServer {
+		dir = "server"
+	}
+	id := newRecordID()
+	fields := RawFields{
+		{Key: "WARC-Type", Value: webSocketType},
+		{Key: "WARC-Target-URI", Value: f.URI},
+		{Key: "WARC-Date", Value: formatVersionDate("1.0", date)},
+		{Key: "WARC-Record-ID", Value: id},
+	}
+	for _, c := range f.ConcurrentTo {
+		fields.Add("WARC-Concurrent-To", bracketID(c))
+	}
+	fields.Add(webSocketDirection, dir)
+	fields.Add("Content-Type", webSocketMIME+";msgtype="+typ)
+	fields.Add("WARC-Block-Digest", sha1Digest(f.Payload).String())
+	return id, newWARCWriter(w).writeRecord("1.0", fields, bytes.NewReader(f.Payload), int64(len(f.Payload)))
+}
+
+// ReadWebSocketFrame reads the WebSocket frame held in a record returned by a Reader's Next method.
+// Returns ErrWebSocket if the record isn't a WebSocket frame record.
+func ReadWebSocketFrame(rec Record) (WebSocketFrame, error) {
+	fields := rec.Fields()
+	if !strings.EqualFold(fields.Get("WARC-Type"), webSocketType) {
+		return WebSocketFrame{}, ErrWebSocket
+	}
+	f := WebSocketFrame{
+		URI:          rec.URL(),
+		Type:         "binary",
+		FromServer:   strings.EqualFold(fields.Get(webSocketDirection), "server"),
+		Date:         rec.Date(),
+		ConcurrentTo: fields["WARC-Concurrent-To"],
+	}
+	if mt, params, err := mime.ParseMediaType(fields.Get("Content-Type")); err == nil && mt == webSocketMIME && params["msgtype"] != "" {
+		f.Type = params["msgtype"]
+	}
+	var err error
+	f.Payload, err = ioutil.ReadAll(rec)
+	return f, err
+}
@@ -0,0 +1,63 @@
+package webarchive
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestWebSocketFrame(t *testing.T) {
+	buf := &bytes.Buffer{}
+	if _, err := WriteWebSocketFrame(buf, WebSocketFrame{URI: "example.com/socket"}); err != ErrTargetURI {
+		t.Fatalf("expecting ErrTargetURI, got %v", err)
+	}
+	frames := []WebSocketFrame{
+		{URI: "wss://example.com/socket", Type: "text", ConcurrentTo: []string{"urn:uuid:1"}, Payload: []byte(`{"hello":1}`)},
+		{URI: "wss://example.com/socket", FromServer: true, Payload: []byte{0, 1, 2}},
+	}
+	for _, f := range frames {
+		if _, err := WriteWebSocketFrame(buf, f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	findings, err := Validator{Digests: true}.Validate(bytes.NewReader(buf.Bytes()))
+	if err != nil || len(findings) > 0 {
+		t.Fatalf("expecting valid records, got %v %v", findings, err)
+	}
+	// round trip through a rewrite
+	out := &bytes.Buffer{}
+	if _, err := Delete(out, bytes.NewReader(buf.Bytes()), nil, ""); err != nil {
+		t.Fatal(err)
+	}
+	rdr, err := NewReader(bytes.NewReader(out.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, expect := range frames {
+		rec, err := rdr.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, err := ReadWebSocketFrame(rec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.URI != expect.URI || f.FromServer != expect.FromServer || !bytes.Equal(f.Payload, expect.Payload) {
+			t.Errorf("%d: bad frame %v", i, f)
+		}
+		if (i == 0 && (f.Type != "text" || len(f.ConcurrentTo) != 1 || f.ConcurrentTo[0] != "<urn:uuid:1>")) || (i == 1 && f.Type != "binary") {
+			t.Errorf("%d: bad type or concurrent records %v", i, f)
+		}
+	}
+	rdr, _ = NewReader(bytes.NewReader(out.Bytes()))
+	if _, err = rdr.NextPayload(); err == nil {
+		t.Error("expecting frames not to be returned by NextPayload")
+	}
+	f, _ := os.Open("examples/hello-world.warc")
+	defer f.Close()
+	rdr, _ = NewReader(f)
+	rec, _ := rdr.Next()
+	if _, err = ReadWebSocketFrame(rec); err != ErrWebSocket {
+		t.Errorf("expecting ErrWebSocket, got %v", err)
+	}
+}
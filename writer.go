@@ -0,0 +1,1234 @@
+// Copyright 2015 Richard Lehane. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webarchive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// warcWriter serialises WARC records: version line, fields, blank line, block and
+// the two CRLFs that end each record.
+type warcWriter struct {
+	w     io.Writer
+	n     int64 // bytes written so far
+	count int   // records written so far
+	gzip  bool  // write each record as its own gzip member
+	level int   // gzip compression level; gzip.DefaultCompression unless set
+	zw    *gzip.Writer
+	zstd  bool          // write each record as its own zstd frame
+	dict  []byte        // dictionary of zstd frames
+	dg    DigestFunc    // block and payload digests of generated records; sha1Digest if nil
+	rep   *Reproducible // record IDs, dates and gzip header times of generated records, if set
+	sl    bool          // give each gzip member an "sl" extra field with its lengths
+	mbuf  bytes.Buffer  // buffers gzip members to measure them, if sl is set
+}
+
+// Compression identifies how the records of a WARC file are compressed.
+type Compression int
+
+const (
+	NoCompression   Compression = iota // an uncompressed .warc file
+	GzipCompression                    // a .warc.gz file with each record compressed as its own gzip member
+	ZstdCompression                    // a .warc.zst file with each record compressed as its own zstd frame (see RegisterZstd)
+)
+
+func newWARCWriter(w io.Writer) *warcWriter {
+	return &warcWriter{w: w, level: gzip.DefaultCompression}
+}
+
+// setCompression sets how records are compressed. Returns ErrCompression if c is not supported, or is
+// ZstdCompression and no codec is registered.
+func (w *warcWriter) setCompression(c Compression) error {
+	switch c {
+	case NoCompression, GzipCompression:
+	case ZstdCompression:
+		if zstdCodec == nil {
+			return fmt.Errorf("%w: zstd (see RegisterZstd)", ErrCompression)
+		}
+	default:
+		return ErrCompression
+	}
+	w.gzip, w.zstd = c == GzipCompression, c == ZstdCompression
+	return nil
+}
+
+func (w *warcWriter) Write(p []byte) (int, error) {
+	i, err := w.w.Write(p)
+	w.n += int64(i)
+	return i, err
+}
+
+// recordHeader serialises the version line and fields of a record, with the Content-Length field set to sz
+func recordHeader(version string, fields RawFields, sz int64) []byte {
+	if version == "" {
+		version = "1.0"
+	}
+	fields = fields.Clone()
+	fields.Set("Content-Length", strconv.FormatInt(sz, 10))
+	buf := &bytes.Buffer{}
+	buf.WriteString("WARC/" + version + "\r\n")
+	fields.WriteTo(buf)
+	if l := len(fields); l == 0 || fields[l-1].Key != "" || fields[l-1].Value != "" {
+		buf.WriteString("\r\n")
+	}
+	return buf.Bytes()
+}
+
+// recordSize returns the number of bytes an uncompressed record will occupy when written
+func recordSize(version string, fields RawFields, sz int64) int64 {
+	return int64(len(recordHeader(version, fields, sz))) + sz + 4
+}
+
+// writeRecord writes a record with the given version (e.g. "1.0"), fields and block.
+// The Content-Length field is set to sz, which must be the length of the block.
+func (w *warcWriter) writeRecord(version string, fields RawFields, block io.Reader, sz int64) error {
+	return w.writeMember(recordHeader(version, fields, sz), block, sz, "\r\n\r\n")
+}
+
+// writeMember writes a record of the given header, a block of length sz and trailer. If records are compressed, the
+// record is written as its own gzip member.
+func (w *warcWriter) writeMember(hdr []byte, block io.Reader, sz int64, trailer string) error {
+	var dst, out io.Writer = w, w // out is the destination of compressed records
+	if w.gzip && w.sl {
+		// members are compressed to a buffer, to measure them before they are written
+		w.mbuf.Reset()
+		out = &w.mbuf
+	}
+	var frame io.WriteCloser // the zstd frame, or gzip member of a registered Compressor
+	if w.zstd {
+		var err error
+		if frame, err = zstdCodec.NewWriter(w, w.dict); err != nil {
+			return err
+		}
+		dst = frame
+	} else if w.gzip && gzipCompressor != nil {
+		var mtime time.Time
+		if w.rep != nil {
+			mtime = w.rep.ModTime
+		}
+		var err error
+		if frame, err = gzipCompressor.NewWriter(out, w.level, mtime); err != nil {
+			return err
+		}
+		dst = frame
+	} else if w.gzip {
+		if w.zw == nil {
+			var err error
+			if w.zw, err = gzip.NewWriterLevel(out, w.level); err != nil {
+				return err
+			}
+		} else {
+			w.zw.Reset(out)
+		}
+		if w.rep != nil {
+			w.zw.ModTime = w.rep.ModTime
+		}
+		dst = w.zw
+	}
+	if _, err := dst.Write(hdr); err != nil {
+		return err
+	}
+	if n, err := io.CopyN(dst, block, sz); err != nil {
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		}
+		return err
+	} else if n < sz {
+		return io.ErrUnexpectedEOF
+	}
+	if _, err := io.WriteString(dst, trailer); err != nil {
+		return err
+	}
+	if frame != nil {
+		if err := frame.Close(); err != nil {
+			return err
+		}
+	} else if w.gzip {
+		if err := w.zw.Close(); err != nil {
+			return err
+		}
+	}
+	if w.gzip && w.sl {
+		if err := w.writeSkipLength(int64(len(hdr)) + sz + int64(len(trailer))); err != nil {
+			return err
+		}
+	}
+	w.count++
+	return nil
+}
+
+// gzip member header flags, and the length of the "sl" extra field
+const (
+	gzipFHCRC  = 0x02
+	gzipFEXTRA = 0x04
+	slLen      = 12 // subfield ID, length and the two lengths
+)
+
+// writeSkipLength writes the buffered gzip member of a record of ulen bytes, adding an "sl" (skip length) subfield
+// to the extra field of its header, holding the compressed length of the whole member and the uncompressed length of
+// the record as little-endian uint32s. Lengths too large for a uint32 are given as 0. A member that already has an extra
+// field or header CRC is written unchanged.
+func (w *warcWriter) writeSkipLength(ulen int64) error {
+	b := w.mbuf.Bytes()
+	if len(b) < 10 || b[3]&(gzipFEXTRA|gzipFHCRC) != 0 {
+		_, err := w.Write(b)
+		return err
+	}
+	clen := int64(len(b)) + 2 + slLen
+	hdr := make([]byte, 10, 12+slLen)
+	copy(hdr, b)
+	hdr[3] |= gzipFEXTRA
+	hdr = append(hdr, slLen, 0, 's', 'l', 8, 0)
+	for _, l := range []int64{clen, ulen} {
+		if l > math.MaxUint32 {
+			l = 0
+		}
+		hdr = append(hdr, byte(l), byte(l>>8), byte(l>>16), byte(l>>24))
+	}
+	if _, err := w.Write(hdr); err != nil {
+		return err
+	}
+	_, err := w.Write(b[10:])
+	return err
+}
+
+// WARCWriter writes WARC records to an io.Writer. The version line, Content-Length field and the CRLFs that frame each
+// record are written by the WARCWriter, so callers give only the record's fields and block.
+//
+// Example:
+//
+//	ww, _ := webarchive.NewWARCWriter(f, webarchive.GzipCompression)
+//	h := webarchive.NewRecordHeader(webarchive.TypeResource, "http://example.com/", time.Now())
+//	h.Set("Content-Type", "text/plain")
+//	err := ww.WriteRecord(h, strings.NewReader("hello world"))
+type WARCWriter struct {
+	// SegmentSize is the largest block written as a single record: larger blocks are split into a first segment and
+	// continuation records of at most SegmentSize bytes. 0 for no limit.
+	SegmentSize int64
+	// Dedup, if set, is consulted for each response record: responses with a payload captured before are written as
+	// revisit records (using the identical-payload-digest profile) that refer to the earlier capture, and retain the
+	// HTTP headers of the response but not its payload.
+	Dedup DedupStore
+	// Digests, if set, adds a WARC-Block-Digest to records that lack one and a WARC-Payload-Digest to response and
+	// resource records that lack one, computed as the block is written. Blocks that can't be read twice (i.e. aren't an
+	// io.ReadSeeker) are spooled to a temporary file while their digests are computed.
+	Digests bool
+	// DigestAlgorithm is the algorithm of the digests computed by the WARCWriter, as for DigestWith e.g. "sha256".
+	// Digests are base32 encoded. "sha1" if empty.
+	DigestAlgorithm string
+	// Reproducible, if set, supplies the record IDs, dates and gzip header times that the WARCWriter generates, so that
+	// its output can be reproduced exactly.
+	Reproducible *Reproducible
+	// SkipLengths, if set, gives each gzip member written with GzipCompression an "sl" subfield in the extra field of
+	// its header, holding the compressed length of the member and the uncompressed length of its record, so that
+	// readers can skip records without decompressing them. Members are compressed in memory to measure them.
+	SkipLengths bool
+
+	w    *warcWriter
+	info string // ID of the warcinfo record written by WriteWarcinfo
+}
+
+// NewWARCWriter returns a WARCWriter writing to w with the given compression.
+// With GzipCompression, each record is written as its own gzip member, following the IIPC convention for .warc.gz
+// files: members begin exactly at the Offset of each record, so the file can be indexed and records read by seeking.
+// Likewise, with ZstdCompression, each record is written as its own zstd frame.
+// Returns ErrCompression if the compression is not supported, or is ZstdCompression and no codec is registered.
+func NewWARCWriter(w io.Writer, c Compression) (*WARCWriter, error) {
+	ww := newWARCWriter(w)
+	if err := ww.setCompression(c); err != nil {
+		return nil, err
+	}
+	return &WARCWriter{w: ww}, nil
+}
+
+// SetZstdDictionary writes the dictionary with which the records of a .warc.zst file are compressed, as a skippable
+// frame at the start of the file. It must be called before any records are written. Returns ErrCompression if the
+// WARCWriter doesn't use ZstdCompression or has already written records.
+func (w *WARCWriter) SetZstdDictionary(dict []byte) error {
+	if !w.w.zstd || w.w.n > 0 {
+		return ErrCompression
+	}
+	if err := writeZstdDictionary(w.w, dict); err != nil {
+		return err
+	}
+	w.w.dict = dict
+	return nil
+}
+
+// WriteRecord writes a record with the fields of h and the block read from block, which may be nil for an empty block.
+// h may be a RecordHeader or a record read from a WARC file with Next, such that records can be copied with
+// WriteRecord(rec, rec). The record is written with the version of h, if it has one, or else as WARC 1.0.
+//
+// The Content-Length field is set to the length of the rest of the block: this is taken from the Len method of block if
+// it has one, or by seeking to its end, and otherwise the block is read into memory to measure it. A WARC-Record-ID and
+// WARC-Date are added if h doesn't have them. Returns ErrWARCHeader if h has no WARC-Type field, or if it is a record
+// whose HTTP headers were stripped by NextPayload.
+func (w *WARCWriter) WriteRecord(h Header, block io.Reader) error {
+	if s, ok := h.(interface{ Stripped() bool }); ok && s.Stripped() {
+		return fmt.Errorf("%w: HTTP headers were stripped by NextPayload", ErrWARCHeader)
+	}
+	var version string
+	if v, ok := h.(interface{ Version() string }); ok {
+		version = v.Version()
+	}
+	fields := h.RawFields().Clone()
+	if fields.Get("WARC-Type") == "" {
+		return fmt.Errorf("%w: no WARC-Type field", ErrWARCHeader)
+	}
+	w.w.rep, w.w.sl = w.Reproducible, w.SkipLengths
+	if fields.Get("WARC-Record-ID") == "" {
+		fields.Add("WARC-Record-ID", w.w.recordID())
+	}
+	if fields.Get("WARC-Date") == "" {
+		fields.Add("WARC-Date", formatVersionDate(version, w.w.date()))
+	}
+	if w.info != "" && fields.Get("WARC-Type") != string(TypeWarcinfo) && fields.Get("WARC-Warcinfo-ID") == "" {
+		fields.Add("WARC-Warcinfo-ID", w.info)
+	}
+	w.w.dg = nil
+	if w.DigestAlgorithm != "" {
+		dg, err := DigestWith(w.DigestAlgorithm, Base32)
+		if err != nil {
+			return err
+		}
+		w.w.dg = dg
+	}
+	var sz int64
+	var err error
+	if w.Dedup != nil && fields.Get("WARC-Type") == string(TypeResponse) {
+		fields, block, sz, err = w.dedup(version, fields, block)
+	} else {
+		block, sz, err = sizeBlock(block)
+	}
+	if err != nil {
+		return err
+	}
+	if w.Digests {
+		var done func()
+		if fields, block, done, err = w.addDigests(fields, block, sz); err != nil {
+			return err
+		}
+		defer done()
+	}
+	if w.SegmentSize > 0 && sz > w.SegmentSize {
+		return w.writeSegments(version, fields, block, sz)
+	}
+	return w.w.writeRecord(version, fields, block, sz)
+}
+
+// writeSegments splits a block of sz bytes into segment records of at most SegmentSize bytes. The first segment keeps
+// the fields of the record, and the others are continuation records that refer to it with WARC-Segment-Origin-ID; the
+// last gives the length of the whole block in WARC-Segment-Total-Length. Each segment has the digest of its own block.
+func (w *WARCWriter) writeSegments(version string, fields RawFields, block io.Reader, sz int64) error {
+	origin := fields.Get("WARC-Record-ID")
+	buf := make([]byte, w.SegmentSize)
+	for n, written := 1, int64(0); written < sz; n++ {
+		l := sz - written
+		if l > w.SegmentSize {
+			l = w.SegmentSize
+		}
+		if _, err := io.ReadFull(block, buf[:l]); err != nil {
+			if err == io.EOF {
+				return io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		seg := fields
+		if n > 1 {
+			seg = RawFields{
+				{Key: "WARC-Type", Value: string(TypeContinuation)},
+				{Key: "WARC-Record-ID", Value: w.w.recordID()},
+				{Key: "WARC-Date", Value: fields.Get("WARC-Date")},
+			}
+			for _, key := range []string{"WARC-Target-URI", "WARC-Warcinfo-ID"} {
+				if v := fields.Get(key); v != "" {
+					seg.Add(key, v)
+				}
+			}
+			seg.Add("WARC-Segment-Origin-ID", origin)
+		}
+		seg.Set("WARC-Segment-Number", strconv.Itoa(n))
+		seg.Set("WARC-Block-Digest", w.w.digest(buf[:l]).String())
+		written += l
+		if written == sz {
+			seg.Set("WARC-Segment-Total-Length", strconv.FormatInt(sz, 10))
+		}
+		if err := w.w.writeRecord(version, seg, bytes.NewReader(buf[:l]), l); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addDigests computes the digests missing from the fields of a record, returning the fields, a reader of the block
+// that begins where block did, and a function to call once the block has been written
+func (w *WARCWriter) addDigests(fields RawFields, block io.Reader, sz int64) (RawFields, io.Reader, func(), error) {
+	done := func() {}
+	var balg, palg string
+	alg := w.DigestAlgorithm
+	if alg == "" {
+		alg = "sha1"
+	}
+	if fields.Get("WARC-Block-Digest") == "" {
+		balg = alg
+	}
+	switch RecordType(fields.Get("WARC-Type")) {
+	case TypeResponse, TypeResource:
+		if fields.Get("WARC-Payload-Digest") == "" {
+			palg = alg
+		}
+	}
+	if balg == "" && palg == "" {
+		return fields, block, done, nil
+	}
+	dg := newDigester(balg, palg)
+	rs, ok := block.(io.ReadSeeker)
+	if ok {
+		start, err := rs.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, nil, done, err
+		}
+		if _, err := io.CopyN(dg, rs, sz); err != nil {
+			return nil, nil, done, err
+		}
+		if _, err := rs.Seek(start, io.SeekStart); err != nil {
+			return nil, nil, done, err
+		}
+	} else {
+		f, err := ioutil.TempFile("", "webarchive-*.block")
+		if err != nil {
+			return nil, nil, done, err
+		}
+		done = func() {
+			f.Close()
+			os.Remove(f.Name())
+		}
+		if _, err := io.CopyN(io.MultiWriter(f, dg), block, sz); err != nil {
+			done()
+			return nil, nil, func() {}, err
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			done()
+			return nil, nil, func() {}, err
+		}
+		rs = f
+	}
+	bsum, psum := dg.sums()
+	key := algorithmKey(alg)
+	if bsum != nil {
+		fields.Set("WARC-Block-Digest", Digest{Algorithm: key, Value: Base32.encode(bsum)}.String())
+	}
+	if psum != nil {
+		fields.Set("WARC-Payload-Digest", Digest{Algorithm: key, Value: Base32.encode(psum)}.String())
+	}
+	return fields, rs, done, nil
+}
+
+// sizeBlock returns the length of the rest of a block to be written: from its Len method, from the unread part of a
+// record, by seeking to its end, or else by reading it into memory. Size methods aren't used, as they give the length of
+// the whole of a reader, such as a strings.Reader, rather than the length left to be read.
+func sizeBlock(block io.Reader) (io.Reader, int64, error) {
+	switch b := block.(type) {
+	case nil:
+		return &bytes.Reader{}, 0, nil
+	case interface{ Len() int }:
+		return block, int64(b.Len()), nil
+	case interface{ unread() int64 }:
+		return block, b.unread(), nil
+	case io.Seeker:
+		if cur, err := b.Seek(0, io.SeekCurrent); err == nil {
+			end, err := b.Seek(0, io.SeekEnd)
+			if err != nil {
+				return nil, 0, err
+			}
+			_, err = b.Seek(cur, io.SeekStart)
+			return block, end - cur, err
+		}
+		// not seekable after all, such as a pipe
+	}
+	buf, err := ioutil.ReadAll(block)
+	if err != nil {
+		return nil, 0, err
+	}
+	return bytes.NewReader(buf), int64(len(buf)), nil
+}
+
+// WriteWarcinfo writes a warcinfo record describing the file, normally as its first record, with the given WARC
+// version (e.g. "1.1") and WARC-Filename, if filename isn't empty. The record is dated now, and its block is made from
+// info: a Software, Format and ConformsTo for the version, and the Hostname of the machine, are filled in if empty.
+//
+// Returns the WARC-Record-ID of the warcinfo record. Records written afterwards without a WARC-Warcinfo-ID field are
+// given one referring to it.
+func (w *WARCWriter) WriteWarcinfo(version, filename string, info Warcinfo) (string, error) {
+	if version == "" {
+		version = "1.0"
+	}
+	if info.Software == "" {
+		info.Software = software
+	}
+	if info.Format == "" {
+		info.Format = "WARC File Format " + version
+	}
+	if info.ConformsTo == "" {
+		switch version {
+		case "1.0":
+			info.ConformsTo = conformsTo10
+		case "1.1":
+			info.ConformsTo = conformsTo11
+		}
+	}
+	if info.Hostname == "" {
+		info.Hostname, _ = os.Hostname()
+	}
+	w.w.rep, w.w.sl = w.Reproducible, w.SkipLengths
+	id, err := w.w.writeWarcinfo(version, filename, info.Bytes())
+	if err != nil {
+		return "", err
+	}
+	w.info = id
+	return id, nil
+}
+
+// WarcinfoID returns the WARC-Record-ID of the warcinfo record written by WriteWarcinfo, or an empty string.
+func (w *WARCWriter) WarcinfoID() string { return w.info }
+
+// Count returns the number of records written.
+func (w *WARCWriter) Count() int { return w.w.count }
+
+// Offset returns the number of bytes written, which is the offset at which the next record will begin.
+func (w *WARCWriter) Offset() int64 { return w.w.n }
+
+// RollingWriter writes WARC records to a sequence of outputs, starting a new output once the current one reaches a
+// size or number of records, so that a long crawl is written as files of a manageable size. Each output begins with a
+// warcinfo record made from the RollingWriter's Warcinfo (see WARCWriter.WriteWarcinfo), which the records in it refer
+// to with WARC-Warcinfo-ID. The segments of a record are never split between outputs.
+//
+// Close must be called to close the last output. A RollingWriter is safe for concurrent use: records are written one
+// at a time.
+//
+// Example:
+//
+//	rw, _ := webarchive.NewRollingWriter(webarchive.TimestampFileOutputs("out", "crawl", webarchive.GzipCompression),
+//		webarchive.GzipCompression, 1<<30, 0, webarchive.Warcinfo{Operator: "archive@example.com"})
+//	defer rw.Close()
+type RollingWriter struct {
+	SegmentSize     int64         // as for the WARCWriter of each output
+	Dedup           DedupStore    // as for the WARCWriter of each output
+	Reproducible    *Reproducible // as for the WARCWriter of each output
+	SkipLengths     bool          // as for the WARCWriter of each output
+	Digests         bool          // as for the WARCWriter of each output
+	DigestAlgorithm string        // as for the WARCWriter of each output
+
+	mu         sync.Mutex
+	out        *rotator
+	c          Compression
+	maxSize    int64
+	maxRecords int
+	info       Warcinfo
+	ww         *WARCWriter // writer of the current output
+	names      []string
+}
+
+// NewRollingWriter returns a RollingWriter that writes records to outputs with the given compression. A new output is
+// started once the current one reaches maxSize bytes or holds maxRecords records (not counting its warcinfo record);
+// either may be 0 for no limit. Returns ErrCompression if the compression is not supported.
+func NewRollingWriter(outputs Outputs, c Compression, maxSize int64, maxRecords int, info Warcinfo) (*RollingWriter, error) {
+	if err := newWARCWriter(nil).setCompression(c); err != nil {
+		return nil, err
+	}
+	return &RollingWriter{
+		out:        &rotator{outputs: outputs},
+		c:          c,
+		maxSize:    maxSize,
+		maxRecords: maxRecords,
+		info:       info,
+	}, nil
+}
+
+// WriteRecord writes a record as WARCWriter.WriteRecord does, first starting a new output if the current one is full.
+// The warcinfo record of a new output has the WARC version of the record.
+func (rw *RollingWriter) WriteRecord(h Header, block io.Reader) error {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	if rw.ww == nil || (rw.maxSize > 0 && rw.ww.Offset() >= rw.maxSize) ||
+		(rw.maxRecords > 0 && rw.ww.Count()-1 >= rw.maxRecords) {
+		if err := rw.rotate(h); err != nil {
+			return err
+		}
+	}
+	rw.ww.SegmentSize, rw.ww.Dedup = rw.SegmentSize, rw.Dedup
+	rw.ww.Reproducible, rw.ww.SkipLengths = rw.Reproducible, rw.SkipLengths
+	rw.ww.Digests, rw.ww.DigestAlgorithm = rw.Digests, rw.DigestAlgorithm
+	return rw.ww.WriteRecord(h, block)
+}
+
+// rotate starts a new output with a warcinfo record of the version of h
+func (rw *RollingWriter) rotate(h Header) error {
+	rw.ww = nil
+	if err := rw.out.rotate(); err != nil {
+		return err
+	}
+	rw.out.setCompression(rw.c)
+	rw.names = append(rw.names, rw.out.name)
+	ww := &WARCWriter{
+		Reproducible:    rw.Reproducible,
+		SkipLengths:     rw.SkipLengths,
+		Digests:         rw.Digests,
+		DigestAlgorithm: rw.DigestAlgorithm,
+		w:               rw.out.warcWriter,
+	}
+	var version string
+	if v, ok := h.(interface{ Version() string }); ok {
+		version = v.Version()
+	}
+	if _, err := ww.WriteWarcinfo(version, rw.out.name, rw.info); err != nil {
+		return err
+	}
+	rw.ww = ww
+	return nil
+}
+
+// Names returns the names of the outputs written so far, in order.
+func (rw *RollingWriter) Names() []string {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	return append([]string(nil), rw.names...)
+}
+
+// Close closes the current output. Records written after Close are written to a new output.
+func (rw *RollingWriter) Close() error {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	rw.ww = nil
+	return rw.out.close()
+}
+
+// Writer is implemented by WARCWriter and RollingWriter.
+type Writer interface {
+	WriteRecord(h Header, block io.Reader) error
+}
+
+// CopyRecord streams a record returned by a Reader's Next method to w, without holding its block in memory (unless
+// w deduplicates responses). The fields of WARC records are kept as they were read, with their original spelling and
+// order. As the compression of the output is that of w, copying records to a writer with another compression
+// recompresses them e.g. from a .warc file to a .warc.gz file with each record as its own gzip member.
+//
+// ARC records are copied as WARC 1.0 response records, if they hold an HTTP response, or else resource records.
+// Returns ErrReserialize for records whose block has already been read, and ErrWARCHeader for records whose HTTP
+// headers were stripped by NextPayload.
+func CopyRecord(w Writer, rec Record) error {
+	switch r := rec.(type) {
+	case *WARCReader:
+		if r.thisIdx > 0 {
+			return ErrReserialize
+		}
+	case *ARCReader:
+		if r.thisIdx > 0 {
+			return ErrReserialize
+		}
+		if len(r.RawFields()) > 0 {
+			return fmt.Errorf("%w: HTTP headers were stripped by NextPayload", ErrWARCHeader)
+		}
+		typ, ct := TypeResource, r.MIME()
+		if ct == "" || ct == "no-type" {
+			ct = "application/octet-stream"
+		}
+		if r.IsHTTP() {
+			typ, ct = TypeResponse, "application/http;msgtype=response"
+		}
+		h := NewRecordHeader(typ, r.URL(), r.Date())
+		if ip := r.IP(); ip != "" && ip != "0.0.0.0" {
+			h.Set("WARC-IP-Address", ip)
+		}
+		h.Set("Content-Type", ct)
+		return w.WriteRecord(h, r)
+	}
+	return w.WriteRecord(rec, rec)
+}
+
+// RecordHeader holds the fields of a record to be written by a WARCWriter. It satisfies the Header interface.
+type RecordHeader struct {
+	version string
+	date    time.Time
+	fields  RawFields
+}
+
+// NewRecordHeader returns a RecordHeader for a WARC 1.0 record of the given type, with a new WARC-Record-ID, a WARC-Date
+// of date and, if uri isn't empty, a WARC-Target-URI field. Other fields can be added with Set and Add.
+func NewRecordHeader(typ RecordType, uri string, date time.Time) *RecordHeader {
+	h := &RecordHeader{version: "1.0", date: date, fields: RawFields{
+		{Key: "WARC-Type", Value: string(typ)},
+		{Key: "WARC-Record-ID", Value: newRecordID()},
+		{Key: "WARC-Date", Value: formatVersionDate("1.0", date)},
+	}}
+	if uri != "" {
+		h.fields.Add("WARC-Target-URI", uri)
+	}
+	return h
+}
+
+// SetVersion sets the WARC version of the record e.g. "1.1", and formats the WARC-Date for that version: for WARC 1.1
+// records, it retains any fractional seconds of the date the header was created with.
+func (h *RecordHeader) SetVersion(version string) {
+	h.version = version
+	h.fields.Set("WARC-Date", formatVersionDate(version, h.date))
+}
+
+// SetRefersTo sets the fields that refer a revisit record to the capture it revisits: WARC-Refers-To, if id isn't
+// empty, and for records of WARC 1.1 and later the WARC-Refers-To-Target-URI and WARC-Refers-To-Date of the capture.
+// Call SetVersion first for WARC 1.1 records.
+func (h *RecordHeader) SetRefersTo(id, uri string, date time.Time) {
+	if id != "" {
+		h.fields.Set("WARC-Refers-To", id)
+	}
+	if h.version == "1.0" || h.version == "" {
+		return
+	}
+	h.fields.Set("WARC-Refers-To-Target-URI", uri)
+	h.fields.Set("WARC-Refers-To-Date", formatVersionDate(h.version, date))
+}
+
+// NewConversionRecord returns a RecordHeader for a conversion record: an alternative version of the content of
+// original, such as an image migrated from an obsolete format, in the media type contentType. The record has the
+// target URI of the original and refers to it with WARC-Refers-To, and has the WARC version of original if it has
+// one. It is dated date, the time of the conversion. The converted content is written as its block e.g.
+//
+//	h, _ := webarchive.NewConversionRecord(rec, "image/png", time.Now())
+//	err := ww.WriteRecord(h, bytes.NewReader(png))
+//
+// Returns ErrWARCHeader if original has no WARC-Record-ID, as when it is read from an ARC file.
+func NewConversionRecord(original Header, contentType string, date time.Time) (*RecordHeader, error) {
+	id := original.ID()
+	if id == "" {
+		return nil, fmt.Errorf("%w: original has no WARC-Record-ID", ErrWARCHeader)
+	}
+	h := NewRecordHeader(TypeConversion, original.URL(), date)
+	if v, ok := original.(interface{ Version() string }); ok && v.Version() != "" {
+		h.SetVersion(v.Version())
+	}
+	h.Set("WARC-Refers-To", id)
+	h.Set("Content-Type", contentType)
+	return h, nil
+}
+
+// Version returns the WARC version of the record.
+func (h *RecordHeader) Version() string { return h.version }
+
+// Type returns the WARC-Type of the record.
+func (h *RecordHeader) Type() string { return h.fields.Get("WARC-Type") }
+
+// ID returns the WARC-Record-ID of the record, for use in the WARC-Concurrent-To or WARC-Refers-To fields of others.
+func (h *RecordHeader) ID() string { return h.fields.Get("WARC-Record-ID") }
+
+// Set sets a field, replacing any existing values.
+func (h *RecordHeader) Set(key, value string) { h.fields.Set(key, value) }
+
+// Add adds a field, retaining any existing values.
+func (h *RecordHeader) Add(key, value string) { h.fields.Add(key, value) }
+
+// Del removes all values of a field.
+func (h *RecordHeader) Del(key string) { h.fields.Del(key) }
+
+// URL returns the WARC-Target-URI of the record.
+func (h *RecordHeader) URL() string {
+	return strings.TrimSuffix(strings.TrimPrefix(h.fields.Get("WARC-Target-URI"), "<"), ">")
+}
+
+// NormalizedURL returns the WARC-Target-URI of the record in the normal form given by NormalizeURL.
+func (h *RecordHeader) NormalizedURL() string { return NormalizeURL(h.URL(), false) }
+
+// TargetURI returns the parsed WARC-Target-URI of the record, or nil if it can't be parsed.
+func (h *RecordHeader) TargetURI() *url.URL { return parseTargetURI(h.URL()) }
+
+// Date returns the WARC-Date of the record.
+func (h *RecordHeader) Date() time.Time {
+	t, _ := ParseWARCDate(h.fields.Get("WARC-Date"))
+	return t
+}
+
+// MIME returns the WARC-Identified-Payload-Type of the record, or else its Content-Type.
+func (h *RecordHeader) MIME() string {
+	if mt := h.fields.Get("WARC-Identified-Payload-Type"); mt != "" {
+		return mt
+	}
+	return h.fields.Get("Content-Type")
+}
+
+// Fields returns the fields of the record as a map of canonical keys to values.
+func (h *RecordHeader) Fields() Fields {
+	buf := &bytes.Buffer{}
+	h.fields.WriteTo(buf)
+	return getAllValues(buf.Bytes())
+}
+
+// RawFields returns a copy of the fields of the record in the order they were added.
+func (h *RecordHeader) RawFields() RawFields { return h.fields.Clone() }
+
+// Parsed returns ErrNoParser: there are no field parsers for records being written.
+func (h *RecordHeader) Parsed(key string) (interface{}, error) { return nil, ErrNoParser }
+
+func (h *RecordHeader) transferEncodings() []string { return nil }
+
+func (h *RecordHeader) encodings() []string { return nil }
+
+// ARCWriter writes ARC files: a version block describing the file, followed by URL records.
+// Both version 1 and version 2 URL records are supported, as given by the Version of the ARC the writer is created with.
+//
+// Example:
+//
+//	aw, _ := webarchive.NewARCWriter(f, webarchive.NoCompression, webarchive.ARC{FileDesc: "crawl.arc", Version: 1}, nil)
+//	err := aw.WriteRecord(webarchive.ARCURLRecord{URL: "http://example.com/", Date: time.Now(), MIME: "text/plain"},
+//		strings.NewReader("hello world"))
+type ARCWriter struct {
+	w        *warcWriter
+	version  int
+	filename string
+}
+
+// ARCURLRecord holds the fields of the URL record line that begins each record of an ARC file.
+type ARCURLRecord struct {
+	URL        string    // URL of the record; spaces are escaped as %20
+	IP         string    // IP address of the server; "0.0.0.0" if empty
+	Date       time.Time // archive date of the record
+	MIME       string    // media type of the record, without parameters; "no-type" if empty
+	StatusCode int       // HTTP status code (version 2 only)
+	Checksum   string    // checksum of the record (version 2 only); "-" if empty
+	Location   string    // redirect location (version 2 only); "-" if empty
+}
+
+// ARCURLRecordOf returns the URL record fields of a record read from an ARC or WARC file, for copying it with an
+// ARCWriter. For WARC records, the IP is taken from the WARC-IP-Address field.
+func ARCURLRecordOf(h Header) ARCURLRecord {
+	u := ARCURLRecord{URL: h.URL(), Date: h.Date(), MIME: h.MIME()}
+	a, ok := h.(*ARCReader)
+	if !ok {
+		u.IP = h.RawFields().Get("WARC-IP-Address")
+		return u
+	}
+	u.IP = a.IP()
+	if u2, ok := a.arcHeader.(*url2); ok {
+		u.StatusCode, u.Checksum, u.Location = u2.statusCode, u2.checksum, u2.location
+	}
+	return u
+}
+
+// NewARCWriter returns an ARCWriter writing to w with the given compression. The version block of the file is written
+// immediately, from the fields of arc and any metadata (such as the XML arcmetadata block written by Heritrix).
+// A FileDesc without the "filedesc://" prefix is given it, and the version 2 Filename fields of records are taken from
+// the FileDesc. Returns ErrCompression if the compression isn't supported, and ErrVersionBlock if the Version isn't
+// 1 or 2 (a zero Version is taken as 1).
+func NewARCWriter(w io.Writer, c Compression, arc ARC, metadata []byte) (*ARCWriter, error) {
+	ww := newWARCWriter(w)
+	if err := ww.setCompression(c); err != nil {
+		return nil, err
+	}
+	if arc.Version == 0 {
+		arc.Version = 1
+	}
+	if arc.Version != 1 && arc.Version != 2 {
+		return nil, ErrVersionBlock
+	}
+	aw := &ARCWriter{w: ww, version: arc.Version, filename: strings.TrimPrefix(arc.FileDesc, "filedesc://")}
+	if arc.FileDate.IsZero() {
+		arc.FileDate = now()
+	}
+	origin := arc.OriginCode
+	if origin == "" {
+		origin = "-"
+	}
+	var body string
+	if arc.Version == 1 {
+		// the reserved field is 1 for files with an arcmetadata block, per Heritrix
+		reserved := "0"
+		if len(metadata) > 0 {
+			reserved = "1"
+		}
+		body = "1 " + reserved + " " + origin + "\nURL IP-address Archive-date Content-type Archive-length\n"
+	} else {
+		body = "2 0 " + origin + "\nURL IP-address Archive-date Content-type Result-code Checksum Location Offset Filename Archive-length\n"
+	}
+	block := io.MultiReader(strings.NewReader(body), bytes.NewReader(metadata))
+	desc := ARCURLRecord{URL: "filedesc://" + aw.filename, IP: arc.Address, Date: arc.FileDate, MIME: "text/plain", StatusCode: 200}
+	if err := aw.write(desc, block, int64(len(body)+len(metadata))); err != nil {
+		return nil, err
+	}
+	return aw, nil
+}
+
+// WriteRecord writes a URL record with the fields of u and the block read from block, which may be nil for an empty
+// block. The Archive-length field is set to the length of the rest of the block, which is taken from its Len method if
+// it has one, or by seeking to its end, and otherwise by reading the block into memory. The Offset field of version 2
+// records is set by the ARCWriter.
+func (w *ARCWriter) WriteRecord(u ARCURLRecord, block io.Reader) error {
+	block, sz, err := sizeBlock(block)
+	if err != nil {
+		return err
+	}
+	return w.write(u, block, sz)
+}
+
+func (w *ARCWriter) write(u ARCURLRecord, block io.Reader, sz int64) error {
+	fields := []string{strings.Replace(u.URL, " ", "%20", -1), arcField(u.IP, "0.0.0.0"), u.Date.UTC().Format(ARCTime)}
+	mime := u.MIME
+	if i := strings.IndexByte(mime, ';'); i > -1 {
+		mime = mime[:i]
+	}
+	fields = append(fields, arcField(mime, "no-type"))
+	if w.version == 2 {
+		fields = append(fields, strconv.Itoa(u.StatusCode), arcField(u.Checksum, "-"), arcField(u.Location, "-"),
+			strconv.FormatInt(w.w.n, 10), arcField(w.filename, "-"))
+	}
+	fields = append(fields, strconv.FormatInt(sz, 10))
+	return w.w.writeMember([]byte(strings.Join(fields, " ")+"\n"), block, sz, "\n")
+}
+
+// arcField returns a value for a URL record line, which can't contain spaces, or def if it is empty
+func arcField(s, def string) string {
+	if s = strings.Join(strings.Fields(s), ""); s == "" {
+		return def
+	}
+	return s
+}
+
+// Count returns the number of URL records written, not counting the version block.
+func (w *ARCWriter) Count() int { return w.w.count - 1 }
+
+// Offset returns the number of bytes written, which is the offset at which the next record will begin.
+func (w *ARCWriter) Offset() int64 { return w.w.n }
+
+// Outputs opens the nth (counting from 0) output file for operations that write more than one WARC file.
+// It returns the name of the file, which is recorded in the WARC-Filename field of warcinfo records,
+// and a writer for the file.
+type Outputs func(n int) (string, io.WriteCloser, error)
+
+// FileOutputs returns Outputs that create files in dir, named with the given prefix and a serial number
+// e.g. "merged-00000.warc". Files are given the extension of the compression of the records written to them, as for
+// TimestampFileOutputs: a Splitter of a .warc.gz file writes GzipCompression.
+func FileOutputs(dir, prefix string, c Compression) Outputs {
+	ext := fileExt(c)
+	return func(n int) (string, io.WriteCloser, error) {
+		name := fmt.Sprintf("%s-%05d%s", prefix, n, ext)
+		f, err := os.Create(filepath.Join(dir, name))
+		return name, f, err
+	}
+}
+
+// TimestampFileOutputs returns Outputs that create files in dir named by the usual convention for crawls: the prefix,
+// the time the file was opened (in UTC, to the millisecond) and a serial number e.g.
+// "crawl-20200102030405006-00000.warc". Files have a ".warc.gz" extension for GzipCompression, and ".warc.zst" for
+// ZstdCompression.
+func TimestampFileOutputs(dir, prefix string, c Compression) Outputs {
+	ext := fileExt(c)
+	return func(n int) (string, io.WriteCloser, error) {
+		ts := strings.Replace(now().UTC().Format("20060102150405.000"), ".", "", 1)
+		name := fmt.Sprintf("%s-%s-%05d%s", prefix, ts, n, ext)
+		f, err := os.Create(filepath.Join(dir, name))
+		return name, f, err
+	}
+}
+
+// fileExt returns the extension of WARC files with compression c
+func fileExt(c Compression) string {
+	switch c {
+	case GzipCompression:
+		return ".warc.gz"
+	case ZstdCompression:
+		return ".warc.zst"
+	}
+	return ".warc"
+}
+
+// AtomicFile is a file that is written under a temporary name, in the directory of its final name, and renamed to its
+// final name when closed. A job that is interrupted leaves only the temporary file (named with a leading "." and a
+// ".tmp" extension) rather than a half-written file that looks like a complete archive.
+type AtomicFile struct {
+	*os.File
+	name string // final name
+	sync bool
+	done bool
+}
+
+// CreateAtomic creates an AtomicFile that will be renamed to name when closed. As with os.Create, the file has mode
+// 0666 before the umask is applied. If sync is set, the file is flushed to stable storage before it is renamed, and its
+// directory after.
+func CreateAtomic(name string, sync bool) (*AtomicFile, error) {
+	// not ioutil.TempFile, which creates files with mode 0600
+	var rnd [8]byte
+	for i := 0; ; i++ {
+		rand.Read(rnd[:])
+		tmp := filepath.Join(filepath.Dir(name), fmt.Sprintf(".%s.%x.tmp", filepath.Base(name), rnd))
+		f, err := os.OpenFile(tmp, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+		if err == nil {
+			return &AtomicFile{File: f, name: name, sync: sync}, nil
+		}
+		if !os.IsExist(err) || i == 100 {
+			return nil, err
+		}
+	}
+}
+
+// Name returns the final name of the file.
+func (a *AtomicFile) Name() string { return a.name }
+
+// Close closes the file and renames it to its final name, replacing any existing file of that name.
+func (a *AtomicFile) Close() error {
+	if a.done {
+		return os.ErrClosed
+	}
+	a.done = true
+	var err error
+	if a.sync {
+		err = a.File.Sync()
+	}
+	if cerr := a.File.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(a.File.Name())
+		return err
+	}
+	if err = os.Rename(a.File.Name(), a.name); err != nil {
+		os.Remove(a.File.Name())
+		return err
+	}
+	if a.sync {
+		if d, err := os.Open(filepath.Dir(a.name)); err == nil {
+			d.Sync() // not supported on all platforms
+			d.Close()
+		}
+	}
+	return nil
+}
+
+// Abort closes and removes the file without renaming it, for use when a job fails. After Close, Abort does nothing.
+func (a *AtomicFile) Abort() error {
+	if a.done {
+		return nil
+	}
+	a.done = true
+	a.File.Close()
+	return os.Remove(a.File.Name())
+}
+
+// AtomicFileOutputs returns Outputs that create files as FileOutputs does, but with CreateAtomic.
+// Operations writing to the outputs abort the file they are writing if they fail.
+func AtomicFileOutputs(dir, prefix string, c Compression, sync bool) Outputs {
+	ext := fileExt(c)
+	return func(n int) (string, io.WriteCloser, error) {
+		name := fmt.Sprintf("%s-%05d%s", prefix, n, ext)
+		f, err := CreateAtomic(filepath.Join(dir, name), sync)
+		return name, f, err
+	}
+}
+
+// rotator writes records to a sequence of outputs
+type rotator struct {
+	outputs Outputs
+	serial  int    // number of outputs opened
+	name    string // name of the current output
+	c       io.WriteCloser
+	*warcWriter
+}
+
+// rotate closes the current output, if any, and opens the next one
+func (r *rotator) rotate() error {
+	if err := r.close(); err != nil {
+		return err
+	}
+	var err error
+	r.name, r.c, err = r.outputs(r.serial)
+	if err != nil {
+		return err
+	}
+	r.serial++
+	r.warcWriter = newWARCWriter(r.c)
+	return nil
+}
+
+func (r *rotator) close() error {
+	if r.c == nil {
+		return nil
+	}
+	err := r.c.Close()
+	r.c, r.warcWriter = nil, nil
+	return err
+}
+
+// abort the current output, if any, when an operation fails: outputs that can be aborted (e.g. an AtomicFile)
+// are discarded, others are closed
+func (r *rotator) abort() {
+	if a, ok := r.c.(interface{ Abort() error }); ok {
+		a.Abort()
+		r.c, r.warcWriter = nil, nil
+		return
+	}
+	r.close()
+}
+
+// now is the clock used for the WARC-Date of generated records
+var now = time.Now
+
+// newRecordID returns a new random (version 4) UUID in the form used for WARC-Record-ID.
+func newRecordID() string {
+	var u [16]byte
+	rand.Read(u[:])
+	u[6] = (u[6] & 0x0f) | 0x40
+	u[8] = (u[8] & 0x3f) | 0x80
+	return fmt.Sprintf("<urn:uuid:%x-%x-%x-%x-%x>", u[0:4], u[4:6], u[6:8], u[8:10], u[10:])
+}
+
+// Reproducible supplies the values that a writer would otherwise generate afresh each time it is run, so that an
+// archive built twice from the same inputs is byte-identical, for testing and fixity workflows. WARC-Record-IDs are
+// taken from IDs rather than being random, WARC-Dates from Clock rather than the time of writing, and each gzip member
+// has a header with ModTime. Give a Warcinfo a Hostname for the warcinfo records of a writer to be reproducible too.
+// Records that have their own ID and date keep them: as a RecordHeader is given an ID when it is made, Set its
+// WARC-Record-ID (e.g. from the same IDs) for it to be reproducible.
+//
+// Example:
+//
+//	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+//	ww.Reproducible = &webarchive.Reproducible{
+//		IDs:     webarchive.SeededIDs("build-1"),
+//		Clock:   func() time.Time { return start },
+//		ModTime: start,
+//	}
+type Reproducible struct {
+	IDs     func() string    // returns each new WARC-Record-ID, like SeededIDs; random UUIDs if nil
+	Clock   func() time.Time // returns the WARC-Date of records that don't have one; the current time if nil
+	ModTime time.Time        // modification time in the header of each gzip member; none if zero
+}
+
+// SeededIDs returns a source of WARC-Record-IDs for Reproducible: a sequence of name-based (version 5) UUIDs derived
+// from seed, which is the same each time the sequence is made with that seed.
+func SeededIDs(seed string) func() string {
+	var n uint64
+	return func() string {
+		n++
+		h := sha1.Sum([]byte(seed + "\x00" + strconv.FormatUint(n, 10)))
+		u := h[:16]
+		u[6] = (u[6] & 0x0f) | 0x50
+		u[8] = (u[8] & 0x3f) | 0x80
+		return fmt.Sprintf("<urn:uuid:%x-%x-%x-%x-%x>", u[0:4], u[4:6], u[6:8], u[8:10], u[10:])
+	}
+}
+
+// recordID returns the WARC-Record-ID of a generated record
+func (w *warcWriter) recordID() string {
+	if w.rep != nil && w.rep.IDs != nil {
+		return w.rep.IDs()
+	}
+	return newRecordID()
+}
+
+// date returns the WARC-Date of a generated record
+func (w *warcWriter) date() time.Time {
+	if w.rep != nil && w.rep.Clock != nil {
+		return w.rep.Clock()
+	}
+	return now()
+}
+
+// write a warcinfo record with the given application/warc-fields block, returning its ID
+func (w *warcWriter) writeWarcinfo(version, filename string, block []byte) (string, error) {
+	id := w.recordID()
+	fields := RawFields{
+		{Key: "WARC-Type", Value: "warcinfo"},
+		{Key: "WARC-Date", Value: formatVersionDate(version, w.date())},
+		{Key: "WARC-Record-ID", Value: id},
+	}
+	if filename != "" {
+		fields.Add("WARC-Filename", filename)
+	}
+	fields.Add("Content-Type", "application/warc-fields")
+	return id, w.writeRecord(version, fields, bytes.NewReader(block), int64(len(block)))
+}
+
+// digest computes the digest of a generated record's block or payload
+func (w *warcWriter) digest(b []byte) Digest {
+	if w.dg == nil {
+		return sha1Digest(b)
+	}
+	return w.dg(b)
+}
+
+// exchange is an HTTP request and response to be written as a response record and a request record concurrent to it
+type exchange struct {
+	uri      string    // WARC-Target-URI
+	date     time.Time // WARC-Date
+	ip       string    // WARC-IP-Address; omitted if empty
+	warcinfo string    // WARC-Warcinfo-ID; omitted if empty
+	protocol []string  // WARC-Protocol fields
+	cipher   string    // WARC-Cipher-Suite; omitted if empty
+	req      []byte    // request message
+	resp     []byte    // response message
+	payload  []byte    // entity body of the response, for the WARC-Payload-Digest
+}
+
+// writeExchange writes the response and request records of an exchange
+func (w *warcWriter) writeExchange(version string, e exchange) error {
+	respID := w.recordID()
+	for _, m := range []struct {
+		typ, id, ct string
+		block       []byte
+	}{
+		{"response", respID, "application/http;msgtype=response", e.resp},
+		{"request", w.recordID(), "application/http;msgtype=request", e.req},
+	} {
+		fields := RawFields{
+			{Key: "WARC-Type", Value: m.typ},
+			{Key: "WARC-Record-ID", Value: m.id},
+			{Key: "WARC-Date", Value: formatVersionDate(version, e.date)},
+			{Key: "WARC-Target-URI", Value: e.uri},
+		}
+		if m.typ == "request" {
+			fields.Add("WARC-Concurrent-To", respID)
+		}
+		if e.ip != "" {
+			fields.Add("WARC-IP-Address", e.ip)
+		}
+		if e.warcinfo != "" {
+			fields.Add("WARC-Warcinfo-ID", e.warcinfo)
+		}
+		for _, p := range e.protocol {
+			fields.Add("WARC-Protocol", p)
+		}
+		if e.cipher != "" {
+			fields.Add("WARC-Cipher-Suite", e.cipher)
+		}
+		fields.Add("Content-Type", m.ct)
+		fields.Add("WARC-Block-Digest", w.digest(m.block).String())
+		if m.typ == "response" {
+			fields.Add("WARC-Payload-Digest", w.digest(e.payload).String())
+		}
+		if err := w.writeRecord(version, fields, bytes.NewReader(m.block), int64(len(m.block))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,785 @@
+package webarchive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+func TestAtomicFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "webarchive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "out.warc")
+	f, err := CreateAtomic(name, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("WARC/1.0\r\n")
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Fatal("expecting file not to exist before Close")
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := ioutil.ReadFile(name); err != nil || string(b) != "WARC/1.0\r\n" {
+		t.Fatalf("expecting file to be renamed on Close, got %q %v", b, err)
+	}
+	plain := filepath.Join(dir, "plain")
+	pf, _ := os.Create(plain)
+	pf.Close()
+	pinfo, _ := os.Stat(plain)
+	os.Remove(plain)
+	if info, _ := os.Stat(name); info.Mode() != pinfo.Mode() {
+		t.Errorf("expecting the mode of a file made by os.Create, %v, got %v", pinfo.Mode(), info.Mode())
+	}
+	if err := f.Abort(); err != nil {
+		t.Errorf("expecting Abort after Close to do nothing, got %v", err)
+	}
+	_, wc, err := AtomicFileOutputs(dir, "aborted", NoCompression, false)(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := &rotator{c: wc}
+	out.abort()
+	entries, _ := ioutil.ReadDir(dir)
+	if len(entries) != 1 || entries[0].Name() != "out.warc" {
+		t.Errorf("expecting aborted output to be removed, got %v", entries)
+	}
+}
+
+func TestWARCWriter(t *testing.T) {
+	buf := &bytes.Buffer{}
+	ww, err := NewWARCWriter(buf, GzipCompression)
+	if err != nil {
+		t.Fatal(err)
+	}
+	date := time.Date(2020, 1, 2, 3, 4, 5, 600000000, time.UTC)
+	res := NewRecordHeader(TypeResource, "http://example.com/", date)
+	res.SetVersion("1.1")
+	res.Set("Content-Type", "text/plain")
+	if err := ww.WriteRecord(res, strings.NewReader("hello world")); err != nil {
+		t.Fatal(err)
+	}
+	meta := NewRecordHeader(TypeMetadata, "", date)
+	meta.Set("WARC-Concurrent-To", res.ID())
+	meta.Set("Content-Type", "application/warc-fields")
+	if err := ww.WriteRecord(meta, ioutil.NopCloser(strings.NewReader("via: test\r\n"))); err != nil {
+		t.Fatal(err)
+	}
+	if err := ww.WriteRecord(&RecordHeader{}, nil); !errors.Is(err, ErrWARCHeader) {
+		t.Errorf("expecting ErrWARCHeader for a record without a type, got %v", err)
+	}
+	if ww.Count() != 2 || ww.Offset() != int64(buf.Len()) {
+		t.Fatalf("expecting 2 records and %d bytes, got %d and %d", buf.Len(), ww.Count(), ww.Offset())
+	}
+	fields, blocks := readAll(t, buf.Bytes())
+	if len(fields) != 2 {
+		t.Fatalf("expecting 2 records, got %d", len(fields))
+	}
+	if string(blocks[0]) != "hello world" || fields[0].Get("Content-Length") != "11" ||
+		fields[0].Get("WARC-Date") != "2020-01-02T03:04:05.6Z" || fields[0].Get("WARC-Record-ID") != res.ID() {
+		t.Errorf("bad resource record: %v %q", fields[0], blocks[0])
+	}
+	if string(blocks[1]) != "via: test\r\n" || fields[1].Get("WARC-Concurrent-To") != res.ID() {
+		t.Errorf("bad metadata record: %v %q", fields[1], blocks[1])
+	}
+}
+
+func TestWARCWriterPartlyRead(t *testing.T) {
+	checkExamples(t)
+	buf := &bytes.Buffer{}
+	ww, _ := NewWARCWriter(buf, NoCompression)
+	sr := strings.NewReader("hello world")
+	sr.Read(make([]byte, 6))
+	if err := ww.WriteRecord(NewRecordHeader(TypeResource, "http://example.com/", time.Now()), sr); err != nil {
+		t.Fatal(err)
+	}
+	f, _ := os.Open("examples/hello-world.warc")
+	defer f.Close()
+	f.Seek(100, io.SeekStart)
+	if err := ww.WriteRecord(NewRecordHeader(TypeResource, "http://example.com/file", time.Now()), f); err != nil {
+		t.Fatal(err)
+	}
+	rdr, _ := NewWARCReader(bytes.NewReader(buf.Bytes()))
+	rec, _ := rdr.Next()
+	rec.Read(make([]byte, 2))
+	if err := ww.WriteRecord(NewRecordHeader(TypeResource, "http://example.com/record", time.Now()), rec); err != nil {
+		t.Fatal(err)
+	}
+	fields, blocks := readAll(t, buf.Bytes())
+	info, _ := f.Stat()
+	if len(fields) != 3 || string(blocks[0]) != "world" || int64(len(blocks[1])) != info.Size()-100 || string(blocks[2]) != "rld" {
+		t.Fatalf("expecting the rest of each block to be written, got %q", blocks)
+	}
+	buf.Reset()
+	if err := ww.WriteRecord(NewRecordHeader(TypeResource, "http://example.com/", time.Now()), iotest.TimeoutReader(strings.NewReader("hello world"))); err == nil || buf.Len() > 0 {
+		t.Errorf("expecting a block that can't be read to fail before the record is written, got %d bytes (%v)", buf.Len(), err)
+	}
+}
+
+func TestWARCWriterCopy(t *testing.T) {
+	src, err := ioutil.ReadFile("examples/hello-world.warc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rdr, err := NewWARCReader(bytes.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := &bytes.Buffer{}
+	ww, _ := NewWARCWriter(buf, NoCompression)
+	for {
+		rec, err := rdr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ww.WriteRecord(rec, rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !bytes.Equal(buf.Bytes(), src) {
+		t.Error("expecting records copied with WriteRecord to be unchanged")
+	}
+}
+
+func TestARCWriter(t *testing.T) {
+	date := time.Date(1996, 11, 4, 14, 21, 3, 0, time.UTC)
+	for _, version := range []int{1, 2} {
+		buf := &bytes.Buffer{}
+		aw, err := NewARCWriter(buf, GzipCompression, ARC{FileDesc: "test.arc", OriginCode: "Test", FileDate: date, Version: version}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		u := ARCURLRecord{URL: "http://example.com/a b", IP: "127.0.0.1", Date: date, MIME: "text/plain; charset=utf-8", StatusCode: 200}
+		if err := aw.WriteRecord(u, strings.NewReader("hello world")); err != nil {
+			t.Fatal(err)
+		}
+		if aw.Count() != 1 || aw.Offset() != int64(buf.Len()) {
+			t.Fatalf("expecting 1 record and %d bytes, got %d and %d", buf.Len(), aw.Count(), aw.Offset())
+		}
+		rdr, err := NewARCReader(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rdr.Version != version || rdr.OriginCode != "Test" || rdr.FileDesc != "filedesc://test.arc" || !rdr.FileDate.Equal(date) {
+			t.Errorf("bad version block: %+v", rdr.ARC)
+		}
+		rec, err := rdr.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := ioutil.ReadAll(rec)
+		if string(b) != "hello world" || rec.URL() != "http://example.com/a%20b" || rec.MIME() != "text/plain" ||
+			rec.(ARCRecord).IP() != "127.0.0.1" || !rec.Date().Equal(date) {
+			t.Errorf("version %d: bad record %v %q", version, rec.Fields(), b)
+		}
+		if version == 2 && ARCURLRecordOf(rec).StatusCode != 200 {
+			t.Errorf("expecting status code 200, got %v", rec.Fields())
+		}
+		if _, err := rdr.Next(); err != io.EOF {
+			t.Errorf("expecting EOF, got %v", err)
+		}
+	}
+	if _, err := NewARCWriter(ioutil.Discard, NoCompression, ARC{Version: 3}, nil); err != ErrVersionBlock {
+		t.Errorf("expecting ErrVersionBlock, got %v", err)
+	}
+}
+
+func TestARCWriterCopy(t *testing.T) {
+	f, err := os.Open("examples/IAH-20080430204825-00000-blackbook.arc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rdr, err := NewARCReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	arc := *rdr.ARC
+	arc.Version = 2
+	buf := &bytes.Buffer{}
+	aw, err := NewARCWriter(buf, NoCompression, arc, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want []ARCURLRecord
+	var sizes []int64
+	for {
+		rec, err := rdr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		u := ARCURLRecordOf(rec)
+		want, sizes = append(want, u), append(sizes, rec.Size())
+		if err := aw.WriteRecord(u, rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// copying the version 2 copy should reproduce it exactly
+	rdr, err = NewARCReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cp := &bytes.Buffer{}
+	aw, _ = NewARCWriter(cp, NoCompression, *rdr.ARC, nil)
+	var i int
+	for rec, err := rdr.Next(); err == nil; rec, err = rdr.Next() {
+		got := ARCURLRecordOf(rec)
+		if i >= len(want) || got.URL != want[i].URL || got.IP != want[i].IP || !got.Date.Equal(want[i].Date) ||
+			rec.Size() != sizes[i] {
+			t.Fatalf("record %d: expecting %+v, got %+v", i, want[i], got)
+		}
+		if err := aw.WriteRecord(got, rec); err != nil {
+			t.Fatal(err)
+		}
+		i++
+	}
+	if i != 299 {
+		t.Errorf("expecting 299 records, got %d", i)
+	}
+	if !bytes.Equal(cp.Bytes(), buf.Bytes()) {
+		t.Error("expecting records copied with WriteRecord to be unchanged")
+	}
+}
+
+func TestWARCWriterMembers(t *testing.T) {
+	buf := &bytes.Buffer{}
+	ww, _ := NewWARCWriter(buf, GzipCompression)
+	var offsets []int64
+	for _, s := range []string{"one", "two", "three"} {
+		offsets = append(offsets, ww.Offset())
+		h := NewRecordHeader(TypeResource, "http://example.com/"+s, time.Now())
+		if err := ww.WriteRecord(h, strings.NewReader(s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var got []int64
+	if err := ScanOffsets(bytes.NewReader(buf.Bytes()), func(off, l int64) error {
+		got = append(got, off)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(offsets) {
+		t.Fatalf("expecting %d gzip members, got %d", len(offsets), len(got))
+	}
+	for i, off := range offsets {
+		if got[i] != off {
+			t.Errorf("record %d: expecting member at %d, got %d", i, off, got[i])
+		}
+		zr, err := gzip.NewReader(bytes.NewReader(buf.Bytes()[off:]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		zr.Multistream(false)
+		b, _ := ioutil.ReadAll(zr)
+		if !bytes.HasPrefix(b, []byte("WARC/1.0\r\n")) || !bytes.HasSuffix(b, []byte("\r\n\r\n")) {
+			t.Errorf("record %d: expecting a member to hold exactly one record, got %q", i, b)
+		}
+	}
+}
+
+func TestWARCWriterWarcinfo(t *testing.T) {
+	buf := &bytes.Buffer{}
+	ww, _ := NewWARCWriter(buf, NoCompression)
+	id, err := ww.WriteWarcinfo("1.1", "test.warc", Warcinfo{Operator: "tester"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id == "" || ww.WarcinfoID() != id {
+		t.Fatalf("expecting warcinfo ID, got %q and %q", id, ww.WarcinfoID())
+	}
+	if err := ww.WriteRecord(NewRecordHeader(TypeResource, "http://example.com/", time.Now()), strings.NewReader("hello")); err != nil {
+		t.Fatal(err)
+	}
+	fields, blocks := readAll(t, buf.Bytes())
+	if len(fields) != 2 {
+		t.Fatalf("expecting 2 records, got %d", len(fields))
+	}
+	if fields[0].Get("WARC-Type") != "warcinfo" || fields[0].Get("WARC-Filename") != "test.warc" || fields[0].Get("WARC-Record-ID") != id {
+		t.Errorf("bad warcinfo record %v", fields[0])
+	}
+	wi := ParseWarcinfo(blocks[0])
+	if wi.Software != software || wi.Format != "WARC File Format 1.1" || wi.ConformsTo != conformsTo11 || wi.Operator != "tester" {
+		t.Errorf("bad warcinfo block %+v", wi)
+	}
+	if fields[1].Get("WARC-Warcinfo-ID") != id {
+		t.Errorf("expecting record to refer to warcinfo %s, got %v", id, fields[1])
+	}
+	buf.Reset()
+	ww, _ = NewWARCWriter(buf, NoCompression)
+	if _, err = ww.WriteWarcinfo("1.0", "", Warcinfo{ConformsTo: "http://example.com/profile", Format: "custom"}); err != nil {
+		t.Fatal(err)
+	}
+	_, blocks = readAll(t, buf.Bytes())
+	if wi = ParseWarcinfo(blocks[0]); wi.ConformsTo != "http://example.com/profile" || wi.Format != "custom" {
+		t.Errorf("expecting the given conformsTo and format to be kept, got %+v", wi)
+	}
+	buf.Reset()
+	ww, _ = NewWARCWriter(buf, NoCompression)
+	if _, err = ww.WriteWarcinfo("1.0", "", Warcinfo{Format: "custom"}); err != nil {
+		t.Fatal(err)
+	}
+	_, blocks = readAll(t, buf.Bytes())
+	if wi = ParseWarcinfo(blocks[0]); wi.ConformsTo != conformsTo10 {
+		t.Errorf("expecting conformsTo to be filled in, got %+v", wi)
+	}
+}
+
+func TestWARCWriterSegments(t *testing.T) {
+	buf := &bytes.Buffer{}
+	ww, _ := NewWARCWriter(buf, NoCompression)
+	ww.SegmentSize = 10
+	h := NewRecordHeader(TypeResource, "http://example.com/", time.Now())
+	h.Set("Content-Type", "text/plain")
+	payload := "abcdefghijklmnopqrstuvwxy"
+	if err := ww.WriteRecord(h, strings.NewReader(payload)); err != nil {
+		t.Fatal(err)
+	}
+	fields, blocks := readAll(t, buf.Bytes())
+	if len(fields) != 3 {
+		t.Fatalf("expecting 3 segments, got %d", len(fields))
+	}
+	for i, f := range fields {
+		if f.Get("WARC-Segment-Number") != strconv.Itoa(i+1) {
+			t.Errorf("segment %d: bad segment number %v", i, f)
+		}
+		if i > 0 && (f.Get("WARC-Type") != "continuation" || f.Get("WARC-Segment-Origin-ID") != h.ID() ||
+			f.Get("WARC-Target-URI") != "http://example.com/") {
+			t.Errorf("segment %d: bad continuation record %v", i, f)
+		}
+	}
+	if fields[0].Get("WARC-Segment-Total-Length") != "" || fields[2].Get("WARC-Segment-Total-Length") != "25" {
+		t.Errorf("expecting total length on last segment only, got %v and %v", fields[0], fields[2])
+	}
+	if string(blocks[0]) != payload[:10] || string(blocks[2]) != payload[20:] {
+		t.Errorf("bad segment blocks %q", blocks)
+	}
+	rep, err := Validate(bytes.NewReader(buf.Bytes()))
+	if err != nil || !rep.Valid() {
+		t.Errorf("expecting valid segments, got %v %v", rep.Findings, err)
+	}
+	rdr, _ := NewWARCReader(bytes.NewReader(buf.Bytes()))
+	rec, err := rdr.NextPayload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := ioutil.ReadAll(rec); string(b) != payload {
+		t.Errorf("expecting segments to be reassembled as %q, got %q", payload, b)
+	}
+}
+
+func TestRollingWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "webarchive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	rw, err := NewRollingWriter(TimestampFileOutputs(dir, "crawl", GzipCompression), GzipCompression, 0, 2, Warcinfo{Operator: "tester"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rw.Digests, rw.DigestAlgorithm = true, "sha256"
+	for i := 0; i < 5; i++ {
+		h := NewRecordHeader(TypeResource, "http://example.com/"+strconv.Itoa(i), time.Now())
+		h.Set("Content-Type", "text/plain")
+		if err := rw.WriteRecord(h, strings.NewReader("hello")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := rw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	names := rw.Names()
+	if len(names) != 3 {
+		t.Fatalf("expecting 3 files, got %v", names)
+	}
+	for i, name := range names {
+		if !strings.HasPrefix(name, "crawl-") || !strings.HasSuffix(name, "-0000"+strconv.Itoa(i)+".warc.gz") || len(name) != len("crawl-20200102030405006-00000.warc.gz") {
+			t.Errorf("bad file name %s", name)
+		}
+		f, err := os.Open(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rdr, err := NewWARCReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var info string
+		var n int
+		for rec, err := rdr.Next(); err == nil; rec, err = rdr.Next() {
+			fields := rec.RawFields()
+			if n == 0 {
+				if fields.Get("WARC-Type") != "warcinfo" || fields.Get("WARC-Filename") != name {
+					t.Errorf("%s: expecting a warcinfo record first, got %v", name, fields)
+				}
+				info = fields.Get("WARC-Record-ID")
+			} else if fields.Get("WARC-Warcinfo-ID") != info {
+				t.Errorf("%s: expecting record to refer to warcinfo %s, got %v", name, info, fields)
+			} else if !strings.HasPrefix(fields.Get("WARC-Block-Digest"), "sha256:") {
+				t.Errorf("%s: expecting a sha256 block digest, got %v", name, fields)
+			}
+			n++
+		}
+		f.Seek(0, io.SeekStart)
+		if rep, err := Validate(f); err != nil || !rep.Valid() {
+			t.Errorf("%s: expecting a valid file, got %v %v", name, rep, err)
+		}
+		f.Close()
+		if want := []int{3, 3, 2}[i]; n != want {
+			t.Errorf("%s: expecting %d records, got %d", name, want, n)
+		}
+	}
+}
+
+func TestRollingWriterConcurrent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "webarchive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	rw, err := NewRollingWriter(TimestampFileOutputs(dir, "crawl", NoCompression), NoCompression, 0, 3, Warcinfo{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				h := NewRecordHeader(TypeResource, "http://example.com/"+strconv.Itoa(i*10+j), time.Now())
+				h.Set("Content-Type", "text/plain")
+				if err := rw.WriteRecord(h, strings.NewReader("hello")); err != nil {
+					t.Error(err)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	if err := rw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	for _, name := range rw.Names() {
+		f, err := os.Open(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rep, err := Validate(f); err != nil || !rep.Valid() {
+			t.Errorf("%s: expecting a valid file, got %v %v", name, rep, err)
+		}
+		f.Seek(0, io.SeekStart)
+		rdr, _ := NewWARCReader(f)
+		for rec, err := rdr.Next(); err == nil; rec, err = rdr.Next() {
+			if rec.RawFields().Get("WARC-Type") != "warcinfo" {
+				n++
+			}
+		}
+		f.Close()
+	}
+	if n != 40 {
+		t.Errorf("expecting 40 records, got %d", n)
+	}
+}
+
+func TestCopyRecord(t *testing.T) {
+	src, err := ioutil.ReadFile("examples/hello-world.warc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rdr, _ := NewWARCReader(bytes.NewReader(src))
+	buf := &bytes.Buffer{}
+	ww, _ := NewWARCWriter(buf, GzipCompression)
+	for rec, err := rdr.Next(); err == nil; rec, err = rdr.Next() {
+		if err := CopyRecord(ww, rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	zr, err := gzip.NewReader(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := ioutil.ReadAll(zr); !bytes.Equal(b, src) {
+		t.Error("expecting records copied to a gzip writer to decompress to the original")
+	}
+	rdr, _ = NewWARCReader(bytes.NewReader(src))
+	rec, _ := rdr.Next()
+	rec.Read(make([]byte, 1))
+	if err := CopyRecord(ww, rec); err != ErrReserialize {
+		t.Errorf("expecting ErrReserialize for a partly read record, got %v", err)
+	}
+	f, err := os.Open("examples/IAH-20080430204825-00000-blackbook.arc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	ardr, err := NewARCReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	ww, _ = NewWARCWriter(buf, NoCompression)
+	for rec, err := ardr.Next(); err == nil; rec, err = ardr.Next() {
+		if err := CopyRecord(ww, rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fields, _ := readAll(t, buf.Bytes())
+	if len(fields) != 299 {
+		t.Fatalf("expecting 299 records, got %d", len(fields))
+	}
+	var responses int
+	for _, f := range fields {
+		if f.Get("WARC-Type") == "response" {
+			responses++
+		}
+	}
+	if responses == 0 || responses == len(fields) {
+		t.Errorf("expecting both response and resource records, got %d responses", responses)
+	}
+	if rep, err := Validate(bytes.NewReader(buf.Bytes())); err != nil || !rep.Valid() {
+		t.Errorf("expecting valid WARC, got %v %v", rep.Findings, err)
+	}
+}
+
+func TestWARCWriterDigests(t *testing.T) {
+	const resp = "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\n\r\nhello world"
+	buf := &bytes.Buffer{}
+	ww, _ := NewWARCWriter(buf, NoCompression)
+	ww.Digests = true
+	h := NewRecordHeader(TypeResponse, "http://example.com/", time.Now())
+	h.Set("Content-Type", "application/http;msgtype=response")
+	if err := ww.WriteRecord(h, strings.NewReader(resp)); err != nil {
+		t.Fatal(err)
+	}
+	ww.DigestAlgorithm = "sha256"
+	meta := NewRecordHeader(TypeMetadata, "", time.Now())
+	meta.Set("Content-Type", "application/warc-fields")
+	if err := ww.WriteRecord(meta, strings.NewReader("via: test\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	// ARC records can't be read twice, so are spooled
+	f, err := os.Open("examples/hello-world.arc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	ardr, err := NewARCReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec, err := ardr.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := CopyRecord(ww, rec); err != nil {
+		t.Fatal(err)
+	}
+	fields, _ := readAll(t, buf.Bytes())
+	if len(fields) != 3 {
+		t.Fatalf("expecting 3 records, got %d", len(fields))
+	}
+	if fields[0].Get("WARC-Block-Digest") != sha1Digest([]byte(resp)).String() ||
+		fields[0].Get("WARC-Payload-Digest") != sha1Digest([]byte("hello world")).String() {
+		t.Errorf("bad digests of response %v", fields[0])
+	}
+	if !strings.HasPrefix(fields[1].Get("WARC-Block-Digest"), "sha256:") || fields[1].Get("WARC-Payload-Digest") != "" {
+		t.Errorf("expecting only a sha256 block digest for metadata, got %v", fields[1])
+	}
+	if fields[2].Get("WARC-Block-Digest") == "" || fields[2].Get("WARC-Payload-Digest") == "" {
+		t.Errorf("expecting digests of copied ARC record, got %v", fields[2])
+	}
+	if rep, err := Validate(bytes.NewReader(buf.Bytes())); err != nil || !rep.Valid() {
+		t.Errorf("expecting valid digests, got %v %v", rep.Findings, err)
+	}
+	ww.DigestAlgorithm = "nonesuch"
+	if err := ww.WriteRecord(NewRecordHeader(TypeMetadata, "", time.Now()), nil); err != ErrDigestAlgorithm {
+		t.Errorf("expecting ErrDigestAlgorithm, got %v", err)
+	}
+}
+
+func TestReproducible(t *testing.T) {
+	date := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	build := func() []byte {
+		var buf bytes.Buffer
+		ww, _ := NewWARCWriter(&buf, GzipCompression)
+		ids := SeededIDs("test")
+		ww.Reproducible = &Reproducible{IDs: ids, Clock: func() time.Time { return date }, ModTime: date}
+		ww.SegmentSize = 4
+		if _, err := ww.WriteWarcinfo("1.1", "test.warc.gz", Warcinfo{Hostname: "example"}); err != nil {
+			t.Fatal(err)
+		}
+		h := NewRecordHeader(TypeResource, "http://example.com/", date)
+		h.Del("WARC-Record-ID")
+		h.Del("WARC-Date")
+		h.Set("Content-Type", "text/plain")
+		if err := ww.WriteRecord(h, strings.NewReader("hello world")); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+	a, b := build(), build()
+	if !bytes.Equal(a, b) {
+		t.Fatal("expecting identical output from identical inputs")
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(a))
+	if err != nil || !zr.ModTime.Equal(date) {
+		t.Fatalf("expecting gzip headers with a fixed modification time, got %v %v", zr.ModTime, err)
+	}
+	fields, recs := readAll(t, a)
+	if len(recs) != 4 || fields[1].Get("WARC-Date") != "2020-01-02T03:04:05Z" || fields[0].Get("WARC-Record-ID") == fields[1].Get("WARC-Record-ID") {
+		t.Errorf("bad records: %v", fields)
+	}
+	ids := SeededIDs("test")
+	if id := ids(); id != fields[0].Get("WARC-Record-ID") || !strings.HasPrefix(id, "<urn:uuid:") || id[24] != '5' {
+		t.Errorf("bad seeded ID %s", id)
+	}
+}
+
+func TestWARCWriterSkipLengths(t *testing.T) {
+	write := func(sl bool) []byte {
+		var buf bytes.Buffer
+		ww, _ := NewWARCWriter(&buf, GzipCompression)
+		ww.SkipLengths = sl
+		block := make([]byte, 1<<17)
+		for i := range block {
+			block[i] = byte(i * i >> 3)
+		}
+		for i := 0; i < 3; i++ {
+			h := NewRecordHeader(TypeResource, "http://example.com/"+strconv.Itoa(i), time.Now())
+			h.Set("Content-Type", "application/octet-stream")
+			if err := ww.WriteRecord(h, bytes.NewReader(block)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return buf.Bytes()
+	}
+	offsets := func(b []byte) [][2]int64 {
+		var extents [][2]int64
+		ScanOffsets(bytes.NewReader(b), func(offset, length int64) error {
+			extents = append(extents, [2]int64{offset, length})
+			return nil
+		})
+		return extents
+	}
+	b := write(true)
+	extents := offsets(b)
+	if len(extents) != 3 {
+		t.Fatalf("expecting 3 members, got %d", len(extents))
+	}
+	for _, e := range extents {
+		zr, err := gzip.NewReader(bytes.NewReader(b[e[0] : e[0]+e[1]]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ex := zr.Header.Extra
+		rec, _ := ioutil.ReadAll(zr)
+		if len(ex) != 12 || string(ex[:4]) != "sl\x08\x00" ||
+			int64(binary.LittleEndian.Uint32(ex[4:])) != e[1] || int(binary.LittleEndian.Uint32(ex[8:])) != len(rec) {
+			t.Fatalf("bad sl field %q for member of %d bytes and record of %d", ex, e[1], len(rec))
+		}
+	}
+	// corrupt the compressed data of the second record: records that are skipped aren't decompressed
+	corrupt := func(b []byte) []byte {
+		e := offsets(b)[1]
+		c := append([]byte{}, b...)
+		c[e[0]+e[1]-100] ^= 0xff
+		return c
+	}
+	count := func(r io.Reader) (int, error) {
+		rdr, err := NewReader(r)
+		if err != nil {
+			return 0, err
+		}
+		var n int
+		for _, err = rdr.Next(); err == nil; _, err = rdr.Next() {
+			n++
+		}
+		if err == io.EOF {
+			err = nil
+		}
+		return n, err
+	}
+	if n, err := count(bytes.NewReader(corrupt(b))); n != 3 || err != nil {
+		t.Errorf("expecting 3 records, skipped by seeking, got %d %v", n, err)
+	}
+	if n, err := count(struct{ io.Reader }{bytes.NewReader(corrupt(b))}); n != 3 || err != nil {
+		t.Errorf("expecting 3 records, skipped by discarding, got %d %v", n, err)
+	}
+	if n, err := count(bytes.NewReader(corrupt(write(false)))); err == nil {
+		t.Errorf("expecting an error decompressing a corrupt record without skip lengths, got %d records", n)
+	}
+	// the compressed length is given by the sl field before a record is read
+	rdr, _ := NewWARCReader(bytes.NewReader(b))
+	for i := 0; i < 3; i++ {
+		if _, err := rdr.Next(); err != nil || rdr.CompressedOffset() != extents[i][0] || rdr.CompressedLength() != extents[i][1] {
+			t.Fatalf("record %d: expecting extent %v, got %d %d %v", i, extents[i], rdr.CompressedOffset(), rdr.CompressedLength(), err)
+		}
+	}
+}
+
+func TestNewConversionRecord(t *testing.T) {
+	checkExamples(t)
+	f, _ := os.Open("examples/hello-world.warc")
+	defer f.Close()
+	rdr, _ := NewWARCReader(f)
+	var buf bytes.Buffer
+	ww, _ := NewWARCWriter(&buf, NoCompression)
+	ww.Digests = true
+	var ids []string
+	for rec, err := rdr.Next(); err == nil; rec, err = rdr.Next() {
+		if rdr.Type() != "resource" {
+			continue
+		}
+		h, err := NewConversionRecord(rec, "text/plain", time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ww.WriteRecord(h, strings.NewReader("migrated")); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, rdr.ID())
+	}
+	fields, blocks := readAll(t, buf.Bytes())
+	if len(ids) == 0 || len(fields) != len(ids) {
+		t.Fatalf("expecting a conversion record for each resource, got %d for %d", len(fields), len(ids))
+	}
+	for i, f := range fields {
+		if f.Get("WARC-Type") != "conversion" || f.Get("WARC-Refers-To") != ids[i] || f.Get("Content-Type") != "text/plain" ||
+			f.Get("WARC-Target-URI") == "" || string(blocks[i]) != "migrated" {
+			t.Errorf("bad conversion record %v", f)
+		}
+	}
+	if rep, err := Validate(bytes.NewReader(buf.Bytes())); err != nil || !rep.Valid() {
+		t.Errorf("expecting valid conversion records, got %v %v", rep, err)
+	}
+	arc, _ := os.Open("examples/hello-world.arc")
+	defer arc.Close()
+	ardr, _ := NewARCReader(arc)
+	rec, _ := ardr.Next()
+	if _, err := NewConversionRecord(rec, "text/plain", time.Now()); !errors.Is(err, ErrWARCHeader) {
+		t.Errorf("expecting ErrWARCHeader for an ARC record, got %v", err)
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright 2015 Richard Lehane. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webarchive
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// ZstdCodec compresses and decompresses zstd streams, for reading and writing .warc.zst files. The standard library
+// has no zstd implementation, so a codec wrapping one (such as github.com/klauspost/compress/zstd) must be registered
+// with RegisterZstd before these files can be read or written.
+type ZstdCodec interface {
+	// NewReader returns a reader of the concatenated frames in r, decompressed with the given dictionary (nil if the
+	// file has none).
+	NewReader(r io.Reader, dict []byte) (io.ReadCloser, error)
+	// NewWriter returns a writer of a single frame to w, compressed with the given dictionary (nil for none). The frame
+	// is ended by closing the writer.
+	NewWriter(w io.Writer, dict []byte) (io.WriteCloser, error)
+}
+
+var zstdCodec ZstdCodec
+
+// RegisterZstd sets the codec used to read and write zstd compressed WARC files.
+// RegisterZstd is not safe for concurrent use and is intended to be called from an init function.
+func RegisterZstd(c ZstdCodec) {
+	zstdCodec = c
+}
+
+const (
+	zstdMagic     = 0xFD2FB528
+	zstdDictMagic = 0x184D2A5D // the skippable frame holding the dictionary of a .warc.zst file
+	zstdSkipMask  = 0xFFFFFFF0
+	zstdSkipMagic = 0x184D2A50 // skippable frames have magic numbers 0x184D2A50 to 0x184D2A5F
+)
+
+// iszstd reports whether buf begins a zstd frame or a skippable frame
+func iszstd(buf []byte) bool {
+	if len(buf) < 4 {
+		return false
+	}
+	m := binary.LittleEndian.Uint32(buf)
+	return m == zstdMagic || m&zstdSkipMask == zstdSkipMagic
+}
+
+// zstdReader returns a reader of a .warc.zst file read from src. Following the IIPC specification, the file may begin
+// with a skippable frame holding the dictionary with which its records were compressed; a dictionary that is itself
+// zstd compressed is decompressed first. Returns an error wrapping ErrCompression if no codec is registered.
+func zstdReader(src *bufio.Reader) (io.ReadCloser, error) {
+	if zstdCodec == nil {
+		return nil, fmt.Errorf("%w: zstd (see RegisterZstd)", ErrCompression)
+	}
+	var dict []byte
+	if hdr, err := src.Peek(8); err == nil && binary.LittleEndian.Uint32(hdr) == zstdDictMagic {
+		dict = make([]byte, binary.LittleEndian.Uint32(hdr[4:]))
+		src.Discard(8)
+		if _, err := io.ReadFull(src, dict); err != nil {
+			return nil, fmt.Errorf("%w: truncated zstd dictionary", ErrCompression)
+		}
+		if len(dict) >= 4 && binary.LittleEndian.Uint32(dict) == zstdMagic {
+			if dict, err = zstdDecompress(dict); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return zstdCodec.NewReader(src, dict)
+}
+
+func zstdDecompress(b []byte) ([]byte, error) {
+	rc, err := zstdCodec.NewReader(bytes.NewReader(b), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return ioutil.ReadAll(rc)
+}
+
+// writeZstdDictionary writes the skippable frame holding a dictionary at the start of a .warc.zst file
+func writeZstdDictionary(w io.Writer, dict []byte) error {
+	var hdr [8]byte
+	binary.LittleEndian.PutUint32(hdr[:], zstdDictMagic)
+	binary.LittleEndian.PutUint32(hdr[4:], uint32(len(dict)))
+	if _, err := w.Write(hdr[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(dict)
+	return err
+}
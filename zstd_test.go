@@ -0,0 +1,112 @@
+package webarchive
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeZstd stores data in frames with the zstd magic number and a length, without compressing it
+type fakeZstd struct {
+	dicts [][]byte // dictionaries given to NewReader
+}
+
+func (f *fakeZstd) NewReader(r io.Reader, dict []byte) (io.ReadCloser, error) {
+	f.dicts = append(f.dicts, dict)
+	pr, pw := io.Pipe()
+	go func() {
+		var hdr [8]byte
+		for {
+			if _, err := io.ReadFull(r, hdr[:]); err != nil {
+				if err == io.EOF {
+					err = nil
+				}
+				pw.CloseWithError(err)
+				return
+			}
+			if _, err := io.CopyN(pw, r, int64(binary.LittleEndian.Uint32(hdr[4:]))); err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+		}
+	}()
+	return pr, nil
+}
+
+type fakeFrame struct {
+	w   io.Writer
+	buf bytes.Buffer
+}
+
+func (f *fakeFrame) Write(p []byte) (int, error) { return f.buf.Write(p) }
+
+func (f *fakeFrame) Close() error {
+	var hdr [8]byte
+	binary.LittleEndian.PutUint32(hdr[:], zstdMagic)
+	binary.LittleEndian.PutUint32(hdr[4:], uint32(f.buf.Len()))
+	f.w.Write(hdr[:])
+	_, err := f.w.Write(f.buf.Bytes())
+	return err
+}
+
+func (f *fakeZstd) NewWriter(w io.Writer, dict []byte) (io.WriteCloser, error) {
+	return &fakeFrame{w: w}, nil
+}
+
+func TestZstd(t *testing.T) {
+	if _, err := NewWARCWriter(ioutil.Discard, ZstdCompression); !errors.Is(err, ErrCompression) {
+		t.Fatalf("expecting ErrCompression without a zstd codec, got %v", err)
+	}
+	codec := &fakeZstd{}
+	RegisterZstd(codec)
+	defer RegisterZstd(nil)
+	buf := &bytes.Buffer{}
+	ww, err := NewWARCWriter(buf, ZstdCompression)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ww.SetZstdDictionary([]byte("dictionary")); err != nil {
+		t.Fatal(err)
+	}
+	var offsets []int64
+	for _, s := range []string{"one", "two"} {
+		offsets = append(offsets, ww.Offset())
+		h := NewRecordHeader(TypeResource, "http://example.com/"+s, time.Now())
+		h.Set("Content-Type", "text/plain")
+		if err := ww.WriteRecord(h, strings.NewReader(s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ww.SetZstdDictionary(nil); err != ErrCompression {
+		t.Errorf("expecting ErrCompression setting a dictionary after records, got %v", err)
+	}
+	if binary.LittleEndian.Uint32(buf.Bytes()[offsets[1]:]) != zstdMagic {
+		t.Error("expecting each record to begin a frame")
+	}
+	src := buf.Bytes()
+	rdr, err := NewReader(bytes.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rdr.Close()
+	var got []string
+	for rec, err := rdr.Next(); err == nil; rec, err = rdr.Next() {
+		b, _ := ioutil.ReadAll(rec)
+		got = append(got, string(b))
+	}
+	if strings.Join(got, " ") != "one two" {
+		t.Errorf("expecting records one and two, got %v", got)
+	}
+	if len(codec.dicts) != 1 || string(codec.dicts[0]) != "dictionary" {
+		t.Errorf("expecting the dictionary to be given to the codec, got %q", codec.dicts)
+	}
+	RegisterZstd(nil)
+	if _, err := NewReader(bytes.NewReader(src)); !errors.Is(err, ErrCompression) {
+		t.Errorf("expecting ErrCompression reading without a zstd codec, got %v", err)
+	}
+}